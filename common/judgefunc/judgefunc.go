@@ -0,0 +1,191 @@
+// Package judgefunc parses the function of strategy/expression, which is shared by judge(computing),
+// hbs and portal(validating).
+//
+// Supported functions:
+//
+//	max(#3), min(#3), all(#3), sum(#3), avg(#3)  - last N points
+//	max(5m), min(5m), all(5m), sum(5m), avg(5m)  - points within the time window
+//	diff(#3), pdiff(#3)                          - the latest point compared with last N points
+//	p95(#10), p99(15m)                           - percentile(1 ~ 99) of points
+//	stddev(#10), stddev(10m)                     - standard deviation of points
+//	count_over(#5, >, 90), count_over(5m, >, 90) - the number of points which breach the condition
+//	slope(10m), slope(#10)                       - rate of change(per second), by linear regression
+//
+// The unit of time window could be "s", "m", "h" or "d".
+package judgefunc
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	Max        = "max"
+	Min        = "min"
+	All        = "all"
+	Sum        = "sum"
+	Avg        = "avg"
+	Diff       = "diff"
+	PDiff      = "pdiff"
+	Percentile = "percentile"
+	Stddev     = "stddev"
+	CountOver  = "count_over"
+	Slope      = "slope"
+)
+
+// Spec is the parsed function
+type Spec struct {
+	Name string
+	// Either Limit(#N) or Window(seconds) is set
+	Limit  int
+	Window int64
+	// Only for percentile, e.g. 95 for "p95"
+	Percentile float64
+	// Only for count_over, the condition of breaching
+	Operator string
+	Value    float64
+}
+
+func (s *Spec) IsWindow() bool {
+	return s.Window > 0
+}
+
+func (s *Spec) String() string {
+	var arg string
+	if s.IsWindow() {
+		arg = fmt.Sprintf("%ds", s.Window)
+	} else {
+		arg = fmt.Sprintf("#%d", s.Limit)
+	}
+
+	switch s.Name {
+	case Percentile:
+		return fmt.Sprintf("p%v(%s)", s.Percentile, arg)
+	case CountOver:
+		return fmt.Sprintf("%s(%s,%s,%v)", s.Name, arg, s.Operator, s.Value)
+	}
+	return fmt.Sprintf("%s(%s)", s.Name, arg)
+}
+
+var (
+	funcPattern       = regexp.MustCompile(`^\s*([a-z_]+|p\d{1,2})\s*\((.*)\)\s*$`)
+	percentilePattern = regexp.MustCompile(`^p(\d{1,2})$`)
+	durationPattern   = regexp.MustCompile(`^(\d+)([smhd])$`)
+)
+
+var durationUnits = map[string]int64{
+	"s": 1,
+	"m": 60,
+	"h": 3600,
+	"d": 86400,
+}
+
+var validOperators = map[string]bool{
+	"=": true, "==": true, "!=": true,
+	"<": true, "<=": true, ">": true, ">=": true,
+}
+
+// Parse parses the string of function, e.g. "avg(#3)", "p95(10m)", "count_over(#5,>,90)"
+func Parse(str string) (*Spec, error) {
+	matches := funcPattern.FindStringSubmatch(str)
+	if matches == nil {
+		return nil, fmt.Errorf("bad format of function: %q", str)
+	}
+
+	spec := &Spec{Name: matches[1]}
+	args := splitArgs(matches[2])
+
+	if m := percentilePattern.FindStringSubmatch(spec.Name); m != nil {
+		p, _ := strconv.Atoi(m[1])
+		if p < 1 {
+			return nil, fmt.Errorf("percentile must be in 1 ~ 99: %q", str)
+		}
+		spec.Name = Percentile
+		spec.Percentile = float64(p)
+	}
+
+	switch spec.Name {
+	case Max, Min, All, Sum, Avg, Percentile, Stddev, Slope:
+		if len(args) != 1 {
+			return nil, fmt.Errorf("%s() needs exactly one argument: %q", spec.Name, str)
+		}
+	case Diff, PDiff:
+		if len(args) != 1 || !strings.HasPrefix(args[0], "#") {
+			return nil, fmt.Errorf("%s() needs exactly one argument of #N: %q", spec.Name, str)
+		}
+	case CountOver:
+		if len(args) != 3 {
+			return nil, fmt.Errorf("count_over() needs 3 arguments(#N or window, operator, value): %q", str)
+		}
+		if !validOperators[args[1]] {
+			return nil, fmt.Errorf("unknown operator %q of count_over(): %q", args[1], str)
+		}
+		value, err := strconv.ParseFloat(args[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad value %q of count_over(): %q", args[2], str)
+		}
+		spec.Operator = args[1]
+		spec.Value = value
+	default:
+		return nil, fmt.Errorf("not supported function: %q", str)
+	}
+
+	if err := parseRange(spec, args[0]); err != nil {
+		return nil, fmt.Errorf("%v: %q", err, str)
+	}
+
+	if spec.Name == Slope && !spec.IsWindow() && spec.Limit < 2 {
+		return nil, fmt.Errorf("slope() needs at least 2 points: %q", str)
+	}
+
+	return spec, nil
+}
+
+// Validate checks the function and the operator of a strategy/expression
+func Validate(funcStr string, operator string) error {
+	if _, err := Parse(funcStr); err != nil {
+		return err
+	}
+	if !validOperators[operator] {
+		return fmt.Errorf("unknown operator: %q", operator)
+	}
+	return nil
+}
+
+// parseRange parses "#N" or time window(e.g. "5m")
+func parseRange(spec *Spec, arg string) error {
+	if strings.HasPrefix(arg, "#") {
+		limit, err := strconv.Atoi(arg[1:])
+		if err != nil || limit < 1 {
+			return fmt.Errorf("bad number of points %q", arg)
+		}
+		spec.Limit = limit
+		return nil
+	}
+
+	m := durationPattern.FindStringSubmatch(arg)
+	if m == nil {
+		return fmt.Errorf("bad time window %q", arg)
+	}
+	n, _ := strconv.ParseInt(m[1], 10, 64)
+	if n < 1 {
+		return fmt.Errorf("bad time window %q", arg)
+	}
+	spec.Window = n * durationUnits[m[2]]
+
+	return nil
+}
+
+func splitArgs(str string) []string {
+	if strings.TrimSpace(str) == "" {
+		return []string{}
+	}
+
+	args := strings.Split(str, ",")
+	for i, arg := range args {
+		args[i] = strings.TrimSpace(arg)
+	}
+	return args
+}
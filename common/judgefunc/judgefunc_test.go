@@ -0,0 +1,67 @@
+package judgefunc
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+type TestJudgeFuncSuite struct{}
+
+var _ = Suite(&TestJudgeFuncSuite{})
+
+// Tests the parsing of valid functions
+func (suite *TestJudgeFuncSuite) TestParse(c *C) {
+	testCases := []*struct {
+		funcStr  string
+		expected *Spec
+	}{
+		{"max(#3)", &Spec{Name: Max, Limit: 3}},
+		{"avg(5m)", &Spec{Name: Avg, Window: 300}},
+		{"sum(1h)", &Spec{Name: Sum, Window: 3600}},
+		{"diff(#10)", &Spec{Name: Diff, Limit: 10}},
+		{"p95(#20)", &Spec{Name: Percentile, Limit: 20, Percentile: 95}},
+		{"p99(15m)", &Spec{Name: Percentile, Window: 900, Percentile: 99}},
+		{"stddev(#10)", &Spec{Name: Stddev, Limit: 10}},
+		{"count_over(#5, >, 90)", &Spec{Name: CountOver, Limit: 5, Operator: ">", Value: 90}},
+		{"count_over(10m,<=,0.5)", &Spec{Name: CountOver, Window: 600, Operator: "<=", Value: 0.5}},
+		{"slope(10m)", &Spec{Name: Slope, Window: 600}},
+	}
+
+	for i, testCase := range testCases {
+		comment := Commentf("Test Case: %d", i+1)
+
+		spec, err := Parse(testCase.funcStr)
+		c.Assert(err, IsNil, comment)
+		c.Assert(spec, DeepEquals, testCase.expected, comment)
+	}
+}
+
+// Tests the error of invalid functions
+func (suite *TestJudgeFuncSuite) TestParseError(c *C) {
+	testCases := []string{
+		"",
+		"max",
+		"max(#0)",
+		"max(#a)",
+		"avg(5x)",
+		"unknown(#3)",
+		"diff(5m)",
+		"p0(#3)",
+		"p100(#3)",
+		"count_over(#5)",
+		"count_over(#5, ~, 90)",
+		"count_over(#5, >, abc)",
+		"slope(#1)",
+	}
+
+	for i, funcStr := range testCases {
+		_, err := Parse(funcStr)
+		c.Assert(err, NotNil, Commentf("Test Case: %d", i+1))
+	}
+}
+
+// Tests the validation of operator
+func (suite *TestJudgeFuncSuite) TestValidate(c *C) {
+	c.Assert(Validate("avg(#3)", ">="), IsNil)
+	c.Assert(Validate("avg(#3)", "=>"), NotNil)
+	c.Assert(Validate("avg(3)", ">="), NotNil)
+}
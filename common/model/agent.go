@@ -23,6 +23,38 @@ func (this *AgentReportRequest) String() string {
 	)
 }
 
+// AgentCommandReport is the record of a remote command executed(or rejected) by the agent
+type AgentCommandReport struct {
+	Hostname   string
+	Caller     string
+	RemoteAddr string
+	Command    string
+	Args       []string
+	Nonce      string
+	ExitCode   int
+	Duration   int64 // ms
+	Timeout    bool
+	Error      string
+	Timestamp  int64
+}
+
+func (this *AgentCommandReport) String() string {
+	return fmt.Sprintf(
+		"<Hostname:%s, Caller:%s, RemoteAddr:%s, Command:%s, Args:%v, Nonce:%s, ExitCode:%d, Duration:%dms, Timeout:%v, Error:%s, Timestamp:%d>",
+		this.Hostname,
+		this.Caller,
+		this.RemoteAddr,
+		this.Command,
+		this.Args,
+		this.Nonce,
+		this.ExitCode,
+		this.Duration,
+		this.Timeout,
+		this.Error,
+		this.Timestamp,
+	)
+}
+
 type AgentUpdateInfo struct {
 	LastUpdate    int64
 	ReportRequest *AgentReportRequest
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/Cepave/open-falcon-backend/common/model"
+	cutils "github.com/Cepave/open-falcon-backend/common/utils"
 	"github.com/Cepave/open-falcon-backend/modules/agent/g"
 	log "github.com/Sirupsen/logrus"
 )
@@ -29,6 +30,9 @@ func syncBuiltinMetrics() {
 		var ports = []int64{}
 		var paths = []string{}
 		var procs = make(map[string]map[int]string)
+		var procStats = make(map[string]map[int]string)
+		var probes = make(map[string]*g.Probe)
+		var logRules = make(map[string]*g.LogRule)
 		var urls = make(map[string]string)
 
 		hostname, err := g.Hostname()
@@ -106,35 +110,79 @@ func syncBuiltinMetrics() {
 				continue
 			}
 
-			if metric.Metric == g.PROC_NUM {
-				arr := strings.Split(metric.Tags, ",")
+			// http.check.health等, 同一个类型相同tags的策略只探测一次
+			if probe := parseProbe(metric); probe != nil {
+				probes[probe.Type+"/"+probe.Tags] = probe
+				continue
+			}
 
-				tmpMap := make(map[int]string)
-
-				for i := 0; i < len(arr); i++ {
-					if strings.HasPrefix(arr[i], "name=") {
-						tmpMap[1] = strings.TrimSpace(arr[i][5:])
-					} else if strings.HasPrefix(arr[i], "cmdline=") {
-						tmpMap[2] = strings.TrimSpace(arr[i][8:])
-					} else if strings.Contains(arr[i], "=") {
-						log.Errorln("proc.num with wrong tag:", arr)
-						tmpMap[3] = "wrong tags"
-					}
+			// log.match.count等, tags中的rule, path和pattern都不能为空
+			if strings.HasPrefix(metric.Metric, g.LOG_MATCH+".") {
+				params := cutils.DictedTagstring(metric.Tags)
+				if params["rule"] == "" || params["path"] == "" || params["pattern"] == "" {
+					log.Errorln("log.match.* with wrong tags:", metric.Tags)
+					continue
 				}
+				tags := cutils.SortedTags(params)
+				logRules[tags] = &g.LogRule{Tags: tags, Path: params["path"], Pattern: params["pattern"]}
+				continue
+			}
 
-				_, nameExist := tmpMap[1]
-				_, cmdExist := tmpMap[2]
-				_, wrongTagsExist := tmpMap[3]
-				if !wrongTagsExist && !(nameExist && cmdExist) {
+			if metric.Metric == g.PROC_NUM {
+				if tmpMap, ok := parseProcTags(metric.Tags); ok {
 					procs[metric.Tags] = tmpMap
 				}
+				continue
+			}
+
+			// proc.cpu.percent等, 采集进程组的资源使用
+			if strings.HasPrefix(metric.Metric, g.PROC_PREFIX) {
+				if tmpMap, ok := parseProcTags(metric.Tags); ok {
+					procStats[metric.Tags] = tmpMap
+				}
 			}
 		}
 
 		g.SetReportUrls(urls)
 		g.SetReportPorts(ports)
 		g.SetReportProcs(procs)
+		g.SetReportProcStats(procStats)
+		g.SetReportProbes(probes)
+		g.SetReportLogRules(logRules)
 		g.SetDuPaths(paths)
 
 	}
 }
+
+// parseProcTags parses the tags of proc.*, e.g. name=xx or cmdline=xx => {1=>xx} or {2=>xx}
+func parseProcTags(tags string) (map[int]string, bool) {
+	arr := strings.Split(tags, ",")
+
+	tmpMap := make(map[int]string)
+
+	for i := 0; i < len(arr); i++ {
+		if strings.HasPrefix(arr[i], "name=") {
+			tmpMap[1] = strings.TrimSpace(arr[i][5:])
+		} else if strings.HasPrefix(arr[i], "cmdline=") {
+			tmpMap[2] = strings.TrimSpace(arr[i][8:])
+		} else if strings.Contains(arr[i], "=") {
+			log.Errorln("proc.* with wrong tag:", arr)
+			tmpMap[3] = "wrong tags"
+		}
+	}
+
+	_, nameExist := tmpMap[1]
+	_, cmdExist := tmpMap[2]
+	_, wrongTagsExist := tmpMap[3]
+	return tmpMap, !wrongTagsExist && !(nameExist && cmdExist)
+}
+
+func parseProbe(metric *model.BuiltinMetric) *g.Probe {
+	for _, t := range []string{g.HTTP_CHECK, g.TCP_CHECK, g.DNS_CHECK, g.TLS_CHECK} {
+		if strings.HasPrefix(metric.Metric, t+".") {
+			params := cutils.DictedTagstring(metric.Tags)
+			return &g.Probe{Type: t, Tags: cutils.SortedTags(params), Params: params}
+		}
+	}
+	return nil
+}
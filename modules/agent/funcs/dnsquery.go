@@ -0,0 +1,162 @@
+package funcs
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	dnsTypeA     = 1
+	dnsClassIN   = 1
+	dnsMaxPacket = 512
+)
+
+var errDNSMalformed = errors.New("malformed dns response")
+
+// lookupHost 使用系统的配置解析, net.LookupHost不支持超时, 超时后不再等待结果
+func lookupHost(domain string, timeout time.Duration) ([]string, error) {
+	type result struct {
+		addrs []string
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		addrs, err := net.LookupHost(domain)
+		done <- result{addrs, err}
+	}()
+	select {
+	case r := <-done:
+		return r.addrs, r.err
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("lookup %s: timeout after %v", domain, timeout)
+	}
+}
+
+// lookupA 通过UDP向指定的server查询domain的A记录
+func lookupA(server, domain string, timeout time.Duration) ([]string, error) {
+	conn, err := net.DialTimeout("udp", server, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	id := uint16(rand.Intn(1 << 16))
+	query, err := buildDNSQuery(id, domain)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, dnsMaxPacket)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		// 忽略id不匹配的响应(之前超时的查询)
+		if n >= 2 && binary.BigEndian.Uint16(buf) != id {
+			continue
+		}
+		return parseDNSResponse(buf[:n])
+	}
+}
+
+func buildDNSQuery(id uint16, domain string) ([]byte, error) {
+	msg := make([]byte, 12, dnsMaxPacket)
+	binary.BigEndian.PutUint16(msg[0:], id)
+	binary.BigEndian.PutUint16(msg[2:], 0x0100) // RD
+	binary.BigEndian.PutUint16(msg[4:], 1)      // QDCOUNT
+	for _, label := range strings.Split(strings.TrimSuffix(domain, "."), ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return nil, fmt.Errorf("invalid domain %q", domain)
+		}
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	msg = append(msg, 0, 0, dnsTypeA, 0, dnsClassIN)
+	return msg, nil
+}
+
+// parseDNSResponse 返回响应中所有A记录的ip
+func parseDNSResponse(msg []byte) ([]string, error) {
+	if len(msg) < 12 {
+		return nil, errDNSMalformed
+	}
+	flags := binary.BigEndian.Uint16(msg[2:])
+	if flags&0x8000 == 0 {
+		return nil, errDNSMalformed
+	}
+	if rcode := flags & 0x000f; rcode != 0 {
+		return nil, fmt.Errorf("dns server returns rcode %d", rcode)
+	}
+	qdcount := int(binary.BigEndian.Uint16(msg[4:]))
+	ancount := int(binary.BigEndian.Uint16(msg[6:]))
+
+	off := 12
+	var err error
+	for i := 0; i < qdcount; i++ {
+		if off, err = skipDNSName(msg, off); err != nil {
+			return nil, err
+		}
+		off += 4
+	}
+
+	addrs := []string{}
+	for i := 0; i < ancount; i++ {
+		if off, err = skipDNSName(msg, off); err != nil {
+			return nil, err
+		}
+		if off+10 > len(msg) {
+			return nil, errDNSMalformed
+		}
+		typ := binary.BigEndian.Uint16(msg[off:])
+		class := binary.BigEndian.Uint16(msg[off+2:])
+		length := int(binary.BigEndian.Uint16(msg[off+8:]))
+		off += 10
+		if off+length > len(msg) {
+			return nil, errDNSMalformed
+		}
+		if typ == dnsTypeA && class == dnsClassIN && length == net.IPv4len {
+			addrs = append(addrs, net.IP(msg[off:off+length]).String())
+		}
+		off += length
+	}
+	if len(addrs) == 0 {
+		return nil, errors.New("no such host")
+	}
+	return addrs, nil
+}
+
+// skipDNSName 跳过off处的域名, 返回其后的偏移
+func skipDNSName(msg []byte, off int) (int, error) {
+	for {
+		if off >= len(msg) {
+			return 0, errDNSMalformed
+		}
+		c := int(msg[off])
+		switch c & 0xc0 {
+		case 0x00:
+			off++
+			if c == 0 {
+				return off, nil
+			}
+			off += c
+		case 0xc0:
+			// 压缩的指针占两个字节, 且是域名的结尾
+			if off+2 > len(msg) {
+				return 0, errDNSMalformed
+			}
+			return off + 2, nil
+		default:
+			return 0, errDNSMalformed
+		}
+	}
+}
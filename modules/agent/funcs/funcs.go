@@ -37,6 +37,7 @@ func BuildMappers() {
 				IOStatsMetrics,
 				NetstatMetrics,
 				ProcMetrics,
+				ProcStatMetrics,
 				UdpMetrics,
 			},
 			Interval: interval,
@@ -57,12 +58,14 @@ func BuildMappers() {
 		FuncsAndInterval{
 			Fs: []func() []*model.MetricValue{
 				DuMetrics,
+				LogMetrics,
 			},
 			Interval: interval,
 		},
 		FuncsAndInterval{
 			Fs: []func() []*model.MetricValue{
 				UrlMetrics,
+				ProbeMetrics,
 			},
 			Interval: interval,
 		},
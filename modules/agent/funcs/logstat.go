@@ -0,0 +1,57 @@
+package funcs
+
+import (
+	"path/filepath"
+	"regexp"
+
+	"github.com/Cepave/open-falcon-backend/common/model"
+	"github.com/Cepave/open-falcon-backend/modules/agent/g"
+	"github.com/Cepave/open-falcon-backend/modules/agent/logwatch"
+	log "github.com/Sirupsen/logrus"
+)
+
+// 每个文件上报一组, tags是策略的tags加上file=文件路径;
+// pattern有捕获组时, 第一个捕获组按照数字解析, 上报sum, max和avg
+const (
+	LOG_MATCH_COUNT = "log.match.count"
+	LOG_MATCH_SUM   = "log.match.sum"
+	LOG_MATCH_MAX   = "log.match.max"
+	LOG_MATCH_AVG   = "log.match.avg"
+)
+
+var logWatcher *logwatch.Watcher
+
+func LogMetrics() (L []*model.MetricValue) {
+	logRules := g.ReportLogRules()
+	// 规则被删除后仍然需要采集一次, 以关闭文件
+	if len(logRules) == 0 && logWatcher == nil {
+		return
+	}
+	if logWatcher == nil {
+		logWatcher = logwatch.NewWatcher(filepath.Join(g.Root, "var", "logwatch.json"))
+	}
+
+	rules := []*logwatch.Rule{}
+	for _, r := range logRules {
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			log.Printf("bad pattern of log rule [%s]: %v", r.Tags, err)
+			continue
+		}
+		rules = append(rules, &logwatch.Rule{Name: r.Tags, Path: r.Path, Pattern: re})
+	}
+
+	for _, result := range logWatcher.Collect(rules) {
+		tags := result.Rule.Name + ",file=" + result.File
+		L = append(L, GaugeValue(LOG_MATCH_COUNT, result.Count, tags))
+		if result.Rule.Pattern.NumSubexp() == 0 {
+			continue
+		}
+		L = append(L, GaugeValue(LOG_MATCH_SUM, result.Sum, tags))
+		if result.Values > 0 {
+			L = append(L, GaugeValue(LOG_MATCH_MAX, result.Max, tags))
+			L = append(L, GaugeValue(LOG_MATCH_AVG, result.Avg(), tags))
+		}
+	}
+	return
+}
@@ -0,0 +1,346 @@
+package funcs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Cepave/open-falcon-backend/common/model"
+	"github.com/Cepave/open-falcon-backend/modules/agent/g"
+	log "github.com/Sirupsen/logrus"
+)
+
+// 探测的结果按照策略的tags上报, 时间的单位是ms
+//
+// http.check: url, method(GET), status(200, 多个用|分隔), match(响应body的正则), timeout(s), insecure(true时不校验证书)
+// tcp.check: addr, send, expect(响应中包含的字符串), timeout(s)
+// dns.check: domain, server(ip:port, 默认使用系统的配置, 指定时只查询A记录), expect(解析结果中包含的ip), timeout(s)
+// tls.check: addr, servername, timeout(s)
+const (
+	HTTP_CHECK_HEALTH       = "http.check.health"
+	HTTP_CHECK_STATUS       = "http.check.status"
+	HTTP_CHECK_TIME         = "http.check.time"
+	HTTP_CHECK_DNS_TIME     = "http.check.dns.time"
+	HTTP_CHECK_CONNECT_TIME = "http.check.connect.time"
+	HTTP_CHECK_TLS_TIME     = "http.check.tls.time"
+	HTTP_CHECK_TTFB         = "http.check.ttfb"
+	TCP_CHECK_HEALTH        = "tcp.check.health"
+	TCP_CHECK_TIME          = "tcp.check.time"
+	DNS_CHECK_HEALTH        = "dns.check.health"
+	DNS_CHECK_TIME          = "dns.check.time"
+	TLS_CHECK_HEALTH        = "tls.check.health"
+	TLS_CHECK_TIME          = "tls.check.time"
+	TLS_CHECK_DAYS          = "tls.check.days"
+)
+
+const (
+	defaultProbeTimeout = 5 * time.Second
+	maxProbeBody        = 1024 * 1024
+)
+
+func ProbeMetrics() (L []*model.MetricValue) {
+	probes := g.ReportProbes()
+	if len(probes) == 0 {
+		return
+	}
+
+	lock := new(sync.Mutex)
+	wg := new(sync.WaitGroup)
+	for _, probe := range probes {
+		wg.Add(1)
+		go func(probe *g.Probe) {
+			defer wg.Done()
+			metrics := runProbe(probe)
+			lock.Lock()
+			L = append(L, metrics...)
+			lock.Unlock()
+		}(probe)
+	}
+	wg.Wait()
+	return
+}
+
+func runProbe(probe *g.Probe) []*model.MetricValue {
+	timeout := probeTimeout(probe.Params)
+	switch probe.Type {
+	case g.HTTP_CHECK:
+		return probeHTTP(probe.Params, timeout).metrics(probe.Tags)
+	case g.TCP_CHECK:
+		r := probeTCP(probe.Params, timeout)
+		return healthAndTime(TCP_CHECK_HEALTH, TCP_CHECK_TIME, r.ok, r.time, probe.Tags)
+	case g.DNS_CHECK:
+		r := probeDNS(probe.Params, timeout)
+		return healthAndTime(DNS_CHECK_HEALTH, DNS_CHECK_TIME, r.ok, r.time, probe.Tags)
+	case g.TLS_CHECK:
+		r := probeTLS(probe.Params, timeout)
+		L := healthAndTime(TLS_CHECK_HEALTH, TLS_CHECK_TIME, r.ok, r.time, probe.Tags)
+		if !r.expiry.IsZero() {
+			L = append(L, GaugeValue(TLS_CHECK_DAYS, int64(r.expiry.Sub(time.Now()).Hours()/24), probe.Tags))
+		}
+		return L
+	}
+	return nil
+}
+
+func probeTimeout(params map[string]string) time.Duration {
+	if sec, err := strconv.Atoi(params["timeout"]); err == nil && sec > 0 {
+		return time.Duration(sec) * time.Second
+	}
+	return defaultProbeTimeout
+}
+
+func healthAndTime(health, elapsed string, ok bool, t time.Duration, tags string) []*model.MetricValue {
+	if !ok {
+		return []*model.MetricValue{GaugeValue(health, 0, tags)}
+	}
+	return []*model.MetricValue{GaugeValue(health, 1, tags), GaugeValue(elapsed, ms(t), tags)}
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+type httpResult struct {
+	ok      bool
+	status  int
+	total   time.Duration
+	dns     time.Duration
+	connect time.Duration
+	tls     time.Duration
+	ttfb    time.Duration
+}
+
+func (this *httpResult) metrics(tags string) []*model.MetricValue {
+	L := []*model.MetricValue{GaugeValue(HTTP_CHECK_HEALTH, boolValue(this.ok), tags)}
+	if this.status == 0 {
+		return L
+	}
+	return append(L,
+		GaugeValue(HTTP_CHECK_STATUS, this.status, tags),
+		GaugeValue(HTTP_CHECK_TIME, ms(this.total), tags),
+		GaugeValue(HTTP_CHECK_DNS_TIME, ms(this.dns), tags),
+		GaugeValue(HTTP_CHECK_CONNECT_TIME, ms(this.connect), tags),
+		GaugeValue(HTTP_CHECK_TLS_TIME, ms(this.tls), tags),
+		GaugeValue(HTTP_CHECK_TTFB, ms(this.ttfb), tags),
+	)
+}
+
+func boolValue(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// probeHTTP does not follow the redirections, the status is 0 if there is no response
+func probeHTTP(params map[string]string, timeout time.Duration) *httpResult {
+	ret := &httpResult{}
+	url := params["url"]
+	method := strings.ToUpper(params["method"])
+	if method == "" {
+		method = "GET"
+	}
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		log.Printf("probe url [%v] failed: %v", url, err)
+		return ret
+	}
+
+	var dnsStart, connectStart, tlsStart time.Time
+	start := time.Now()
+	trace := &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { dnsStart = time.Now() },
+		DNSDone:              func(httptrace.DNSDoneInfo) { ret.dns = time.Since(dnsStart) },
+		ConnectStart:         func(string, string) { connectStart = time.Now() },
+		ConnectDone:          func(string, string, error) { ret.connect = time.Since(connectStart) },
+		TLSHandshakeStart:    func() { tlsStart = time.Now() },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { ret.tls = time.Since(tlsStart) },
+		GotFirstResponseByte: func() { ret.ttfb = time.Since(start) },
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+
+	client := &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DisableKeepAlives: true,
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: params["insecure"] == "true"},
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Printf("probe url [%v] failed: %v", url, err)
+		return ret
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxProbeBody))
+	ret.total = time.Since(start)
+	ret.status = resp.StatusCode
+	if err != nil {
+		log.Printf("read body of [%v] failed: %v", url, err)
+		return ret
+	}
+
+	expected := params["status"]
+	if expected == "" {
+		expected = "200"
+	}
+	for _, s := range strings.Split(expected, "|") {
+		if s == strconv.Itoa(resp.StatusCode) {
+			ret.ok = true
+		}
+	}
+	if !ret.ok {
+		log.Printf("return code [%d] of [%v] is not %s", resp.StatusCode, url, expected)
+		return ret
+	}
+
+	if match := params["match"]; match != "" {
+		re, err := regexp.Compile(match)
+		if err != nil {
+			log.Printf("bad match [%s] of [%v]: %v", match, url, err)
+			ret.ok = false
+			return ret
+		}
+		ret.ok = re.Match(body)
+	}
+	return ret
+}
+
+type probeResult struct {
+	ok     bool
+	time   time.Duration
+	expiry time.Time // the certificate of tls.check
+}
+
+var escapeReplacer = strings.NewReplacer(`\r`, "\r", `\n`, "\n", `\t`, "\t")
+
+func probeTCP(params map[string]string, timeout time.Duration) *probeResult {
+	ret := &probeResult{}
+	addr := params["addr"]
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		log.Printf("probe tcp [%v] failed: %v", addr, err)
+		return ret
+	}
+	defer conn.Close()
+	conn.SetDeadline(start.Add(timeout))
+
+	if send := params["send"]; send != "" {
+		if _, err := conn.Write([]byte(escapeReplacer.Replace(send))); err != nil {
+			log.Printf("write tcp [%v] failed: %v", addr, err)
+			return ret
+		}
+	}
+	if expect := params["expect"]; expect != "" {
+		expect = escapeReplacer.Replace(expect)
+		buf := make([]byte, 4096)
+		received := []byte{}
+		for !strings.Contains(string(received), expect) {
+			n, err := conn.Read(buf)
+			received = append(received, buf[:n]...)
+			if err != nil || len(received) > maxProbeBody {
+				log.Printf("tcp [%v] does not return %q: %v", addr, expect, err)
+				return ret
+			}
+		}
+	}
+	ret.ok, ret.time = true, time.Since(start)
+	return ret
+}
+
+func probeDNS(params map[string]string, timeout time.Duration) *probeResult {
+	ret := &probeResult{}
+	domain := params["domain"]
+
+	start := time.Now()
+	var addrs []string
+	var err error
+	if server := params["server"]; server != "" {
+		if _, _, e := net.SplitHostPort(server); e != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		addrs, err = lookupA(server, domain, timeout)
+	} else {
+		addrs, err = lookupHost(domain, timeout)
+	}
+	if err != nil {
+		log.Printf("probe dns [%v] failed: %v", domain, err)
+		return ret
+	}
+	if expect := params["expect"]; expect != "" {
+		found := false
+		for _, addr := range addrs {
+			found = found || addr == expect
+		}
+		if !found {
+			log.Printf("dns [%v] does not resolve to %v: %v", domain, expect, addrs)
+			return ret
+		}
+	}
+	ret.ok, ret.time = true, time.Since(start)
+	return ret
+}
+
+// probeTLS reports the expiry of the certificate even if it is not trusted, ok means a valid certificate
+func probeTLS(params map[string]string, timeout time.Duration) *probeResult {
+	ret := &probeResult{}
+	addr := params["addr"]
+	serverName := params["servername"]
+	if serverName == "" {
+		serverName, _, _ = net.SplitHostPort(addr)
+	}
+
+	start := time.Now()
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", addr, &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		log.Printf("probe tls [%v] failed: %v", addr, err)
+		return ret
+	}
+	defer conn.Close()
+	ret.time = time.Since(start)
+
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return ret
+	}
+	ret.expiry = certs[0].NotAfter
+
+	opts := x509.VerifyOptions{DNSName: serverName, Intermediates: x509.NewCertPool()}
+	for _, cert := range certs[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	if _, err := certs[0].Verify(opts); err != nil {
+		log.Printf("verify certificate of [%v] failed: %v", addr, err)
+		return ret
+	}
+	ret.ok = true
+	return ret
+}
+
+// probeUrl is the check of url.check.health, as `curl -I` before
+func probeUrl(furl string, timeout string) (bool, error) {
+	params := map[string]string{"url": furl, "method": "HEAD", "timeout": timeout}
+	r := probeHTTP(params, probeTimeout(params))
+	if !r.ok {
+		return false, fmt.Errorf("probe url [%v] failed, status: %d", furl, r.status)
+	}
+	return true, nil
+}
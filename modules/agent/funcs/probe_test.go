@@ -0,0 +1,131 @@
+package funcs
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProbeHTTP(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/moved" {
+			http.Redirect(w, r, "/", http.StatusFound)
+			return
+		}
+		w.Write([]byte(`{"status": "ok"}`))
+	}))
+	defer ts.Close()
+
+	cases := []struct {
+		params map[string]string
+		ok     bool
+		status int
+	}{
+		{map[string]string{"url": ts.URL}, true, 200},
+		{map[string]string{"url": ts.URL, "match": `"status":\s*"ok"`}, true, 200},
+		{map[string]string{"url": ts.URL, "match": `error`}, false, 200},
+		{map[string]string{"url": ts.URL + "/moved"}, false, 302},
+		{map[string]string{"url": ts.URL + "/moved", "status": "301|302"}, true, 302},
+		{map[string]string{"url": "http://127.0.0.1:1"}, false, 0},
+	}
+	for i, c := range cases {
+		r := probeHTTP(c.params, time.Second)
+		if r.ok != c.ok || r.status != c.status {
+			t.Errorf("case %d: expected %v %d, got %v %d", i, c.ok, c.status, r.ok, r.status)
+		}
+		if r.status != 0 && (r.total <= 0 || r.ttfb <= 0 || r.ttfb > r.total) {
+			t.Errorf("case %d: unexpected times %+v", i, r)
+		}
+	}
+}
+
+func TestProbeTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				line, _ := bufio.NewReader(conn).ReadString('\n')
+				if strings.TrimSpace(line) == "PING" {
+					conn.Write([]byte("+PONG\r\n"))
+				}
+			}(conn)
+		}
+	}()
+
+	addr := l.Addr().String()
+	if r := probeTCP(map[string]string{"addr": addr}, time.Second); !r.ok {
+		t.Error("connect failed")
+	}
+	if r := probeTCP(map[string]string{"addr": addr, "send": `PING\r\n`, "expect": "PONG"}, time.Second); !r.ok {
+		t.Error("expect PONG")
+	}
+	if r := probeTCP(map[string]string{"addr": addr, "send": `QUIT\r\n`, "expect": "PONG"}, time.Second); r.ok {
+		t.Error("unexpected PONG")
+	}
+}
+
+func TestProbeDNS(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			resp := append([]byte{}, buf[:n]...)
+			resp[2], resp[3] = 0x81, 0x80
+			resp[7] = 1
+			// 压缩的域名指向question, A IN ttl=60 10.0.0.1
+			resp = append(resp, 0xc0, 12, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4, 10, 0, 0, 1)
+			conn.WriteTo(resp, addr)
+		}
+	}()
+
+	server := conn.LocalAddr().String()
+	if r := probeDNS(map[string]string{"domain": "www.example.com", "server": server, "expect": "10.0.0.1"}, time.Second); !r.ok {
+		t.Error("expect 10.0.0.1")
+	}
+	if r := probeDNS(map[string]string{"domain": "www.example.com", "server": server, "expect": "10.0.0.2"}, time.Second); r.ok {
+		t.Error("unexpected 10.0.0.2")
+	}
+	if _, err := parseDNSResponse([]byte{0, 1, 0x81, 0x83, 0, 0, 0, 0, 0, 0, 0, 0}); err == nil {
+		t.Error("expect NXDOMAIN error")
+	}
+}
+
+func TestProbeTLS(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	addr := strings.TrimPrefix(ts.URL, "https://")
+	r := probeTLS(map[string]string{"addr": addr}, time.Second)
+	// the certificate of httptest is not trusted
+	if r.ok || r.expiry.Before(time.Now()) {
+		t.Errorf("unexpected result: %+v", r)
+	}
+
+	if r := probeHTTP(map[string]string{"url": ts.URL}, time.Second); r.ok || r.status != 0 {
+		t.Errorf("untrusted certificate passes: %+v", r)
+	}
+	if r := probeHTTP(map[string]string{"url": ts.URL, "insecure": "true"}, time.Second); !r.ok || r.tls <= 0 {
+		t.Errorf("unexpected result: %+v", r)
+	}
+}
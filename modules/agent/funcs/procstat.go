@@ -0,0 +1,311 @@
+package funcs
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Cepave/open-falcon-backend/common/model"
+	"github.com/Cepave/open-falcon-backend/modules/agent/g"
+	log "github.com/Sirupsen/logrus"
+	"github.com/toolkits/nux"
+)
+
+// 按照与proc.num相同的tags(name=xx或cmdline=xx)匹配进程组, 采集进程组的资源使用.
+// cpu, io和上下文切换是两次采集之间每个进程的增量之和, 新出现的进程从下一次采集开始计算
+const (
+	PROC_CPU_PERCENT = "proc.cpu.percent"
+	PROC_MEM_RSS     = "proc.mem.rss"
+	PROC_MEM_VSZ     = "proc.mem.vsz"
+	PROC_FD_NUM      = "proc.fd.num"
+	PROC_THREAD_NUM  = "proc.thread.num"
+	PROC_IO_READ     = "proc.io.read.bytes"
+	PROC_IO_WRITE    = "proc.io.write.bytes"
+	PROC_CTXT        = "proc.ctxt.switches"
+	PROC_UPTIME      = "proc.uptime"
+	PROC_RESTART     = "proc.restart"
+)
+
+// USER_HZ, the unit of the times in /proc/<pid>/stat
+const clockTicks = 100
+
+type procStat struct {
+	Pid       int
+	Utime     uint64
+	Stime     uint64
+	Threads   int64
+	StartTime uint64 // clock ticks since boot
+	Vsz       uint64 // bytes
+	Rss       uint64 // pages
+}
+
+type procIO struct {
+	ReadBytes  uint64
+	WriteBytes uint64
+}
+
+// procCounters is the history of a process, StartTime tells the reused pid
+type procCounters struct {
+	StartTime  uint64
+	Ticks      uint64
+	ReadBytes  uint64
+	WriteBytes uint64
+	Ctxt       uint64
+}
+
+type oldestProc struct {
+	Pid       int
+	StartTime uint64
+}
+
+var (
+	procHistory     = map[int]procCounters{}
+	procHistoryTime time.Time
+	oldestProcs     = map[string]oldestProc{}
+	procStatLock    = new(sync.Mutex)
+
+	bootTime     int64
+	bootTimeOnce sync.Once
+)
+
+func ProcStatMetrics() (L []*model.MetricValue) {
+	reportProcStats := g.ReportProcStats()
+	if len(reportProcStats) == 0 {
+		return
+	}
+
+	ps, err := nux.AllProcs()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	procStatLock.Lock()
+	defer procStatLock.Unlock()
+
+	now := time.Now()
+	elapsed := now.Sub(procHistoryTime).Seconds()
+	if procHistoryTime.IsZero() {
+		elapsed = 0
+	}
+	history := map[int]procCounters{}
+	oldest := map[string]oldestProc{}
+
+	for tags, m := range reportProcStats {
+		var (
+			matched            bool
+			ticks, read, write uint64
+			ctxt, rss, vsz     uint64
+			fds, threads       int64
+			first              *procStat
+			// 计数器变小(例如/proc/<pid>/io时而不可读)时这一次不上报, 避免uint64下溢
+			readBad, writeBad, ctxtBad bool
+		)
+		for _, p := range ps {
+			if !is_a(p, m) {
+				continue
+			}
+			st, err := readProcStat(p.Pid)
+			if err != nil {
+				continue
+			}
+			matched = true
+
+			c, ok := history[st.Pid]
+			if !ok {
+				c = readProcCounters(st)
+				history[st.Pid] = c
+			}
+			if prev, ok := procHistory[st.Pid]; ok && prev.StartTime == st.StartTime {
+				ticks += c.Ticks - prev.Ticks
+				read, readBad = addDelta(read, c.ReadBytes, prev.ReadBytes, readBad)
+				write, writeBad = addDelta(write, c.WriteBytes, prev.WriteBytes, writeBad)
+				ctxt, ctxtBad = addDelta(ctxt, c.Ctxt, prev.Ctxt, ctxtBad)
+			}
+
+			rss += st.Rss * uint64(os.Getpagesize())
+			vsz += st.Vsz
+			threads += st.Threads
+			fds += countFds(st.Pid)
+			if first == nil || st.StartTime < first.StartTime {
+				first = st
+			}
+		}
+
+		// 进程组为空时保留之前最老的进程, 进程重新出现时上报重启
+		prev, hasPrev := oldestProcs[tags]
+		if !matched {
+			if hasPrev {
+				oldest[tags] = prev
+			}
+			continue
+		}
+		cur := oldestProc{Pid: first.Pid, StartTime: first.StartTime}
+		oldest[tags] = cur
+		restarted := 0
+		if hasPrev && prev != cur {
+			restarted = 1
+		}
+
+		L = append(L, GaugeValue(PROC_MEM_RSS, rss, tags))
+		L = append(L, GaugeValue(PROC_MEM_VSZ, vsz, tags))
+		L = append(L, GaugeValue(PROC_FD_NUM, fds, tags))
+		L = append(L, GaugeValue(PROC_THREAD_NUM, threads, tags))
+		L = append(L, GaugeValue(PROC_RESTART, restarted, tags))
+		if bt := getBootTime(); bt > 0 {
+			L = append(L, GaugeValue(PROC_UPTIME, now.Unix()-bt-int64(first.StartTime/clockTicks), tags))
+		}
+		if elapsed > 0 {
+			L = append(L, GaugeValue(PROC_CPU_PERCENT, float64(ticks)/clockTicks/elapsed*100, tags))
+			if !readBad {
+				L = append(L, GaugeValue(PROC_IO_READ, float64(read)/elapsed, tags))
+			}
+			if !writeBad {
+				L = append(L, GaugeValue(PROC_IO_WRITE, float64(write)/elapsed, tags))
+			}
+			if !ctxtBad {
+				L = append(L, GaugeValue(PROC_CTXT, float64(ctxt)/elapsed, tags))
+			}
+		}
+	}
+
+	procHistory = history
+	procHistoryTime = now
+	oldestProcs = oldest
+	return
+}
+
+// addDelta adds cur-prev to sum, bad is true once a counter goes backwards
+func addDelta(sum, cur, prev uint64, bad bool) (uint64, bool) {
+	if cur < prev {
+		return sum, true
+	}
+	return sum + cur - prev, bad
+}
+
+func readProcStat(pid int) (*procStat, error) {
+	bs, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return nil, err
+	}
+	return parseProcStat(string(bs))
+}
+
+// parseProcStat parses /proc/<pid>/stat, the comm in parentheses may contain spaces
+func parseProcStat(content string) (*procStat, error) {
+	i := strings.Index(content, "(")
+	j := strings.LastIndex(content, ")")
+	if i < 0 || j < i {
+		return nil, fmt.Errorf("bad stat: %s", content)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(content[:i]))
+	if err != nil {
+		return nil, err
+	}
+
+	// fields[0] is the 3rd field(state)
+	fields := strings.Fields(content[j+1:])
+	if len(fields) < 22 {
+		return nil, fmt.Errorf("bad stat: %s", content)
+	}
+	values := map[int]uint64{}
+	for _, idx := range []int{11, 12, 17, 19, 20, 21} {
+		if values[idx], err = strconv.ParseUint(fields[idx], 10, 64); err != nil {
+			return nil, err
+		}
+	}
+	return &procStat{
+		Pid:       pid,
+		Utime:     values[11],
+		Stime:     values[12],
+		Threads:   int64(values[17]),
+		StartTime: values[19],
+		Vsz:       values[20],
+		Rss:       values[21],
+	}, nil
+}
+
+// readProcCounters reads io and context switches, which are zero without privilege
+func readProcCounters(st *procStat) procCounters {
+	c := procCounters{StartTime: st.StartTime, Ticks: st.Utime + st.Stime}
+	if bs, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/io", st.Pid)); err == nil {
+		pio := parseProcIO(string(bs))
+		c.ReadBytes, c.WriteBytes = pio.ReadBytes, pio.WriteBytes
+	}
+	if bs, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/status", st.Pid)); err == nil {
+		c.Ctxt = parseCtxtSwitches(string(bs))
+	}
+	return c
+}
+
+func parseProcIO(content string) *procIO {
+	ret := &procIO{}
+	for _, line := range strings.Split(content, "\n") {
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		v, err := strconv.ParseUint(strings.TrimSpace(kv[1]), 10, 64)
+		if err != nil {
+			continue
+		}
+		switch kv[0] {
+		case "read_bytes":
+			ret.ReadBytes = v
+		case "write_bytes":
+			ret.WriteBytes = v
+		}
+	}
+	return ret
+}
+
+func parseCtxtSwitches(content string) uint64 {
+	var ret uint64
+	for _, line := range strings.Split(content, "\n") {
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		if kv[0] == "voluntary_ctxt_switches" || kv[0] == "nonvoluntary_ctxt_switches" {
+			v, _ := strconv.ParseUint(strings.TrimSpace(kv[1]), 10, 64)
+			ret += v
+		}
+	}
+	return ret
+}
+
+func countFds(pid int) int64 {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/fd", pid))
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	names, _ := f.Readdirnames(-1)
+	return int64(len(names))
+}
+
+// getBootTime returns the btime in /proc/stat, 0 if unknown
+func getBootTime() int64 {
+	bootTimeOnce.Do(func() {
+		f, err := os.Open("/proc/stat")
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) == 2 && fields[0] == "btime" {
+				bootTime, _ = strconv.ParseInt(fields[1], 10, 64)
+				return
+			}
+		}
+	})
+	return bootTime
+}
@@ -0,0 +1,47 @@
+package funcs
+
+import "testing"
+
+func TestParseProcStat(t *testing.T) {
+	content := "1234 (falcon agent) S 1 1234 1234 0 -1 4202752 2337 0 0 0 150 50 0 0 20 0 12 0 3600 1073741824 2048 18446744073709551615 1 1 0 0 0 0 0 0 0 0 0 0 17 3 0 0 0 0 0\n"
+	st, err := parseProcStat(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Pid != 1234 || st.Utime != 150 || st.Stime != 50 || st.Threads != 12 ||
+		st.StartTime != 3600 || st.Vsz != 1073741824 || st.Rss != 2048 {
+		t.Errorf("unexpected stat: %+v", st)
+	}
+
+	if _, err := parseProcStat("1234 (agent) S 1"); err == nil {
+		t.Error("expected error of short stat")
+	}
+}
+
+func TestParseProcIO(t *testing.T) {
+	content := "rchar: 100\nwchar: 200\nsyscr: 3\nsyscw: 4\nread_bytes: 4096\nwrite_bytes: 8192\ncancelled_write_bytes: 0\n"
+	if io := parseProcIO(content); io.ReadBytes != 4096 || io.WriteBytes != 8192 {
+		t.Errorf("unexpected io: %+v", io)
+	}
+}
+
+func TestParseCtxtSwitches(t *testing.T) {
+	content := "Name:\tagent\nThreads:\t12\nvoluntary_ctxt_switches:\t150\nnonvoluntary_ctxt_switches:\t7\n"
+	if n := parseCtxtSwitches(content); n != 157 {
+		t.Errorf("unexpected context switches: %d", n)
+	}
+}
+
+func TestAddDelta(t *testing.T) {
+	sum, bad := addDelta(10, 30, 20, false)
+	if sum != 20 || bad {
+		t.Errorf("unexpected delta: %d %v", sum, bad)
+	}
+	// the counter goes backwards, e.g. /proc/<pid>/io is not readable this time
+	if sum, bad = addDelta(sum, 0, 4096, bad); sum != 20 || !bad {
+		t.Errorf("unexpected delta of underflow: %d %v", sum, bad)
+	}
+	if sum, bad = addDelta(sum, 5, 1, bad); sum != 24 || !bad {
+		t.Errorf("the bad step is not kept: %d %v", sum, bad)
+	}
+}
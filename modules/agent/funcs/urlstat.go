@@ -1,16 +1,10 @@
 package funcs
 
 import (
-	"bufio"
-	"bytes"
 	"fmt"
-	log "github.com/Sirupsen/logrus"
-	"strings"
 
 	"github.com/Cepave/open-falcon-backend/common/model"
 	"github.com/Cepave/open-falcon-backend/modules/agent/g"
-	"github.com/toolkits/file"
-	"github.com/toolkits/sys"
 )
 
 func UrlMetrics() (L []*model.MetricValue) {
@@ -33,22 +27,3 @@ func UrlMetrics() (L []*model.MetricValue) {
 	}
 	return
 }
-
-func probeUrl(furl string, timeout string) (bool, error) {
-	bs, err := sys.CmdOutBytes("curl", "--max-filesize", "102400", "-I", "-m", timeout, "-o", "/dev/null", "-s", "-w", "%{http_code}", furl)
-	if err != nil {
-		log.Printf("probe url [%v] failed.the err is: [%v]\n", furl, err)
-		return false, err
-	}
-	reader := bufio.NewReader(bytes.NewBuffer(bs))
-	retcode, err := file.ReadLine(reader)
-	if err != nil {
-		log.Println("read retcode failed.err is:", err)
-		return false, err
-	}
-	if strings.TrimSpace(string(retcode)) != "200" {
-		log.Printf("return code [%v] is not 200.query url is [%v]", string(retcode), furl)
-		return false, err
-	}
-	return true, err
-}
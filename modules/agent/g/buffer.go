@@ -0,0 +1,293 @@
+package g
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Cepave/open-falcon-backend/common/model"
+	log "github.com/Sirupsen/logrus"
+	"github.com/toolkits/file"
+)
+
+// 所有transfer都不可达时, 发送失败的数据先缓存在内存中, 内存满了之后追加到文件(每行一批数据),
+// transfer恢复后按照从旧到新的顺序重新发送. 缓存不为空时, 新的数据也进入缓存, 以保证发送的顺序
+const replayInterval = 5 * time.Second
+
+var errBufferFull = errors.New("buffer file is full")
+
+type BufferStat struct {
+	Buffered      int64 `json:"buffered"` // metrics put into the buffer
+	Replayed      int64 `json:"replayed"`
+	Dropped       int64 `json:"dropped"` // metrics dropped since the buffer is full
+	MemoryMetrics int64 `json:"memory_metrics"`
+	FileBytes     int64 `json:"file_bytes"` // unsent bytes in the file
+}
+
+type metricBuffer struct {
+	sync.Mutex
+	maxMemory   int
+	maxFileSize int64
+
+	memory  *list.List // of []*model.MetricValue
+	memSize int
+
+	filename string
+	file     *os.File
+	offset   int64 // 文件中已经发送的位置
+	size     int64
+
+	buffered int64
+	replayed int64
+	dropped  int64
+}
+
+func newMetricBuffer(filename string, maxMemory int, maxFileSize int64) (*metricBuffer, error) {
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	b := &metricBuffer{
+		maxMemory:   maxMemory,
+		maxFileSize: maxFileSize,
+		memory:      list.New(),
+		filename:    filename,
+		file:        f,
+	}
+	if err := b.recover(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return b, nil
+}
+
+// recover truncates the incomplete batch at the tail of the file, and restores the sent offset
+func (this *metricBuffer) recover() error {
+	info, err := this.file.Stat()
+	if err != nil {
+		return err
+	}
+	end := info.Size()
+	buf := make([]byte, 4096)
+	for end > 0 {
+		n := int64(len(buf))
+		if end < n {
+			n = end
+		}
+		if _, err := this.file.ReadAt(buf[:n], end-n); err != nil {
+			return err
+		}
+		if i := bytes.LastIndexByte(buf[:n], '\n'); i >= 0 {
+			end = end - n + int64(i) + 1
+			break
+		}
+		end -= n
+	}
+	if end < info.Size() {
+		log.Printf("truncate the incomplete tail of %s: %d -> %d", this.filename, info.Size(), end)
+		if err := this.file.Truncate(end); err != nil {
+			return err
+		}
+	}
+	this.size = end
+
+	if s, err := file.ToTrimString(this.filename + ".offset"); err == nil {
+		if offset, err := strconv.ParseInt(s, 10, 64); err == nil && offset >= 0 && offset <= end {
+			this.offset = offset
+		}
+	}
+	if this.offset == this.size {
+		return this.reset()
+	}
+	return nil
+}
+
+// reset truncates the file after all of the batches in it are sent
+func (this *metricBuffer) reset() error {
+	this.offset, this.size = 0, 0
+	if err := this.file.Truncate(0); err != nil {
+		return err
+	}
+	return this.saveOffset()
+}
+
+func (this *metricBuffer) saveOffset() error {
+	return ioutil.WriteFile(this.filename+".offset", []byte(strconv.FormatInt(this.offset, 10)), 0644)
+}
+
+func (this *metricBuffer) pending() bool {
+	this.Lock()
+	defer this.Unlock()
+	return this.memory.Len() > 0 || this.offset < this.size
+}
+
+func (this *metricBuffer) push(metrics []*model.MetricValue) {
+	this.Lock()
+	defer this.Unlock()
+	atomic.AddInt64(&this.buffered, int64(len(metrics)))
+
+	// 文件中有数据时, 内存中的都是更早的数据, 新的数据只能追加到文件
+	if this.offset == this.size && this.memSize+len(metrics) <= this.maxMemory {
+		this.memory.PushBack(metrics)
+		this.memSize += len(metrics)
+		return
+	}
+
+	line, err := json.Marshal(metrics)
+	if err == nil && this.size+int64(len(line))+1 > this.maxFileSize {
+		err = errBufferFull
+	}
+	if err == nil {
+		if _, err = this.file.Write(append(line, '\n')); err != nil {
+			this.file.Truncate(this.size)
+		}
+	}
+	if err != nil {
+		atomic.AddInt64(&this.dropped, int64(len(metrics)))
+		log.Printf("drop %d metrics: %v", len(metrics), err)
+		return
+	}
+	this.size += int64(len(line)) + 1
+}
+
+// peek returns the oldest batches up to max metrics(one batch at least),
+// and the function to remove them from the buffer after they are sent.
+// The function is nil if the buffer is empty.
+func (this *metricBuffer) peek(max int) ([]*model.MetricValue, func()) {
+	this.Lock()
+	defer this.Unlock()
+
+	ret := []*model.MetricValue{}
+	if this.memory.Len() > 0 {
+		n := 0
+		for e := this.memory.Front(); e != nil; e = e.Next() {
+			batch := e.Value.([]*model.MetricValue)
+			if n > 0 && len(ret)+len(batch) > max {
+				break
+			}
+			ret = append(ret, batch...)
+			n++
+		}
+		return ret, func() {
+			this.Lock()
+			defer this.Unlock()
+			for i := 0; i < n; i++ {
+				this.memory.Remove(this.memory.Front())
+			}
+			this.memSize -= len(ret)
+			atomic.AddInt64(&this.replayed, int64(len(ret)))
+		}
+	}
+
+	if this.offset == this.size {
+		return nil, nil
+	}
+	r := bufio.NewReader(io.NewSectionReader(this.file, this.offset, this.size-this.offset))
+	offset := this.offset
+	for offset < this.size {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			log.Printf("read %s fail: %v", this.filename, err)
+			break
+		}
+		var batch []*model.MetricValue
+		if err := json.Unmarshal(line, &batch); err != nil {
+			log.Printf("skip the broken batch in %s: %v", this.filename, err)
+			offset += int64(len(line))
+			continue
+		}
+		if len(ret) > 0 && len(ret)+len(batch) > max {
+			break
+		}
+		ret = append(ret, batch...)
+		offset += int64(len(line))
+	}
+	return ret, func() {
+		this.Lock()
+		defer this.Unlock()
+		this.offset = offset
+		var err error
+		if this.offset == this.size {
+			err = this.reset()
+		} else {
+			err = this.saveOffset()
+		}
+		if err != nil {
+			log.Printf("update %s fail: %v", this.filename, err)
+		}
+		atomic.AddInt64(&this.replayed, int64(len(ret)))
+	}
+}
+
+func (this *metricBuffer) stat() *BufferStat {
+	this.Lock()
+	defer this.Unlock()
+	return &BufferStat{
+		Buffered:      atomic.LoadInt64(&this.buffered),
+		Replayed:      atomic.LoadInt64(&this.replayed),
+		Dropped:       atomic.LoadInt64(&this.dropped),
+		MemoryMetrics: int64(this.memSize),
+		FileBytes:     this.size - this.offset,
+	}
+}
+
+var buffer *metricBuffer
+
+func InitBuffer() {
+	cfg := Config().Transfer.Buffer
+	if cfg == nil || !cfg.Enabled {
+		return
+	}
+
+	filename := cfg.File
+	if !filepath.IsAbs(filename) {
+		filename = filepath.Join(Root, filename)
+	}
+	b, err := newMetricBuffer(filename, cfg.MaxMemory, int64(cfg.MaxFileSize)*1024*1024)
+	if err != nil {
+		log.Fatalln("init buffer fail:", err)
+	}
+	buffer = b
+
+	go replay(cfg.ReplayBatch)
+}
+
+// GetBufferStat returns nil if the buffer is disabled
+func GetBufferStat() *BufferStat {
+	if buffer == nil {
+		return nil
+	}
+	return buffer.stat()
+}
+
+func replay(max int) {
+	for {
+		time.Sleep(replayInterval)
+		for {
+			metrics, remove := buffer.peek(max)
+			if remove == nil {
+				break
+			}
+			if len(metrics) > 0 {
+				var resp model.TransferResponse
+				if !SendMetrics(metrics, &resp) {
+					break
+				}
+			}
+			remove()
+		}
+	}
+}
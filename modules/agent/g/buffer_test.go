@@ -0,0 +1,99 @@
+package g
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Cepave/open-falcon-backend/common/model"
+)
+
+func batch(start int64, n int) []*model.MetricValue {
+	ret := []*model.MetricValue{}
+	for i := 0; i < n; i++ {
+		ret = append(ret, &model.MetricValue{Endpoint: "host", Metric: "cpu.idle", Value: 1, Timestamp: start + int64(i)})
+	}
+	return ret
+}
+
+func drain(t *testing.T, b *metricBuffer, max int) []int64 {
+	ts := []int64{}
+	for {
+		metrics, remove := b.peek(max)
+		if remove == nil {
+			return ts
+		}
+		for _, m := range metrics {
+			ts = append(ts, m.Timestamp)
+		}
+		remove()
+	}
+}
+
+func TestBufferOverflowToFile(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "buffer")
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "var", "buffer.dat")
+
+	b, err := newMetricBuffer(filename, 4, 1024*1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.push(batch(0, 2))
+	b.push(batch(2, 2))
+	// memory is full
+	b.push(batch(4, 3))
+	b.push(batch(7, 1))
+	if stat := b.stat(); stat.MemoryMetrics != 4 || stat.FileBytes == 0 || stat.Buffered != 8 {
+		t.Fatalf("unexpected stat: %+v", stat)
+	}
+
+	ts := drain(t, b, 3)
+	if len(ts) != 8 {
+		t.Fatalf("expected 8 metrics, got %v", ts)
+	}
+	for i, v := range ts {
+		if v != int64(i) {
+			t.Fatalf("unexpected order: %v", ts)
+		}
+	}
+	if stat := b.stat(); stat.Replayed != 8 || stat.FileBytes != 0 || b.pending() {
+		t.Errorf("unexpected stat: %+v", stat)
+	}
+}
+
+func TestBufferRecover(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "buffer")
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "buffer.dat")
+
+	b, _ := newMetricBuffer(filename, 0, 1024*1024)
+	b.push(batch(0, 1))
+	b.push(batch(1, 1))
+	b.push(batch(2, 1))
+	_, remove := b.peek(1)
+	remove()
+	b.file.Write([]byte(`[{"endpoint":`))
+	b.file.Close()
+
+	b, err := newMetricBuffer(filename, 0, 1024*1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ts := drain(t, b, 10); len(ts) != 2 || ts[0] != 1 || ts[1] != 2 {
+		t.Errorf("unexpected metrics after recovering: %v", ts)
+	}
+}
+
+func TestBufferFull(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "buffer")
+	defer os.RemoveAll(dir)
+
+	b, _ := newMetricBuffer(filepath.Join(dir, "buffer.dat"), 0, 200)
+	b.push(batch(0, 1))
+	b.push(batch(1, 1))
+	if stat := b.stat(); stat.Dropped != 1 || stat.Buffered != 2 {
+		t.Errorf("unexpected stat: %+v", stat)
+	}
+}
@@ -27,17 +27,35 @@ type HeartbeatConfig struct {
 	Timeout  int    `json:"timeout"`
 }
 
+type BufferConfig struct {
+	Enabled     bool   `json:"enabled"`
+	MaxMemory   int    `json:"maxMemory"`   // metrics in memory
+	File        string `json:"file"`        // relative to the work dir
+	MaxFileSize int    `json:"maxFileSize"` // MB
+	ReplayBatch int    `json:"replayBatch"` // metrics per Transfer.Update when replaying
+}
+
 type TransferConfig struct {
-	Enabled  bool     `json:"enabled"`
-	Addrs    []string `json:"addrs"`
-	Interval int      `json:"interval"`
-	Timeout  int      `json:"timeout"`
+	Enabled  bool          `json:"enabled"`
+	Addrs    []string      `json:"addrs"`
+	Interval int           `json:"interval"`
+	Timeout  int           `json:"timeout"`
+	Buffer   *BufferConfig `json:"buffer"`
 }
 
 type HttpConfig struct {
-	Enabled  bool   `json:"enabled"`
-	Listen   string `json:"listen"`
-	Backdoor bool   `json:"backdoor"`
+	Enabled bool   `json:"enabled"`
+	Listen  string `json:"listen"`
+}
+
+type RemoteConfig struct {
+	Enabled   bool                `json:"enabled"`
+	PublicKey string              `json:"publicKey"` // PEM file of the RSA public key
+	Commands  map[string][]string `json:"commands"`  // name => arguments, {param} is replaced by the param
+	Timeout   int                 `json:"timeout"`   // s
+	MaxOutput int                 `json:"maxOutput"` // bytes
+	MaxTTL    int                 `json:"maxTTL"`    // s, the longest expiry from now
+	Log       string              `json:"log"`       // the audit log
 }
 
 type CollectorConfig struct {
@@ -53,6 +71,7 @@ type GlobalConfig struct {
 	Heartbeat     *HeartbeatConfig `json:"heartbeat"`
 	Transfer      *TransferConfig  `json:"transfer"`
 	Http          *HttpConfig      `json:"http"`
+	Remote        *RemoteConfig    `json:"remote"`
 	Collector     *CollectorConfig `json:"collector"`
 	IgnoreMetrics map[string]bool  `json:"ignore"`
 }
@@ -122,6 +141,13 @@ func ParseConfig(cfg string) {
 		log.Fatalln("parse config file:", cfg, "fail:", err)
 	}
 
+	if c.Transfer != nil && c.Transfer.Buffer != nil {
+		checkBufferConfig(c.Transfer.Buffer)
+	}
+	if c.Remote != nil {
+		checkRemoteConfig(c.Remote)
+	}
+
 	lock.Lock()
 	defer lock.Unlock()
 
@@ -129,3 +155,33 @@ func ParseConfig(cfg string) {
 
 	log.Println("read config file:", cfg, "successfully")
 }
+
+func checkBufferConfig(b *BufferConfig) {
+	if b.MaxMemory <= 0 {
+		b.MaxMemory = 100000
+	}
+	if b.File == "" {
+		b.File = "var/buffer.dat"
+	}
+	if b.MaxFileSize <= 0 {
+		b.MaxFileSize = 1024
+	}
+	if b.ReplayBatch <= 0 {
+		b.ReplayBatch = 1000
+	}
+}
+
+func checkRemoteConfig(r *RemoteConfig) {
+	if r.Timeout <= 0 {
+		r.Timeout = 30
+	}
+	if r.MaxOutput <= 0 {
+		r.MaxOutput = 64 * 1024
+	}
+	if r.MaxTTL <= 0 {
+		r.MaxTTL = 300
+	}
+	if r.Log == "" {
+		r.Log = "var/remote.log"
+	}
+}
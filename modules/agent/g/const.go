@@ -19,11 +19,22 @@ import (
 // 5.1.10: Fix and modify builtin metrics.
 // 5.2.0: Fix agent orphan processes problem and add /v1/tail API
 // 6.0.0: Use new plugin/git repo updating mechanism.
+// 6.1.0: Buffer metrics locally and replay them when transfers are unreachable.
+// 6.2.0: Collect the resources of the processes configured by proc.* strategies.
+// 6.3.0: Native HTTP/TCP/DNS/TLS checks, url.check.health does not use curl any more.
+// 6.4.0: Count the lines of the log files matching the log.match.* strategies.
+// 7.0.0: Replace /run with the signed and audited remote commands.
 const (
-	VERSION          = "6.0.0"
+	VERSION          = "7.0.0"
 	COLLECT_INTERVAL = time.Second
 	URL_CHECK_HEALTH = "url.check.health"
 	NET_PORT_LISTEN  = "net.port.listen"
 	DU_BS            = "du.bs"
 	PROC_NUM         = "proc.num"
+	PROC_PREFIX      = "proc."
+	HTTP_CHECK       = "http.check"
+	TCP_CHECK        = "tcp.check"
+	DNS_CHECK        = "dns.check"
+	TLS_CHECK        = "tls.check"
+	LOG_MATCH        = "log.match"
 )
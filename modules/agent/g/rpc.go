@@ -1,6 +1,7 @@
 package g
 
 import (
+	"fmt"
 	log "github.com/Sirupsen/logrus"
 	"github.com/toolkits/net"
 	"math"
@@ -14,6 +15,8 @@ type SingleConnRpcClient struct {
 	rpcClient *rpc.Client
 	RpcServer string
 	Timeout   time.Duration
+	// 连接失败时直接返回错误, 不阻塞重试
+	FailFast bool
 }
 
 func (this *SingleConnRpcClient) close() {
@@ -23,9 +26,9 @@ func (this *SingleConnRpcClient) close() {
 	}
 }
 
-func (this *SingleConnRpcClient) insureConn() {
+func (this *SingleConnRpcClient) insureConn() error {
 	if this.rpcClient != nil {
-		return
+		return nil
 	}
 
 	var err error
@@ -33,15 +36,18 @@ func (this *SingleConnRpcClient) insureConn() {
 
 	for {
 		if this.rpcClient != nil {
-			return
+			return nil
 		}
 
 		this.rpcClient, err = net.JsonRpcClient("tcp", this.RpcServer, this.Timeout)
 		if err == nil {
-			return
+			return nil
 		}
 
 		log.Printf("dial %s fail: %v", this.RpcServer, err)
+		if this.FailFast {
+			return err
+		}
 
 		if retry > 6 {
 			retry = 1
@@ -58,7 +64,9 @@ func (this *SingleConnRpcClient) Call(method string, args interface{}, reply int
 	this.Lock()
 	defer this.Unlock()
 
-	this.insureConn()
+	if err := this.insureConn(); err != nil {
+		return err
+	}
 
 	timeout := time.Duration(50 * time.Second)
 	done := make(chan error, 1)
@@ -72,6 +80,7 @@ func (this *SingleConnRpcClient) Call(method string, args interface{}, reply int
 	case <-time.After(timeout):
 		log.Printf("[WARN] rpc call timeout %v => %v", this.rpcClient, this.RpcServer)
 		this.close()
+		return fmt.Errorf("call %s timeout", this.RpcServer)
 	case err := <-done:
 		if err != nil {
 			this.close()
@@ -14,7 +14,8 @@ var (
 	TransferClients map[string]*SingleConnRpcClient = map[string]*SingleConnRpcClient{}
 )
 
-func SendMetrics(metrics []*model.MetricValue, resp *model.TransferResponse) {
+// SendMetrics sends the metrics to one of the transfers, false if all of them fail
+func SendMetrics(metrics []*model.MetricValue, resp *model.TransferResponse) bool {
 	rand.Seed(time.Now().UnixNano())
 	for _, i := range rand.Perm(len(Config().Transfer.Addrs)) {
 		addr := Config().Transfer.Addrs[i]
@@ -22,9 +23,10 @@ func SendMetrics(metrics []*model.MetricValue, resp *model.TransferResponse) {
 			initTransferClient(addr)
 		}
 		if updateMetrics(addr, metrics, resp) {
-			break
+			return true
 		}
 	}
+	return false
 }
 
 func initTransferClient(addr string) {
@@ -33,6 +35,7 @@ func initTransferClient(addr string) {
 	TransferClients[addr] = &SingleConnRpcClient{
 		RpcServer: addr,
 		Timeout:   time.Duration(Config().Transfer.Timeout) * time.Millisecond,
+		FailFast:  true,
 	}
 }
 
@@ -66,8 +66,16 @@ func SendToTransfer(metrics []*model.MetricValue) {
 		log.Printf("=> <Total=%d> %v\n", len(metrics), metrics[0])
 	}
 
+	// 缓存中有更早的数据时, 排在它们之后发送
+	if buffer != nil && buffer.pending() {
+		buffer.push(metrics)
+		return
+	}
+
 	var resp model.TransferResponse
-	SendMetrics(metrics, &resp)
+	if !SendMetrics(metrics, &resp) && buffer != nil {
+		buffer.push(metrics)
+	}
 
 	if debug {
 		log.Println("<=", &resp)
@@ -145,6 +153,72 @@ func SetReportProcs(procs map[string]map[int]string) {
 	reportProcs = procs
 }
 
+var (
+	// the process groups of which the resources are collected, same as reportProcs
+	reportProcStats     map[string]map[int]string
+	reportProcStatsLock = new(sync.RWMutex)
+)
+
+func ReportProcStats() map[string]map[int]string {
+	reportProcStatsLock.RLock()
+	defer reportProcStatsLock.RUnlock()
+	return reportProcStats
+}
+
+func SetReportProcStats(procs map[string]map[int]string) {
+	reportProcStatsLock.Lock()
+	defer reportProcStatsLock.Unlock()
+	reportProcStats = procs
+}
+
+// Probe is a synthetic check configured by the strategies of http.check.*, tcp.check.*, dns.check.* or tls.check.*
+type Probe struct {
+	Type   string // HTTP_CHECK, TCP_CHECK, DNS_CHECK or TLS_CHECK
+	Tags   string
+	Params map[string]string
+}
+
+var (
+	reportProbes     map[string]*Probe
+	reportProbesLock = new(sync.RWMutex)
+)
+
+func ReportProbes() map[string]*Probe {
+	reportProbesLock.RLock()
+	defer reportProbesLock.RUnlock()
+	return reportProbes
+}
+
+func SetReportProbes(probes map[string]*Probe) {
+	reportProbesLock.Lock()
+	defer reportProbesLock.Unlock()
+	reportProbes = probes
+}
+
+// LogRule is configured by the strategies of log.match.*, Tags are the sorted tags of the strategy
+type LogRule struct {
+	Tags    string
+	Path    string
+	Pattern string
+}
+
+var (
+	reportLogRules     map[string]*LogRule
+	reportLogRulesLock = new(sync.RWMutex)
+)
+
+func ReportLogRules() map[string]*LogRule {
+	reportLogRulesLock.RLock()
+	defer reportLogRulesLock.RUnlock()
+	return reportLogRules
+}
+
+func SetReportLogRules(rules map[string]*LogRule) {
+	reportLogRulesLock.Lock()
+	defer reportLogRulesLock.Unlock()
+	reportLogRules = rules
+}
+
 var (
 	ips     []string
 	ipsLock = new(sync.Mutex)
@@ -0,0 +1,17 @@
+package http
+
+import (
+	"github.com/Cepave/open-falcon-backend/modules/agent/g"
+	"net/http"
+)
+
+func configBufferRoutes() {
+	http.HandleFunc("/buffer", func(w http.ResponseWriter, r *http.Request) {
+		stat := g.GetBufferStat()
+		if stat == nil {
+			RenderMsgJson(w, "buffer is disabled")
+			return
+		}
+		RenderDataJson(w, stat)
+	})
+}
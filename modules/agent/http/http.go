@@ -15,6 +15,7 @@ type Dto struct {
 
 func init() {
 	configAdminRoutes()
+	configBufferRoutes()
 	configCpuRoutes()
 	configDfRoutes()
 	configHealthRoutes()
@@ -24,7 +25,7 @@ func init() {
 	configPageRoutes()
 	configPluginRoutes()
 	configPushRoutes()
-	configRunRoutes()
+	configRemoteRoutes()
 	configSystemRoutes()
 	configTailRoutes()
 }
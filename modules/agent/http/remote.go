@@ -0,0 +1,35 @@
+package http
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/Cepave/open-falcon-backend/modules/agent/remote"
+)
+
+func configRemoteRoutes() {
+	http.HandleFunc("/v1/remote/run", func(w http.ResponseWriter, r *http.Request) {
+		if !remote.Enabled() {
+			w.Write([]byte("remote command disabled"))
+			return
+		}
+		if r.Method != "POST" {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req remote.Request
+		if err := json.NewDecoder(io.LimitReader(r.Body, 64*1024)).Decode(&req); err != nil {
+			http.Error(w, "cannot decode body", http.StatusBadRequest)
+			return
+		}
+
+		ret, err := remote.Execute(&req, r.RemoteAddr)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		RenderDataJson(w, ret)
+	})
+}
@@ -0,0 +1,273 @@
+// Package logwatch counts the lines of the log files matching the rules.
+//
+// Every file is read from the last position at each collection. The files are followed by the device and
+// the inode, so a rotated file is read to the end and counted to its old path, and it is not read again
+// if it still matches the path(e.g. app.log.1 of app.log*).
+// The positions are saved in the checkpoint file, so restarting does not count the lines twice.
+package logwatch
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+type Rule struct {
+	Name    string // the key of the rule, e.g. the tags of the strategy
+	Path    string // file or glob
+	Pattern *regexp.Regexp
+}
+
+// Result is the lines of a file matching a rule since the last collection.
+// If the pattern has a capture group, the first group is parsed as a number.
+type Result struct {
+	Rule   *Rule
+	File   string
+	Count  int64
+	Values int64 // numbers of the capture group
+	Sum    float64
+	Max    float64
+}
+
+func (this *Result) Avg() float64 {
+	if this.Values == 0 {
+		return 0
+	}
+	return this.Sum / float64(this.Values)
+}
+
+type position struct {
+	Path   string `json:"path"`
+	Offset int64  `json:"offset"`
+}
+
+type Watcher struct {
+	sync.Mutex
+	checkpoint string
+	positions  map[string]*position // from the checkpoint file
+	tailers    map[string]*tailer
+	rules      map[string]bool // the rules collected before
+}
+
+func NewWatcher(checkpoint string) *Watcher {
+	w := &Watcher{
+		checkpoint: checkpoint,
+		positions:  map[string]*position{},
+		tailers:    map[string]*tailer{},
+		rules:      map[string]bool{},
+	}
+	if bs, err := ioutil.ReadFile(checkpoint); err == nil {
+		if err := json.Unmarshal(bs, &w.positions); err != nil {
+			log.Printf("load checkpoint %s fail: %v", checkpoint, err)
+		}
+	}
+	return w
+}
+
+// tailerKey identifies the file by the device and the inode, so the rotated file is not read again by the new path
+func tailerKey(rule *Rule, info os.FileInfo) string {
+	dev, ino := fileId(info)
+	return rule.Name + "|" + strconv.FormatUint(dev, 10) + ":" + strconv.FormatUint(ino, 10)
+}
+
+// Collect reads the files of the rules, and closes the files which are not in the rules any more
+func (this *Watcher) Collect(rules []*Rule) []*Result {
+	this.Lock()
+	defer this.Unlock()
+
+	results := []*Result{}
+	tailers := map[string]*tailer{}
+	rulesSeen := map[string]bool{}
+	for _, rule := range rules {
+		files, err := filepath.Glob(rule.Path)
+		if err != nil {
+			log.Printf("bad path %s of rule %s: %v", rule.Path, rule.Name, err)
+			continue
+		}
+		// 规则第一次采集时已经存在的文件从末尾开始读, 之后新出现的文件从头开始读
+		fromStart := this.rules[rule.Name]
+		rulesSeen[rule.Name] = true
+
+		// 同一个文件(inode)只读一次, 例如轮转后的app.log.1仍然匹配时, 从原来的位置继续读
+		keys := make([]string, len(files))
+		matched := map[string]bool{}
+		for i, file := range files {
+			if info, err := os.Stat(file); err == nil && !matched[tailerKey(rule, info)] {
+				keys[i] = tailerKey(rule, info)
+				matched[keys[i]] = true
+			}
+		}
+		// 已经不匹配的文件(被轮转走了), 读完剩余的行计入原来的路径
+		rotated := map[string]*tailer{}
+		for key, t := range this.tailers {
+			if t.rule == rule.Name && !matched[key] {
+				rotated[t.path] = t
+				delete(this.tailers, key)
+			}
+		}
+
+		for i, file := range files {
+			key := keys[i]
+			if key == "" {
+				continue
+			}
+			result := &Result{Rule: rule, File: file, Max: math.Inf(-1)}
+			if old, ok := rotated[file]; ok {
+				log.Printf("%s is rotated", file)
+				old.poll(result)
+				old.file.Close()
+				delete(rotated, file)
+			}
+
+			t, ok := this.tailers[key]
+			if !ok {
+				if t, err = openTailer(rule.Name, file, this.positions[key], fromStart || this.known(rule, file)); err != nil {
+					log.Printf("open %s fail: %v", file, err)
+					continue
+				}
+			}
+			delete(this.tailers, key)
+			tailers[key] = t
+
+			t.path = file
+			t.poll(result)
+			results = append(results, result)
+		}
+		for path, old := range rotated {
+			result := &Result{Rule: rule, File: path, Max: math.Inf(-1)}
+			old.poll(result)
+			old.file.Close()
+			results = append(results, result)
+		}
+	}
+	for _, result := range results {
+		if result.Values == 0 {
+			result.Max = 0
+		}
+	}
+
+	for _, t := range this.tailers {
+		t.file.Close()
+	}
+	this.tailers = tailers
+	this.rules = rulesSeen
+	this.save()
+	return results
+}
+
+// known tells whether the path was followed before restarting, then the file of the path is rotated while the agent is down
+func (this *Watcher) known(rule *Rule, path string) bool {
+	for key, pos := range this.positions {
+		if pos.Path == path && strings.HasPrefix(key, rule.Name+"|") {
+			return true
+		}
+	}
+	return false
+}
+
+func (this *Watcher) save() {
+	this.positions = map[string]*position{}
+	for key, t := range this.tailers {
+		this.positions[key] = &position{Path: t.path, Offset: t.offset}
+	}
+	bs, _ := json.Marshal(this.positions)
+	tmp := this.checkpoint + ".tmp"
+	err := os.MkdirAll(filepath.Dir(this.checkpoint), 0755)
+	if err == nil {
+		err = ioutil.WriteFile(tmp, bs, 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp, this.checkpoint)
+	}
+	if err != nil {
+		log.Printf("save checkpoint %s fail: %v", this.checkpoint, err)
+	}
+}
+
+type tailer struct {
+	file   *os.File
+	rule   string
+	path   string // the path matched at the last collection
+	offset int64
+}
+
+func fileId(info os.FileInfo) (dev, ino uint64) {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Dev), st.Ino
+	}
+	return 0, 0
+}
+
+// openTailer restores the position of the file, the file is read from the end if it is new and not fromStart
+func openTailer(rule, path string, pos *position, fromStart bool) (*tailer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	t := &tailer{file: f, rule: rule, path: path}
+	switch {
+	case pos != nil && pos.Offset <= info.Size():
+		t.offset = pos.Offset
+	case pos != nil || fromStart:
+		t.offset = 0
+	default:
+		t.offset = info.Size()
+	}
+	return t, nil
+}
+
+// poll reads the file(maybe rotated) to the end
+func (this *tailer) poll(result *Result) {
+	if info, err := this.file.Stat(); err == nil && info.Size() < this.offset {
+		log.Printf("%s is truncated", this.path)
+		this.offset = 0
+	}
+	this.read(result)
+}
+
+// read matches the complete lines after the offset
+func (this *tailer) read(result *Result) {
+	r := bufio.NewReader(io.NewSectionReader(this.file, this.offset, math.MaxInt64-this.offset))
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("read %s fail: %v", this.file.Name(), err)
+			}
+			return
+		}
+		this.offset += int64(len(line))
+
+		m := result.Rule.Pattern.FindSubmatch(bytes.TrimRight(line, "\r\n"))
+		if m == nil {
+			continue
+		}
+		result.Count++
+		if len(m) < 2 {
+			continue
+		}
+		if v, err := strconv.ParseFloat(string(m[1]), 64); err == nil {
+			result.Values++
+			result.Sum += v
+			result.Max = math.Max(result.Max, v)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package logwatch
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func appendFile(t *testing.T, path, content string) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(content)
+	f.Close()
+}
+
+func collectOne(t *testing.T, w *Watcher, rule *Rule) *Result {
+	results := w.Collect([]*Rule{rule})
+	if len(results) != 1 {
+		t.Fatalf("expected 1 result, got %d", len(results))
+	}
+	return results[0]
+}
+
+func TestWatcher(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logwatch")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+	checkpoint := filepath.Join(dir, "var", "logwatch.json")
+	rule := &Rule{Name: "slow", Path: filepath.Join(dir, "*.log"), Pattern: regexp.MustCompile(`slow request cost=(\d+)ms`)}
+
+	// the existing lines are skipped
+	appendFile(t, path, "slow request cost=1000ms\n")
+	w := NewWatcher(checkpoint)
+	if r := collectOne(t, w, rule); r.Count != 0 {
+		t.Errorf("existing lines are counted: %+v", r)
+	}
+
+	appendFile(t, path, "slow request cost=100ms\nok\nslow request cost=300ms\nslow request cost=")
+	r := collectOne(t, w, rule)
+	if r.File != path || r.Count != 2 || r.Sum != 400 || r.Max != 300 || r.Avg() != 200 {
+		t.Errorf("unexpected result: %+v", r)
+	}
+
+	// the incomplete line, and the rotated file
+	appendFile(t, path, "abc ms\n")
+	os.Rename(path, path+".1")
+	appendFile(t, path, "slow request cost=50ms\n")
+	if r := collectOne(t, w, rule); r.Count != 1 || r.Sum != 50 {
+		t.Errorf("unexpected result after rotating: %+v", r)
+	}
+	appendFile(t, path+".1", "slow request cost=10ms\n")
+	appendFile(t, path, "slow request cost=20ms\n")
+	if r := collectOne(t, w, rule); r.Count != 1 || r.Sum != 20 {
+		t.Errorf("the rotated file is read: %+v", r)
+	}
+
+	// truncated
+	os.Truncate(path, 0)
+	appendFile(t, path, "slow request cost=1ms\n")
+	if r := collectOne(t, w, rule); r.Count != 1 || r.Sum != 1 {
+		t.Errorf("unexpected result after truncating: %+v", r)
+	}
+
+	// restart
+	appendFile(t, path, "slow request cost=2ms\n")
+	w = NewWatcher(checkpoint)
+	if r := collectOne(t, w, rule); r.Count != 1 || r.Sum != 2 {
+		t.Errorf("unexpected result after restarting: %+v", r)
+	}
+}
+
+func TestWatcherNewFile(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logwatch")
+	defer os.RemoveAll(dir)
+	rule := &Rule{Name: "error", Path: filepath.Join(dir, "*.log"), Pattern: regexp.MustCompile(`ERROR`)}
+
+	w := NewWatcher(filepath.Join(dir, "logwatch.json"))
+	if results := w.Collect([]*Rule{rule}); len(results) != 0 {
+		t.Errorf("unexpected results: %v", results)
+	}
+	// the files created after the first collection are read from the start
+	appendFile(t, filepath.Join(dir, "a.log"), "ERROR 1\nINFO 2\nERROR 3\n")
+	if r := collectOne(t, w, rule); r.Count != 2 || r.Values != 0 || r.Max != 0 {
+		t.Errorf("unexpected result: %+v", r)
+	}
+}
+
+func TestWatcherRotatedMatched(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logwatch")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+	rule := &Rule{Name: "error", Path: filepath.Join(dir, "app.log*"), Pattern: regexp.MustCompile(`ERROR`)}
+
+	w := NewWatcher(filepath.Join(dir, "logwatch.json"))
+	w.Collect([]*Rule{rule})
+	appendFile(t, path, "ERROR 1\nERROR 2\n")
+	if r := collectOne(t, w, rule); r.Count != 2 {
+		t.Errorf("unexpected result: %+v", r)
+	}
+
+	// app.log.1 still matches the rule after rotating, only the new lines of it are counted
+	appendFile(t, path, "ERROR 3\n")
+	os.Rename(path, path+".1")
+	appendFile(t, path, "ERROR 4\n")
+	counts := map[string]int64{}
+	for _, r := range w.Collect([]*Rule{rule}) {
+		counts[r.File] += r.Count
+	}
+	if len(counts) != 2 || counts[path] != 1 || counts[path+".1"] != 1 {
+		t.Errorf("unexpected results after rotating: %v", counts)
+	}
+
+	// a hard link of the followed file is not read twice
+	os.Link(path, path+".bak")
+	appendFile(t, path, "ERROR 5\n")
+	total := int64(0)
+	for _, r := range w.Collect([]*Rule{rule}) {
+		total += r.Count
+	}
+	if total != 1 {
+		t.Errorf("expected 1 line, got %d", total)
+	}
+}
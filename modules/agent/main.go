@@ -8,6 +8,7 @@ import (
 	"github.com/Cepave/open-falcon-backend/modules/agent/funcs"
 	"github.com/Cepave/open-falcon-backend/modules/agent/g"
 	"github.com/Cepave/open-falcon-backend/modules/agent/http"
+	"github.com/Cepave/open-falcon-backend/modules/agent/remote"
 	"os"
 )
 
@@ -32,6 +33,8 @@ func main() {
 	g.InitRootDir()
 	g.InitPublicIps()
 	g.InitRpcClients()
+	g.InitBuffer()
+	remote.Init()
 
 	funcs.BuildMappers()
 
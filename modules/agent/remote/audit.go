@@ -0,0 +1,106 @@
+package remote
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Cepave/open-falcon-backend/common/model"
+	"github.com/Cepave/open-falcon-backend/modules/agent/g"
+	log "github.com/Sirupsen/logrus"
+)
+
+var (
+	verifier  *Verifier
+	auditLog  *os.File
+	auditLock = new(sync.Mutex)
+)
+
+func absPath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(g.Root, path)
+}
+
+func Init() {
+	cfg := g.Config().Remote
+	if cfg == nil || !cfg.Enabled {
+		return
+	}
+
+	key, err := LoadPublicKey(absPath(cfg.PublicKey))
+	if err != nil {
+		log.Fatalln("load public key of remote commands fail:", err)
+	}
+
+	filename := absPath(cfg.Log)
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		log.Fatalln("create dir of the audit log fail:", err)
+	}
+	if auditLog, err = os.OpenFile(filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600); err != nil {
+		log.Fatalln("open the audit log fail:", err)
+	}
+
+	verifier, err = NewVerifier(key, cfg.Commands, time.Duration(cfg.MaxTTL)*time.Second, filepath.Join(g.Root, "var", "remote_nonces.json"))
+	if err != nil {
+		log.Fatalln("init the verifier of remote commands fail:", err)
+	}
+}
+
+func Enabled() bool {
+	return verifier != nil
+}
+
+// Execute verifies and runs the request, every request(even rejected) is logged and reported to HBS
+func Execute(req *Request, remoteAddr string) (*Result, error) {
+	cfg := g.Config().Remote
+	hostname, _ := g.Hostname()
+	report := &model.AgentCommandReport{
+		Hostname:   hostname,
+		Caller:     req.Caller,
+		RemoteAddr: remoteAddr,
+		Command:    req.Command,
+		Nonce:      req.Nonce,
+		ExitCode:   -1,
+		Timestamp:  time.Now().Unix(),
+	}
+
+	args, err := verifier.Check(req, hostname, time.Now())
+	if err != nil {
+		report.Error = err.Error()
+		audit(report)
+		return nil, err
+	}
+	report.Args = args
+
+	ret := Run(args, time.Duration(cfg.Timeout)*time.Second, cfg.MaxOutput)
+	report.ExitCode = ret.ExitCode
+	report.Duration = ret.Duration
+	report.Timeout = ret.Timeout
+	report.Error = ret.Error
+	audit(report)
+	return ret, nil
+}
+
+func audit(report *model.AgentCommandReport) {
+	bs, _ := json.Marshal(report)
+	auditLock.Lock()
+	if _, err := auditLog.Write(append(bs, '\n')); err != nil {
+		log.Errorln("write the audit log fail:", err, report)
+	}
+	auditLock.Unlock()
+	log.Println("remote command:", report)
+
+	if g.HbsClient == nil {
+		return
+	}
+	go func() {
+		var resp model.SimpleRpcResponse
+		if err := g.HbsClient.Call("Agent.ReportCommand", report, &resp); err != nil || resp.Code != 0 {
+			log.Errorln("call Agent.ReportCommand fail:", err, "Request:", report)
+		}
+	}()
+}
@@ -0,0 +1,71 @@
+package remote
+
+import (
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+type Result struct {
+	ExitCode  int    `json:"exit_code"` // -1 if the command is not executed or killed
+	Output    string `json:"output"`    // stdout and stderr
+	Truncated bool   `json:"truncated"`
+	Timeout   bool   `json:"timeout"`
+	Duration  int64  `json:"duration"` // ms
+	Error     string `json:"error"`
+}
+
+// limitedBuffer keeps the first max bytes
+type limitedBuffer struct {
+	buf       []byte
+	max       int
+	truncated bool
+}
+
+func (this *limitedBuffer) Write(p []byte) (int, error) {
+	if free := this.max - len(this.buf); free < len(p) {
+		this.buf = append(this.buf, p[:free]...)
+		this.truncated = true
+	} else {
+		this.buf = append(this.buf, p...)
+	}
+	return len(p), nil
+}
+
+// Run executes the command in a new session, and kills the session on timeout
+func Run(args []string, timeout time.Duration, maxOutput int) *Result {
+	ret := &Result{ExitCode: -1}
+	out := &limitedBuffer{max: maxOutput}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+
+	start := time.Now()
+	if err := cmd.Start(); err != nil {
+		ret.Error = err.Error()
+		return ret
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	var err error
+	select {
+	case <-time.After(timeout):
+		ret.Timeout = true
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		err = <-done
+	case err = <-done:
+	}
+	ret.Duration = int64(time.Since(start) / time.Millisecond)
+	ret.Output, ret.Truncated = string(out.buf), out.truncated
+
+	if status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); ok && status.Exited() {
+		ret.ExitCode = status.ExitStatus()
+	}
+	if err != nil {
+		ret.Error = err.Error()
+	}
+	return ret
+}
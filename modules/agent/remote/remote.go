@@ -0,0 +1,223 @@
+// Package remote executes the commands signed by the portal.
+//
+// A request names a command in the allowlist of the agent, and carries the parameters of the
+// command template, the target hostname, an expiry and a nonce. The payload is signed by the
+// RSA private key(PKCS#1 v1.5, SHA-256), and verified by the public key configured on the agent.
+// The command is executed without shell, so the parameters can not inject other commands.
+package remote
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Request struct {
+	Hostname  string            `json:"hostname"`
+	Caller    string            `json:"caller"`
+	Command   string            `json:"command"`
+	Params    map[string]string `json:"params"`
+	Expire    int64             `json:"expire"` // unix timestamp
+	Nonce     string            `json:"nonce"`
+	Signature string            `json:"signature"` // base64
+}
+
+// Payload is the signed content: hostname, caller, command, the sorted params(k=v joined by &),
+// expire and nonce, joined by \n
+func (this *Request) Payload() []byte {
+	keys := make([]string, 0, len(this.Params))
+	for k := range this.Params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	params := make([]string, len(keys))
+	for i, k := range keys {
+		params[i] = k + "=" + this.Params[k]
+	}
+
+	return []byte(strings.Join([]string{
+		this.Hostname,
+		this.Caller,
+		this.Command,
+		strings.Join(params, "&"),
+		strconv.FormatInt(this.Expire, 10),
+		this.Nonce,
+	}, "\n"))
+}
+
+var (
+	paramKeyPattern   = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+	paramValuePattern = regexp.MustCompile(`^[A-Za-z0-9_.,:/@+-]*$`)
+	placeholder       = regexp.MustCompile(`\{([A-Za-z0-9_]+)\}`)
+)
+
+// Verifier checks the requests, a nonce can be used once before the expiry.
+// The used nonces are saved in nonceFile, so the requests can not be replayed after the agent restarts.
+type Verifier struct {
+	sync.Mutex
+	key       *rsa.PublicKey
+	commands  map[string][]string
+	maxTTL    time.Duration
+	nonceFile string           // empty if the nonces are kept in memory only
+	nonces    map[string]int64 // nonce => expire
+}
+
+func NewVerifier(key *rsa.PublicKey, commands map[string][]string, maxTTL time.Duration, nonceFile string) (*Verifier, error) {
+	v := &Verifier{
+		key:       key,
+		commands:  commands,
+		maxTTL:    maxTTL,
+		nonceFile: nonceFile,
+		nonces:    map[string]int64{},
+	}
+	if nonceFile == "" {
+		return v, nil
+	}
+	bs, err := ioutil.ReadFile(nonceFile)
+	if os.IsNotExist(err) {
+		return v, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// 文件损坏时无法确认哪些nonce已经使用过, 拒绝启动
+	if err = json.Unmarshal(bs, &v.nonces); err != nil {
+		return nil, fmt.Errorf("load nonces from %s fail: %v", nonceFile, err)
+	}
+	return v, nil
+}
+
+// LoadPublicKey reads the RSA public key in PEM(PKIX)
+func LoadPublicKey(filename string) (*rsa.PublicKey, error) {
+	bs, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(bs)
+	if block == nil {
+		return nil, fmt.Errorf("no pem block in %s", filename)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a rsa public key", filename)
+	}
+	return rsaKey, nil
+}
+
+// Check verifies the request for the host, and returns the arguments of the command
+func (this *Verifier) Check(req *Request, hostname string, now time.Time) ([]string, error) {
+	if req.Hostname != hostname {
+		return nil, fmt.Errorf("the request is for %s", req.Hostname)
+	}
+	if req.Caller == "" || req.Nonce == "" {
+		return nil, errors.New("caller and nonce are required")
+	}
+	if strings.ContainsAny(req.Caller+req.Command+req.Nonce, "\n") {
+		return nil, errors.New("bad caller, command or nonce")
+	}
+	if req.Expire < now.Unix() {
+		return nil, errors.New("the request is expired")
+	}
+	if req.Expire > now.Add(this.maxTTL).Unix() {
+		return nil, fmt.Errorf("the expiry is longer than %v", this.maxTTL)
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(req.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("bad signature: %v", err)
+	}
+	hashed := sha256.Sum256(req.Payload())
+	if err := rsa.VerifyPKCS1v15(this.key, crypto.SHA256, hashed[:], sig); err != nil {
+		return nil, errors.New("invalid signature")
+	}
+
+	args, err := this.render(req)
+	if err != nil {
+		return nil, err
+	}
+
+	this.Lock()
+	defer this.Unlock()
+	for nonce, expire := range this.nonces {
+		if expire < now.Unix() {
+			delete(this.nonces, nonce)
+		}
+	}
+	if _, ok := this.nonces[req.Nonce]; ok {
+		return nil, errors.New("the nonce is used")
+	}
+	this.nonces[req.Nonce] = req.Expire
+	// the command is not executed if the nonce is not saved
+	if err := this.saveNonces(); err != nil {
+		delete(this.nonces, req.Nonce)
+		return nil, fmt.Errorf("save nonces fail: %v", err)
+	}
+	return args, nil
+}
+
+func (this *Verifier) saveNonces() error {
+	if this.nonceFile == "" {
+		return nil
+	}
+	bs, _ := json.Marshal(this.nonces)
+	tmp := this.nonceFile + ".tmp"
+	err := os.MkdirAll(filepath.Dir(this.nonceFile), 0755)
+	if err == nil {
+		err = ioutil.WriteFile(tmp, bs, 0600)
+	}
+	if err == nil {
+		err = os.Rename(tmp, this.nonceFile)
+	}
+	return err
+}
+
+// render replaces {name} in the template by the param, every placeholder must have a param.
+// The params can not be options(-x) or go up the directories(..)
+func (this *Verifier) render(req *Request) ([]string, error) {
+	tpl, ok := this.commands[req.Command]
+	if !ok || len(tpl) == 0 {
+		return nil, fmt.Errorf("command %s is not allowed", req.Command)
+	}
+	for k, v := range req.Params {
+		if !paramKeyPattern.MatchString(k) || !paramValuePattern.MatchString(v) ||
+			strings.HasPrefix(v, "-") || strings.Contains(v, "..") {
+			return nil, fmt.Errorf("bad param %s=%s", k, v)
+		}
+	}
+
+	args := make([]string, len(tpl))
+	var missing string
+	for i, arg := range tpl {
+		args[i] = placeholder.ReplaceAllStringFunc(arg, func(s string) string {
+			name := s[1 : len(s)-1]
+			v, ok := req.Params[name]
+			if !ok {
+				missing = name
+			}
+			return v
+		})
+	}
+	if missing != "" {
+		return nil, fmt.Errorf("param %s is required", missing)
+	}
+	return args, nil
+}
@@ -0,0 +1,192 @@
+package remote
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func sign(t *testing.T, key *rsa.PrivateKey, req *Request) {
+	hashed := sha256.Sum256(req.Payload())
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Signature = base64.StdEncoding.EncodeToString(sig)
+}
+
+func TestVerifier(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := NewVerifier(&key.PublicKey, map[string][]string{
+		"tail-log": {"tail", "-n", "{lines}", "/home/work/logs/{file}"},
+	}, 5*time.Minute, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+
+	newRequest := func(nonce string, params map[string]string) *Request {
+		req := &Request{
+			Hostname: "host-1",
+			Caller:   "ops",
+			Command:  "tail-log",
+			Params:   params,
+			Expire:   now.Unix() + 60,
+			Nonce:    nonce,
+		}
+		sign(t, key, req)
+		return req
+	}
+
+	req := newRequest("n1", map[string]string{"lines": "100", "file": "app.log"})
+	args, err := v.Check(req, "host-1", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(args, " ") != "tail -n 100 /home/work/logs/app.log" {
+		t.Errorf("unexpected args: %v", args)
+	}
+	if _, err := v.Check(req, "host-1", now); err == nil {
+		t.Error("the nonce is replayed")
+	}
+
+	cases := []struct {
+		req      *Request
+		hostname string
+		now      time.Time
+	}{
+		// other host
+		{newRequest("n2", map[string]string{"lines": "1", "file": "a"}), "host-2", now},
+		// expired
+		{newRequest("n3", map[string]string{"lines": "1", "file": "a"}), "host-1", now.Add(2 * time.Minute)},
+		// bad params
+		{newRequest("n4", map[string]string{"lines": "1", "file": "../../etc/shadow"}), "host-1", now},
+		{newRequest("n5", map[string]string{"lines": "-f", "file": "a"}), "host-1", now},
+		{newRequest("n6", map[string]string{"lines": "1;reboot", "file": "a"}), "host-1", now},
+		{newRequest("n7", map[string]string{"lines": "1"}), "host-1", now},
+	}
+	for i, c := range cases {
+		if _, err := v.Check(c.req, c.hostname, c.now); err == nil {
+			t.Errorf("case %d: expected error", i)
+		}
+	}
+
+	// tampered
+	req = newRequest("n8", map[string]string{"lines": "1", "file": "a"})
+	req.Params["file"] = "b"
+	if _, err := v.Check(req, "host-1", now); err == nil || err.Error() != "invalid signature" {
+		t.Errorf("expected invalid signature, got %v", err)
+	}
+	// not allowed
+	req = &Request{Hostname: "host-1", Caller: "ops", Command: "reboot", Expire: now.Unix() + 60, Nonce: "n9"}
+	sign(t, key, req)
+	if _, err := v.Check(req, "host-1", now); err == nil {
+		t.Error("expected error of the command not allowed")
+	}
+	// too long expiry
+	req = &Request{Hostname: "host-1", Caller: "ops", Command: "tail-log", Expire: now.Unix() + 3600, Nonce: "n10"}
+	sign(t, key, req)
+	if _, err := v.Check(req, "host-1", now); err == nil {
+		t.Error("expected error of the expiry")
+	}
+}
+
+func TestVerifierNonceFile(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	nonceFile := filepath.Join(dir, "var", "remote_nonces.json")
+	commands := map[string][]string{"uptime": {"uptime"}}
+	now := time.Now()
+
+	newRequest := func(nonce string, expire int64) *Request {
+		req := &Request{Hostname: "host-1", Caller: "ops", Command: "uptime", Expire: expire, Nonce: nonce}
+		sign(t, key, req)
+		return req
+	}
+
+	v, err := NewVerifier(&key.PublicKey, commands, 5*time.Minute, nonceFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := newRequest("n1", now.Unix()+60)
+	if _, err := v.Check(req, "host-1", now); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重启之后nonce仍然不能重复使用
+	v, err = NewVerifier(&key.PublicKey, commands, 5*time.Minute, nonceFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Check(req, "host-1", now); err == nil || err.Error() != "the nonce is used" {
+		t.Errorf("expected error of the used nonce, got %v", err)
+	}
+
+	// 过期的nonce被清理
+	later := now.Add(2 * time.Minute)
+	if _, err := v.Check(newRequest("n2", later.Unix()+60), "host-1", later); err != nil {
+		t.Fatal(err)
+	}
+	v, _ = NewVerifier(&key.PublicKey, commands, 5*time.Minute, nonceFile)
+	if _, ok := v.nonces["n1"]; ok || len(v.nonces) != 1 {
+		t.Errorf("unexpected nonces: %v", v.nonces)
+	}
+
+	if err := ioutil.WriteFile(nonceFile, []byte(`{"n1": `), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewVerifier(&key.PublicKey, commands, 5*time.Minute, nonceFile); err == nil {
+		t.Error("expected error of the broken nonce file")
+	}
+
+	// nonce无法保存时不执行命令
+	nonceFile = filepath.Join(dir, "nonces.json")
+	v, _ = NewVerifier(&key.PublicKey, commands, 5*time.Minute, nonceFile)
+	os.MkdirAll(nonceFile+".tmp", 0755)
+	if _, err := v.Check(newRequest("n3", now.Unix()+60), "host-1", now); err == nil {
+		t.Error("expected error of saving nonces")
+	}
+	if len(v.nonces) != 0 {
+		t.Errorf("the unsaved nonce is kept: %v", v.nonces)
+	}
+}
+
+func TestRun(t *testing.T) {
+	ret := Run([]string{"sh", "-c", "echo hello; exit 3"}, time.Second, 1024)
+	if ret.ExitCode != 3 || ret.Output != "hello\n" || ret.Timeout || ret.Truncated {
+		t.Errorf("unexpected result: %+v", ret)
+	}
+
+	ret = Run([]string{"sh", "-c", "yes | head -c 10000"}, time.Second, 100)
+	if ret.ExitCode != 0 || len(ret.Output) != 100 || !ret.Truncated {
+		t.Errorf("unexpected result: %+v", ret)
+	}
+
+	ret = Run([]string{"sh", "-c", "sleep 10"}, 100*time.Millisecond, 100)
+	if !ret.Timeout || ret.ExitCode != -1 || ret.Duration >= 5000 {
+		t.Errorf("unexpected result: %+v", ret)
+	}
+
+	ret = Run([]string{"/no/such/command"}, time.Second, 100)
+	if ret.ExitCode != -1 || ret.Error == "" {
+		t.Errorf("unexpected result: %+v", ret)
+	}
+}
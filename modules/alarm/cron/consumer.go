@@ -4,9 +4,11 @@ import (
 	"encoding/json"
 	"github.com/Cepave/open-falcon-backend/modules/alarm/api"
 	"github.com/Cepave/open-falcon-backend/modules/alarm/g"
+	webhookmodel "github.com/Cepave/open-falcon-backend/modules/alarm/model/webhook"
 	"github.com/Cepave/open-falcon-backend/modules/alarm/redis"
 	"github.com/Cepave/open-falcon-backend/common/model"
 	log "github.com/Sirupsen/logrus"
+	"github.com/toolkits/container/set"
 )
 
 func consume(event *model.Event, isHigh bool) {
@@ -20,11 +22,18 @@ func consume(event *model.Event, isHigh bool) {
 		return
 	}
 
+	dispatchWebhook(event, action.Id)
+
 	if action.Callback == 1 {
 		HandleCallback(event, action)
 		return
 	}
 
+	if policy := EscalationPolicyOf(action.Id); policy != nil {
+		consumeWithEscalation(event, policy, isHigh)
+		return
+	}
+
 	if isHigh {
 		consumeHighEvents(event, action)
 	} else {
@@ -38,19 +47,7 @@ func consumeHighEvents(event *model.Event, action *api.Action) {
 		return
 	}
 
-	phones, mails := api.ParseTeams(action.Uic)
-
-	smsContent := GenerateSmsContent(event)
-	mailContent := GenerateMailContent(event)
-	QQContent  := GenerateQQContent(event)
-
-	if event.Priority() < 3 {
-		redis.WriteSms(phones, smsContent)
-	}
-
-	redis.WriteMail(mails, smsContent, mailContent)
-	redis.WriteQQ(mails, smsContent, QQContent)
-	ParseUserServerchan(event, action)
+	notifyUsers(event, api.GetUsers(action.Uic), true)
 }
 
 // 低优先级的做报警合并
@@ -59,18 +56,63 @@ func consumeLowEvents(event *model.Event, action *api.Action) {
 		return
 	}
 
-	if event.Priority() < 3 {
-		ParseUserSms(event, action)
+	notifyUsers(event, api.GetUsers(action.Uic), false)
+}
+
+// notifyUsers sends the event to users by the channels of action: sms(only for P0~P2), mail, QQ and serverchan
+func notifyUsers(event *model.Event, userMap map[string]*api.User, isHigh bool) {
+	if len(userMap) == 0 {
+		return
 	}
+	channels := ChannelsOf(event.ActionId())
 
-	ParseUserMail(event, action)
-	ParseUserQQ(event, action)
-	ParseUserServerchan(event, action)
+	if !isHigh {
+		if event.Priority() < 3 && channels.Has(webhookmodel.ChannelSms) {
+			sendUserSms(event, userMap)
+		}
+		if channels.Has(webhookmodel.ChannelMail) {
+			sendUserMail(event, userMap)
+		}
+		if channels.Has(webhookmodel.ChannelQQ) {
+			sendUserQQ(event, userMap)
+		}
+		if channels.Has(webhookmodel.ChannelServerchan) {
+			sendUserServerchan(event, userMap)
+		}
+		return
+	}
+
+	phoneSet := set.NewStringSet()
+	mailSet := set.NewStringSet()
+	for _, user := range userMap {
+		phoneSet.Add(user.Phone)
+		mailSet.Add(user.Email)
+	}
+	phones, mails := phoneSet.ToSlice(), mailSet.ToSlice()
+
+	smsContent := GenerateSmsContent(event)
+	mailContent := GenerateMailContent(event)
+	QQContent := GenerateQQContent(event)
+
+	if event.Priority() < 3 && channels.Has(webhookmodel.ChannelSms) {
+		redis.WriteSms(phones, smsContent)
+	}
+	if channels.Has(webhookmodel.ChannelMail) {
+		redis.WriteMail(mails, smsContent, mailContent)
+	}
+	if channels.Has(webhookmodel.ChannelQQ) {
+		redis.WriteQQ(mails, smsContent, QQContent)
+	}
+	if channels.Has(webhookmodel.ChannelServerchan) {
+		sendUserServerchan(event, userMap)
+	}
 }
 
 func ParseUserSms(event *model.Event, action *api.Action) {
-	userMap := api.GetUsers(action.Uic)
+	sendUserSms(event, api.GetUsers(action.Uic))
+}
 
+func sendUserSms(event *model.Event, userMap map[string]*api.User) {
 	content := GenerateSmsContent(event)
 	metric := event.Metric()
 	status := event.Status
@@ -103,8 +145,10 @@ func ParseUserSms(event *model.Event, action *api.Action) {
 }
 
 func ParseUserMail(event *model.Event, action *api.Action) {
-	userMap := api.GetUsers(action.Uic)
+	sendUserMail(event, api.GetUsers(action.Uic))
+}
 
+func sendUserMail(event *model.Event, userMap map[string]*api.User) {
 	metric := event.Metric()
 	subject := GenerateSmsContent(event)
 	content := GenerateMailContent(event)
@@ -139,8 +183,10 @@ func ParseUserMail(event *model.Event, action *api.Action) {
 }
 
 func ParseUserQQ(event *model.Event, action *api.Action) {
-	userMap := api.GetUsers(action.Uic)
+	sendUserQQ(event, api.GetUsers(action.Uic))
+}
 
+func sendUserQQ(event *model.Event, userMap map[string]*api.User) {
 	metric := event.Metric()
 	subject := GenerateSmsContent(event)
 	content := GenerateQQContent(event)
@@ -175,7 +221,10 @@ func ParseUserQQ(event *model.Event, action *api.Action) {
 }
 
 func ParseUserServerchan(event *model.Event, action *api.Action) {
-	userMap := api.GetUsers(action.Uic)
+	sendUserServerchan(event, api.GetUsers(action.Uic))
+}
+
+func sendUserServerchan(event *model.Event, userMap map[string]*api.User) {
 	metric := event.Metric()
 	subject := GenerateSmsContent(event)
 	content := GenerateServerchanContent(event)
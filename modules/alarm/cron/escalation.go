@@ -0,0 +1,370 @@
+package cron
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Cepave/open-falcon-backend/common/model"
+	"github.com/Cepave/open-falcon-backend/modules/alarm/api"
+	"github.com/Cepave/open-falcon-backend/modules/alarm/g"
+	escmodel "github.com/Cepave/open-falcon-backend/modules/alarm/model/escalation"
+	eventmodel "github.com/Cepave/open-falcon-backend/modules/alarm/model/event"
+	uicmodel "github.com/Cepave/open-falcon-backend/modules/alarm/model/uic"
+	log "github.com/Sirupsen/logrus"
+	"github.com/garyburd/redigo/redis"
+)
+
+// 未确认的event按升级策略逐级通知, 状态保存在redis中, alarm重启后继续升级
+const escalationKey = "alarm:escalation"
+
+// 停止升级的记录每隔一段时间检查一次case的状态, case恢复/关闭/删除后删除记录
+const escalationCheckInterval = 600
+
+// 超过这个时间没有新event的记录也会被删除, 例如endpoint被删除, case一直没有恢复
+const escalationMaxAge = 7 * 86400
+
+// actions of escalating task
+const (
+	escalationWait   = iota // not due yet, or the case is snoozed
+	escalationNotify        // escalates to the next step
+	escalationStop          // stops escalating, keeps the record for notifying the recovery
+	escalationDelete        // the case is recovered, closed, removed or expired
+)
+
+type SafeEscalationPolicies struct {
+	sync.RWMutex
+	Policies  map[int]*escmodel.Policy   // policy id => policy
+	Actions   map[int]int                // action id => policy id
+	Schedules map[int]*escmodel.Schedule // schedule id => schedule
+}
+
+var EscalationPolicies = &SafeEscalationPolicies{
+	Policies:  make(map[int]*escmodel.Policy),
+	Actions:   make(map[int]int),
+	Schedules: make(map[int]*escmodel.Schedule),
+}
+
+func (this *SafeEscalationPolicies) Set(policies map[int]*escmodel.Policy, actions map[int]int, schedules map[int]*escmodel.Schedule) {
+	this.Lock()
+	defer this.Unlock()
+	this.Policies = policies
+	this.Actions = actions
+	this.Schedules = schedules
+}
+
+func (this *SafeEscalationPolicies) Policy(id int) *escmodel.Policy {
+	this.RLock()
+	defer this.RUnlock()
+	return this.Policies[id]
+}
+
+func (this *SafeEscalationPolicies) Schedule(id int) *escmodel.Schedule {
+	this.RLock()
+	defer this.RUnlock()
+	return this.Schedules[id]
+}
+
+// EscalationPolicyOf returns the policy of action, nil if the action has no policy(or the policy has no step)
+func EscalationPolicyOf(actionId int) *escmodel.Policy {
+	EscalationPolicies.RLock()
+	defer EscalationPolicies.RUnlock()
+
+	policy, ok := EscalationPolicies.Policies[EscalationPolicies.Actions[actionId]]
+	if !ok || len(policy.Steps) == 0 {
+		return nil
+	}
+	return policy
+}
+
+// pendingEscalation is the progress of escalation of an event case
+type pendingEscalation struct {
+	Event    *model.Event `json:"event"`
+	PolicyId int          `json:"policy_id"`
+	Step     int          `json:"step"`      // index of the step which has been notified
+	NotifyAt int64        `json:"notify_at"` // time of notifying the next step, 0 if there is no next step or it is acknowledged
+	IsHigh   bool         `json:"is_high"`
+	// stopped by the acknowledgement or closing of the case, escalates again after the case is reopened
+	Stopped bool `json:"stopped"`
+	// time of checking the lifecycle of the case again, for the record which has no next step
+	CheckAt int64 `json:"check_at"`
+}
+
+func (this *pendingEscalation) due(now time.Time) bool {
+	if this.NotifyAt == 0 {
+		return now.Unix() >= this.CheckAt
+	}
+	return now.Unix() >= this.NotifyAt
+}
+
+// advance decides the action of escalating task, the progress is updated for escalationNotify and escalationStop
+func (this *pendingEscalation) advance(lc *eventmodel.CaseLifecycle, policy *escmodel.Policy, now time.Time) int {
+	// 关闭的case收到新的event时会重新打开, 从第一级重新升级, 不需要保留记录
+	if lc == nil || lc.Recovered() || lc.Closed() || now.Unix()-this.Event.EventTime >= escalationMaxAge {
+		return escalationDelete
+	}
+	if this.NotifyAt == 0 {
+		this.CheckAt = now.Unix() + escalationCheckInterval
+		return escalationStop
+	}
+	// postpones the escalation until the snooze is over
+	if lc.Snoozed(now) {
+		return escalationWait
+	}
+	if lc.Acknowledged() || policy == nil || this.Step+1 >= len(policy.Steps) {
+		this.NotifyAt = 0
+		this.Stopped = lc.Acknowledged()
+		this.CheckAt = now.Unix() + escalationCheckInterval
+		return escalationStop
+	}
+
+	this.Step++
+	this.NotifyAt = nextNotifyAt(policy, this.Step, now)
+	return escalationNotify
+}
+
+// rearmed returns true if the escalation is stopped by the lifecycle, and the case is reopened or
+// becomes a new occurrence(the acknowledgement is reset by InsertEvent)
+func (this *pendingEscalation) rearmed(lc *eventmodel.CaseLifecycle) bool {
+	return this.Stopped && lc != nil && !lc.Acknowledged() && !lc.Closed()
+}
+
+// serializes the modification of escalation between consumers and escalating task
+var escalationLock = new(sync.Mutex)
+
+// 定期同步升级策略和值班表
+func SyncEscalationPolicies() {
+	duration := time.Duration(30) * time.Second
+	for {
+		syncEscalationPolicies()
+		time.Sleep(duration)
+	}
+}
+
+func syncEscalationPolicies() {
+	policies, err := escmodel.QueryPolicies()
+	if err != nil {
+		log.Errorf("query escalation policies fail: %v", err)
+		return
+	}
+	actions, err := escmodel.QueryActionPolicies()
+	if err != nil {
+		log.Errorf("query escalation policies of action fail: %v", err)
+		return
+	}
+	schedules, err := escmodel.QuerySchedules(time.Now())
+	if err != nil {
+		log.Errorf("query on-call schedules fail: %v", err)
+		return
+	}
+	EscalationPolicies.Set(policies, actions, schedules)
+}
+
+func consumeWithEscalation(event *model.Event, policy *escmodel.Policy, isHigh bool) {
+	escalationLock.Lock()
+	defer escalationLock.Unlock()
+
+	pending, err := loadEscalation(event.Id)
+	if err != nil {
+		log.Errorf("load escalation of %s fail: %v", event.Id, err)
+	}
+
+	// 恢复通知发给所有已经通知过的人
+	if event.Status == "OK" {
+		last := 0
+		if pending != nil {
+			last = pending.Step
+			deleteEscalation(event.Id)
+		}
+		notifyUsers(event, usersOfSteps(policy, 0, last), isHigh)
+		return
+	}
+
+	// 确认或关闭后重新打开的case从第一级重新升级
+	if pending != nil && pending.Stopped {
+		lc, err := eventmodel.QueryCaseLifecycle(event.Id)
+		if err != nil {
+			log.Errorf("query lifecycle of case %s fail: %v", event.Id, err)
+		} else if pending.rearmed(lc) {
+			log.Infof("case %s is reopened, escalates again", event.Id)
+			pending = nil
+		}
+	}
+
+	// 重复的报警发给当前级别的人
+	if pending != nil && pending.PolicyId == policy.Id {
+		pending.Event = event
+		saveEscalation(pending)
+		notifyUsers(event, usersOfSteps(policy, pending.Step, pending.Step), isHigh)
+		return
+	}
+
+	pending = &pendingEscalation{
+		Event:    event,
+		PolicyId: policy.Id,
+		Step:     0,
+		IsHigh:   isHigh,
+	}
+	pending.NotifyAt = nextNotifyAt(policy, 0, time.Now())
+	saveEscalation(pending)
+	notifyUsers(event, usersOfSteps(policy, 0, 0), isHigh)
+}
+
+// 升级未被确认的event
+func Escalate() {
+	duration := time.Duration(30) * time.Second
+	for {
+		time.Sleep(duration)
+		escalate()
+	}
+}
+
+func escalate() {
+	escalationLock.Lock()
+	defer escalationLock.Unlock()
+
+	all, err := loadAllEscalations()
+	if err != nil {
+		log.Errorf("load escalations fail: %v", err)
+		return
+	}
+
+	now := time.Now()
+	for _, pending := range all {
+		if !pending.due(now) {
+			continue
+		}
+
+		lc, err := eventmodel.QueryCaseLifecycle(pending.Event.Id)
+		if err != nil {
+			log.Errorf("query lifecycle of case %s fail: %v", pending.Event.Id, err)
+			continue
+		}
+
+		policy := EscalationPolicies.Policy(pending.PolicyId)
+		switch pending.advance(lc, policy, now) {
+		case escalationDelete:
+			deleteEscalation(pending.Event.Id)
+		case escalationStop:
+			saveEscalation(pending)
+		case escalationNotify:
+			saveEscalation(pending)
+			log.Infof("escalate case %s to step %d of policy %s", pending.Event.Id, policy.Steps[pending.Step].Step, policy.Name)
+			notifyUsers(pending.Event, usersOfSteps(policy, pending.Step, pending.Step), pending.IsHigh)
+		}
+	}
+}
+
+func nextNotifyAt(policy *escmodel.Policy, step int, now time.Time) int64 {
+	if step+1 >= len(policy.Steps) {
+		return 0
+	}
+	return now.Unix() + int64(policy.Steps[step+1].WaitMinutes)*60
+}
+
+// usersOfSteps resolves the receivers of steps[from ~ to] at notification time
+func usersOfSteps(policy *escmodel.Policy, from int, to int) map[string]*api.User {
+	userMap := make(map[string]*api.User)
+	names := []string{}
+
+	now := time.Now()
+	for i := from; i <= to && i < len(policy.Steps); i++ {
+		step := policy.Steps[i]
+
+		if step.ScheduleId != 0 {
+			if schedule := EscalationPolicies.Schedule(step.ScheduleId); schedule != nil {
+				if name := schedule.OnCall(now, step.ScheduleOffset); name != "" {
+					names = append(names, name)
+				}
+			}
+		}
+		for _, name := range strings.Split(step.Users, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+		if step.Teams != "" {
+			for name, user := range api.GetUsers(step.Teams) {
+				userMap[name] = user
+			}
+		}
+	}
+
+	users, err := uicmodel.QueryUsersByName(names)
+	if err != nil {
+		log.Errorf("query users %v fail: %v", names, err)
+	}
+	for _, user := range users {
+		userMap[user.Name] = &api.User{
+			Name:  user.Name,
+			Email: user.Email,
+			Phone: user.Phone,
+			IM:    user.IM,
+		}
+	}
+	return userMap
+}
+
+func loadEscalation(id string) (*pendingEscalation, error) {
+	rc := g.RedisConnPool.Get()
+	defer rc.Close()
+
+	reply, err := redis.String(rc.Do("HGET", escalationKey, id))
+	if err == redis.ErrNil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	pending := &pendingEscalation{}
+	if err := json.Unmarshal([]byte(reply), pending); err != nil {
+		return nil, err
+	}
+	return pending, nil
+}
+
+func loadAllEscalations() ([]*pendingEscalation, error) {
+	rc := g.RedisConnPool.Get()
+	defer rc.Close()
+
+	reply, err := redis.StringMap(rc.Do("HGETALL", escalationKey))
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]*pendingEscalation, 0, len(reply))
+	for id, value := range reply {
+		pending := &pendingEscalation{}
+		if err := json.Unmarshal([]byte(value), pending); err != nil || pending.Event == nil {
+			log.Errorf("bad escalation of %s: %v", id, err)
+			rc.Do("HDEL", escalationKey, id)
+			continue
+		}
+		ret = append(ret, pending)
+	}
+	return ret, nil
+}
+
+func saveEscalation(pending *pendingEscalation) {
+	bs, err := json.Marshal(pending)
+	if err != nil {
+		log.Errorf("json marshal escalation of %s fail: %v", pending.Event.Id, err)
+		return
+	}
+
+	rc := g.RedisConnPool.Get()
+	defer rc.Close()
+	if _, err := rc.Do("HSET", escalationKey, pending.Event.Id, string(bs)); err != nil {
+		log.Errorf("HSET redis %s fail: %v", escalationKey, err)
+	}
+}
+
+func deleteEscalation(id string) {
+	rc := g.RedisConnPool.Get()
+	defer rc.Close()
+	if _, err := rc.Do("HDEL", escalationKey, id); err != nil {
+		log.Errorf("HDEL redis %s fail: %v", escalationKey, err)
+	}
+}
@@ -0,0 +1,150 @@
+package cron
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Cepave/open-falcon-backend/common/model"
+	escmodel "github.com/Cepave/open-falcon-backend/modules/alarm/model/escalation"
+	eventmodel "github.com/Cepave/open-falcon-backend/modules/alarm/model/event"
+)
+
+func TestRearmed(t *testing.T) {
+	stopped := &pendingEscalation{Step: 1, Stopped: true}
+	finished := &pendingEscalation{Step: 2}
+	cases := []struct {
+		pending *pendingEscalation
+		lc      *eventmodel.CaseLifecycle
+		rearmed bool
+	}{
+		// reopened, the acknowledgement is reset
+		{stopped, &eventmodel.CaseLifecycle{Status: "PROBLEM", ProcessStatus: "unresolved"}, true},
+		{stopped, &eventmodel.CaseLifecycle{Status: "PROBLEM", AcknowledgedBy: "alice"}, false},
+		{stopped, &eventmodel.CaseLifecycle{Status: "PROBLEM", ProcessStatus: "in progress"}, false},
+		{stopped, &eventmodel.CaseLifecycle{Status: "PROBLEM", ProcessStatus: "resolved"}, false},
+		{stopped, nil, false},
+		// all steps are notified, the repeat notifications are not escalated again
+		{finished, &eventmodel.CaseLifecycle{Status: "PROBLEM", ProcessStatus: "unresolved"}, false},
+	}
+	for i, c := range cases {
+		if c.pending.rearmed(c.lc) != c.rearmed {
+			t.Errorf("case %d: expected rearmed %v", i, c.rearmed)
+		}
+	}
+}
+
+func testPolicy() *escmodel.Policy {
+	return &escmodel.Policy{Id: 1, Name: "test", Steps: []*escmodel.Step{
+		{Step: 1, Users: "alice"},
+		{Step: 2, WaitMinutes: 10, Users: "bob"},
+		{Step: 3, WaitMinutes: 30, Users: "carol"},
+	}}
+}
+
+func TestNextNotifyAt(t *testing.T) {
+	policy := testPolicy()
+	now := time.Unix(1500000000, 0)
+	for step, expected := range []int64{1500000000 + 600, 1500000000 + 1800, 0} {
+		if ts := nextNotifyAt(policy, step, now); ts != expected {
+			t.Errorf("step %d: expected %d, got %d", step, expected, ts)
+		}
+	}
+}
+
+func TestAdvance(t *testing.T) {
+	policy := testPolicy()
+	now := time.Unix(1500000000, 0)
+	unresolved := &eventmodel.CaseLifecycle{Status: "PROBLEM", ProcessStatus: "unresolved"}
+
+	pending := &pendingEscalation{
+		Event:    &model.Event{Id: "s_1_abc", EventTime: now.Unix()},
+		PolicyId: policy.Id,
+		NotifyAt: nextNotifyAt(policy, 0, now),
+	}
+
+	// 逐级升级, 直到最后一级
+	for _, expected := range []struct {
+		at       int64
+		step     int
+		notifyAt int64 // 0 if there is no next step
+	}{
+		{600, 1, now.Unix() + 600 + 1800},
+		{2400, 2, 0},
+	} {
+		at := time.Unix(now.Unix()+expected.at, 0)
+		if pending.due(time.Unix(at.Unix()-1, 0)) || !pending.due(at) {
+			t.Fatalf("step %d should be due at %d", expected.step, at.Unix())
+		}
+		if action := pending.advance(unresolved, policy, at); action != escalationNotify {
+			t.Fatalf("expected notifying step %d, got action %d", expected.step, action)
+		}
+		if pending.Step != expected.step || pending.NotifyAt != expected.notifyAt {
+			t.Errorf("unexpected progress: step %d, notify at %d", pending.Step, pending.NotifyAt)
+		}
+	}
+
+	// 所有级别都通知过了, 保留记录, 定期检查case的状态
+	at := time.Unix(now.Unix()+2400, 0)
+	if action := pending.advance(unresolved, policy, at); action != escalationStop || pending.Stopped {
+		t.Errorf("expected finished, got action %d(stopped: %v)", action, pending.Stopped)
+	}
+	if pending.CheckAt != at.Unix()+escalationCheckInterval || pending.due(at) {
+		t.Errorf("unexpected check time %d", pending.CheckAt)
+	}
+
+	for i, c := range []struct {
+		lc     *eventmodel.CaseLifecycle
+		age    int64
+		action int
+	}{
+		{unresolved, 0, escalationStop},
+		{&eventmodel.CaseLifecycle{Status: "PROBLEM", AcknowledgedBy: "alice"}, 0, escalationStop},
+		{&eventmodel.CaseLifecycle{Status: "OK", ProcessStatus: "unresolved"}, 0, escalationDelete},
+		{&eventmodel.CaseLifecycle{Status: "PROBLEM", ProcessStatus: "resolved"}, 0, escalationDelete},
+		{&eventmodel.CaseLifecycle{Status: "PROBLEM", ProcessStatus: "ignored"}, 0, escalationDelete},
+		{nil, 0, escalationDelete},
+		// 长期没有新的event
+		{unresolved, escalationMaxAge, escalationDelete},
+	} {
+		finished := &pendingEscalation{
+			Event:    &model.Event{Id: "s_1_abc", EventTime: now.Unix() - c.age},
+			PolicyId: policy.Id,
+			Step:     2,
+		}
+		if action := finished.advance(c.lc, policy, now); action != c.action {
+			t.Errorf("case %d: expected action %d, got %d", i, c.action, action)
+		}
+	}
+}
+
+func TestAdvanceStopped(t *testing.T) {
+	policy := testPolicy()
+	now := time.Unix(1500000000, 0)
+	newPending := func() *pendingEscalation {
+		return &pendingEscalation{
+			Event:    &model.Event{Id: "s_1_abc", EventTime: now.Unix() - 600},
+			PolicyId: policy.Id,
+			NotifyAt: now.Unix(),
+		}
+	}
+
+	// 确认后停止升级, case重新打开后从第一级重新升级
+	pending := newPending()
+	acked := &eventmodel.CaseLifecycle{Status: "PROBLEM", ProcessStatus: "in progress"}
+	if action := pending.advance(acked, policy, now); action != escalationStop || !pending.Stopped || pending.NotifyAt != 0 || pending.Step != 0 {
+		t.Errorf("expected stopped, got action %d: %+v", action, pending)
+	}
+
+	// snooze期间暂停升级
+	pending = newPending()
+	snoozed := &eventmodel.CaseLifecycle{Status: "PROBLEM", SnoozedUntil: now.Unix() + 60}
+	if action := pending.advance(snoozed, policy, now); action != escalationWait || pending.Step != 0 || pending.NotifyAt != now.Unix() {
+		t.Errorf("expected waiting, got action %d: %+v", action, pending)
+	}
+
+	// 升级策略被删除
+	pending = newPending()
+	if action := pending.advance(&eventmodel.CaseLifecycle{Status: "PROBLEM"}, nil, now); action != escalationStop || pending.Stopped {
+		t.Errorf("expected finished, got action %d: %+v", action, pending)
+	}
+}
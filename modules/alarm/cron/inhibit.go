@@ -0,0 +1,263 @@
+package cron
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Cepave/open-falcon-backend/common/model"
+	inhibitmodel "github.com/Cepave/open-falcon-backend/modules/alarm/model/inhibit"
+	log "github.com/Sirupsen/logrus"
+)
+
+// PROBLEM cases which are not updated in this period are not able to inhibit others,
+// e.g. the endpoint has been removed but the case is never recovered.
+const inhibitSourceMaxAge = 86400
+
+type SafeInhibitRules struct {
+	sync.RWMutex
+	Rules        []*inhibitmodel.Rule
+	Dependencies []*inhibitmodel.Dependency
+}
+
+var InhibitRules = &SafeInhibitRules{}
+
+func (this *SafeInhibitRules) Get() ([]*inhibitmodel.Rule, []*inhibitmodel.Dependency) {
+	this.RLock()
+	defer this.RUnlock()
+	return this.Rules, this.Dependencies
+}
+
+func (this *SafeInhibitRules) Set(rules []*inhibitmodel.Rule, deps []*inhibitmodel.Dependency) {
+	this.Lock()
+	defer this.Unlock()
+	this.Rules = rules
+	this.Dependencies = deps
+}
+
+// ProblemCases keeps the cases in PROBLEM status, which are candidates of inhibiting source.
+// Inhibited keeps the cases whose PROBLEM notifications are suppressed(case id => id of inhibiting case),
+// so that the recovery of them is suppressed as well.
+type SafeProblemCases struct {
+	sync.RWMutex
+	M         map[string]*inhibitmodel.Case
+	Inhibited map[string]string
+}
+
+var ProblemCases = &SafeProblemCases{
+	M:         make(map[string]*inhibitmodel.Case),
+	Inhibited: make(map[string]string),
+}
+
+func (this *SafeProblemCases) Snapshot() []*inhibitmodel.Case {
+	this.RLock()
+	defer this.RUnlock()
+	ret := make([]*inhibitmodel.Case, 0, len(this.M))
+	for _, c := range this.M {
+		ret = append(ret, c)
+	}
+	return ret
+}
+
+func (this *SafeProblemCases) Reset(cases []*inhibitmodel.Case, inhibited map[string]string) {
+	m := make(map[string]*inhibitmodel.Case, len(cases))
+	for _, c := range cases {
+		m[c.Id] = c
+	}
+
+	this.Lock()
+	defer this.Unlock()
+	this.M = m
+	this.Inhibited = inhibited
+}
+
+// Update keeps the status of case, inhibitedBy is empty if the case is not inhibited
+func (this *SafeProblemCases) Update(event *model.Event, inhibitedBy string) {
+	this.Lock()
+	defer this.Unlock()
+
+	if event.Status == "OK" {
+		delete(this.M, event.Id)
+		delete(this.Inhibited, event.Id)
+		return
+	}
+
+	this.M[event.Id] = inhibitmodel.CaseOfEvent(event)
+	if inhibitedBy != "" {
+		this.Inhibited[event.Id] = inhibitedBy
+	} else {
+		delete(this.Inhibited, event.Id)
+	}
+}
+
+func (this *SafeProblemCases) InhibitedBy(id string) (string, bool) {
+	this.RLock()
+	defer this.RUnlock()
+	source, ok := this.Inhibited[id]
+	return source, ok
+}
+
+// 定期同步抑制规则/依赖关系, 以及处于PROBLEM状态的event_cases
+func SyncInhibitRules() {
+	duration := time.Duration(30) * time.Second
+	for {
+		syncInhibitRules()
+		time.Sleep(duration)
+	}
+}
+
+func syncInhibitRules() {
+	HostGroups.Reset()
+
+	rules, err := inhibitmodel.QueryRules()
+	if err != nil {
+		log.Errorf("query inhibit rules fail: %v", err)
+		return
+	}
+	deps, err := inhibitmodel.QueryDependencies()
+	if err != nil {
+		log.Errorf("query endpoint dependencies fail: %v", err)
+		return
+	}
+	InhibitRules.Set(rules, deps)
+
+	cases, inhibited, err := inhibitmodel.QueryProblemCases(inhibitSourceMaxAge)
+	if err != nil {
+		log.Errorf("query problem cases fail: %v", err)
+		return
+	}
+	ProblemCases.Reset(cases, inhibited)
+}
+
+// MatchInhibition returns id of the case which inhibits the event, empty if there is none.
+// The status of event is kept for inhibiting other events.
+func MatchInhibition(event *model.Event) string {
+	source := findInhibitingCase(event)
+	ProblemCases.Update(event, source)
+	return source
+}
+
+func findInhibitingCase(event *model.Event) string {
+	// the recovery is suppressed if the problem was suppressed
+	if event.Status == "OK" {
+		source, _ := ProblemCases.InhibitedBy(event.Id)
+		return source
+	}
+
+	rules, deps := InhibitRules.Get()
+	if len(rules) == 0 && len(deps) == 0 {
+		return ""
+	}
+
+	target := inhibitmodel.CaseOfEvent(event)
+	problems := ProblemCases.Snapshot()
+
+	for _, dep := range deps {
+		if dep.Child != target.Endpoint {
+			continue
+		}
+		for _, c := range problems {
+			if canInhibit(c, target) && dep.MatchParent(c) {
+				return c.Id
+			}
+		}
+	}
+
+	for _, rule := range rules {
+		if !rule.MatchTarget(target) {
+			continue
+		}
+		for _, c := range problems {
+			if !canInhibit(c, target) || !rule.MatchSource(c) {
+				continue
+			}
+			if shareLabels(rule.EqualLabels(), c, target, HostGroups) {
+				return c.Id
+			}
+		}
+	}
+
+	return ""
+}
+
+// the source which is inhibited by the target cannot inhibit the target,
+// otherwise the rules inhibiting each other suppress both of them
+func canInhibit(source *inhibitmodel.Case, target *inhibitmodel.Case) bool {
+	if source.Id == target.Id {
+		return false
+	}
+	inhibitedBy, _ := ProblemCases.InhibitedBy(source.Id)
+	return inhibitedBy != target.Id
+}
+
+func shareLabels(labels []string, source *inhibitmodel.Case, target *inhibitmodel.Case, groups *SafeHostGroups) bool {
+	for _, label := range labels {
+		switch label {
+		case inhibitmodel.LabelEndpoint:
+			if source.Endpoint != target.Endpoint {
+				return false
+			}
+		case inhibitmodel.LabelHostGroup:
+			if !groups.share(source.Endpoint, target.Endpoint) {
+				return false
+			}
+		default:
+			v, ok := source.Tags[label]
+			if !ok || target.Tags[label] != v {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// SafeHostGroups caches the host groups of endpoints for inhibition and silence,
+// it is cleared on every syncing of the rules, so the host groups of an endpoint are queried at most once in a period.
+type SafeHostGroups struct {
+	sync.RWMutex
+	M map[string]map[int]bool
+}
+
+var HostGroups = &SafeHostGroups{M: make(map[string]map[int]bool)}
+
+var queryHostGroups = inhibitmodel.QueryHostGroups
+
+func (this *SafeHostGroups) Reset() {
+	this.Lock()
+	defer this.Unlock()
+	this.M = make(map[string]map[int]bool)
+}
+
+func (this *SafeHostGroups) get(endpoint string) map[int]bool {
+	this.RLock()
+	groups, ok := this.M[endpoint]
+	this.RUnlock()
+	if ok {
+		return groups
+	}
+
+	ids, err := queryHostGroups(endpoint)
+	if err != nil {
+		// 查询失败时不缓存, 下次再查询
+		log.Errorf("query host groups of %s fail: %v", endpoint, err)
+		return map[int]bool{}
+	}
+	groups = make(map[int]bool, len(ids))
+	for _, id := range ids {
+		groups[id] = true
+	}
+
+	this.Lock()
+	defer this.Unlock()
+	this.M[endpoint] = groups
+	return groups
+}
+
+func (this *SafeHostGroups) share(a string, b string) bool {
+	groupsOfB := this.get(b)
+	for id := range this.get(a) {
+		if groupsOfB[id] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,128 @@
+package cron
+
+import (
+	"testing"
+
+	"github.com/Cepave/open-falcon-backend/common/model"
+	inhibitmodel "github.com/Cepave/open-falcon-backend/modules/alarm/model/inhibit"
+)
+
+func inhibitEvent(id string, status string, endpoint string, metric string, tags map[string]string) *model.Event {
+	return &model.Event{
+		Id:         id,
+		Status:     status,
+		Endpoint:   endpoint,
+		Strategy:   &model.Strategy{Id: 1, Metric: metric},
+		PushedTags: tags,
+	}
+}
+
+// resetInhibition clears the cases and sets the rules, host-01 and host-02 are in the same host group.
+// It returns the number of queries of host groups, and the function restoring the query.
+func resetInhibition(rules []*inhibitmodel.Rule, deps []*inhibitmodel.Dependency) (*int, func()) {
+	InhibitRules.Set(rules, deps)
+	ProblemCases.Reset(nil, make(map[string]string))
+	HostGroups.Reset()
+
+	queries := 0
+	origin := queryHostGroups
+	queryHostGroups = func(endpoint string) ([]int, error) {
+		queries++
+		switch endpoint {
+		case "host-01", "host-02":
+			return []int{1, 2}, nil
+		}
+		return []int{3}, nil
+	}
+	return &queries, func() { queryHostGroups = origin }
+}
+
+func TestInhibitByDependency(t *testing.T) {
+	_, restore := resetInhibition(nil, []*inhibitmodel.Dependency{
+		{Parent: "switch-01", Child: "host-01", ParentMetric: "agent.alive"},
+	})
+	defer restore()
+
+	if source := MatchInhibition(inhibitEvent("s_1_a", "PROBLEM", "switch-01", "net.if.in.bytes", nil)); source != "" {
+		t.Fatalf("unexpected inhibition by %s", source)
+	}
+	if source := MatchInhibition(inhibitEvent("s_1_b", "PROBLEM", "host-01", "cpu.idle", nil)); source != "" {
+		t.Errorf("the parent metric is not matched, but inhibited by %s", source)
+	}
+
+	MatchInhibition(inhibitEvent("s_1_c", "PROBLEM", "switch-01", "agent.alive", nil))
+	if source := MatchInhibition(inhibitEvent("s_1_d", "PROBLEM", "host-01", "cpu.idle", nil)); source != "s_1_c" {
+		t.Errorf("expected inhibited by s_1_c, got %q", source)
+	}
+	if source := MatchInhibition(inhibitEvent("s_1_e", "PROBLEM", "host-02", "cpu.idle", nil)); source != "" {
+		t.Errorf("other endpoint is inhibited by %s", source)
+	}
+
+	// the recovery of the inhibited case is suppressed as well
+	if source := MatchInhibition(inhibitEvent("s_1_d", "OK", "host-01", "cpu.idle", nil)); source != "s_1_c" {
+		t.Errorf("expected the recovery inhibited by s_1_c, got %q", source)
+	}
+	if _, ok := ProblemCases.InhibitedBy("s_1_d"); ok {
+		t.Error("the recovered case is kept")
+	}
+}
+
+func TestInhibitByRule(t *testing.T) {
+	queries, restore := resetInhibition([]*inhibitmodel.Rule{
+		{SourceMetric: "agent.alive", Equal: "endpoint"},
+		{SourceMetric: "net.port.listen", TargetMetric: "http.latency", Equal: "grp"},
+		{SourceMetric: "mysql.alive", SourceTags: "role=master", TargetMetric: "mysql.slave", Equal: "idc"},
+	}, nil)
+	defer restore()
+
+	MatchInhibition(inhibitEvent("s_1_a", "PROBLEM", "host-01", "agent.alive", nil))
+	MatchInhibition(inhibitEvent("s_1_b", "PROBLEM", "host-01", "net.port.listen", nil))
+	MatchInhibition(inhibitEvent("s_1_c", "PROBLEM", "db-01", "mysql.alive", map[string]string{"role": "master", "idc": "bj"}))
+
+	for _, c := range []struct {
+		event    *model.Event
+		expected string
+	}{
+		{inhibitEvent("s_1_d", "PROBLEM", "host-01", "cpu.idle", nil), "s_1_a"},
+		{inhibitEvent("s_1_e", "PROBLEM", "host-03", "cpu.idle", nil), ""},
+		// the same host group
+		{inhibitEvent("s_1_f", "PROBLEM", "host-02", "http.latency", nil), "s_1_b"},
+		{inhibitEvent("s_1_g", "PROBLEM", "host-03", "http.latency", nil), ""},
+		// the same tag
+		{inhibitEvent("s_1_h", "PROBLEM", "db-02", "mysql.slave", map[string]string{"idc": "bj"}), "s_1_c"},
+		{inhibitEvent("s_1_i", "PROBLEM", "db-03", "mysql.slave", map[string]string{"idc": "sh"}), ""},
+		{inhibitEvent("s_1_j", "PROBLEM", "db-04", "mysql.slave", nil), ""},
+	} {
+		if source := findInhibitingCase(c.event); source != c.expected {
+			t.Errorf("%s: expected inhibited by %q, got %q", c.event.Id, c.expected, source)
+		}
+	}
+
+	// the host groups are cached until the rules are synced
+	if *queries != 3 {
+		t.Errorf("expected 3 queries of host groups, got %d", *queries)
+	}
+	findInhibitingCase(inhibitEvent("s_1_k", "PROBLEM", "host-02", "http.latency", nil))
+	if *queries != 3 {
+		t.Errorf("the host groups are queried again: %d", *queries)
+	}
+}
+
+func TestInhibitEachOther(t *testing.T) {
+	_, restore := resetInhibition([]*inhibitmodel.Rule{
+		{SourceMetric: "cpu.idle", TargetMetric: "load.1min", Equal: "endpoint"},
+		{SourceMetric: "load.1min", TargetMetric: "cpu.idle", Equal: "endpoint"},
+	}, nil)
+	defer restore()
+
+	if source := MatchInhibition(inhibitEvent("s_1_a", "PROBLEM", "host-01", "cpu.idle", nil)); source != "" {
+		t.Fatalf("unexpected inhibition by %s", source)
+	}
+	if source := MatchInhibition(inhibitEvent("s_2_a", "PROBLEM", "host-01", "load.1min", nil)); source != "s_1_a" {
+		t.Fatalf("expected inhibited by s_1_a, got %q", source)
+	}
+	// the source inhibited by the case cannot inhibit the case
+	if source := MatchInhibition(inhibitEvent("s_1_a", "PROBLEM", "host-01", "cpu.idle", nil)); source != "" {
+		t.Errorf("the cases inhibit each other, s_1_a is inhibited by %s", source)
+	}
+}
@@ -19,11 +19,14 @@ func ReadHighEvent() {
 	}
 
 	for {
-		event, err := popEvent(queues)
+		event, suppressed, err := popEvent(queues)
 		if err != nil {
 			time.Sleep(time.Second)
 			continue
 		}
+		if suppressed {
+			continue
+		}
 		consume(event, true)
 	}
 }
@@ -35,16 +38,20 @@ func ReadLowEvent() {
 	}
 
 	for {
-		event, err := popEvent(queues)
+		event, suppressed, err := popEvent(queues)
 		if err != nil {
 			time.Sleep(time.Second)
 			continue
 		}
+		if suppressed {
+			continue
+		}
 		consume(event, false)
 	}
 }
 
-func popEvent(queues []string) (*model.Event, error) {
+// suppressed is true if the event is silenced or inhibited, its notifications should not be sent
+func popEvent(queues []string) (event *model.Event, suppressed bool, err error) {
 	count := len(queues)
 
 	params := make([]interface{}, count+1)
@@ -60,21 +67,59 @@ func popEvent(queues []string) (*model.Event, error) {
 	reply, err := redis.Strings(rc.Do("BRPOP", params...))
 	if err != nil {
 		log.Error(fmt.Sprintf("get alarm event from redis fail: %v", err))
-		return nil, err
+		return nil, false, err
 	}
 
-	var event model.Event
-	err = json.Unmarshal([]byte(reply[1]), &event)
+	event = &model.Event{}
+	err = json.Unmarshal([]byte(reply[1]), event)
 	if err != nil {
 		log.Error(fmt.Sprintf("parse alarm event fail: %v", err))
-		return nil, err
+		return nil, false, err
 	}
 
 	log.Debug(event.String())
+
+	sup := eventmodel.Suppression{}
+	if s := MatchSilence(event); s != nil {
+		log.Debugf("event %s is silenced by %v", event.Id, s)
+		sup.SilenceId = s.Id
+	}
+	if source := MatchInhibition(event); source != "" {
+		log.Debugf("event %s is inhibited by case %s", event.Id, source)
+		sup.InhibitedBy = source
+	}
+
+	// the lifecycle before the event is recorded, a new occurrence resets the acknowledgement
+	muted := ""
+	if lc, err := eventmodel.QueryCaseLifecycle(event.Id); err != nil {
+		log.Errorf("query lifecycle of case %s fail: %v", event.Id, err)
+	} else if lc != nil {
+		muted = mutedByLifecycle(event, lc, time.Now())
+	}
+	if muted != "" {
+		log.Debugf("event %s is muted: %s", event.Id, muted)
+	}
+
 	//insert event into database
-	eventmodel.InsertEvent(&event)
+	eventmodel.InsertEvent(event, sup)
 	// save in memory. display in dashboard
-	g.Events.Put(&event)
+	g.Events.Put(event)
+
+	return event, sup.IsSuppressed() || muted != "", nil
+}
 
-	return &event, nil
+// mutedByLifecycle returns the reason if the notifications of event should not be sent:
+// snoozed cases send nothing until the snooze is over, acknowledged cases stop repeat notifications.
+// A closed case is reopened by the event, its acknowledgement is reset by InsertEvent.
+func mutedByLifecycle(event *model.Event, lc *eventmodel.CaseLifecycle, now time.Time) string {
+	if lc.Snoozed(now) {
+		return fmt.Sprintf("snoozed until %s", time.Unix(lc.SnoozedUntil, 0).Format("2006-01-02 15:04:05"))
+	}
+	if event.Status == "PROBLEM" && event.CurrentStep > 1 && !lc.Recovered() && !lc.Closed() && lc.Acknowledged() {
+		if lc.AcknowledgedBy != "" {
+			return "acknowledged by " + lc.AcknowledgedBy
+		}
+		return "in progress"
+	}
+	return ""
 }
@@ -0,0 +1,43 @@
+package cron
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Cepave/open-falcon-backend/common/model"
+	eventmodel "github.com/Cepave/open-falcon-backend/modules/alarm/model/event"
+)
+
+func TestMutedByLifecycle(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	problem := func(step int) *model.Event {
+		return &model.Event{Id: "s_1_abc", Status: "PROBLEM", CurrentStep: step}
+	}
+	cases := []struct {
+		event *model.Event
+		lc    eventmodel.CaseLifecycle
+		muted bool
+	}{
+		{problem(2), eventmodel.CaseLifecycle{Status: "PROBLEM", ProcessStatus: "unresolved"}, false},
+		// repeat notifications of acknowledged cases
+		{problem(2), eventmodel.CaseLifecycle{Status: "PROBLEM", AcknowledgedBy: "alice"}, true},
+		{problem(3), eventmodel.CaseLifecycle{Status: "PROBLEM", ProcessStatus: "in progress"}, true},
+		// a new occurrence needs to be acknowledged again
+		{problem(1), eventmodel.CaseLifecycle{Status: "OK", AcknowledgedBy: "alice"}, false},
+		{problem(1), eventmodel.CaseLifecycle{Status: "PROBLEM", AcknowledgedBy: "alice"}, false},
+		// the closed case is reopened
+		{problem(2), eventmodel.CaseLifecycle{Status: "PROBLEM", ProcessStatus: "resolved", AcknowledgedBy: "alice"}, false},
+		{problem(2), eventmodel.CaseLifecycle{Status: "PROBLEM", ProcessStatus: "ignored"}, false},
+		// the recovery of acknowledged case is sent
+		{&model.Event{Status: "OK", CurrentStep: 1}, eventmodel.CaseLifecycle{Status: "PROBLEM", AcknowledgedBy: "alice"}, false},
+		// snoozed cases send nothing
+		{&model.Event{Status: "OK", CurrentStep: 1}, eventmodel.CaseLifecycle{Status: "PROBLEM", SnoozedUntil: now.Unix() + 60}, true},
+		{problem(1), eventmodel.CaseLifecycle{Status: "PROBLEM", SnoozedUntil: now.Unix() + 60}, true},
+		{problem(1), eventmodel.CaseLifecycle{Status: "PROBLEM", SnoozedUntil: now.Unix()}, false},
+	}
+	for i, c := range cases {
+		if reason := mutedByLifecycle(c.event, &c.lc, now); (reason != "") != c.muted {
+			t.Errorf("case %d: expected muted %v, got %q", i, c.muted, reason)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package cron
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Cepave/open-falcon-backend/common/model"
+	silencemodel "github.com/Cepave/open-falcon-backend/modules/alarm/model/silence"
+	log "github.com/Sirupsen/logrus"
+)
+
+type SafeSilences struct {
+	sync.RWMutex
+	L []*silencemodel.Silence
+}
+
+var Silences = &SafeSilences{L: []*silencemodel.Silence{}}
+
+func (this *SafeSilences) Get() []*silencemodel.Silence {
+	this.RLock()
+	defer this.RUnlock()
+	return this.L
+}
+
+func (this *SafeSilences) Set(silences []*silencemodel.Silence) {
+	this.Lock()
+	defer this.Unlock()
+	this.L = silences
+}
+
+// 定期从数据库同步静默规则, 新增/修改的规则在一个周期内生效
+func SyncSilences() {
+	duration := time.Duration(30) * time.Second
+	for {
+		syncSilences()
+		time.Sleep(duration)
+	}
+}
+
+func syncSilences() {
+	silences, err := silencemodel.QuerySilences(time.Now())
+	if err != nil {
+		log.Errorf("query silences fail: %v", err)
+		return
+	}
+	Silences.Set(silences)
+}
+
+// MatchSilence returns the first active silence matched with the event, nil if there is none
+func MatchSilence(event *model.Event) *silencemodel.Silence {
+	now := time.Now()
+	for _, s := range Silences.Get() {
+		if !s.IsActive(now) || !s.MatchEvent(event) {
+			continue
+		}
+
+		if s.GrpId != 0 && !HostGroups.get(event.Endpoint)[s.GrpId] {
+			continue
+		}
+
+		return s
+	}
+	return nil
+}
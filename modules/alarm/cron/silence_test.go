@@ -0,0 +1,45 @@
+package cron
+
+import (
+	"testing"
+	"time"
+
+	silencemodel "github.com/Cepave/open-falcon-backend/modules/alarm/model/silence"
+)
+
+func TestMatchSilence(t *testing.T) {
+	queries, restore := resetInhibition(nil, nil)
+	defer restore()
+
+	now := time.Now().Unix()
+	Silences.Set([]*silencemodel.Silence{
+		{Id: 1, Metric: "cpu.idle", StartAt: now + 3600},
+		{Id: 2, GrpId: 2, Metric: "cpu.idle", StartAt: now - 3600},
+		{Id: 3, Endpoint: "host-03", StartAt: now - 3600, EndAt: now + 3600},
+	})
+	defer Silences.Set(nil)
+
+	for _, c := range []struct {
+		endpoint string
+		metric   string
+		expected int
+	}{
+		{"host-01", "cpu.idle", 2},
+		{"host-02", "cpu.idle", 2},
+		{"host-01", "mem.free", 0},
+		{"host-03", "mem.free", 3},
+		// not in the host group
+		{"host-04", "cpu.idle", 0},
+		{"host-01", "cpu.idle", 2},
+	} {
+		s := MatchSilence(inhibitEvent("s_1_a", "PROBLEM", c.endpoint, c.metric, nil))
+		if (s == nil && c.expected != 0) || (s != nil && s.Id != c.expected) {
+			t.Errorf("%s/%s: expected silence %d, got %v", c.endpoint, c.metric, c.expected, s)
+		}
+	}
+
+	// the host groups are queried once for an endpoint
+	if *queries != 3 {
+		t.Errorf("expected 3 queries of host groups, got %d", *queries)
+	}
+}
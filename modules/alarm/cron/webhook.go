@@ -0,0 +1,317 @@
+package cron
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"github.com/Cepave/open-falcon-backend/common/model"
+	webhookmodel "github.com/Cepave/open-falcon-backend/modules/alarm/model/webhook"
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	// header of HMAC-SHA256 signature of body: "sha256=<hex>"
+	webhookSignatureHeader = "X-Falcon-Signature"
+	webhookMaxBackoff      = 60 * time.Second
+	// no more retries once a delivery has taken so long, including the timeouts of requests
+	webhookMaxElapsed  = 5 * time.Minute
+	webhookMaxResponse = 4096
+	// so many workers post the webhooks, the events are dropped when the queue is full
+	webhookWorkers   = 32
+	webhookQueueSize = 1024
+)
+
+// used if the body template of webhook is empty
+const defaultWebhookTemplate = `{
+	"id": {{json .Id}},
+	"endpoint": {{json .Endpoint}},
+	"metric": {{json .Metric}},
+	"tags": {{json .PushedTags}},
+	"func": {{json .Func}},
+	"left_value": {{json .LeftValue}},
+	"operator": {{json .Operator}},
+	"right_value": {{json .RightValue}},
+	"note": {{json .Note}},
+	"status": {{json .Status}},
+	"step": {{.CurrentStep}},
+	"max_step": {{.MaxStep}},
+	"priority": {{.Priority}},
+	"time": {{json .FormattedTime}},
+	"tpl_id": {{.TplId}},
+	"exp_id": {{.ExpressionId}},
+	"stra_id": {{.StrategyId}}
+}`
+
+var webhookFuncs = template.FuncMap{
+	// json renders the value as a JSON literal, e.g. a quoted and escaped string
+	"json": func(v interface{}) (string, error) {
+		bs, err := json.Marshal(v)
+		return string(bs), err
+	},
+	// tags renders pushed tags as "k1:v1,k2:v2", sorted by the keys
+	"tags": func(tags map[string]string) string {
+		keys := make([]string, 0, len(tags))
+		for k := range tags {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		l := make([]string, len(keys))
+		for i, k := range keys {
+			l[i] = fmt.Sprintf("%s:%s", k, tags[k])
+		}
+		return strings.Join(l, ",")
+	},
+}
+
+type compiledWebhook struct {
+	*webhookmodel.Webhook
+	tpl     *template.Template
+	headers map[string]string
+}
+
+func compileWebhook(hook *webhookmodel.Webhook) (*compiledWebhook, error) {
+	text := hook.BodyTemplate
+	if text == "" {
+		text = defaultWebhookTemplate
+	}
+	tpl, err := template.New(hook.Name).Funcs(webhookFuncs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := make(map[string]string)
+	if hook.Headers != "" {
+		if err := json.Unmarshal([]byte(hook.Headers), &headers); err != nil {
+			return nil, fmt.Errorf("bad headers: %v", err)
+		}
+	}
+	return &compiledWebhook{Webhook: hook, tpl: tpl, headers: headers}, nil
+}
+
+type SafeWebhooks struct {
+	sync.RWMutex
+	Hooks   map[int]*compiledWebhook
+	Actions map[int]*webhookmodel.ActionChannels
+}
+
+var Webhooks = &SafeWebhooks{
+	Hooks:   make(map[int]*compiledWebhook),
+	Actions: make(map[int]*webhookmodel.ActionChannels),
+}
+
+func (this *SafeWebhooks) Set(hooks map[int]*compiledWebhook, actions map[int]*webhookmodel.ActionChannels) {
+	this.Lock()
+	defer this.Unlock()
+	this.Hooks = hooks
+	this.Actions = actions
+}
+
+// ChannelsOf returns the notification channels of action
+func ChannelsOf(actionId int) webhookmodel.Channels {
+	Webhooks.RLock()
+	defer Webhooks.RUnlock()
+	if ac, ok := Webhooks.Actions[actionId]; ok {
+		return webhookmodel.ParseChannels(ac.Channels)
+	}
+	return webhookmodel.Channels{}
+}
+
+// WebhookOf returns the webhook of action, nil if the action has no webhook
+func WebhookOf(actionId int) *compiledWebhook {
+	Webhooks.RLock()
+	defer Webhooks.RUnlock()
+	if ac, ok := Webhooks.Actions[actionId]; ok {
+		return Webhooks.Hooks[ac.WebhookId]
+	}
+	return nil
+}
+
+// 定期同步webhook以及action的通知渠道
+func SyncWebhooks() {
+	duration := time.Duration(30) * time.Second
+	for {
+		syncWebhooks()
+		time.Sleep(duration)
+	}
+}
+
+func syncWebhooks() {
+	hooks, err := webhookmodel.QueryWebhooks()
+	if err != nil {
+		log.Errorf("query webhooks fail: %v", err)
+		return
+	}
+	actions, err := webhookmodel.QueryActionChannels()
+	if err != nil {
+		log.Errorf("query channels of action fail: %v", err)
+		return
+	}
+
+	compiled := make(map[int]*compiledWebhook, len(hooks))
+	for id, hook := range hooks {
+		c, err := compileWebhook(hook)
+		if err != nil {
+			log.Errorf("webhook %s is ignored: %v", hook.Name, err)
+			continue
+		}
+		compiled[id] = c
+	}
+	Webhooks.Set(compiled, actions)
+}
+
+type webhookTask struct {
+	hook  *compiledWebhook
+	event *model.Event
+}
+
+var (
+	webhookQueue = make(chan *webhookTask, webhookQueueSize)
+	// number of events dropped because the queue is full
+	webhookDropped uint64
+)
+
+// StartWebhookWorkers starts the workers posting the queued webhooks
+func StartWebhookWorkers() {
+	for i := 0; i < webhookWorkers; i++ {
+		go func() {
+			for task := range webhookQueue {
+				task.hook.deliver(task.event)
+			}
+		}()
+	}
+}
+
+// dispatchWebhook queues the event for the webhook of action, never blocks the consumer
+func dispatchWebhook(event *model.Event, actionId int) {
+	if !ChannelsOf(actionId).Has(webhookmodel.ChannelWebhook) {
+		return
+	}
+	hook := WebhookOf(actionId)
+	if hook == nil {
+		log.Warnf("action %d has webhook channel but no valid webhook", actionId)
+		return
+	}
+
+	select {
+	case webhookQueue <- &webhookTask{hook: hook, event: event}:
+	default:
+		dropped := atomic.AddUint64(&webhookDropped, 1)
+		log.Errorf("webhook queue is full, drop %s of webhook %s, %d dropped", event.Id, hook.Name, dropped)
+	}
+}
+
+// deliver posts the event, retries with exponential backoff on network errors, 429 and 5xx responses,
+// until max_retries or webhookMaxElapsed is reached. Every attempt is recorded in alarm_webhook_delivery.
+func (this *compiledWebhook) deliver(event *model.Event) {
+	var buf bytes.Buffer
+	if err := this.tpl.Execute(&buf, event); err != nil {
+		log.Errorf("render webhook %s for %s fail: %v", this.Name, event.Id, err)
+		this.record(&webhookmodel.Delivery{Attempt: 1, Error: "render template: " + err.Error()}, event)
+		return
+	}
+	body := buf.Bytes()
+
+	maxRetries := this.MaxRetries
+	if maxRetries < 0 {
+		maxRetries = 0
+	}
+	deadline := time.Now().Add(webhookMaxElapsed)
+	backoff := time.Second
+	attempt := 1
+	for ; ; attempt++ {
+		d, retryable := this.post(body)
+		d.Attempt = attempt
+		this.record(d, event)
+		if !retryable {
+			return
+		}
+		if attempt > maxRetries || time.Now().Add(backoff+this.timeout()).After(deadline) {
+			break
+		}
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > webhookMaxBackoff {
+			backoff = webhookMaxBackoff
+		}
+	}
+	log.Errorf("webhook %s for %s failed after %d attempts", this.Name, event.Id, attempt)
+}
+
+func (this *compiledWebhook) post(body []byte) (d *webhookmodel.Delivery, retryable bool) {
+	d = &webhookmodel.Delivery{Request: string(body)}
+
+	method := this.Method
+	if method == "" {
+		method = "POST"
+	}
+	req, err := http.NewRequest(method, this.Url, bytes.NewReader(body))
+	if err != nil {
+		d.Error = err.Error()
+		return d, false
+	}
+
+	if this.ContentType == webhookmodel.ContentTypeForm {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range this.headers {
+		req.Header.Set(k, v)
+	}
+	if this.Secret != "" {
+		req.Header.Set(webhookSignatureHeader, "sha256="+signWebhook(this.Secret, body))
+	}
+
+	client := &http.Client{Timeout: this.timeout()}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	d.Duration = time.Since(start)
+	if err != nil {
+		d.Error = err.Error()
+		return d, true
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := ioutil.ReadAll(io.LimitReader(resp.Body, webhookMaxResponse))
+	d.StatusCode = resp.StatusCode
+	d.Response = string(respBody)
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return d, false
+	}
+	d.Error = resp.Status
+	return d, resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+func (this *compiledWebhook) timeout() time.Duration {
+	if this.Timeout <= 0 {
+		return 10 * time.Second
+	}
+	return time.Duration(this.Timeout) * time.Second
+}
+
+func (this *compiledWebhook) record(d *webhookmodel.Delivery, event *model.Event) {
+	d.EventCaseId = event.Id
+	d.WebhookId = this.Id
+	if err := webhookmodel.InsertDelivery(d); err != nil {
+		log.Errorf("insert delivery of webhook %s fail: %v", this.Name, err)
+	}
+}
+
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,167 @@
+package cron
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Cepave/open-falcon-backend/common/model"
+	webhookmodel "github.com/Cepave/open-falcon-backend/modules/alarm/model/webhook"
+)
+
+func testEvent() *model.Event {
+	return &model.Event{
+		Id:          "s_1_abc",
+		Status:      "PROBLEM",
+		Endpoint:    "web-01",
+		LeftValue:   95.5,
+		CurrentStep: 1,
+		EventTime:   1500000000,
+		PushedTags:  map[string]string{"module": "nginx", "idc": "bj", "app": "web"},
+		Strategy: &model.Strategy{
+			Id: 1, Metric: "cpu.busy", Func: "all(#3)", Operator: ">", RightValue: 90,
+			MaxStep: 3, Priority: 0, Note: `cpu "busy"`, Tpl: &model.Template{Id: 2},
+		},
+	}
+}
+
+func TestSignWebhook(t *testing.T) {
+	// echo -n '{"id":1}' | openssl dgst -sha256 -hmac secret
+	if sig := signWebhook("secret", []byte(`{"id":1}`)); sig != "03def589620c813f198fd03d7967e292b163ef0435ebf43071ce0e9519763cb7" {
+		t.Errorf("unexpected signature %s", sig)
+	}
+}
+
+func TestCompileWebhook(t *testing.T) {
+	// the default template renders a JSON object
+	hook, err := compileWebhook(&webhookmodel.Webhook{Name: "default", Headers: `{"Authorization": "Bearer xxx"}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hook.headers["Authorization"] != "Bearer xxx" {
+		t.Errorf("unexpected headers %v", hook.headers)
+	}
+	var buf bytes.Buffer
+	if err := hook.tpl.Execute(&buf, testEvent()); err != nil {
+		t.Fatal(err)
+	}
+	payload := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(buf.String()), &payload); err != nil {
+		t.Fatalf("bad JSON %s: %v", buf.String(), err)
+	}
+	if payload["id"] != "s_1_abc" || payload["note"] != `cpu "busy"` || payload["right_value"] != float64(90) || payload["tpl_id"] != float64(2) {
+		t.Errorf("unexpected payload %v", payload)
+	}
+
+	// the tags are sorted by the keys
+	hook, err = compileWebhook(&webhookmodel.Webhook{Name: "text", BodyTemplate: `{{.Endpoint}} {{tags .PushedTags}}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		buf.Reset()
+		hook.tpl.Execute(&buf, testEvent())
+		if buf.String() != "web-01 app:web,idc:bj,module:nginx" {
+			t.Fatalf("unexpected body %q", buf.String())
+		}
+	}
+
+	for _, bad := range []*webhookmodel.Webhook{
+		{Name: "bad template", BodyTemplate: `{{.Endpoint`},
+		{Name: "bad headers", Headers: `["Authorization"]`},
+	} {
+		if _, err := compileWebhook(bad); err == nil {
+			t.Errorf("expected error of %s", bad.Name)
+		}
+	}
+}
+
+func TestPostWebhook(t *testing.T) {
+	var lastReq *http.Request
+	var lastBody []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		lastReq = req
+		lastBody, _ = ioutil.ReadAll(req.Body)
+		switch req.URL.Path {
+		case "/ok":
+			w.Write([]byte(strings.Repeat("a", webhookMaxResponse+1)))
+		case "/bad":
+			w.WriteHeader(http.StatusBadRequest)
+		case "/busy":
+			w.WriteHeader(http.StatusTooManyRequests)
+		case "/down":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	hook := func(path string) *compiledWebhook {
+		h, err := compileWebhook(&webhookmodel.Webhook{
+			Name: path, Url: server.URL + path, Method: "PUT", ContentType: webhookmodel.ContentTypeForm,
+			Headers: `{"X-Token": "t"}`, Secret: "secret", Timeout: 1,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+
+	body := []byte(`{"id":1}`)
+	d, retryable := hook("/ok").post(body)
+	if retryable || d.StatusCode != 200 || d.Error != "" || d.Request != string(body) || len(d.Response) != webhookMaxResponse {
+		t.Errorf("unexpected delivery %+v, retryable %v", d, retryable)
+	}
+	if lastReq.Method != "PUT" || string(lastBody) != string(body) ||
+		lastReq.Header.Get("Content-Type") != "application/x-www-form-urlencoded" || lastReq.Header.Get("X-Token") != "t" ||
+		lastReq.Header.Get(webhookSignatureHeader) != "sha256="+signWebhook("secret", body) {
+		t.Errorf("unexpected request %s %v", lastReq.Method, lastReq.Header)
+	}
+
+	for path, expected := range map[string]bool{"/bad": false, "/busy": true, "/down": true} {
+		d, retryable := hook(path).post(body)
+		if retryable != expected || d.Error == "" {
+			t.Errorf("%s: expected retryable %v, got %v, delivery %+v", path, expected, retryable, d)
+		}
+	}
+
+	// the network errors are retried, the bad requests are not
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	h := hook("/ok")
+	h.Url = closed.URL
+	if d, retryable := h.post(body); !retryable || d.Error == "" {
+		t.Errorf("network error should be retried, got %+v", d)
+	}
+	h.Method = "BAD METHOD"
+	if d, retryable := h.post(body); retryable || d.Error == "" {
+		t.Errorf("bad request should not be retried, got %+v", d)
+	}
+}
+
+func TestDispatchWebhookQueueFull(t *testing.T) {
+	hook, err := compileWebhook(&webhookmodel.Webhook{Id: 1, Name: "hook"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	Webhooks.Set(
+		map[int]*compiledWebhook{1: hook},
+		map[int]*webhookmodel.ActionChannels{1: {Id: 1, WebhookId: 1, Channels: "webhook"}},
+	)
+	defer Webhooks.Set(map[int]*compiledWebhook{}, map[int]*webhookmodel.ActionChannels{})
+
+	// no worker is started, so the queue is never drained and the consumer must not block
+	event := &model.Event{Id: "s_1"}
+	for i := 0; i < webhookQueueSize+3; i++ {
+		dispatchWebhook(event, 1)
+	}
+	if len(webhookQueue) != webhookQueueSize || webhookDropped != 3 {
+		t.Errorf("expected %d queued and 3 dropped, got %d and %d", webhookQueueSize, len(webhookQueue), webhookDropped)
+	}
+	for len(webhookQueue) > 0 {
+		<-webhookQueue
+	}
+}
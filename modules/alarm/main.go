@@ -35,6 +35,12 @@ func main() {
 	model.InitDatabase()
 
 	go http.Start()
+	go cron.SyncSilences()
+	go cron.SyncInhibitRules()
+	go cron.SyncEscalationPolicies()
+	go cron.Escalate()
+	go cron.SyncWebhooks()
+	cron.StartWebhookWorkers()
 	go cron.ReadHighEvent()
 	go cron.ReadLowEvent()
 	go cron.CombineSms()
@@ -0,0 +1,170 @@
+package escalation
+
+import (
+	"strings"
+	"time"
+
+	"github.com/astaxie/beego/orm"
+)
+
+// Step of escalation policy, the receivers are the union of:
+//   - the on-call person of schedule(ScheduleOffset 0 is the primary, 1 is the secondary, and so on)
+//   - Users, names of user, comma separated
+//   - Teams, names of team, comma separated
+type Step struct {
+	Id             int
+	PolicyId       int
+	Step           int
+	WaitMinutes    int // waiting for acknowledgement after the previous step, ignored for the first step
+	ScheduleId     int
+	ScheduleOffset int
+	Users          string
+	Teams          string
+}
+
+type Policy struct {
+	Id    int
+	Name  string
+	Steps []*Step // ordered by Step
+}
+
+// Schedule is a rotation of members, the on-call person is handed off every RotationDays days from RotationStart
+type Schedule struct {
+	Id            int
+	Name          string
+	Members       string // names of user, comma separated, in the order of rotation
+	RotationStart int64  // unix time
+	RotationDays  int
+	Overrides     []*Override
+}
+
+// Override replaces the primary on-call person of schedule in [StartAt, EndAt)
+type Override struct {
+	Id         int
+	ScheduleId int
+	User       string
+	StartAt    int64
+	EndAt      int64
+}
+
+func (this *Schedule) MemberList() []string {
+	members := []string{}
+	for _, m := range strings.Split(this.Members, ",") {
+		if m = strings.TrimSpace(m); m != "" {
+			members = append(members, m)
+		}
+	}
+	return members
+}
+
+// OnCall returns the name of on-call person at the time, offset 0 is the primary one
+func (this *Schedule) OnCall(now time.Time, offset int) string {
+	ts := now.Unix()
+	if offset == 0 {
+		for _, o := range this.Overrides {
+			if ts >= o.StartAt && ts < o.EndAt {
+				return o.User
+			}
+		}
+	}
+
+	members := this.MemberList()
+	if len(members) == 0 {
+		return ""
+	}
+
+	days := this.RotationDays
+	if days <= 0 {
+		days = 7
+	}
+
+	rotation := int64(0)
+	if ts > this.RotationStart {
+		rotation = (ts - this.RotationStart) / int64(days*86400)
+	}
+	return members[(int(rotation%int64(len(members)))+offset)%len(members)]
+}
+
+// QueryPolicies loads the policies with steps, keyed by id
+func QueryPolicies() (map[int]*Policy, error) {
+	q := orm.NewOrm()
+	q.Using("falcon_portal")
+
+	var policies []*Policy
+	if _, err := q.Raw(`SELECT id, name FROM escalation_policy`).QueryRows(&policies); err != nil {
+		return nil, err
+	}
+	var steps []*Step
+	if _, err := q.Raw(
+		`SELECT id, policy_id, step, wait_minutes, schedule_id, schedule_offset, users, teams
+		FROM escalation_step ORDER BY policy_id, step`,
+	).QueryRows(&steps); err != nil {
+		return nil, err
+	}
+
+	ret := make(map[int]*Policy, len(policies))
+	for _, p := range policies {
+		ret[p.Id] = p
+	}
+	for _, s := range steps {
+		if p, ok := ret[s.PolicyId]; ok {
+			p.Steps = append(p.Steps, s)
+		}
+	}
+	return ret, nil
+}
+
+type actionPolicy struct {
+	Id                 int
+	EscalationPolicyId int
+}
+
+// QueryActionPolicies returns action id => policy id
+func QueryActionPolicies() (map[int]int, error) {
+	q := orm.NewOrm()
+	q.Using("falcon_portal")
+
+	var rows []*actionPolicy
+	if _, err := q.Raw(`SELECT id, escalation_policy_id FROM action WHERE escalation_policy_id > 0`).QueryRows(&rows); err != nil {
+		return nil, err
+	}
+
+	ret := make(map[int]int, len(rows))
+	for _, row := range rows {
+		ret[row.Id] = row.EscalationPolicyId
+	}
+	return ret, nil
+}
+
+// QuerySchedules loads the schedules with the overrides which are not expired, keyed by id
+func QuerySchedules(now time.Time) (map[int]*Schedule, error) {
+	q := orm.NewOrm()
+	q.Using("default")
+
+	var schedules []*Schedule
+	if _, err := q.Raw(
+		`SELECT id, name, members, UNIX_TIMESTAMP(rotation_start) AS rotation_start, rotation_days
+		FROM oncall_schedule`,
+	).QueryRows(&schedules); err != nil {
+		return nil, err
+	}
+	var overrides []*Override
+	if _, err := q.Raw(
+		`SELECT id, schedule_id, user, UNIX_TIMESTAMP(start_at) AS start_at, UNIX_TIMESTAMP(end_at) AS end_at
+		FROM oncall_override WHERE end_at >= ?`,
+		now.Format("2006-01-02 15:04:05"),
+	).QueryRows(&overrides); err != nil {
+		return nil, err
+	}
+
+	ret := make(map[int]*Schedule, len(schedules))
+	for _, s := range schedules {
+		ret[s.Id] = s
+	}
+	for _, o := range overrides {
+		if s, ok := ret[o.ScheduleId]; ok {
+			s.Overrides = append(s.Overrides, o)
+		}
+	}
+	return ret, nil
+}
@@ -0,0 +1,55 @@
+package escalation
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOnCall(t *testing.T) {
+	start := int64(1500000000)
+	schedule := &Schedule{
+		Members:       "alice, bob,,carol",
+		RotationStart: start,
+		RotationDays:  2,
+		Overrides: []*Override{
+			{User: "dave", StartAt: start + 86400*5, EndAt: start + 86400*6},
+		},
+	}
+
+	for _, c := range []struct {
+		ts       int64
+		offset   int
+		expected string
+	}{
+		{start - 3600, 0, "alice"}, // 轮换开始之前是第一个人
+		{start, 0, "alice"},
+		{start, 1, "bob"},
+		{start, 2, "carol"},
+		{start, 3, "alice"},
+		{start + 86400*2 - 1, 0, "alice"},
+		{start + 86400*2, 0, "bob"},
+		{start + 86400*2, 1, "carol"},
+		{start + 86400*4, 1, "alice"},
+		{start + 86400*6, 0, "alice"}, // 轮换了一圈
+		// 临时替换只影响主值班
+		{start + 86400*5, 0, "dave"},
+		{start + 86400*5, 1, "alice"},
+		{start + 86400*6 - 1, 0, "dave"},
+	} {
+		if name := schedule.OnCall(time.Unix(c.ts, 0), c.offset); name != c.expected {
+			t.Errorf("%d(offset %d): expected %s, got %s", c.ts-start, c.offset, c.expected, name)
+		}
+	}
+
+	// 默认每7天轮换一次
+	schedule = &Schedule{Members: "alice,bob", RotationStart: start}
+	if name := schedule.OnCall(time.Unix(start+86400*7-1, 0), 0); name != "alice" {
+		t.Errorf("expected alice, got %s", name)
+	}
+	if name := schedule.OnCall(time.Unix(start+86400*7, 0), 0); name != "bob" {
+		t.Errorf("expected bob, got %s", name)
+	}
+	if name := (&Schedule{Members: " , "}).OnCall(time.Unix(start, 0), 0); name != "" {
+		t.Errorf("expected nobody, got %s", name)
+	}
+}
@@ -25,6 +25,8 @@ type EventCases struct {
 	ExpressionId  int       `json:"expression_id"`
 	StrategyId    int       `json:"strategy_id"`
 	TemplateId    int       `json:"template_id"`
+	SilenceId     int       `json:"silence_id"`
+	InhibitedBy   string    `json:"inhibited_by"`
 	Events        []*Events `json:"evevnts" orm:"reverse(many)"`
 }
 
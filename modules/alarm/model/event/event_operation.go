@@ -37,7 +37,20 @@ func insertEvent(q orm.Ormer, eve *coommonModel.Event) (res interface{}, err err
 	return
 }
 
-func InsertEvent(eve *coommonModel.Event) {
+// Suppression records why the notifications of event are not sent
+type Suppression struct {
+	// id of alarm_silence which mutes the event, 0 if it is not silenced
+	SilenceId int
+	// id of event case which inhibits the event, empty if it is not inhibited
+	InhibitedBy string
+}
+
+func (this Suppression) IsSuppressed() bool {
+	return this.SilenceId != 0 || this.InhibitedBy != ""
+}
+
+// InsertEvent records the event into event_cases/events
+func InsertEvent(eve *coommonModel.Event, sup Suppression) {
 	q := orm.NewOrm()
 	q.Using("falcon_portal")
 	var event []EventCases
@@ -64,8 +77,10 @@ func InsertEvent(eve *coommonModel.Event) {
 					tpl_creator,
 					expression_id,
 					strategy_id,
-					template_id
-					) VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`
+					template_id,
+					silence_id,
+					inhibited_by
+					) VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`
 		tpl_creator := ""
 		if eve.Tpl() != nil {
 			tpl_creator = eve.Tpl().Creator
@@ -91,7 +106,9 @@ func InsertEvent(eve *coommonModel.Event) {
 			eve.ExpressionId(),
 			eve.StrategyId(),
 			//template_id
-			eve.TplId()).Exec()
+			eve.TplId(),
+			sup.SilenceId,
+			sup.InhibitedBy).Exec()
 
 	} else {
 		sqltemplete := `UPDATE event_cases SET
@@ -106,11 +123,17 @@ func InsertEvent(eve *coommonModel.Event) {
 				tpl_creator = ?,
 				expression_id = ?,
 				strategy_id = ?,
-				template_id = ?`
+				template_id = ?,
+				silence_id = ?,
+				inhibited_by = ?`
 		//reopen case
 		if event[0].ProcessStatus == "resolved" || event[0].ProcessStatus == "ignored" {
 			sqltemplete = fmt.Sprintf("%v ,process_status = '%s', process_note = %d", sqltemplete, "unresolved", 0)
 		}
+		//the acknowledgement is only for the occurrence, a new occurrence or a reopened case needs to be acknowledged again
+		if (eve.Status == "PROBLEM" && eve.CurrentStep == 1) || event[0].ProcessStatus == "resolved" || event[0].ProcessStatus == "ignored" {
+			sqltemplete = fmt.Sprintf("%v ,acknowledged_by = '', acknowledged_at = NULL", sqltemplete)
+		}
 
 		tpl_creator := ""
 		if eve.Tpl() != nil {
@@ -133,6 +156,8 @@ func InsertEvent(eve *coommonModel.Event) {
 				eve.ExpressionId(),
 				eve.StrategyId(),
 				eve.TplId(),
+				sup.SilenceId,
+				sup.InhibitedBy,
 				time.Unix(eve.EventTime, 0).Format(timeLayout),
 				eve.Id,
 			).Exec()
@@ -152,6 +177,8 @@ func InsertEvent(eve *coommonModel.Event) {
 				eve.ExpressionId(),
 				eve.StrategyId(),
 				eve.TplId(),
+				sup.SilenceId,
+				sup.InhibitedBy,
 				eve.Id,
 			).Exec()
 		}
@@ -162,6 +189,52 @@ func InsertEvent(eve *coommonModel.Event) {
 	log.Debug(fmt.Sprintf("%v, %v", res2, err))
 }
 
+// CaseLifecycle is the handling state of case, which is maintained by f2e-api
+type CaseLifecycle struct {
+	Id             string
+	Status         string
+	ProcessStatus  string
+	AcknowledgedBy string
+	SnoozedUntil   int64 // unix time, 0 if the case is not snoozed
+}
+
+// Acknowledged means someone is handling the case, repeat notifications are not sent
+func (this *CaseLifecycle) Acknowledged() bool {
+	return this.AcknowledgedBy != "" || this.ProcessStatus == "in progress"
+}
+
+// Closed means the case is resolved manually or ignored
+func (this *CaseLifecycle) Closed() bool {
+	return this.ProcessStatus == "resolved" || this.ProcessStatus == "ignored"
+}
+
+// Snoozed means all notifications of the case are not sent until SnoozedUntil
+func (this *CaseLifecycle) Snoozed(now time.Time) bool {
+	return this.SnoozedUntil > now.Unix()
+}
+
+func (this *CaseLifecycle) Recovered() bool {
+	return this.Status == "OK"
+}
+
+// QueryCaseLifecycle returns nil if the case does not exist
+func QueryCaseLifecycle(id string) (*CaseLifecycle, error) {
+	q := orm.NewOrm()
+	q.Using("falcon_portal")
+
+	var rows []*CaseLifecycle
+	_, err := q.Raw(
+		`SELECT id, status, IFNULL(process_status, '') AS process_status, acknowledged_by,
+			IFNULL(UNIX_TIMESTAMP(snoozed_until), 0) AS snoozed_until
+		FROM event_cases WHERE id = ?`,
+		id,
+	).QueryRows(&rows)
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+	return rows[0], nil
+}
+
 func counterGen(metric string, tags string) (mycounter string) {
 	mycounter = metric
 	if tags != "" {
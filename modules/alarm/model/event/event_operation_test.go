@@ -0,0 +1,30 @@
+package event
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCaseLifecycle(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	cases := []struct {
+		lc                                       CaseLifecycle
+		acknowledged, closed, snoozed, recovered bool
+	}{
+		{CaseLifecycle{Status: "PROBLEM", ProcessStatus: "unresolved"}, false, false, false, false},
+		{CaseLifecycle{Status: "PROBLEM", ProcessStatus: "unresolved", AcknowledgedBy: "alice"}, true, false, false, false},
+		{CaseLifecycle{Status: "PROBLEM", ProcessStatus: "in progress"}, true, false, false, false},
+		{CaseLifecycle{Status: "PROBLEM", ProcessStatus: "resolved"}, false, true, false, false},
+		{CaseLifecycle{Status: "PROBLEM", ProcessStatus: "ignored", AcknowledgedBy: "alice"}, true, true, false, false},
+		{CaseLifecycle{Status: "OK", ProcessStatus: ""}, false, false, false, true},
+		{CaseLifecycle{Status: "PROBLEM", SnoozedUntil: now.Unix() + 1}, false, false, true, false},
+		// the snooze is over
+		{CaseLifecycle{Status: "PROBLEM", SnoozedUntil: now.Unix()}, false, false, false, false},
+	}
+	for i, c := range cases {
+		if c.lc.Acknowledged() != c.acknowledged || c.lc.Closed() != c.closed ||
+			c.lc.Snoozed(now) != c.snoozed || c.lc.Recovered() != c.recovered {
+			t.Errorf("case %d: unexpected predicates of %+v", i, c.lc)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package inhibit
+
+import (
+	"fmt"
+	"strings"
+
+	coommonModel "github.com/Cepave/open-falcon-backend/common/model"
+	"github.com/Cepave/open-falcon-backend/common/utils"
+	"github.com/astaxie/beego/orm"
+)
+
+// Labels of Rule.Equal which are not tags of event
+const (
+	LabelEndpoint  = "endpoint"
+	LabelHostGroup = "grp"
+)
+
+// Case is the subject of inhibition, built from an event or a row of event_cases
+type Case struct {
+	Id         string
+	Endpoint   string
+	Metric     string
+	Tags       map[string]string
+	StrategyId int
+}
+
+func CaseOfEvent(eve *coommonModel.Event) *Case {
+	return &Case{
+		Id:         eve.Id,
+		Endpoint:   eve.Endpoint,
+		Metric:     eve.Metric(),
+		Tags:       eve.PushedTags,
+		StrategyId: eve.StrategyId(),
+	}
+}
+
+func (this *Case) String() string {
+	return fmt.Sprintf("<Id:%s, Endpoint:%s, Metric:%s, Tags:%v>", this.Id, this.Endpoint, this.Metric, this.Tags)
+}
+
+// Rule: while an event matching source is PROBLEM,
+// suppress notifications for events matching target that share the labels of Equal.
+//
+// Empty(or zero) matcher matches everything.
+type Rule struct {
+	Id               int
+	SourceMetric     string
+	SourceTags       string // "k1=v1,k2=v2"
+	SourceStrategyId int
+	TargetMetric     string
+	TargetTags       string
+	TargetStrategyId int
+	Equal            string // "endpoint", "grp" or names of tags, comma separated
+	Creator          string
+	Comment          string
+}
+
+func (this *Rule) MatchSource(c *Case) bool {
+	return matchCase(c, this.SourceMetric, this.SourceTags, this.SourceStrategyId)
+}
+
+func (this *Rule) MatchTarget(c *Case) bool {
+	return matchCase(c, this.TargetMetric, this.TargetTags, this.TargetStrategyId)
+}
+
+// EqualLabels returns the labels which should be shared by source and target
+func (this *Rule) EqualLabels() []string {
+	labels := []string{}
+	for _, label := range strings.Split(this.Equal, ",") {
+		if label = strings.TrimSpace(label); label != "" {
+			labels = append(labels, label)
+		}
+	}
+	return labels
+}
+
+func matchCase(c *Case, metric string, tags string, strategyId int) bool {
+	if metric != "" && metric != c.Metric {
+		return false
+	}
+	if strategyId != 0 && strategyId != c.StrategyId {
+		return false
+	}
+	for k, v := range utils.DictedTagstring(tags) {
+		if pushed, ok := c.Tags[k]; !ok || pushed != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Dependency: while the parent endpoint has a PROBLEM event(of ParentMetric if it is not empty),
+// notifications of the child endpoint are suppressed.
+type Dependency struct {
+	Id           int
+	Parent       string
+	Child        string
+	ParentMetric string
+}
+
+func (this *Dependency) MatchParent(c *Case) bool {
+	return c.Endpoint == this.Parent && (this.ParentMetric == "" || this.ParentMetric == c.Metric)
+}
+
+func QueryRules() (rules []*Rule, err error) {
+	q := orm.NewOrm()
+	q.Using("falcon_portal")
+	_, err = q.Raw(
+		`SELECT id, source_metric, source_tags, source_strategy_id,
+			target_metric, target_tags, target_strategy_id, equal, creator, comment
+		FROM alarm_inhibit_rule`,
+	).QueryRows(&rules)
+	return
+}
+
+func QueryDependencies() (deps []*Dependency, err error) {
+	q := orm.NewOrm()
+	q.Using("falcon_portal")
+	_, err = q.Raw(`SELECT id, parent, child, parent_metric FROM alarm_endpoint_dependency`).QueryRows(&deps)
+	return
+}
+
+type problemCase struct {
+	Id          string
+	Endpoint    string
+	Metric      string // counter, "metric/tags"
+	StrategyId  int
+	InhibitedBy string
+}
+
+// QueryProblemCases loads the cases which are PROBLEM and updated within maxAge seconds,
+// returns the cases and the inhibition of them(case id => id of inhibiting case)
+func QueryProblemCases(maxAge int64) (cases []*Case, inhibited map[string]string, err error) {
+	q := orm.NewOrm()
+	q.Using("falcon_portal")
+
+	var rows []*problemCase
+	_, err = q.Raw(
+		`SELECT id, endpoint, metric, IFNULL(strategy_id, 0) AS strategy_id, inhibited_by
+		FROM event_cases
+		WHERE status = 'PROBLEM' AND update_at >= DATE_SUB(NOW(), INTERVAL ? SECOND)`,
+		maxAge,
+	).QueryRows(&rows)
+	if err != nil {
+		return
+	}
+
+	inhibited = make(map[string]string)
+	for _, row := range rows {
+		metric, tags := row.Metric, ""
+		if idx := strings.Index(row.Metric, "/"); idx >= 0 {
+			metric, tags = row.Metric[:idx], row.Metric[idx+1:]
+		}
+		cases = append(cases, &Case{
+			Id:         row.Id,
+			Endpoint:   row.Endpoint,
+			Metric:     metric,
+			Tags:       utils.DictedTagstring(tags),
+			StrategyId: row.StrategyId,
+		})
+		if row.InhibitedBy != "" {
+			inhibited[row.Id] = row.InhibitedBy
+		}
+	}
+	return
+}
+
+// QueryHostGroups returns ids of host groups which the endpoint belongs to
+func QueryHostGroups(endpoint string) (grpIds []int, err error) {
+	q := orm.NewOrm()
+	q.Using("falcon_portal")
+	_, err = q.Raw(
+		`SELECT gh.grp_id FROM host h
+		INNER JOIN grp_host gh ON h.id = gh.host_id
+		WHERE h.hostname = ?`,
+		endpoint,
+	).QueryRows(&grpIds)
+	return
+}
@@ -0,0 +1,128 @@
+package silence
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	coommonModel "github.com/Cepave/open-falcon-backend/common/model"
+	"github.com/Cepave/open-falcon-backend/common/utils"
+	"github.com/astaxie/beego/orm"
+)
+
+const timeLayout = "2006-01-02 15:04:05"
+
+// Silence mutes the notifications of matched events during the time window,
+// the events are still recorded into event_cases.
+//
+// Empty(or zero) matcher matches everything.
+// If Weekdays/DailyBegin/DailyEnd is set, the silence is a recurring window within [StartAt, EndAt],
+// e.g. Weekdays: "0", DailyBegin: "02:00", DailyEnd: "04:00" means every Sunday 02:00 ~ 04:00.
+type Silence struct {
+	Id         int
+	Endpoint   string
+	GrpId      int
+	Metric     string
+	Tags       string // "k1=v1,k2=v2", all of them must be in pushed tags of event
+	StrategyId int
+	TplId      int
+	StartAt    int64 // unix time
+	EndAt      int64 // unix time, 0 means no end
+	Weekdays   string
+	DailyBegin string
+	DailyEnd   string
+	Creator    string
+	Comment    string
+}
+
+func (this *Silence) String() string {
+	return fmt.Sprintf(
+		"<Id:%d, Endpoint:%s, GrpId:%d, Metric:%s, Tags:%s, StrategyId:%d, TplId:%d, Creator:%s>",
+		this.Id, this.Endpoint, this.GrpId, this.Metric, this.Tags, this.StrategyId, this.TplId, this.Creator,
+	)
+}
+
+// IsActive checks whether the time is in the window of silence.
+// Weekdays are the days on which the daily windows begin, e.g. Weekdays: "5", DailyBegin: "23:00", DailyEnd: "01:00"
+// means Friday 23:00 ~ Saturday 01:00.
+func (this *Silence) IsActive(now time.Time) bool {
+	ts := now.Unix()
+	if ts < this.StartAt || (this.EndAt != 0 && ts > this.EndAt) {
+		return false
+	}
+
+	day := now
+	if this.DailyBegin != "" && this.DailyEnd != "" {
+		clock := now.Format("15:04")
+		switch {
+		case this.DailyBegin <= this.DailyEnd:
+			if clock < this.DailyBegin || clock >= this.DailyEnd {
+				return false
+			}
+		case clock >= this.DailyBegin:
+		case clock < this.DailyEnd:
+			// crosses midnight, e.g. 23:00 ~ 01:00, the window began yesterday
+			day = now.AddDate(0, 0, -1)
+		default:
+			return false
+		}
+	}
+
+	return this.onWeekday(day.Weekday())
+}
+
+func (this *Silence) onWeekday(weekday time.Weekday) bool {
+	if this.Weekdays == "" {
+		return true
+	}
+	day := strconv.Itoa(int(weekday))
+	for _, d := range strings.Split(this.Weekdays, ",") {
+		if strings.TrimSpace(d) == day {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchEvent checks the matchers except host group, which needs querying database
+func (this *Silence) MatchEvent(eve *coommonModel.Event) bool {
+	if this.Endpoint != "" && this.Endpoint != eve.Endpoint {
+		return false
+	}
+	if this.Metric != "" && this.Metric != eve.Metric() {
+		return false
+	}
+	if this.StrategyId != 0 && this.StrategyId != eve.StrategyId() {
+		return false
+	}
+	if this.TplId != 0 && this.TplId != eve.TplId() {
+		return false
+	}
+
+	if this.Tags != "" {
+		for k, v := range utils.DictedTagstring(this.Tags) {
+			if pushed, ok := eve.PushedTags[k]; !ok || pushed != v {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// QuerySilences loads the silences which are not expired
+func QuerySilences(now time.Time) (silences []*Silence, err error) {
+	q := orm.NewOrm()
+	q.Using("falcon_portal")
+	_, err = q.Raw(
+		`SELECT id, endpoint, grp_id, metric, tags, strategy_id, tpl_id,
+			UNIX_TIMESTAMP(start_at) AS start_at,
+			IFNULL(UNIX_TIMESTAMP(end_at), 0) AS end_at,
+			weekdays, daily_begin, daily_end, creator, comment
+		FROM alarm_silence
+		WHERE end_at IS NULL OR end_at >= ?`,
+		now.Format(timeLayout),
+	).QueryRows(&silences)
+	return
+}
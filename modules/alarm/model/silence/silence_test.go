@@ -0,0 +1,92 @@
+package silence
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	coommonModel "github.com/Cepave/open-falcon-backend/common/model"
+)
+
+func TestIsActive(t *testing.T) {
+	// 2017-09-01 is Friday
+	at := func(day int, clock string) time.Time {
+		ts, err := time.ParseInLocation("2006-01-02 15:04", fmt.Sprintf("2017-09-%02d %s", day, clock), time.UTC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ts
+	}
+	window := &Silence{StartAt: at(1, "00:00").Unix(), EndAt: at(30, "00:00").Unix()}
+	friday := &Silence{StartAt: window.StartAt, Weekdays: "5", DailyBegin: "02:00", DailyEnd: "04:00"}
+	fridayNight := &Silence{StartAt: window.StartAt, Weekdays: "5", DailyBegin: "23:00", DailyEnd: "01:00"}
+	weekend := &Silence{StartAt: window.StartAt, Weekdays: "0, 6"}
+	nightly := &Silence{StartAt: window.StartAt, DailyBegin: "22:00", DailyEnd: "06:00"}
+
+	for i, c := range []struct {
+		silence  *Silence
+		now      time.Time
+		expected bool
+	}{
+		{window, at(1, "00:00"), true},
+		{window, at(15, "12:00"), true},
+		{window, at(30, "00:01"), false},
+		{window, at(1, "00:00").Add(-time.Second), false},
+
+		{friday, at(1, "02:00"), true},
+		{friday, at(1, "03:59"), true},
+		{friday, at(1, "04:00"), false},
+		{friday, at(2, "03:00"), false},
+		{friday, at(8, "03:00"), true},
+
+		// the window crossing midnight is checked by the day it begins
+		{fridayNight, at(1, "23:30"), true},
+		{fridayNight, at(2, "00:30"), true},
+		{fridayNight, at(2, "01:00"), false},
+		{fridayNight, at(2, "23:30"), false},
+		{fridayNight, at(1, "00:30"), false},
+		{fridayNight, at(1, "12:00"), false},
+
+		{weekend, at(2, "12:00"), true},
+		{weekend, at(3, "23:59"), true},
+		{weekend, at(4, "00:00"), false},
+
+		{nightly, at(3, "23:00"), true},
+		{nightly, at(4, "05:59"), true},
+		{nightly, at(4, "06:00"), false},
+		{nightly, at(4, "21:59"), false},
+	} {
+		if active := c.silence.IsActive(c.now); active != c.expected {
+			t.Errorf("case %d: expected %v at %s(%s), got %v", i, c.expected, c.now, c.now.Weekday(), active)
+		}
+	}
+}
+
+func TestMatchEvent(t *testing.T) {
+	event := &coommonModel.Event{
+		Endpoint:   "host-01",
+		Strategy:   &coommonModel.Strategy{Id: 10, Metric: "cpu.idle", Tpl: &coommonModel.Template{Id: 3}},
+		PushedTags: map[string]string{"idc": "bj", "role": "db"},
+	}
+
+	for i, c := range []struct {
+		silence  *Silence
+		expected bool
+	}{
+		{&Silence{}, true},
+		{&Silence{Endpoint: "host-01", Metric: "cpu.idle"}, true},
+		{&Silence{Endpoint: "host-02"}, false},
+		{&Silence{Metric: "mem.free"}, false},
+		{&Silence{StrategyId: 10, TplId: 3}, true},
+		{&Silence{StrategyId: 11}, false},
+		{&Silence{TplId: 4}, false},
+		{&Silence{Tags: "idc=bj"}, true},
+		{&Silence{Tags: "idc=bj,role=db"}, true},
+		{&Silence{Tags: "idc=sh"}, false},
+		{&Silence{Tags: "idc=bj,port=80"}, false},
+	} {
+		if matched := c.silence.MatchEvent(event); matched != c.expected {
+			t.Errorf("case %d %v: expected %v, got %v", i, c.silence, c.expected, matched)
+		}
+	}
+}
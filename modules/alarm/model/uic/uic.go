@@ -1,6 +1,12 @@
 package uic
 
-import "time"
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/astaxie/beego/orm"
+)
 
 type User struct {
 	Id      int64     `json:"id"`
@@ -21,3 +27,18 @@ type Session struct {
 	Sig     string
 	Expired int
 }
+
+// QueryUsersByName loads the users of names from uic
+func QueryUsersByName(names []string) (users []*User, err error) {
+	if len(names) == 0 {
+		return []*User{}, nil
+	}
+
+	q := orm.NewOrm()
+	q.Using("default")
+	_, err = q.Raw(
+		fmt.Sprintf("SELECT id, name, cnname, email, phone, im, qq, role FROM user WHERE name IN (%s)", strings.TrimSuffix(strings.Repeat("?,", len(names)), ",")),
+		names,
+	).QueryRows(&users)
+	return
+}
@@ -0,0 +1,141 @@
+package webhook
+
+import (
+	"strings"
+	"time"
+
+	"github.com/astaxie/beego/orm"
+)
+
+// Notification channels of action
+const (
+	ChannelSms        = "sms"
+	ChannelMail       = "mail"
+	ChannelQQ         = "qq"
+	ChannelServerchan = "serverchan"
+	ChannelWebhook    = "webhook"
+)
+
+// Content types of webhook body
+const (
+	ContentTypeJson = "json"
+	ContentTypeForm = "form"
+)
+
+// Webhook posts the body rendered from BodyTemplate(text/template, the data is the event) to Url.
+// If Secret is not empty, the body is signed by HMAC-SHA256 in header "X-Falcon-Signature".
+type Webhook struct {
+	Id           int
+	Name         string
+	Url          string
+	Method       string
+	ContentType  string
+	Headers      string // JSON object, e.g. {"Authorization": "Bearer xxx"}
+	BodyTemplate string
+	Secret       string
+	MaxRetries   int
+	Timeout      int // seconds
+}
+
+// Channels is the set of notification channels of action, empty means sms, mail, qq and serverchan
+type Channels map[string]bool
+
+func ParseChannels(s string) Channels {
+	channels := Channels{}
+	for _, c := range strings.Split(s, ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			channels[c] = true
+		}
+	}
+	return channels
+}
+
+func (this Channels) Has(channel string) bool {
+	if len(this) == 0 {
+		return channel != ChannelWebhook
+	}
+	return this[channel]
+}
+
+// ActionChannels is the notification settings of action which are not provided by portal api
+type ActionChannels struct {
+	Id        int
+	WebhookId int
+	Channels  string
+}
+
+func QueryWebhooks() (map[int]*Webhook, error) {
+	q := orm.NewOrm()
+	q.Using("falcon_portal")
+
+	var hooks []*Webhook
+	if _, err := q.Raw(
+		`SELECT id, name, url, method, content_type, headers, body_template, secret, max_retries, timeout
+		FROM alarm_webhook`,
+	).QueryRows(&hooks); err != nil {
+		return nil, err
+	}
+
+	ret := make(map[int]*Webhook, len(hooks))
+	for _, h := range hooks {
+		ret[h.Id] = h
+	}
+	return ret, nil
+}
+
+// QueryActionChannels returns action id => channels, only for the actions which have customized channels or webhook
+func QueryActionChannels() (map[int]*ActionChannels, error) {
+	q := orm.NewOrm()
+	q.Using("falcon_portal")
+
+	var rows []*ActionChannels
+	if _, err := q.Raw(
+		`SELECT id, webhook_id, channels FROM action WHERE webhook_id > 0 OR channels <> ''`,
+	).QueryRows(&rows); err != nil {
+		return nil, err
+	}
+
+	ret := make(map[int]*ActionChannels, len(rows))
+	for _, row := range rows {
+		ret[row.Id] = row
+	}
+	return ret, nil
+}
+
+// Delivery is an attempt of posting webhook
+type Delivery struct {
+	EventCaseId string
+	WebhookId   int
+	Attempt     int
+	StatusCode  int
+	Request     string
+	Response    string
+	Error       string
+	Duration    time.Duration
+}
+
+func InsertDelivery(d *Delivery) error {
+	q := orm.NewOrm()
+	q.Using("falcon_portal")
+	_, err := q.Raw(
+		`INSERT INTO alarm_webhook_delivery
+			(event_caseId, webhook_id, attempt, status_code, request, response, error, duration_ms, create_at)
+		VALUES(?,?,?,?,?,?,?,?,NOW())`,
+		d.EventCaseId,
+		d.WebhookId,
+		d.Attempt,
+		d.StatusCode,
+		truncate(d.Request, 4096),
+		truncate(d.Response, 4096),
+		truncate(d.Error, 255),
+		int64(d.Duration/time.Millisecond),
+	).Exec()
+	return err
+}
+
+func truncate(s string, max int) string {
+	if len(s) > max {
+		return s[:max]
+	}
+	return s
+}
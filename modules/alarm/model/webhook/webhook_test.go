@@ -0,0 +1,19 @@
+package webhook
+
+import "testing"
+
+func TestChannels(t *testing.T) {
+	// empty means sms, mail, qq and serverchan
+	for _, s := range []string{"", " , "} {
+		channels := ParseChannels(s)
+		if !channels.Has(ChannelSms) || !channels.Has(ChannelMail) || !channels.Has(ChannelQQ) ||
+			!channels.Has(ChannelServerchan) || channels.Has(ChannelWebhook) {
+			t.Errorf("unexpected channels of %q: %v", s, channels)
+		}
+	}
+
+	channels := ParseChannels(" webhook, mail ")
+	if !channels.Has(ChannelWebhook) || !channels.Has(ChannelMail) || channels.Has(ChannelSms) || channels.Has(ChannelQQ) {
+		t.Errorf("unexpected channels: %v", channels)
+	}
+}
@@ -0,0 +1,497 @@
+package alarm
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	h "github.com/Cepave/open-falcon-backend/modules/f2e-api/app/helper"
+	alm "github.com/Cepave/open-falcon-backend/modules/f2e-api/app/model/alarm"
+	"github.com/gin-gonic/gin"
+)
+
+func GetEscalationPolicies(c *gin.Context) {
+	policies := []alm.EscalationPolicy{}
+	if dt := db.Alarm.Order("id DESC").Find(&policies); dt.Error != nil {
+		h.JSONR(c, expecstatus, dt.Error)
+		return
+	}
+	steps := []alm.EscalationStep{}
+	if dt := db.Alarm.Order("policy_id, step").Find(&steps); dt.Error != nil {
+		h.JSONR(c, expecstatus, dt.Error)
+		return
+	}
+	stepsOfPolicy := make(map[int64][]alm.EscalationStep)
+	for _, s := range steps {
+		stepsOfPolicy[s.PolicyId] = append(stepsOfPolicy[s.PolicyId], s)
+	}
+	for i := range policies {
+		policies[i].Steps = stepsOfPolicy[policies[i].ID]
+	}
+	h.JSONR(c, policies)
+}
+
+func GetEscalationPolicy(c *gin.Context) {
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		h.JSONR(c, badstatus, "id is missing or not a number")
+		return
+	}
+	policy := alm.EscalationPolicy{ID: int64(id)}
+	if dt := db.Alarm.Find(&policy); dt.Error != nil {
+		h.JSONR(c, badstatus, dt.Error)
+		return
+	}
+	if dt := db.Alarm.Where("policy_id = ?", id).Order("step").Find(&policy.Steps); dt.Error != nil {
+		h.JSONR(c, expecstatus, dt.Error)
+		return
+	}
+	h.JSONR(c, policy)
+}
+
+type APIEscalationStepInputs struct {
+	//minutes waiting for acknowledgement before escalating to this step, ignored for the first step
+	WaitMinutes int `json:"wait_minutes" form:"wait_minutes"`
+	//notify the on-call person of schedule, offset 0 is the primary, 1 is the secondary
+	ScheduleId     int64 `json:"schedule_id" form:"schedule_id"`
+	ScheduleOffset int   `json:"schedule_offset" form:"schedule_offset"`
+	//names of user/team, comma separated
+	Users string `json:"users" form:"users"`
+	Teams string `json:"teams" form:"teams"`
+}
+
+// APIEscalationPolicyInputs is shared by creating and updating, steps are replaced as a whole
+type APIEscalationPolicyInputs struct {
+	Name  string                    `json:"name" form:"name" binding:"required"`
+	Steps []APIEscalationStepInputs `json:"steps" form:"steps" binding:"required"`
+}
+
+func (this APIEscalationPolicyInputs) CheckFormat() (err error) {
+	if len(this.Steps) == 0 {
+		return errors.New("at least one step is needed")
+	}
+	for i, s := range this.Steps {
+		switch {
+		case s.ScheduleId == 0 && s.Users == "" && s.Teams == "":
+			err = fmt.Errorf("step %d: at least one of schedule_id, users and teams is needed", i+1)
+		case s.WaitMinutes < 0 || s.ScheduleOffset < 0:
+			err = fmt.Errorf("step %d: wait_minutes and schedule_offset should not be negative", i+1)
+		case i > 0 && s.WaitMinutes == 0:
+			err = fmt.Errorf("step %d: wait_minutes is needed", i+1)
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (this APIEscalationPolicyInputs) steps(policyId int64) []alm.EscalationStep {
+	steps := make([]alm.EscalationStep, 0, len(this.Steps))
+	for i, s := range this.Steps {
+		steps = append(steps, alm.EscalationStep{
+			PolicyId:       policyId,
+			Step:           i + 1,
+			WaitMinutes:    s.WaitMinutes,
+			ScheduleId:     s.ScheduleId,
+			ScheduleOffset: s.ScheduleOffset,
+			Users:          s.Users,
+			Teams:          s.Teams,
+		})
+	}
+	return steps
+}
+
+func CreateEscalationPolicy(c *gin.Context) {
+	var inputs APIEscalationPolicyInputs
+	if err := c.BindJSON(&inputs); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	if err := inputs.CheckFormat(); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	user, err := h.GetUser(c)
+	if err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	createAt := time.Now()
+	policy := alm.EscalationPolicy{
+		Name:     inputs.Name,
+		Creator:  user.Name,
+		CreateAt: &createAt,
+	}
+	tx := db.Alarm.Begin()
+	if dt := tx.Save(&policy); dt.Error != nil {
+		tx.Rollback()
+		h.JSONR(c, expecstatus, dt.Error)
+		return
+	}
+	for _, step := range inputs.steps(policy.ID) {
+		if dt := tx.Save(&step); dt.Error != nil {
+			tx.Rollback()
+			h.JSONR(c, expecstatus, dt.Error)
+			return
+		}
+		policy.Steps = append(policy.Steps, step)
+	}
+	tx.Commit()
+	h.JSONR(c, policy)
+}
+
+type APIUpdateEscalationPolicyInputs struct {
+	ID int64 `json:"id" form:"id" binding:"required"`
+	APIEscalationPolicyInputs
+}
+
+func UpdateEscalationPolicy(c *gin.Context) {
+	var inputs APIUpdateEscalationPolicyInputs
+	if err := c.BindJSON(&inputs); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	if err := inputs.CheckFormat(); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	user, err := h.GetUser(c)
+	if err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	policy := alm.EscalationPolicy{ID: inputs.ID}
+	if dt := db.Alarm.Find(&policy); dt.Error != nil {
+		h.JSONR(c, expecstatus, fmt.Sprintf("find escalation policy got error:%v", dt.Error))
+		return
+	}
+	if policy.Creator != user.Name && !user.IsAdmin() {
+		h.JSONR(c, badstatus, "You don't have permission!")
+		return
+	}
+	tx := db.Alarm.Begin()
+	if dt := tx.Model(&policy).Where("id = ?", policy.ID).Update("name", inputs.Name); dt.Error != nil {
+		tx.Rollback()
+		h.JSONR(c, expecstatus, dt.Error)
+		return
+	}
+	if dt := tx.Where("policy_id = ?", policy.ID).Delete(alm.EscalationStep{}); dt.Error != nil {
+		tx.Rollback()
+		h.JSONR(c, expecstatus, dt.Error)
+		return
+	}
+	for _, step := range inputs.steps(policy.ID) {
+		if dt := tx.Save(&step); dt.Error != nil {
+			tx.Rollback()
+			h.JSONR(c, expecstatus, dt.Error)
+			return
+		}
+	}
+	tx.Commit()
+	h.JSONR(c, fmt.Sprintf("escalation policy:%d has been updated", policy.ID))
+}
+
+func DeleteEscalationPolicy(c *gin.Context) {
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		h.JSONR(c, badstatus, "id is missing or not a number")
+		return
+	}
+	user, err := h.GetUser(c)
+	if err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	policy := alm.EscalationPolicy{ID: int64(id)}
+	if dt := db.Alarm.Find(&policy); dt.Error != nil {
+		h.JSONR(c, badstatus, dt.Error)
+		return
+	}
+	if policy.Creator != user.Name && !user.IsAdmin() {
+		h.JSONR(c, badstatus, "You don't have permission!")
+		return
+	}
+	tx := db.Alarm.Begin()
+	// actions fall back to notifying their own receivers
+	if dt := tx.Table("action").Where("escalation_policy_id = ?", id).Update("escalation_policy_id", 0); dt.Error != nil {
+		tx.Rollback()
+		h.JSONR(c, expecstatus, dt.Error)
+		return
+	}
+	if dt := tx.Delete(&policy); dt.Error != nil {
+		tx.Rollback()
+		h.JSONR(c, expecstatus, dt.Error)
+		return
+	}
+	tx.Commit()
+	h.JSONR(c, fmt.Sprintf("escalation policy:%d has been deleted", id))
+}
+
+func GetOncallSchedules(c *gin.Context) {
+	schedules := []alm.OncallSchedule{}
+	if dt := db.Uic.Order("id DESC").Find(&schedules); dt.Error != nil {
+		h.JSONR(c, expecstatus, dt.Error)
+		return
+	}
+	h.JSONR(c, schedules)
+}
+
+func GetOncallSchedule(c *gin.Context) {
+	schedule, err := findOncallSchedule(c.Params.ByName("id"))
+	if err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	h.JSONR(c, schedule)
+}
+
+// findOncallSchedule loads the schedule with the overrides which are not expired
+func findOncallSchedule(idstr string) (schedule alm.OncallSchedule, err error) {
+	id, err := strconv.Atoi(idstr)
+	if err != nil {
+		err = errors.New("id is missing or not a number")
+		return
+	}
+	schedule.ID = int64(id)
+	if dt := db.Uic.Find(&schedule); dt.Error != nil {
+		err = dt.Error
+		return
+	}
+	if dt := db.Uic.Where("schedule_id = ? AND end_at >= ?", id, time.Now()).Order("start_at").Find(&schedule.Overrides); dt.Error != nil {
+		err = dt.Error
+	}
+	return
+}
+
+type APIOncallScheduleInputs struct {
+	Name string `json:"name" form:"name" binding:"required"`
+	//names of user, comma separated, in the order of rotation
+	Members string `json:"members" form:"members" binding:"required"`
+	//unix time, the first member is on call from it
+	RotationStart int64 `json:"rotation_start" form:"rotation_start" binding:"required"`
+	//the on-call person is handed off every rotation_days days, default 7
+	RotationDays int `json:"rotation_days" form:"rotation_days"`
+}
+
+func (this APIOncallScheduleInputs) CheckFormat() (err error) {
+	if this.RotationDays < 0 {
+		err = errors.New("rotation_days should not be negative")
+	}
+	return
+}
+
+func (this APIOncallScheduleInputs) rotationDays() int {
+	if this.RotationDays == 0 {
+		return 7
+	}
+	return this.RotationDays
+}
+
+func CreateOncallSchedule(c *gin.Context) {
+	var inputs APIOncallScheduleInputs
+	if err := c.Bind(&inputs); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	if err := inputs.CheckFormat(); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	user, err := h.GetUser(c)
+	if err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	rotationStart := time.Unix(inputs.RotationStart, 0)
+	created := time.Now()
+	schedule := alm.OncallSchedule{
+		Name:          inputs.Name,
+		Members:       inputs.Members,
+		RotationStart: &rotationStart,
+		RotationDays:  inputs.rotationDays(),
+		Creator:       user.Name,
+		Created:       &created,
+	}
+	if dt := db.Uic.Save(&schedule); dt.Error != nil {
+		h.JSONR(c, expecstatus, dt.Error)
+		return
+	}
+	h.JSONR(c, schedule)
+}
+
+type APIUpdateOncallScheduleInputs struct {
+	ID int64 `json:"id" form:"id" binding:"required"`
+	APIOncallScheduleInputs
+}
+
+func UpdateOncallSchedule(c *gin.Context) {
+	var inputs APIUpdateOncallScheduleInputs
+	if err := c.Bind(&inputs); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	if err := inputs.CheckFormat(); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	user, err := h.GetUser(c)
+	if err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	schedule := alm.OncallSchedule{ID: inputs.ID}
+	if dt := db.Uic.Find(&schedule); dt.Error != nil {
+		h.JSONR(c, expecstatus, fmt.Sprintf("find on-call schedule got error:%v", dt.Error))
+		return
+	}
+	if schedule.Creator != user.Name && !user.IsAdmin() {
+		h.JSONR(c, badstatus, "You don't have permission!")
+		return
+	}
+	uschedule := map[string]interface{}{
+		"name":           inputs.Name,
+		"members":        inputs.Members,
+		"rotation_start": time.Unix(inputs.RotationStart, 0),
+		"rotation_days":  inputs.rotationDays(),
+	}
+	if dt := db.Uic.Model(&schedule).Where("id = ?", schedule.ID).Update(uschedule); dt.Error != nil {
+		h.JSONR(c, expecstatus, dt.Error)
+		return
+	}
+	h.JSONR(c, fmt.Sprintf("on-call schedule:%d has been updated", schedule.ID))
+}
+
+func DeleteOncallSchedule(c *gin.Context) {
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		h.JSONR(c, badstatus, "id is missing or not a number")
+		return
+	}
+	user, err := h.GetUser(c)
+	if err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	schedule := alm.OncallSchedule{ID: int64(id)}
+	if dt := db.Uic.Find(&schedule); dt.Error != nil {
+		h.JSONR(c, badstatus, dt.Error)
+		return
+	}
+	if schedule.Creator != user.Name && !user.IsAdmin() {
+		h.JSONR(c, badstatus, "You don't have permission!")
+		return
+	}
+	if dt := db.Uic.Delete(&schedule); dt.Error != nil {
+		h.JSONR(c, expecstatus, dt.Error)
+		return
+	}
+	h.JSONR(c, fmt.Sprintf("on-call schedule:%d has been deleted", id))
+}
+
+type APIGetOncallInputs struct {
+	//0 is the primary, 1 is the secondary, and so on
+	Offset int `json:"offset" form:"offset"`
+	//unix time, default now
+	At int64 `json:"at" form:"at"`
+}
+
+// GetOncall returns who is on call of the schedule
+func GetOncall(c *gin.Context) {
+	var inputs APIGetOncallInputs
+	if err := c.Bind(&inputs); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	if inputs.Offset < 0 {
+		h.JSONR(c, badstatus, "offset should not be negative")
+		return
+	}
+	schedule, err := findOncallSchedule(c.Params.ByName("id"))
+	if err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	at := time.Now()
+	if inputs.At != 0 {
+		at = time.Unix(inputs.At, 0)
+	}
+	h.JSONR(c, map[string]interface{}{
+		"schedule_id": schedule.ID,
+		"offset":      inputs.Offset,
+		"at":          at.Unix(),
+		"user":        schedule.OnCall(at, inputs.Offset),
+	})
+}
+
+type APICreateOncallOverrideInputs struct {
+	ScheduleId int64  `json:"schedule_id" form:"schedule_id" binding:"required"`
+	User       string `json:"user" form:"user" binding:"required"`
+	//unix time
+	StartAt int64 `json:"start_at" form:"start_at" binding:"required"`
+	EndAt   int64 `json:"end_at" form:"end_at" binding:"required"`
+}
+
+func CreateOncallOverride(c *gin.Context) {
+	var inputs APICreateOncallOverrideInputs
+	if err := c.Bind(&inputs); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	if inputs.EndAt <= inputs.StartAt {
+		h.JSONR(c, badstatus, "end_at should be later than start_at")
+		return
+	}
+	user, err := h.GetUser(c)
+	if err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	schedule := alm.OncallSchedule{ID: inputs.ScheduleId}
+	if dt := db.Uic.Find(&schedule); dt.Error != nil {
+		h.JSONR(c, badstatus, fmt.Sprintf("find on-call schedule got error:%v", dt.Error))
+		return
+	}
+	startAt := time.Unix(inputs.StartAt, 0)
+	endAt := time.Unix(inputs.EndAt, 0)
+	override := alm.OncallOverride{
+		ScheduleId: inputs.ScheduleId,
+		User:       inputs.User,
+		StartAt:    &startAt,
+		EndAt:      &endAt,
+		Creator:    user.Name,
+	}
+	if dt := db.Uic.Save(&override); dt.Error != nil {
+		h.JSONR(c, expecstatus, dt.Error)
+		return
+	}
+	h.JSONR(c, override)
+}
+
+func DeleteOncallOverride(c *gin.Context) {
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		h.JSONR(c, badstatus, "id is missing or not a number")
+		return
+	}
+	user, err := h.GetUser(c)
+	if err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	override := alm.OncallOverride{ID: int64(id)}
+	if dt := db.Uic.Find(&override); dt.Error != nil {
+		h.JSONR(c, badstatus, dt.Error)
+		return
+	}
+	if override.Creator != user.Name && override.User != user.Name && !user.IsAdmin() {
+		h.JSONR(c, badstatus, "You don't have permission!")
+		return
+	}
+	if dt := db.Uic.Delete(&override); dt.Error != nil {
+		h.JSONR(c, expecstatus, dt.Error)
+		return
+	}
+	h.JSONR(c, fmt.Sprintf("on-call override:%d has been deleted", id))
+}
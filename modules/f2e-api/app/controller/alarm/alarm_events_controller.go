@@ -18,6 +18,7 @@ type APIGetAlarmListsInputs struct {
 	Status        string `json:"status" form:"status"`
 	ProcessStatus string `json:"process_status" form:"process_status"`
 	Metrics       string `json:"metrics" form:"metrics"`
+	Assignee      string `json:"assignee" form:"assignee"`
 	//id
 	EventId string `json:"event_id" form:"event_id"`
 	//number of reacord's limit on each page
@@ -35,8 +36,10 @@ func (input APIGetAlarmListsInputs) checkInputsContain() error {
 	return nil
 }
 
-func (s APIGetAlarmListsInputs) collectFilters() string {
+// collectFilters returns the where clause and its args, the inputs are bound by ? to avoid sql injection
+func (s APIGetAlarmListsInputs) collectFilters() (string, []interface{}) {
 	tmp := []string{}
+	args := []interface{}{}
 	if s.StartTime != 0 {
 		tmp = append(tmp, fmt.Sprintf("timestamp >= FROM_UNIXTIME(%v)", s.StartTime))
 	}
@@ -47,42 +50,38 @@ func (s APIGetAlarmListsInputs) collectFilters() string {
 		tmp = append(tmp, fmt.Sprintf("priority = %d", s.Priority))
 	}
 	if s.Status != "" {
-		status := ""
-		statusTmp := strings.Split(s.Status, ",")
-		for indx, n := range statusTmp {
-			if indx == 0 {
-				status = fmt.Sprintf(" status = '%s' ", n)
-			} else {
-				status = fmt.Sprintf(" %s OR status = '%s' ", status, n)
-			}
+		status := []string{}
+		for _, n := range strings.Split(s.Status, ",") {
+			status = append(status, "status = ?")
+			args = append(args, n)
 		}
-		status = fmt.Sprintf("( %s )", status)
-		tmp = append(tmp, status)
+		tmp = append(tmp, fmt.Sprintf("( %s )", strings.Join(status, " OR ")))
 	}
 	if s.ProcessStatus != "" {
-		pstatus := ""
-		pstatusTmp := strings.Split(s.ProcessStatus, ",")
-		for indx, n := range pstatusTmp {
-			if indx == 0 {
-				pstatus = fmt.Sprintf(" process_status = '%s' ", n)
-			} else {
-				pstatus = fmt.Sprintf(" %s OR process_status = '%s' ", pstatus, n)
-			}
+		pstatus := []string{}
+		for _, n := range strings.Split(s.ProcessStatus, ",") {
+			pstatus = append(pstatus, "process_status = ?")
+			args = append(args, n)
 		}
-		pstatus = fmt.Sprintf("( %s )", pstatus)
-		tmp = append(tmp, pstatus)
+		tmp = append(tmp, fmt.Sprintf("( %s )", strings.Join(pstatus, " OR ")))
 	}
 	if s.Metrics != "" {
-		tmp = append(tmp, fmt.Sprintf("metrics regexp '%s'", s.Metrics))
+		tmp = append(tmp, "metrics regexp ?")
+		args = append(args, s.Metrics)
+	}
+	if s.Assignee != "" {
+		tmp = append(tmp, "assignee = ?")
+		args = append(args, s.Assignee)
 	}
 	if s.EventId != "" {
-		tmp = append(tmp, fmt.Sprintf("id = '%s'", s.EventId))
+		tmp = append(tmp, "id = ?")
+		args = append(args, s.EventId)
 	}
 	filterStrTmp := strings.Join(tmp, " AND ")
 	if filterStrTmp != "" {
 		filterStrTmp = fmt.Sprintf("WHERE %s", filterStrTmp)
 	}
-	return filterStrTmp
+	return filterStrTmp, args
 }
 
 func AlarmLists(c *gin.Context) {
@@ -99,7 +98,7 @@ func AlarmLists(c *gin.Context) {
 		h.JSONR(c, badstatus, err)
 		return
 	}
-	filterCollector := inputs.collectFilters()
+	filterCollector, filterArgs := inputs.collectFilters()
 	//for get correct table name
 	f := alm.EventCases{}
 	cevens := []alm.EventCases{}
@@ -110,7 +109,7 @@ func AlarmLists(c *gin.Context) {
 			inputs.Limit = 2000
 		}
 		perparedSql = fmt.Sprintf("select * from %s %s order by timestamp DESC limit %d", f.TableName(), filterCollector, inputs.Limit)
-		db.Alarm.Raw(perparedSql).Find(&cevens)
+		db.Alarm.Raw(perparedSql, filterArgs...).Find(&cevens)
 		h.JSONR(c, map[string]interface{}{
 			"limit":    inputs.Limit,
 			"priority": inputs.Priority,
@@ -123,9 +122,9 @@ func AlarmLists(c *gin.Context) {
 			inputs.Limit = 50
 		}
 		perparedSql = fmt.Sprintf("select * from %s %s  order by timestamp DESC limit %d,%d", f.TableName(), filterCollector, inputs.Page, inputs.Limit)
-		db.Alarm.Raw(perparedSql).Find(&cevens)
+		db.Alarm.Raw(perparedSql, filterArgs...).Find(&cevens)
 		var totalCount int64
-		db.Alarm.Raw(fmt.Sprintf("select count(id) from %s %s ", f.TableName(), filterCollector)).Count(&totalCount)
+		db.Alarm.Raw(fmt.Sprintf("select count(id) from %s %s ", f.TableName(), filterCollector), filterArgs...).Count(&totalCount)
 		totalPage := math.Ceil(float64(totalCount) / float64(inputs.Limit))
 		h.JSONR(c, map[string]interface{}{
 			"total_count":  totalCount,
@@ -151,8 +150,9 @@ type APIEventsGetInputs struct {
 	Page int `json:"page" form:"page"`
 }
 
-func (s APIEventsGetInputs) collectFilters() string {
+func (s APIEventsGetInputs) collectFilters() (string, []interface{}) {
 	tmp := []string{}
+	args := []interface{}{}
 	filterStrTmp := ""
 	if s.StartTime != 0 {
 		tmp = append(tmp, fmt.Sprintf("timestamp >= FROM_UNIXTIME(%v)", s.StartTime))
@@ -161,7 +161,8 @@ func (s APIEventsGetInputs) collectFilters() string {
 		tmp = append(tmp, fmt.Sprintf("timestamp <= FROM_UNIXTIME(%v)", s.EndTime))
 	}
 	if s.EventId != "" {
-		tmp = append(tmp, fmt.Sprintf("event_caseId = '%s'", s.EventId))
+		tmp = append(tmp, "event_caseId = ?")
+		args = append(args, s.EventId)
 	}
 	if s.Status == 0 || s.Status == 1 {
 		tmp = append(tmp, fmt.Sprintf("status = %d", s.Status))
@@ -170,7 +171,7 @@ func (s APIEventsGetInputs) collectFilters() string {
 		filterStrTmp = strings.Join(tmp, " AND ")
 		filterStrTmp = fmt.Sprintf("WHERE %s", filterStrTmp)
 	}
-	return filterStrTmp
+	return filterStrTmp, args
 }
 
 func EventsGet(c *gin.Context) {
@@ -182,11 +183,11 @@ func EventsGet(c *gin.Context) {
 		h.JSONR(c, badstatus, err)
 		return
 	}
-	filterCollector := inputs.collectFilters()
+	filterCollector, filterArgs := inputs.collectFilters()
 	//for get correct table name
 	f := alm.Events{}
 	evens := []alm.Events{}
 	perparedSql := fmt.Sprintf("select id, event_caseId, cond, status, timestamp from %s %s order by timestamp DESC limit %d,%d", f.TableName(), filterCollector, inputs.Page, inputs.Limit)
-	db.Alarm.Raw(perparedSql).Scan(&evens)
+	db.Alarm.Raw(perparedSql, filterArgs...).Scan(&evens)
 	h.JSONR(c, evens)
 }
@@ -0,0 +1,216 @@
+package alarm
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	h "github.com/Cepave/open-falcon-backend/modules/f2e-api/app/helper"
+	alm "github.com/Cepave/open-falcon-backend/modules/f2e-api/app/model/alarm"
+	"github.com/gin-gonic/gin"
+)
+
+func GetInhibitRules(c *gin.Context) {
+	rules := []alm.InhibitRule{}
+	if dt := db.Alarm.Order("id DESC").Find(&rules); dt.Error != nil {
+		h.JSONR(c, expecstatus, dt.Error)
+		return
+	}
+	h.JSONR(c, rules)
+}
+
+type APICreateInhibitRuleInputs struct {
+	SourceMetric     string `json:"source_metric" form:"source_metric"`
+	SourceTags       string `json:"source_tags" form:"source_tags"`
+	SourceStrategyId int64  `json:"source_strategy_id" form:"source_strategy_id"`
+	TargetMetric     string `json:"target_metric" form:"target_metric"`
+	TargetTags       string `json:"target_tags" form:"target_tags"`
+	TargetStrategyId int64  `json:"target_strategy_id" form:"target_strategy_id"`
+	//labels shared by source and target: "endpoint", "grp"(host group) or names of tags, ex. "idc"
+	Equal   string `json:"equal" form:"equal" binding:"required"`
+	Comment string `json:"comment" form:"comment"`
+}
+
+func (this APICreateInhibitRuleInputs) CheckFormat() (err error) {
+	switch {
+	case this.SourceMetric == "" && this.SourceTags == "" && this.SourceStrategyId == 0:
+		err = errors.New("at least one of source_metric, source_tags and source_strategy_id is needed")
+	case this.TargetMetric == "" && this.TargetTags == "" && this.TargetStrategyId == 0:
+		err = errors.New("at least one of target_metric, target_tags and target_strategy_id is needed")
+	}
+	return
+}
+
+func CreateInhibitRule(c *gin.Context) {
+	var inputs APICreateInhibitRuleInputs
+	if err := c.Bind(&inputs); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	if err := inputs.CheckFormat(); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	user, err := h.GetUser(c)
+	if err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	createAt := time.Now()
+	rule := alm.InhibitRule{
+		SourceMetric:     inputs.SourceMetric,
+		SourceTags:       inputs.SourceTags,
+		SourceStrategyId: inputs.SourceStrategyId,
+		TargetMetric:     inputs.TargetMetric,
+		TargetTags:       inputs.TargetTags,
+		TargetStrategyId: inputs.TargetStrategyId,
+		Equal:            inputs.Equal,
+		Creator:          user.Name,
+		Comment:          inputs.Comment,
+		CreateAt:         &createAt,
+	}
+	if dt := db.Alarm.Save(&rule); dt.Error != nil {
+		h.JSONR(c, expecstatus, dt.Error)
+		return
+	}
+	h.JSONR(c, rule)
+}
+
+func DeleteInhibitRule(c *gin.Context) {
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		h.JSONR(c, badstatus, "id is missing or not a number")
+		return
+	}
+	user, err := h.GetUser(c)
+	if err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	rule := alm.InhibitRule{ID: int64(id)}
+	if dt := db.Alarm.Find(&rule); dt.Error != nil {
+		h.JSONR(c, badstatus, dt.Error)
+		return
+	}
+	if rule.Creator != user.Name && !user.IsAdmin() {
+		h.JSONR(c, badstatus, "You don't have permission!")
+		return
+	}
+	if dt := db.Alarm.Delete(&rule); dt.Error != nil {
+		h.JSONR(c, expecstatus, dt.Error)
+		return
+	}
+	h.JSONR(c, fmt.Sprintf("inhibit rule:%d has been deleted", id))
+}
+
+type APIGetEndpointDependenciesInputs struct {
+	Parent string `json:"parent" form:"parent"`
+	Child  string `json:"child" form:"child"`
+}
+
+func GetEndpointDependencies(c *gin.Context) {
+	var inputs APIGetEndpointDependenciesInputs
+	if err := c.Bind(&inputs); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	deps := []alm.EndpointDependency{}
+	dt := db.Alarm.Table(alm.EndpointDependency{}.TableName())
+	if inputs.Parent != "" {
+		dt = dt.Where("parent = ?", inputs.Parent)
+	}
+	if inputs.Child != "" {
+		dt = dt.Where("child = ?", inputs.Child)
+	}
+	if dt = dt.Order("id DESC").Scan(&deps); dt.Error != nil {
+		h.JSONR(c, expecstatus, dt.Error)
+		return
+	}
+	h.JSONR(c, deps)
+}
+
+type APICreateEndpointDependencyInputs struct {
+	Parent string `json:"parent" form:"parent" binding:"required"`
+	//children of the parent
+	Children []string `json:"children" form:"children" binding:"required"`
+	//the metric of parent which indicates the parent is down, ex. agent.alive. Empty means any PROBLEM event
+	ParentMetric string `json:"parent_metric" form:"parent_metric"`
+}
+
+func CreateEndpointDependency(c *gin.Context) {
+	var inputs APICreateEndpointDependencyInputs
+	if err := c.Bind(&inputs); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	user, err := h.GetUser(c)
+	if err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	createAt := time.Now()
+	tx := db.Alarm.Begin()
+	deps := []alm.EndpointDependency{}
+	if dt := tx.Find(&deps); dt.Error != nil {
+		tx.Rollback()
+		h.JSONR(c, expecstatus, dt.Error)
+		return
+	}
+	for _, child := range inputs.Children {
+		if child == inputs.Parent {
+			tx.Rollback()
+			h.JSONR(c, badstatus, fmt.Sprintf("endpoint %s cannot depend on itself", child))
+			return
+		}
+		// 互相依赖的endpoint同时告警时, 所有的通知都会被抑制
+		if cycle := alm.DependencyCycle(deps, inputs.Parent, child); cycle != nil {
+			tx.Rollback()
+			h.JSONR(c, badstatus, fmt.Sprintf("dependency of %s on %s makes a cycle: %s", child, inputs.Parent, strings.Join(cycle, " -> ")))
+			return
+		}
+		dep := alm.EndpointDependency{
+			Parent:       inputs.Parent,
+			Child:        child,
+			ParentMetric: inputs.ParentMetric,
+			Creator:      user.Name,
+			CreateAt:     &createAt,
+		}
+		if dt := tx.Save(&dep); dt.Error != nil {
+			tx.Rollback()
+			h.JSONR(c, expecstatus, dt.Error)
+			return
+		}
+		deps = append(deps, dep)
+	}
+	tx.Commit()
+	h.JSONR(c, fmt.Sprintf("%d dependencies of %s have been created", len(inputs.Children), inputs.Parent))
+}
+
+func DeleteEndpointDependency(c *gin.Context) {
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		h.JSONR(c, badstatus, "id is missing or not a number")
+		return
+	}
+	user, err := h.GetUser(c)
+	if err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	dep := alm.EndpointDependency{ID: int64(id)}
+	if dt := db.Alarm.Find(&dep); dt.Error != nil {
+		h.JSONR(c, badstatus, dt.Error)
+		return
+	}
+	if dep.Creator != user.Name && !user.IsAdmin() {
+		h.JSONR(c, badstatus, "You don't have permission!")
+		return
+	}
+	if dt := db.Alarm.Delete(&dep); dt.Error != nil {
+		h.JSONR(c, expecstatus, dt.Error)
+		return
+	}
+	h.JSONR(c, fmt.Sprintf("dependency:%d has been deleted", id))
+}
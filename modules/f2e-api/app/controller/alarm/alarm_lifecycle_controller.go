@@ -0,0 +1,197 @@
+package alarm
+
+import (
+	"fmt"
+	"time"
+
+	h "github.com/Cepave/open-falcon-backend/modules/f2e-api/app/helper"
+	alm "github.com/Cepave/open-falcon-backend/modules/f2e-api/app/model/alarm"
+	"github.com/Cepave/open-falcon-backend/modules/f2e-api/app/model/uic"
+	"github.com/gin-gonic/gin"
+)
+
+// statuses of event_note which record the transitions of event case
+const (
+	noteAcknowledged   = "acknowledged"
+	noteUnacknowledged = "unacknowledged"
+	noteAssigned       = "assigned"
+	noteSnoozed        = "snoozed"
+	noteResolved       = "resolved"
+)
+
+type APIEventCaseTransitionInputs struct {
+	EventId string `json:"event_id" form:"event_id" binding:"required"`
+	//optional, a default note is recorded if it is empty
+	Note string `json:"note" form:"note"`
+}
+
+func (this APIEventCaseTransitionInputs) noteOrDefault(def string) string {
+	if this.Note != "" {
+		return this.Note
+	}
+	return def
+}
+
+// transitEventCase updates the event case and records the transition in event_note with the acting user
+func transitEventCase(c *gin.Context, eventId string, status string, note string, checkCase func(alm.EventCases) error, changes map[string]interface{}) {
+	user, err := h.GetUser(c)
+	if err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	ecase := alm.EventCases{}
+	if dt := db.Alarm.Table(ecase.TableName()).Where("id = ?", eventId).Scan(&ecase); dt.Error != nil {
+		h.JSONR(c, badstatus, fmt.Sprintf("find event case %s got error: %v", eventId, dt.Error))
+		return
+	}
+	if checkCase != nil {
+		if err := checkCase(ecase); err != nil {
+			h.JSONR(c, badstatus, err)
+			return
+		}
+	}
+
+	currentTime := time.Now()
+	anote := alm.EventNote{
+		UserId:      user.ID,
+		Note:        note,
+		Status:      status,
+		EventCaseId: eventId,
+		Timestamp:   &currentTime,
+	}
+	tx := db.Alarm.Begin()
+	if dt := tx.Save(&anote); dt.Error != nil {
+		tx.Rollback()
+		h.JSONR(c, expecstatus, dt.Error)
+		return
+	}
+	if _, ok := changes["process_status"]; ok {
+		changes["process_note"] = anote.ID
+	}
+	if dt := tx.Table(ecase.TableName()).Where("id = ?", eventId).Updates(changes); dt.Error != nil {
+		tx.Rollback()
+		h.JSONR(c, expecstatus, "update got error during update event_cases:"+dt.Error.Error())
+		return
+	}
+	tx.Commit()
+	h.JSONR(c, map[string]string{
+		"id":      eventId,
+		"message": fmt.Sprintf("%s is %s by %s", eventId, status, user.Name),
+	})
+}
+
+func caseIsProblem(ecase alm.EventCases) error {
+	if ecase.Status == "OK" {
+		return fmt.Errorf("event case %s is recovered", ecase.ID)
+	}
+	return nil
+}
+
+// AcknowledgeEventCase stops the repeat notifications and the escalation of case until it recovers
+func AcknowledgeEventCase(c *gin.Context) {
+	var inputs APIEventCaseTransitionInputs
+	if err := c.Bind(&inputs); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	user, err := h.GetUser(c)
+	if err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	transitEventCase(c, inputs.EventId, noteAcknowledged, inputs.noteOrDefault("acknowledged"), caseIsProblem, map[string]interface{}{
+		"acknowledged_by": user.Name,
+		"acknowledged_at": time.Now(),
+		"process_status":  "in progress",
+	})
+}
+
+func UnacknowledgeEventCase(c *gin.Context) {
+	var inputs APIEventCaseTransitionInputs
+	if err := c.Bind(&inputs); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	transitEventCase(c, inputs.EventId, noteUnacknowledged, inputs.noteOrDefault("unacknowledged"), nil, map[string]interface{}{
+		"acknowledged_by": "",
+		"acknowledged_at": nil,
+		"process_status":  "unresolved",
+	})
+}
+
+type APIAssignEventCaseInputs struct {
+	APIEventCaseTransitionInputs
+	//name of user, empty means unassigning
+	Assignee string `json:"assignee" form:"assignee"`
+}
+
+func AssignEventCase(c *gin.Context) {
+	var inputs APIAssignEventCaseInputs
+	if err := c.Bind(&inputs); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	note := "unassigned"
+	if inputs.Assignee != "" {
+		assignee := uic.User{}
+		if dt := db.Uic.Table(assignee.TableName()).Where("name = ?", inputs.Assignee).Scan(&assignee); dt.Error != nil {
+			h.JSONR(c, badstatus, fmt.Sprintf("user %s is not found", inputs.Assignee))
+			return
+		}
+		note = "assigned to " + inputs.Assignee
+	}
+	transitEventCase(c, inputs.EventId, noteAssigned, inputs.noteOrDefault(note), nil, map[string]interface{}{
+		"assignee": inputs.Assignee,
+	})
+}
+
+type APISnoozeEventCaseInputs struct {
+	APIEventCaseTransitionInputs
+	//unix time, no notification is sent until it, 0 means cancelling the snooze
+	Until int64 `json:"until" form:"until"`
+}
+
+func SnoozeEventCase(c *gin.Context) {
+	var inputs APISnoozeEventCaseInputs
+	if err := c.Bind(&inputs); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	if inputs.Until == 0 {
+		transitEventCase(c, inputs.EventId, noteSnoozed, inputs.noteOrDefault("snooze is cancelled"), nil, map[string]interface{}{
+			"snoozed_until": nil,
+		})
+		return
+	}
+	until := time.Unix(inputs.Until, 0)
+	if !until.After(time.Now()) {
+		h.JSONR(c, badstatus, "until should be later than now")
+		return
+	}
+	note := "snoozed until " + until.Format("2006-01-02 15:04:05")
+	transitEventCase(c, inputs.EventId, noteSnoozed, inputs.noteOrDefault(note), caseIsProblem, map[string]interface{}{
+		"snoozed_until": until,
+	})
+}
+
+// ResolveEventCase closes the case manually, alarm reopens it if the problem is reported again
+func ResolveEventCase(c *gin.Context) {
+	var inputs APIEventCaseTransitionInputs
+	if err := c.Bind(&inputs); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	user, err := h.GetUser(c)
+	if err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	note := inputs.noteOrDefault("resolved manually")
+	transitEventCase(c, inputs.EventId, noteResolved, note, nil, map[string]interface{}{
+		"process_status": "resolved",
+		"closed_at":      time.Now(),
+		"closed_note":    note,
+		"user_modified":  user.ID,
+		"snoozed_until":  nil,
+	})
+}
@@ -23,4 +23,39 @@ func Routes(r *gin.Engine) {
 	alarmapi.GET("/events", EventsGet)
 	alarmapi.POST("/event_note", AddNotesToAlarm)
 	alarmapi.GET("/event_note", GetNotesOfAlarm)
+	alarmapi.POST("/event_case/acknowledge", AcknowledgeEventCase)
+	alarmapi.POST("/event_case/unacknowledge", UnacknowledgeEventCase)
+	alarmapi.POST("/event_case/assign", AssignEventCase)
+	alarmapi.POST("/event_case/snooze", SnoozeEventCase)
+	alarmapi.POST("/event_case/resolve", ResolveEventCase)
+	alarmapi.GET("/silences", GetSilences)
+	alarmapi.GET("/silence/:id", GetSilence)
+	alarmapi.POST("/silence", CreateSilence)
+	alarmapi.PUT("/silence", UpdateSilence)
+	alarmapi.DELETE("/silence/:id", DeleteSilence)
+	alarmapi.GET("/inhibit_rules", GetInhibitRules)
+	alarmapi.POST("/inhibit_rule", CreateInhibitRule)
+	alarmapi.DELETE("/inhibit_rule/:id", DeleteInhibitRule)
+	alarmapi.GET("/dependencies", GetEndpointDependencies)
+	alarmapi.POST("/dependency", CreateEndpointDependency)
+	alarmapi.DELETE("/dependency/:id", DeleteEndpointDependency)
+	alarmapi.GET("/escalation_policies", GetEscalationPolicies)
+	alarmapi.GET("/escalation_policy/:id", GetEscalationPolicy)
+	alarmapi.POST("/escalation_policy", CreateEscalationPolicy)
+	alarmapi.PUT("/escalation_policy", UpdateEscalationPolicy)
+	alarmapi.DELETE("/escalation_policy/:id", DeleteEscalationPolicy)
+	alarmapi.GET("/oncall_schedules", GetOncallSchedules)
+	alarmapi.GET("/oncall_schedule/:id", GetOncallSchedule)
+	alarmapi.GET("/oncall_schedule/:id/oncall", GetOncall)
+	alarmapi.POST("/oncall_schedule", CreateOncallSchedule)
+	alarmapi.PUT("/oncall_schedule", UpdateOncallSchedule)
+	alarmapi.DELETE("/oncall_schedule/:id", DeleteOncallSchedule)
+	alarmapi.POST("/oncall_override", CreateOncallOverride)
+	alarmapi.DELETE("/oncall_override/:id", DeleteOncallOverride)
+	alarmapi.GET("/webhooks", GetWebhooks)
+	alarmapi.GET("/webhook/:id", GetWebhook)
+	alarmapi.POST("/webhook", CreateWebhook)
+	alarmapi.PUT("/webhook", UpdateWebhook)
+	alarmapi.DELETE("/webhook/:id", DeleteWebhook)
+	alarmapi.GET("/webhook_deliveries", GetWebhookDeliveries)
 }
@@ -0,0 +1,237 @@
+package alarm
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	h "github.com/Cepave/open-falcon-backend/modules/f2e-api/app/helper"
+	alm "github.com/Cepave/open-falcon-backend/modules/f2e-api/app/model/alarm"
+	"github.com/gin-gonic/gin"
+)
+
+type APIGetSilencesInputs struct {
+	Endpoint string `json:"endpoint" form:"endpoint"`
+	Metric   string `json:"metric" form:"metric"`
+	Creator  string `json:"creator" form:"creator"`
+	//include the expired silences
+	Expired bool `json:"expired" form:"expired"`
+	//number of reacord's limit on each page
+	Limit int `json:"limit" form:"limit"`
+	//pagging
+	Page int `json:"page" form:"page"`
+}
+
+func GetSilences(c *gin.Context) {
+	var inputs APIGetSilencesInputs
+	if err := c.Bind(&inputs); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	if inputs.Limit == 0 || inputs.Limit >= 50 {
+		inputs.Limit = 50
+	}
+
+	silences := []alm.Silence{}
+	dt := db.Alarm.Table(alm.Silence{}.TableName())
+	if inputs.Endpoint != "" {
+		dt = dt.Where("endpoint = ?", inputs.Endpoint)
+	}
+	if inputs.Metric != "" {
+		dt = dt.Where("metric = ?", inputs.Metric)
+	}
+	if inputs.Creator != "" {
+		dt = dt.Where("creator = ?", inputs.Creator)
+	}
+	if !inputs.Expired {
+		dt = dt.Where("end_at IS NULL OR end_at >= ?", time.Now())
+	}
+	if dt = dt.Order("id DESC").Offset(inputs.Page).Limit(inputs.Limit).Scan(&silences); dt.Error != nil {
+		h.JSONR(c, expecstatus, dt.Error)
+		return
+	}
+	h.JSONR(c, silences)
+}
+
+func GetSilence(c *gin.Context) {
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		h.JSONR(c, badstatus, "id is missing or not a number")
+		return
+	}
+	silence := alm.Silence{ID: int64(id)}
+	if dt := db.Alarm.Find(&silence); dt.Error != nil {
+		h.JSONR(c, badstatus, dt.Error)
+		return
+	}
+	h.JSONR(c, silence)
+}
+
+// APISilenceInputs is shared by creating and updating
+type APISilenceInputs struct {
+	Endpoint   string `json:"endpoint" form:"endpoint"`
+	GrpId      int64  `json:"grp_id" form:"grp_id"`
+	Metric     string `json:"metric" form:"metric"`
+	Tags       string `json:"tags" form:"tags"`
+	StrategyId int64  `json:"strategy_id" form:"strategy_id"`
+	TplId      int64  `json:"tpl_id" form:"tpl_id"`
+	//unix time
+	StartAt int64 `json:"start_at" form:"start_at" binding:"required"`
+	//unix time, 0 means no end(only for recurring window)
+	EndAt int64 `json:"end_at" form:"end_at"`
+	//recurring window, ex. weekdays: "0,6"(Sunday and Saturday), daily_begin: "02:00", daily_end: "04:00"
+	Weekdays   string `json:"weekdays" form:"weekdays"`
+	DailyBegin string `json:"daily_begin" form:"daily_begin"`
+	DailyEnd   string `json:"daily_end" form:"daily_end"`
+	Comment    string `json:"comment" form:"comment" binding:"required"`
+}
+
+func (this APISilenceInputs) CheckFormat() (err error) {
+	validWeekdays := regexp.MustCompile(`^[0-6](,[0-6])*$`)
+	validTime := regexp.MustCompile(`^([01]\d|2[0-3]):[0-5]\d$`)
+	recurring := this.Weekdays != "" || this.DailyBegin != "" || this.DailyEnd != ""
+	switch {
+	case this.Endpoint == "" && this.GrpId == 0 && this.Metric == "" && this.Tags == "" && this.StrategyId == 0 && this.TplId == 0:
+		err = errors.New("at least one of endpoint, grp_id, metric, tags, strategy_id and tpl_id is needed")
+	case this.EndAt == 0 && !recurring:
+		err = errors.New("end_at is needed, only recurring window could have no end")
+	case this.EndAt != 0 && this.EndAt <= this.StartAt:
+		err = errors.New("end_at should be later than start_at")
+	case this.Weekdays != "" && !validWeekdays.MatchString(this.Weekdays):
+		err = errors.New("weekdays's formating is not vaild, please refer ex. 0,6 (0 is Sunday)")
+	case (this.DailyBegin == "") != (this.DailyEnd == ""):
+		err = errors.New("daily_begin and daily_end should be given together")
+	case this.DailyBegin != "" && !validTime.MatchString(this.DailyBegin):
+		err = errors.New("daily_begin's formating is not vaild, please refer ex. 02:00")
+	case this.DailyEnd != "" && !validTime.MatchString(this.DailyEnd):
+		err = errors.New("daily_end's formating is not vaild, please refer ex. 04:00")
+	}
+	return
+}
+
+func (this APISilenceInputs) endAt() *time.Time {
+	if this.EndAt == 0 {
+		return nil
+	}
+	t := time.Unix(this.EndAt, 0)
+	return &t
+}
+
+func CreateSilence(c *gin.Context) {
+	var inputs APISilenceInputs
+	if err := c.Bind(&inputs); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	if err := inputs.CheckFormat(); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	user, err := h.GetUser(c)
+	if err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	startAt := time.Unix(inputs.StartAt, 0)
+	createAt := time.Now()
+	silence := alm.Silence{
+		Endpoint:   inputs.Endpoint,
+		GrpId:      inputs.GrpId,
+		Metric:     inputs.Metric,
+		Tags:       inputs.Tags,
+		StrategyId: inputs.StrategyId,
+		TplId:      inputs.TplId,
+		StartAt:    &startAt,
+		EndAt:      inputs.endAt(),
+		Weekdays:   inputs.Weekdays,
+		DailyBegin: inputs.DailyBegin,
+		DailyEnd:   inputs.DailyEnd,
+		Creator:    user.Name,
+		Comment:    inputs.Comment,
+		CreateAt:   &createAt,
+	}
+	if dt := db.Alarm.Save(&silence); dt.Error != nil {
+		h.JSONR(c, expecstatus, dt.Error)
+		return
+	}
+	h.JSONR(c, silence)
+}
+
+type APIUpdateSilenceInputs struct {
+	ID int64 `json:"id" form:"id" binding:"required"`
+	APISilenceInputs
+}
+
+func UpdateSilence(c *gin.Context) {
+	var inputs APIUpdateSilenceInputs
+	if err := c.Bind(&inputs); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	if err := inputs.CheckFormat(); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	user, err := h.GetUser(c)
+	if err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	silence := alm.Silence{ID: inputs.ID}
+	if dt := db.Alarm.Find(&silence); dt.Error != nil {
+		h.JSONR(c, expecstatus, fmt.Sprintf("find silence got error:%v", dt.Error))
+		return
+	}
+	if silence.Creator != user.Name && !user.IsAdmin() {
+		h.JSONR(c, badstatus, "You don't have permission!")
+		return
+	}
+	usilence := map[string]interface{}{
+		"endpoint":    inputs.Endpoint,
+		"grp_id":      inputs.GrpId,
+		"metric":      inputs.Metric,
+		"tags":        inputs.Tags,
+		"strategy_id": inputs.StrategyId,
+		"tpl_id":      inputs.TplId,
+		"start_at":    time.Unix(inputs.StartAt, 0),
+		"end_at":      inputs.endAt(),
+		"weekdays":    inputs.Weekdays,
+		"daily_begin": inputs.DailyBegin,
+		"daily_end":   inputs.DailyEnd,
+		"comment":     inputs.Comment,
+	}
+	if dt := db.Alarm.Model(&silence).Where("id = ?", silence.ID).Updates(usilence); dt.Error != nil {
+		h.JSONR(c, expecstatus, dt.Error)
+		return
+	}
+	h.JSONR(c, fmt.Sprintf("silence:%d has been updated", silence.ID))
+}
+
+func DeleteSilence(c *gin.Context) {
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		h.JSONR(c, badstatus, "id is missing or not a number")
+		return
+	}
+	user, err := h.GetUser(c)
+	if err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	silence := alm.Silence{ID: int64(id)}
+	if dt := db.Alarm.Find(&silence); dt.Error != nil {
+		h.JSONR(c, badstatus, dt.Error)
+		return
+	}
+	if silence.Creator != user.Name && !user.IsAdmin() {
+		h.JSONR(c, badstatus, "You don't have permission!")
+		return
+	}
+	if dt := db.Alarm.Delete(&silence); dt.Error != nil {
+		h.JSONR(c, expecstatus, dt.Error)
+		return
+	}
+	h.JSONR(c, fmt.Sprintf("silence:%d has been deleted", id))
+}
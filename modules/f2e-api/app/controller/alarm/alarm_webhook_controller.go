@@ -0,0 +1,286 @@
+package alarm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"text/template"
+	"time"
+
+	h "github.com/Cepave/open-falcon-backend/modules/f2e-api/app/helper"
+	alm "github.com/Cepave/open-falcon-backend/modules/f2e-api/app/model/alarm"
+	"github.com/gin-gonic/gin"
+)
+
+func GetWebhooks(c *gin.Context) {
+	user, err := h.GetUser(c)
+	if err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	hooks := []alm.Webhook{}
+	if dt := db.Alarm.Order("id DESC").Find(&hooks); dt.Error != nil {
+		h.JSONR(c, expecstatus, dt.Error)
+		return
+	}
+	for i, hook := range hooks {
+		if hook.Creator != user.Name && !user.IsAdmin() {
+			hooks[i] = hook.Redacted()
+		}
+	}
+	h.JSONR(c, hooks)
+}
+
+func GetWebhook(c *gin.Context) {
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		h.JSONR(c, badstatus, "id is missing or not a number")
+		return
+	}
+	user, err := h.GetUser(c)
+	if err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	hook := alm.Webhook{ID: int64(id)}
+	if dt := db.Alarm.Find(&hook); dt.Error != nil {
+		h.JSONR(c, badstatus, dt.Error)
+		return
+	}
+	if hook.Creator != user.Name && !user.IsAdmin() {
+		hook = hook.Redacted()
+	}
+	h.JSONR(c, hook)
+}
+
+// APIWebhookInputs is shared by creating and updating
+type APIWebhookInputs struct {
+	Name string `json:"name" form:"name" binding:"required"`
+	URL  string `json:"url" form:"url" binding:"required"`
+	//POST(default) or PUT
+	Method string `json:"method" form:"method"`
+	//json(default) or form
+	ContentType string `json:"content_type" form:"content_type"`
+	//JSON object, ex. {"Authorization": "Bearer xxx"}
+	Headers string `json:"headers" form:"headers"`
+	//Go text/template, the data is the event, ex. {"text": {{json .Endpoint}}}. Empty means the default JSON payload
+	BodyTemplate string `json:"body_template" form:"body_template"`
+	//the body is signed by HMAC-SHA256 in header X-Falcon-Signature if it is not empty
+	Secret     string `json:"secret" form:"secret"`
+	MaxRetries int    `json:"max_retries" form:"max_retries"`
+	//seconds, default 10
+	Timeout int `json:"timeout" form:"timeout"`
+}
+
+// the functions provided by alarm, only for validating the template
+var webhookFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) { return "", nil },
+	"tags": func(tags map[string]string) string { return "" },
+}
+
+func (this APIWebhookInputs) CheckFormat() (err error) {
+	switch {
+	case this.Method != "" && this.Method != "POST" && this.Method != "PUT":
+		return errors.New("method: only accepect [POST, PUT]")
+	case this.ContentType != "" && this.ContentType != "json" && this.ContentType != "form":
+		return errors.New("content_type: only accepect [json, form]")
+	case this.MaxRetries < 0 || this.MaxRetries > 10:
+		return errors.New("max_retries should be in 0 ~ 10")
+	case this.Timeout < 0 || this.Timeout > 60:
+		return errors.New("timeout should be in 0 ~ 60 seconds")
+	}
+	if u, err := url.Parse(this.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("url %s is not vaild", this.URL)
+	}
+	if this.Headers != "" {
+		headers := map[string]string{}
+		if err := json.Unmarshal([]byte(this.Headers), &headers); err != nil {
+			return fmt.Errorf("headers should be a JSON object of strings: %v", err)
+		}
+	}
+	if _, err := template.New(this.Name).Funcs(webhookFuncs).Parse(this.BodyTemplate); err != nil {
+		return fmt.Errorf("body_template is not vaild: %v", err)
+	}
+	return nil
+}
+
+func (this APIWebhookInputs) method() string {
+	if this.Method == "" {
+		return "POST"
+	}
+	return this.Method
+}
+
+func (this APIWebhookInputs) contentType() string {
+	if this.ContentType == "" {
+		return "json"
+	}
+	return this.ContentType
+}
+
+func (this APIWebhookInputs) timeout() int {
+	if this.Timeout == 0 {
+		return 10
+	}
+	return this.Timeout
+}
+
+func CreateWebhook(c *gin.Context) {
+	var inputs APIWebhookInputs
+	if err := c.Bind(&inputs); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	if err := inputs.CheckFormat(); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	user, err := h.GetUser(c)
+	if err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	createAt := time.Now()
+	hook := alm.Webhook{
+		Name:         inputs.Name,
+		URL:          inputs.URL,
+		Method:       inputs.method(),
+		ContentType:  inputs.contentType(),
+		Headers:      inputs.Headers,
+		BodyTemplate: inputs.BodyTemplate,
+		Secret:       inputs.Secret,
+		MaxRetries:   inputs.MaxRetries,
+		Timeout:      inputs.timeout(),
+		Creator:      user.Name,
+		CreateAt:     &createAt,
+	}
+	if dt := db.Alarm.Save(&hook); dt.Error != nil {
+		h.JSONR(c, expecstatus, dt.Error)
+		return
+	}
+	h.JSONR(c, hook)
+}
+
+type APIUpdateWebhookInputs struct {
+	ID int64 `json:"id" form:"id" binding:"required"`
+	APIWebhookInputs
+	//keep the secret if it is false
+	UpdateSecret bool `json:"update_secret" form:"update_secret"`
+}
+
+func UpdateWebhook(c *gin.Context) {
+	var inputs APIUpdateWebhookInputs
+	if err := c.Bind(&inputs); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	if err := inputs.CheckFormat(); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	user, err := h.GetUser(c)
+	if err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	hook := alm.Webhook{ID: inputs.ID}
+	if dt := db.Alarm.Find(&hook); dt.Error != nil {
+		h.JSONR(c, expecstatus, fmt.Sprintf("find webhook got error:%v", dt.Error))
+		return
+	}
+	if hook.Creator != user.Name && !user.IsAdmin() {
+		h.JSONR(c, badstatus, "You don't have permission!")
+		return
+	}
+	uhook := map[string]interface{}{
+		"name":          inputs.Name,
+		"url":           inputs.URL,
+		"method":        inputs.method(),
+		"content_type":  inputs.contentType(),
+		"headers":       inputs.Headers,
+		"body_template": inputs.BodyTemplate,
+		"max_retries":   inputs.MaxRetries,
+		"timeout":       inputs.timeout(),
+	}
+	if inputs.UpdateSecret {
+		uhook["secret"] = inputs.Secret
+	}
+	if dt := db.Alarm.Model(&hook).Where("id = ?", hook.ID).Updates(uhook); dt.Error != nil {
+		h.JSONR(c, expecstatus, dt.Error)
+		return
+	}
+	h.JSONR(c, fmt.Sprintf("webhook:%d has been updated", hook.ID))
+}
+
+func DeleteWebhook(c *gin.Context) {
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		h.JSONR(c, badstatus, "id is missing or not a number")
+		return
+	}
+	user, err := h.GetUser(c)
+	if err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	hook := alm.Webhook{ID: int64(id)}
+	if dt := db.Alarm.Find(&hook); dt.Error != nil {
+		h.JSONR(c, badstatus, dt.Error)
+		return
+	}
+	if hook.Creator != user.Name && !user.IsAdmin() {
+		h.JSONR(c, badstatus, "You don't have permission!")
+		return
+	}
+	var count int
+	db.Alarm.Table("action").Where("webhook_id = ?", id).Count(&count)
+	if count > 0 {
+		h.JSONR(c, badstatus, fmt.Sprintf("webhook:%d is used by %d actions", id, count))
+		return
+	}
+	if dt := db.Alarm.Delete(&hook); dt.Error != nil {
+		h.JSONR(c, expecstatus, dt.Error)
+		return
+	}
+	h.JSONR(c, fmt.Sprintf("webhook:%d has been deleted", id))
+}
+
+type APIGetWebhookDeliveriesInputs struct {
+	EventId   string `json:"event_id" form:"event_id"`
+	WebhookId int64  `json:"webhook_id" form:"webhook_id"`
+	//number of reacord's limit on each page
+	Limit int `json:"limit" form:"limit"`
+	//pagging
+	Page int `json:"page" form:"page"`
+}
+
+// GetWebhookDeliveries lists the attempts of posting webhooks, newest first
+func GetWebhookDeliveries(c *gin.Context) {
+	var inputs APIGetWebhookDeliveriesInputs
+	if err := c.Bind(&inputs); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
+	if inputs.EventId == "" && inputs.WebhookId == 0 {
+		h.JSONR(c, badstatus, "event_id OR webhook_id, You have to at least pick one on the request.")
+		return
+	}
+	if inputs.Limit == 0 || inputs.Limit >= 50 {
+		inputs.Limit = 50
+	}
+	deliveries := []alm.WebhookDelivery{}
+	dt := db.Alarm.Table(alm.WebhookDelivery{}.TableName())
+	if inputs.EventId != "" {
+		dt = dt.Where("event_caseId = ?", inputs.EventId)
+	}
+	if inputs.WebhookId != 0 {
+		dt = dt.Where("webhook_id = ?", inputs.WebhookId)
+	}
+	if dt = dt.Order("id DESC").Offset(inputs.Page).Limit(inputs.Limit).Scan(&deliveries); dt.Error != nil {
+		h.JSONR(c, expecstatus, dt.Error)
+		return
+	}
+	h.JSONR(c, deliveries)
+}
@@ -7,6 +7,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/Cepave/open-falcon-backend/common/judgefunc"
 	"github.com/gin-gonic/gin"
 	"github.com/jinzhu/gorm"
 	h "github.com/Cepave/open-falcon-backend/modules/f2e-api/app/helper"
@@ -90,6 +91,9 @@ type ActionTmp struct {
 	AfterCallbackSMS   int      `json:"after_callback_sms" binding:"exists"`
 	BeforeCallbackMail int      `json:"before_callback_mail" binding:"exists"`
 	AfterCallbackMail  int      `json:"after_callback_mail" binding:"exists"`
+	EscalationPolicyId int64    `json:"escalation_policy_id"`
+	WebhookId          int64    `json:"webhook_id"`
+	Channels           string   `json:"channels"`
 }
 
 func (this APICreateExrpessionInput) CheckFormat() (err error) {
@@ -101,6 +105,12 @@ func (this APICreateExrpessionInput) CheckFormat() (err error) {
 	case !validRightValue.MatchString(this.RightValue):
 		err = errors.New("right_value's formating is not vaild")
 	}
+	if err == nil {
+		err = judgefunc.Validate(this.Func, this.Op)
+	}
+	if err == nil {
+		err = f.CheckChannels(this.Action.Channels, this.Action.WebhookId)
+	}
 	return
 }
 
@@ -124,6 +134,9 @@ func CreateExrpession(c *gin.Context) {
 		BeforeCallbackMail: inputs.Action.BeforeCallbackMail,
 		AfterCallbackSMS:   inputs.Action.AfterCallbackSMS,
 		AfterCallbackMail:  inputs.Action.AfterCallbackMail,
+		EscalationPolicyId: inputs.Action.EscalationPolicyId,
+		WebhookId:          inputs.Action.WebhookId,
+		Channels:           inputs.Action.Channels,
 	}
 	if dt := tx.Save(&action); dt.Error != nil {
 		h.JSONR(c, expecstatus, dt.Error)
@@ -174,6 +187,9 @@ type ActionTmpU struct {
 	AfterCallbackSMS   int      `json:"after_callback_sms" binding:"exists"`
 	BeforeCallbackMail int      `json:"before_callback_mail" binding:"exists"`
 	AfterCallbackMail  int      `json:"after_callback_mail" binding:"exists"`
+	EscalationPolicyId int64    `json:"escalation_policy_id"`
+	WebhookId          int64    `json:"webhook_id"`
+	Channels           string   `json:"channels"`
 }
 
 func (this APIUpdateExrpessionInput) CheckFormat() (err error) {
@@ -185,6 +201,12 @@ func (this APIUpdateExrpessionInput) CheckFormat() (err error) {
 	case !validRightValue.MatchString(this.RightValue):
 		err = errors.New("right_value's formating is not vaild")
 	}
+	if err == nil {
+		err = judgefunc.Validate(this.Func, this.Op)
+	}
+	if err == nil {
+		err = f.CheckChannels(this.Action.Channels, this.Action.WebhookId)
+	}
 	return
 }
 
@@ -242,6 +264,9 @@ func UpdateExrpession(c *gin.Context) {
 		"BeforeCallbackMail": inputs.Action.BeforeCallbackMail,
 		"AfterCallbackSMS":   inputs.Action.AfterCallbackSMS,
 		"AfterCallbackMail":  inputs.Action.AfterCallbackMail,
+		"EscalationPolicyId": inputs.Action.EscalationPolicyId,
+		"WebhookId":          inputs.Action.WebhookId,
+		"Channels":           inputs.Action.Channels,
 	}
 	if dt = tx.Find(&actionTmp, expression.ActionId); dt.Error != nil {
 		h.JSONR(c, expecstatus, fmt.Sprintf(
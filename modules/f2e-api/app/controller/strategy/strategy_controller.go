@@ -9,6 +9,7 @@ import (
 
 	"io/ioutil"
 
+	"github.com/Cepave/open-falcon-backend/common/judgefunc"
 	"github.com/gin-gonic/gin"
 	h "github.com/Cepave/open-falcon-backend/modules/f2e-api/app/helper"
 	f "github.com/Cepave/open-falcon-backend/modules/f2e-api/app/model/falcon_portal"
@@ -63,6 +64,9 @@ func (this APICreateStrategyInput) CheckFormat() (err error) {
 	case !validTime.MatchString(this.RunEnd) && this.RunEnd != "":
 		err = errors.New("run_end's formating is not vaild, please refer ex. 24:00")
 	}
+	if err == nil {
+		err = judgefunc.Validate(this.Func, this.Op)
+	}
 	return
 }
 
@@ -146,6 +150,9 @@ func (this APIUpdateStrategyInput) CheckFormat() (err error) {
 	case !validTime.MatchString(this.RunEnd) && this.RunEnd != "":
 		err = errors.New("run_end's formating is not vaild, please refer ex. 24:00")
 	}
+	if err == nil {
+		err = judgefunc.Validate(this.Func, this.Op)
+	}
 	return
 }
 
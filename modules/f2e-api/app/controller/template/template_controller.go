@@ -252,6 +252,9 @@ type APICreateActionToTmplateInput struct {
 	AfterCallbackSMS   int    `json:"after_callback_sms" binding:"exists"`
 	BeforeCallbackMail int    `json:"before_callback_mail" binding:"exists"`
 	AfterCallbackMail  int    `json:"after_callback_mail" binding:"exists"`
+	EscalationPolicyId int64  `json:"escalation_policy_id"`
+	WebhookId          int64  `json:"webhook_id"`
+	Channels           string `json:"channels"`
 	TplId              int64  `json:"tpl_id" binding:"required"`
 }
 
@@ -262,6 +265,10 @@ func CreateActionToTmplate(c *gin.Context) {
 		h.JSONR(c, badstatus, err)
 		return
 	}
+	if err := f.CheckChannels(inputs.Channels, inputs.WebhookId); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
 	action := f.Action{
 		UIC:                inputs.UIC,
 		URL:                inputs.URL,
@@ -270,6 +277,9 @@ func CreateActionToTmplate(c *gin.Context) {
 		BeforeCallbackMail: inputs.BeforeCallbackMail,
 		AfterCallbackMail:  inputs.AfterCallbackMail,
 		AfterCallbackSMS:   inputs.AfterCallbackSMS,
+		EscalationPolicyId: inputs.EscalationPolicyId,
+		WebhookId:          inputs.WebhookId,
+		Channels:           inputs.Channels,
 	}
 	tx := db.Falcon.Begin()
 	if dt := tx.Table("action").Save(&action); dt.Error != nil {
@@ -308,6 +318,9 @@ type APIUpdateActionToTmplateInput struct {
 	AfterCallbackSMS   int    `json:"after_callback_sms" binding:"exists"`
 	BeforeCallbackMail int    `json:"before_callback_mail" binding:"exists"`
 	AfterCallbackMail  int    `json:"after_callback_mail" binding:"exists"`
+	EscalationPolicyId int64  `json:"escalation_policy_id"`
+	WebhookId          int64  `json:"webhook_id"`
+	Channels           string `json:"channels"`
 }
 
 func UpdateActionToTmplate(c *gin.Context) {
@@ -317,6 +330,10 @@ func UpdateActionToTmplate(c *gin.Context) {
 		h.JSONR(c, badstatus, err)
 		return
 	}
+	if err := f.CheckChannels(inputs.Channels, inputs.WebhookId); err != nil {
+		h.JSONR(c, badstatus, err)
+		return
+	}
 	var action f.Action
 	tx := db.Falcon.Begin()
 	if dt := tx.Find(&action, inputs.ID); dt.Error != nil {
@@ -333,6 +350,9 @@ func UpdateActionToTmplate(c *gin.Context) {
 		"BeforeCallbackMail": inputs.BeforeCallbackMail,
 		"AfterCallbackMail":  inputs.AfterCallbackMail,
 		"AfterCallbackSMS":   inputs.AfterCallbackSMS,
+		"EscalationPolicyId": inputs.EscalationPolicyId,
+		"WebhookId":          inputs.WebhookId,
+		"Channels":           inputs.Channels,
 	}
 	dt := tx.Model(&action).Where("id = ?", inputs.ID).Update(uaction)
 	if dt.Error != nil {
@@ -0,0 +1,143 @@
+package alarm
+
+import (
+	"strings"
+	"time"
+)
+
+// +-----------+------------------+------+-----+---------+----------------+
+// | Field     | Type             | Null | Key | Default | Extra          |
+// +-----------+------------------+------+-----+---------+----------------+
+// | id        | int(10) unsigned | NO   | PRI | NULL    | auto_increment |
+// | name      | varchar(255)     | NO   | UNI | NULL    |                |
+// | creator   | varchar(64)      | NO   |     |         |                |
+// | create_at | datetime         | NO   |     | NULL    |                |
+// +-----------+------------------+------+-----+---------+----------------+
+
+type EscalationPolicy struct {
+	ID       int64            `json:"id" gorm:"column:id"`
+	Name     string           `json:"name" gorm:"column:name"`
+	Creator  string           `json:"creator" gorm:"column:creator"`
+	CreateAt *time.Time       `json:"create_at" gorm:"column:create_at"`
+	Steps    []EscalationStep `json:"steps" gorm:"-"`
+}
+
+func (this EscalationPolicy) TableName() string {
+	return "escalation_policy"
+}
+
+// +-----------------+------------------+------+-----+---------+----------------+
+// | Field           | Type             | Null | Key | Default | Extra          |
+// +-----------------+------------------+------+-----+---------+----------------+
+// | id              | int(10) unsigned | NO   | PRI | NULL    | auto_increment |
+// | policy_id       | int(10) unsigned | NO   | MUL | NULL    |                |
+// | step            | int(10) unsigned | NO   |     | NULL    |                |
+// | wait_minutes    | int(10) unsigned | NO   |     | 0       |                |
+// | schedule_id     | int(10) unsigned | NO   |     | 0       |                |
+// | schedule_offset | int(10) unsigned | NO   |     | 0       |                |
+// | users           | varchar(1024)    | NO   |     |         |                |
+// | teams           | varchar(1024)    | NO   |     |         |                |
+// +-----------------+------------------+------+-----+---------+----------------+
+
+type EscalationStep struct {
+	ID             int64  `json:"id" gorm:"column:id"`
+	PolicyId       int64  `json:"policy_id" gorm:"column:policy_id"`
+	Step           int    `json:"step" gorm:"column:step"`
+	WaitMinutes    int    `json:"wait_minutes" gorm:"column:wait_minutes"`
+	ScheduleId     int64  `json:"schedule_id" gorm:"column:schedule_id"`
+	ScheduleOffset int    `json:"schedule_offset" gorm:"column:schedule_offset"`
+	Users          string `json:"users" gorm:"column:users"`
+	Teams          string `json:"teams" gorm:"column:teams"`
+}
+
+func (this EscalationStep) TableName() string {
+	return "escalation_step"
+}
+
+// oncall_schedule & oncall_override are in uic
+// +----------------+------------------+------+-----+-------------------+----------------+
+// | Field          | Type             | Null | Key | Default           | Extra          |
+// +----------------+------------------+------+-----+-------------------+----------------+
+// | id             | int(10) unsigned | NO   | PRI | NULL              | auto_increment |
+// | name           | varchar(255)     | NO   | UNI | NULL              |                |
+// | members        | varchar(1024)    | NO   |     |                   |                |
+// | rotation_start | datetime         | NO   |     | NULL              |                |
+// | rotation_days  | int(10) unsigned | NO   |     | 7                 |                |
+// | creator        | varchar(64)      | NO   |     |                   |                |
+// | created        | timestamp        | NO   |     | CURRENT_TIMESTAMP |                |
+// +----------------+------------------+------+-----+-------------------+----------------+
+
+type OncallSchedule struct {
+	ID            int64            `json:"id" gorm:"column:id"`
+	Name          string           `json:"name" gorm:"column:name"`
+	Members       string           `json:"members" gorm:"column:members"`
+	RotationStart *time.Time       `json:"rotation_start" gorm:"column:rotation_start"`
+	RotationDays  int              `json:"rotation_days" gorm:"column:rotation_days"`
+	Creator       string           `json:"creator" gorm:"column:creator"`
+	Created       *time.Time       `json:"created" gorm:"column:created"`
+	Overrides     []OncallOverride `json:"overrides" gorm:"-"`
+}
+
+func (this OncallSchedule) TableName() string {
+	return "oncall_schedule"
+}
+
+func (this OncallSchedule) MemberList() []string {
+	members := []string{}
+	for _, m := range strings.Split(this.Members, ",") {
+		if m = strings.TrimSpace(m); m != "" {
+			members = append(members, m)
+		}
+	}
+	return members
+}
+
+// OnCall returns the on-call person at the time, offset 0 is the primary one which could be overridden.
+// It should be consistent with the rotation of alarm module.
+func (this OncallSchedule) OnCall(now time.Time, offset int) string {
+	if offset == 0 {
+		for _, o := range this.Overrides {
+			if !now.Before(*o.StartAt) && now.Before(*o.EndAt) {
+				return o.User
+			}
+		}
+	}
+
+	members := this.MemberList()
+	if len(members) == 0 {
+		return ""
+	}
+	days := this.RotationDays
+	if days <= 0 {
+		days = 7
+	}
+	rotation := int64(0)
+	if this.RotationStart != nil && now.After(*this.RotationStart) {
+		rotation = int64(now.Sub(*this.RotationStart)/time.Second) / int64(days*86400)
+	}
+	return members[(int(rotation%int64(len(members)))+offset)%len(members)]
+}
+
+// +-------------+------------------+------+-----+---------+----------------+
+// | Field       | Type             | Null | Key | Default | Extra          |
+// +-------------+------------------+------+-----+---------+----------------+
+// | id          | int(10) unsigned | NO   | PRI | NULL    | auto_increment |
+// | schedule_id | int(10) unsigned | NO   | MUL | NULL    |                |
+// | user        | varchar(64)      | NO   |     | NULL    |                |
+// | start_at    | datetime         | NO   |     | NULL    |                |
+// | end_at      | datetime         | NO   |     | NULL    |                |
+// | creator     | varchar(64)      | NO   |     |         |                |
+// +-------------+------------------+------+-----+---------+----------------+
+
+type OncallOverride struct {
+	ID         int64      `json:"id" gorm:"column:id"`
+	ScheduleId int64      `json:"schedule_id" gorm:"column:schedule_id"`
+	User       string     `json:"user" gorm:"column:user"`
+	StartAt    *time.Time `json:"start_at" gorm:"column:start_at"`
+	EndAt      *time.Time `json:"end_at" gorm:"column:end_at"`
+	Creator    string     `json:"creator" gorm:"column:creator"`
+}
+
+func (this OncallOverride) TableName() string {
+	return "oncall_override"
+}
@@ -7,54 +7,66 @@ import (
 	"github.com/Cepave/open-falcon-backend/modules/f2e-api/config"
 )
 
-// +----------------+------------------+------+-----+-------------------+-----------------------------+
-// | Field          | Type             | Null | Key | Default           | Extra                       |
-// +----------------+------------------+------+-----+-------------------+-----------------------------+
-// | id             | varchar(50)      | NO   | PRI | NULL              |                             |
-// | endpoint       | varchar(100)     | NO   | MUL | NULL              |                             |
-// | metric         | varchar(200)     | NO   |     | NULL              |                             |
-// | func           | varchar(50)      | YES  |     | NULL              |                             |
-// | cond           | varchar(200)     | NO   |     | NULL              |                             |
-// | note           | varchar(500)     | YES  |     | NULL              |                             |
-// | max_step       | int(10) unsigned | YES  |     | NULL              |                             |
-// | current_step   | int(10) unsigned | YES  |     | NULL              |                             |
-// | priority       | int(6)           | NO   |     | NULL              |                             |
-// | status         | varchar(20)      | NO   |     | NULL              |                             |
-// | timestamp      | timestamp        | NO   |     | CURRENT_TIMESTAMP | on update CURRENT_TIMESTAMP |
-// | update_at      | timestamp        | YES  |     | NULL              |                             |
-// | closed_at      | timestamp        | YES  |     | NULL              |                             |
-// | closed_note    | varchar(250)     | YES  |     | NULL              |                             |
-// | user_modified  | int(10) unsigned | YES  |     | NULL              |                             |
-// | tpl_creator    | varchar(64)      | YES  |     | NULL              |                             |
-// | expression_id  | int(10) unsigned | YES  |     | NULL              |                             |
-// | strategy_id    | int(10) unsigned | YES  |     | NULL              |                             |
-// | template_id    | int(10) unsigned | YES  |     | NULL              |                             |
-// | process_note   | mediumint(9)     | YES  |     | NULL              |                             |
-// | process_status | varchar(20)      | YES  |     | unresolved        |                             |
-// +----------------+------------------+------+-----+-------------------+-----------------------------+
+// +-----------------+------------------+------+-----+-------------------+-----------------------------+
+// | Field           | Type             | Null | Key | Default           | Extra                       |
+// +-----------------+------------------+------+-----+-------------------+-----------------------------+
+// | id              | varchar(50)      | NO   | PRI | NULL              |                             |
+// | endpoint        | varchar(100)     | NO   | MUL | NULL              |                             |
+// | metric          | varchar(200)     | NO   |     | NULL              |                             |
+// | func            | varchar(50)      | YES  |     | NULL              |                             |
+// | cond            | varchar(200)     | NO   |     | NULL              |                             |
+// | note            | varchar(500)     | YES  |     | NULL              |                             |
+// | max_step        | int(10) unsigned | YES  |     | NULL              |                             |
+// | current_step    | int(10) unsigned | YES  |     | NULL              |                             |
+// | priority        | int(6)           | NO   |     | NULL              |                             |
+// | status          | varchar(20)      | NO   |     | NULL              |                             |
+// | timestamp       | timestamp        | NO   |     | CURRENT_TIMESTAMP | on update CURRENT_TIMESTAMP |
+// | update_at       | timestamp        | YES  |     | NULL              |                             |
+// | closed_at       | timestamp        | YES  |     | NULL              |                             |
+// | closed_note     | varchar(250)     | YES  |     | NULL              |                             |
+// | user_modified   | int(10) unsigned | YES  |     | NULL              |                             |
+// | tpl_creator     | varchar(64)      | YES  |     | NULL              |                             |
+// | expression_id   | int(10) unsigned | YES  |     | NULL              |                             |
+// | strategy_id     | int(10) unsigned | YES  |     | NULL              |                             |
+// | template_id     | int(10) unsigned | YES  |     | NULL              |                             |
+// | process_note    | mediumint(9)     | YES  |     | NULL              |                             |
+// | process_status  | varchar(20)      | YES  |     | unresolved        |                             |
+// | silence_id      | int(10) unsigned | NO   |     | 0                 |                             |
+// | inhibited_by    | varchar(50)      | NO   |     |                   |                             |
+// | acknowledged_by | varchar(64)      | NO   |     |                   |                             |
+// | acknowledged_at | timestamp        | YES  |     | NULL              |                             |
+// | assignee        | varchar(64)      | NO   |     |                   |                             |
+// | snoozed_until   | timestamp        | YES  |     | NULL              |                             |
+// +-----------------+------------------+------+-----+-------------------+-----------------------------+
 
 type EventCases struct {
-	ID            string     `json:"id" gorm:"column:id"`
-	Endpoint      string     `json:"endpoint" grom:"column:endpoint"`
-	Metric        string     `json:"metric" grom:"metric"`
-	Func          string     `json:"func" grom:"func"`
-	Cond          string     `json:"cond" grom:"cond"`
-	Note          string     `json:"note" grom:"note"`
-	MaxStep       int        `json:"step" grom:"step"`
-	CurrentStep   int        `json:"current_step" grom:"current_step"`
-	Priority      int        `json:"priority" grom:"priority"`
-	Status        string     `json:"status" grom:"status"`
-	Timestamp     *time.Time `json:"timestamp" grom:"timestamp"`
-	UpdateAt      *time.Time `json:"update_at" grom:"update_at"`
-	ClosedAt      *time.Time `json:"closed_at" grom:"closed_at"`
-	ClosedNote    string     `json:"closed_note" grom:"closed_note"`
-	UserModified  int64      `json:"user_modified" grom:"user_modified"`
-	TplCreator    string     `json:"tpl_creator" grom:"tpl_creator"`
-	ExpressionId  int64      `json:"expression_id" grom:"expression_id"`
-	StrategyId    int64      `json:"strategy_id" grom:"strategy_id"`
-	TemplateId    int64      `json:"template_id" grom:"template_id"`
-	ProcessNote   int64      `json:"process_note" grom:"process_note"`
-	ProcessStatus string     `json:"process_status" grom:"process_status"`
+	ID             string     `json:"id" gorm:"column:id"`
+	Endpoint       string     `json:"endpoint" grom:"column:endpoint"`
+	Metric         string     `json:"metric" grom:"metric"`
+	Func           string     `json:"func" grom:"func"`
+	Cond           string     `json:"cond" grom:"cond"`
+	Note           string     `json:"note" grom:"note"`
+	MaxStep        int        `json:"step" grom:"step"`
+	CurrentStep    int        `json:"current_step" grom:"current_step"`
+	Priority       int        `json:"priority" grom:"priority"`
+	Status         string     `json:"status" grom:"status"`
+	Timestamp      *time.Time `json:"timestamp" grom:"timestamp"`
+	UpdateAt       *time.Time `json:"update_at" grom:"update_at"`
+	ClosedAt       *time.Time `json:"closed_at" grom:"closed_at"`
+	ClosedNote     string     `json:"closed_note" grom:"closed_note"`
+	UserModified   int64      `json:"user_modified" grom:"user_modified"`
+	TplCreator     string     `json:"tpl_creator" grom:"tpl_creator"`
+	ExpressionId   int64      `json:"expression_id" grom:"expression_id"`
+	StrategyId     int64      `json:"strategy_id" grom:"strategy_id"`
+	TemplateId     int64      `json:"template_id" grom:"template_id"`
+	ProcessNote    int64      `json:"process_note" grom:"process_note"`
+	ProcessStatus  string     `json:"process_status" grom:"process_status"`
+	SilenceId      int64      `json:"silence_id" grom:"silence_id"`
+	InhibitedBy    string     `json:"inhibited_by" grom:"inhibited_by"`
+	AcknowledgedBy string     `json:"acknowledged_by" gorm:"column:acknowledged_by"`
+	AcknowledgedAt *time.Time `json:"acknowledged_at" gorm:"column:acknowledged_at"`
+	Assignee       string     `json:"assignee" gorm:"column:assignee"`
+	SnoozedUntil   *time.Time `json:"snoozed_until" gorm:"column:snoozed_until"`
 }
 
 func (this EventCases) TableName() string {
@@ -0,0 +1,94 @@
+package alarm
+
+import (
+	"time"
+)
+
+// +--------------------+------------------+------+-----+---------+----------------+
+// | Field              | Type             | Null | Key | Default | Extra          |
+// +--------------------+------------------+------+-----+---------+----------------+
+// | id                 | int(10) unsigned | NO   | PRI | NULL    | auto_increment |
+// | source_metric      | varchar(128)     | NO   |     |         |                |
+// | source_tags        | varchar(256)     | NO   |     |         |                |
+// | source_strategy_id | int(10) unsigned | NO   |     | 0       |                |
+// | target_metric      | varchar(128)     | NO   |     |         |                |
+// | target_tags        | varchar(256)     | NO   |     |         |                |
+// | target_strategy_id | int(10) unsigned | NO   |     | 0       |                |
+// | equal              | varchar(256)     | NO   |     |         |                |
+// | creator            | varchar(64)      | NO   |     |         |                |
+// | comment            | varchar(255)     | NO   |     |         |                |
+// | create_at          | datetime         | NO   |     | NULL    |                |
+// +--------------------+------------------+------+-----+---------+----------------+
+
+type InhibitRule struct {
+	ID               int64      `json:"id" gorm:"column:id"`
+	SourceMetric     string     `json:"source_metric" gorm:"column:source_metric"`
+	SourceTags       string     `json:"source_tags" gorm:"column:source_tags"`
+	SourceStrategyId int64      `json:"source_strategy_id" gorm:"column:source_strategy_id"`
+	TargetMetric     string     `json:"target_metric" gorm:"column:target_metric"`
+	TargetTags       string     `json:"target_tags" gorm:"column:target_tags"`
+	TargetStrategyId int64      `json:"target_strategy_id" gorm:"column:target_strategy_id"`
+	Equal            string     `json:"equal" gorm:"column:equal"`
+	Creator          string     `json:"creator" gorm:"column:creator"`
+	Comment          string     `json:"comment" gorm:"column:comment"`
+	CreateAt         *time.Time `json:"create_at" gorm:"column:create_at"`
+}
+
+func (this InhibitRule) TableName() string {
+	return "alarm_inhibit_rule"
+}
+
+// +---------------+------------------+------+-----+---------+----------------+
+// | Field         | Type             | Null | Key | Default | Extra          |
+// +---------------+------------------+------+-----+---------+----------------+
+// | id            | int(10) unsigned | NO   | PRI | NULL    | auto_increment |
+// | parent        | varchar(255)     | NO   | MUL | NULL    |                |
+// | child         | varchar(255)     | NO   | MUL | NULL    |                |
+// | parent_metric | varchar(128)     | NO   |     |         |                |
+// | creator       | varchar(64)      | NO   |     |         |                |
+// | create_at     | datetime         | NO   |     | NULL    |                |
+// +---------------+------------------+------+-----+---------+----------------+
+
+type EndpointDependency struct {
+	ID           int64      `json:"id" gorm:"column:id"`
+	Parent       string     `json:"parent" gorm:"column:parent"`
+	Child        string     `json:"child" gorm:"column:child"`
+	ParentMetric string     `json:"parent_metric" gorm:"column:parent_metric"`
+	Creator      string     `json:"creator" gorm:"column:creator"`
+	CreateAt     *time.Time `json:"create_at" gorm:"column:create_at"`
+}
+
+func (this EndpointDependency) TableName() string {
+	return "alarm_endpoint_dependency"
+}
+
+// DependencyCycle returns the cycle(parent -> child -> ... -> parent) made by adding the dependency
+// of child on parent to deps, nil if there is none
+func DependencyCycle(deps []EndpointDependency, parent string, child string) []string {
+	children := make(map[string][]string)
+	for _, dep := range deps {
+		children[dep.Parent] = append(children[dep.Parent], dep.Child)
+	}
+
+	// 从child开始广度优先搜索, 能够到达parent时就形成了环
+	prev := map[string]string{child: ""}
+	queue := []string{child}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		if current == parent {
+			cycle := []string{}
+			for node := current; node != ""; node = prev[node] {
+				cycle = append([]string{node}, cycle...)
+			}
+			return append([]string{parent}, cycle...)
+		}
+		for _, next := range children[current] {
+			if _, ok := prev[next]; !ok {
+				prev[next] = current
+				queue = append(queue, next)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package alarm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDependencyCycle(t *testing.T) {
+	deps := []EndpointDependency{
+		{Parent: "switch-01", Child: "host-01"},
+		{Parent: "switch-01", Child: "host-02"},
+		{Parent: "host-01", Child: "vm-01"},
+		{Parent: "vm-01", Child: "container-01"},
+	}
+
+	for _, c := range []struct {
+		parent   string
+		child    string
+		expected string
+	}{
+		{"container-01", "switch-01", "container-01 -> switch-01 -> host-01 -> vm-01 -> container-01"},
+		{"vm-01", "host-01", "vm-01 -> host-01 -> vm-01"},
+		{"host-02", "host-02", "host-02 -> host-02"},
+		{"host-02", "vm-01", ""},
+		{"router-01", "switch-01", ""},
+		{"vm-01", "host-02", ""},
+	} {
+		cycle := DependencyCycle(deps, c.parent, c.child)
+		if strings.Join(cycle, " -> ") != c.expected {
+			t.Errorf("%s -> %s: expected %q, got %v", c.parent, c.child, c.expected, cycle)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package alarm
+
+import (
+	"time"
+)
+
+// +-------------+------------------+------+-----+---------+----------------+
+// | Field       | Type             | Null | Key | Default | Extra          |
+// +-------------+------------------+------+-----+---------+----------------+
+// | id          | int(10) unsigned | NO   | PRI | NULL    | auto_increment |
+// | endpoint    | varchar(255)     | NO   |     |         |                |
+// | grp_id      | int(10) unsigned | NO   |     | 0       |                |
+// | metric      | varchar(128)     | NO   |     |         |                |
+// | tags        | varchar(256)     | NO   |     |         |                |
+// | strategy_id | int(10) unsigned | NO   |     | 0       |                |
+// | tpl_id      | int(10) unsigned | NO   |     | 0       |                |
+// | start_at    | datetime         | NO   |     | NULL    |                |
+// | end_at      | datetime         | YES  | MUL | NULL    |                |
+// | weekdays    | varchar(16)      | NO   |     |         |                |
+// | daily_begin | varchar(16)      | NO   |     |         |                |
+// | daily_end   | varchar(16)      | NO   |     |         |                |
+// | creator     | varchar(64)      | NO   |     |         |                |
+// | comment     | varchar(255)     | NO   |     |         |                |
+// | create_at   | datetime         | NO   |     | NULL    |                |
+// +-------------+------------------+------+-----+---------+----------------+
+
+type Silence struct {
+	ID         int64      `json:"id" gorm:"column:id"`
+	Endpoint   string     `json:"endpoint" gorm:"column:endpoint"`
+	GrpId      int64      `json:"grp_id" gorm:"column:grp_id"`
+	Metric     string     `json:"metric" gorm:"column:metric"`
+	Tags       string     `json:"tags" gorm:"column:tags"`
+	StrategyId int64      `json:"strategy_id" gorm:"column:strategy_id"`
+	TplId      int64      `json:"tpl_id" gorm:"column:tpl_id"`
+	StartAt    *time.Time `json:"start_at" gorm:"column:start_at"`
+	EndAt      *time.Time `json:"end_at" gorm:"column:end_at"`
+	Weekdays   string     `json:"weekdays" gorm:"column:weekdays"`
+	DailyBegin string     `json:"daily_begin" gorm:"column:daily_begin"`
+	DailyEnd   string     `json:"daily_end" gorm:"column:daily_end"`
+	Creator    string     `json:"creator" gorm:"column:creator"`
+	Comment    string     `json:"comment" gorm:"column:comment"`
+	CreateAt   *time.Time `json:"create_at" gorm:"column:create_at"`
+}
+
+func (this Silence) TableName() string {
+	return "alarm_silence"
+}
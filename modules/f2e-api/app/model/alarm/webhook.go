@@ -0,0 +1,94 @@
+package alarm
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// +---------------+------------------+------+-----+---------+----------------+
+// | Field         | Type             | Null | Key | Default | Extra          |
+// +---------------+------------------+------+-----+---------+----------------+
+// | id            | int(10) unsigned | NO   | PRI | NULL    | auto_increment |
+// | name          | varchar(255)     | NO   | UNI | NULL    |                |
+// | url           | varchar(1024)    | NO   |     | NULL    |                |
+// | method        | varchar(16)      | NO   |     | POST    |                |
+// | content_type  | varchar(16)      | NO   |     | json    |                |
+// | headers       | text             | NO   |     | NULL    |                |
+// | body_template | text             | NO   |     | NULL    |                |
+// | secret        | varchar(255)     | NO   |     |         |                |
+// | max_retries   | int(10) unsigned | NO   |     | 3       |                |
+// | timeout       | int(10) unsigned | NO   |     | 10      |                |
+// | creator       | varchar(64)      | NO   |     |         |                |
+// | create_at     | datetime         | NO   |     | NULL    |                |
+// +---------------+------------------+------+-----+---------+----------------+
+
+type Webhook struct {
+	ID           int64      `json:"id" gorm:"column:id"`
+	Name         string     `json:"name" gorm:"column:name"`
+	URL          string     `json:"url" gorm:"column:url"`
+	Method       string     `json:"method" gorm:"column:method"`
+	ContentType  string     `json:"content_type" gorm:"column:content_type"`
+	Headers      string     `json:"headers" gorm:"column:headers"`
+	BodyTemplate string     `json:"body_template" gorm:"column:body_template"`
+	Secret       string     `json:"-" gorm:"column:secret"`
+	MaxRetries   int        `json:"max_retries" gorm:"column:max_retries"`
+	Timeout      int        `json:"timeout" gorm:"column:timeout"`
+	Creator      string     `json:"creator" gorm:"column:creator"`
+	CreateAt     *time.Time `json:"create_at" gorm:"column:create_at"`
+}
+
+func (this Webhook) TableName() string {
+	return "alarm_webhook"
+}
+
+const redactedValue = "******"
+
+// Redacted hides the values of headers(e.g. the tokens of authorization), for the users other than the creator and admin
+func (this Webhook) Redacted() Webhook {
+	if this.Headers == "" {
+		return this
+	}
+	headers := map[string]string{}
+	if err := json.Unmarshal([]byte(this.Headers), &headers); err != nil {
+		this.Headers = redactedValue
+		return this
+	}
+	for k := range headers {
+		headers[k] = redactedValue
+	}
+	bs, _ := json.Marshal(headers)
+	this.Headers = string(bs)
+	return this
+}
+
+// +--------------+------------------+------+-----+---------+----------------+
+// | Field        | Type             | Null | Key | Default | Extra          |
+// +--------------+------------------+------+-----+---------+----------------+
+// | id           | int(10) unsigned | NO   | PRI | NULL    | auto_increment |
+// | event_caseId | varchar(50)      | NO   | MUL | NULL    |                |
+// | webhook_id   | int(10) unsigned | NO   | MUL | NULL    |                |
+// | attempt      | int(10) unsigned | NO   |     | 1       |                |
+// | status_code  | int(11)          | NO   |     | 0       |                |
+// | request      | text             | NO   |     | NULL    |                |
+// | response     | text             | NO   |     | NULL    |                |
+// | error        | varchar(255)     | NO   |     |         |                |
+// | duration_ms  | int(10) unsigned | NO   |     | 0       |                |
+// | create_at    | datetime         | NO   |     | NULL    |                |
+// +--------------+------------------+------+-----+---------+----------------+
+
+type WebhookDelivery struct {
+	ID          int64      `json:"id" gorm:"column:id"`
+	EventCaseId string     `json:"event_caseId" gorm:"column:event_caseId"`
+	WebhookId   int64      `json:"webhook_id" gorm:"column:webhook_id"`
+	Attempt     int        `json:"attempt" gorm:"column:attempt"`
+	StatusCode  int        `json:"status_code" gorm:"column:status_code"`
+	Request     string     `json:"request" gorm:"column:request"`
+	Response    string     `json:"response" gorm:"column:response"`
+	Error       string     `json:"error" gorm:"column:error"`
+	DurationMs  int64      `json:"duration_ms" gorm:"column:duration_ms"`
+	CreateAt    *time.Time `json:"create_at" gorm:"column:create_at"`
+}
+
+func (this WebhookDelivery) TableName() string {
+	return "alarm_webhook_delivery"
+}
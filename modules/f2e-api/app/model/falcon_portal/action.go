@@ -1,5 +1,11 @@
 package falcon_portal
 
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
 ////////////////////////////////////////////////////////////////////////////////////
 // |id                    | int(10) unsigned | NO   | PRI | NULL    | auto_increment |
 // | uic                  | varchar(255)     | NO   |     |         |                |
@@ -9,6 +15,9 @@ package falcon_portal
 // | before_callback_mail | tinyint(4)       | NO   |     | 0       |                |
 // | after_callback_sms   | tinyint(4)       | NO   |     | 0       |                |
 // | after_callback_mail  | tinyint(4)       | NO   |     | 0  		  |								 |
+// | escalation_policy_id | int(10) unsigned | NO   |     | 0       |                |
+// | webhook_id           | int(10) unsigned | NO   |     | 0       |                |
+// | channels             | varchar(64)      | NO   |     |         |                |
 ////////////////////////////////////////////////////////////////////////////////////
 type Action struct {
 	ID                 int64  `json:"id" gorm:"column:id"`
@@ -19,8 +28,30 @@ type Action struct {
 	BeforeCallbackMail int    `json:"before_callback_mail" orm:"column:before_callback_mail"`
 	AfterCallbackSMS   int    `json:"after_callback_sms" orm:"column:after_callback_sms"`
 	AfterCallbackMail  int    `json:"after_callback_mail" orm:"column:after_callback_mail"`
+	EscalationPolicyId int64  `json:"escalation_policy_id" gorm:"column:escalation_policy_id"`
+	WebhookId          int64  `json:"webhook_id" gorm:"column:webhook_id"`
+	Channels           string `json:"channels" gorm:"column:channels"`
 }
 
 func (this Action) TableName() string {
 	return "action"
 }
+
+var validChannels = map[string]bool{"sms": true, "mail": true, "qq": true, "serverchan": true, "webhook": true}
+
+// CheckChannels validates the notification channels of action, comma separated, empty means sms, mail, qq and serverchan
+func CheckChannels(channels string, webhookId int64) error {
+	if channels == "" {
+		return nil
+	}
+	for _, c := range strings.Split(channels, ",") {
+		c = strings.TrimSpace(c)
+		if !validChannels[c] {
+			return fmt.Errorf("channel %s is not supported, only accepect [sms, mail, qq, serverchan, webhook]", c)
+		}
+		if c == "webhook" && webhookId == 0 {
+			return errors.New("webhook_id is needed for webhook channel")
+		}
+	}
+	return nil
+}
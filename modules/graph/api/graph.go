@@ -21,6 +21,7 @@ func (this *Graph) GetRrd(key string, rrdfile *g.File) (err error) {
 		return err
 	} else {
 		rrdfile.Filename = g.RrdFileName(g.Config().RRD.Storage, md5, dsType, step)
+		rrdfile.LastTs = store.GetLastItem(md5).Timestamp
 	}
 
 	items := store.GraphItems.PopAll(key)
@@ -32,6 +33,43 @@ func (this *Graph) GetRrd(key string, rrdfile *g.File) (err error) {
 	return
 }
 
+// LastUpdates returns the last update time of the rrd files by the rrd cache keys, for comparing between replicas.
+// The missing files are omitted.
+func (this *Graph) LastUpdates(keys []string, resp *map[string]int64) error {
+	ret := make(map[string]int64, len(keys))
+	storage := g.Config().RRD.Storage
+	for _, key := range keys {
+		md5, dsType, step, err := g.SplitRrdCacheKey(key)
+		if err != nil {
+			continue
+		}
+		filename := g.RrdFileName(storage, md5, dsType, step)
+		if !g.IsRrdFileExist(filename) {
+			continue
+		}
+		if last, err := rrdtool.Last(filename); err == nil {
+			ret[key] = last.Timestamp
+		}
+	}
+	*resp = ret
+	return nil
+}
+
+// PutRrd receives the rrd file pushed by the old node when rebalancing, resp.Code is 1 if the file exists
+func (this *Graph) PutRrd(file g.RrdFile, resp *cmodel.SimpleRpcResponse) error {
+	if !g.Config().Migrating() {
+		return fmt.Errorf("graph is not rebalancing")
+	}
+	existed, err := rrdtool.ReceiveFile(&file)
+	if err != nil {
+		return err
+	}
+	if existed {
+		resp.Code = 1
+	}
+	return nil
+}
+
 func (this *Graph) Ping(req cmodel.NullRpcRequest, resp *cmodel.SimpleRpcResponse) error {
 	return nil
 }
@@ -126,11 +164,10 @@ func (this *Graph) Query(param cmodel.GraphQueryParam, resp *cmodel.GraphQueryRe
 	items, flag := store.GraphItems.FetchAll(key)
 	items_size := len(items)
 
-	if cfg.Migrate.Enabled && flag&g.GRAPH_F_MISS != 0 {
-		node, _ := rrdtool.Consistent.Get(param.Endpoint + "/" + param.Counter)
+	if tasks, remote := rrdtool.SourceNode(param.Endpoint + "/" + param.Counter); cfg.Migrating() && remote && flag&g.GRAPH_F_MISS != 0 {
 		done := make(chan error, 1)
 		res := &cmodel.GraphAccurateQueryResponse{}
-		rrdtool.Net_task_ch[node] <- &rrdtool.Net_task_t{
+		tasks <- &rrdtool.Net_task_t{
 			Method: rrdtool.NET_TASK_M_QUERY,
 			Done:   done,
 			Args:   param,
@@ -141,14 +178,18 @@ func (this *Graph) Query(param cmodel.GraphQueryParam, resp *cmodel.GraphQueryRe
 		datas = res.Values
 		datas_size = len(datas)
 	} else {
-		// read data from rrd file
+		// read data from file
 		datas, _ = rrdtool.Fetch(filename, param.ConsolFun, start_ts, end_ts, qstep)
 		datas_size = len(datas)
 	}
 
-	nowTs := time.Now().Unix()
-	lastUpTs := nowTs - nowTs%int64(step)
-	rra1StartTs := lastUpTs - int64(rrdtool.RRA1PointCnt*step)
+	// 按文件实际的归档计算, 文件不在本地(例如扩容时数据还在旧节点上)时按当前的归档策略
+	now := time.Now().Unix()
+	rra1StartTs, err := rrdtool.RawStart(filename, step, now)
+	if err != nil {
+		rawPoints := g.ResolveRetentionPolicyByCounter(param.Endpoint, param.Counter).RawPoints()
+		rra1StartTs = now - now%int64(step) - int64(rawPoints*step)
+	}
 
 	// consolidated, do not merge
 	if start_ts < rra1StartTs {
@@ -284,7 +325,7 @@ func (this *Graph) Info(param cmodel.GraphInfoParam, resp *cmodel.GraphInfoResp)
 	}
 
 	md5 := cutils.Md5(param.Endpoint + "/" + param.Counter)
-	filename := fmt.Sprintf("%s/%s/%s_%s_%d.rrd", g.Config().RRD.Storage, md5[0:2], md5, dsType, step)
+	filename := g.RrdFileName(g.Config().RRD.Storage, md5, dsType, step)
 
 	resp.ConsolFun = dsType
 	resp.Step = step
@@ -355,5 +396,16 @@ func GetLast(endpoint, counter string) *cmodel.RRDData {
 func GetLastRaw(endpoint, counter string) *cmodel.RRDData {
 	md5 := cutils.Md5(endpoint + "/" + counter)
 	item := store.GetLastItem(md5)
+	if item.Timestamp == 0 {
+		// 重启之后没有收到数据, 从文件中读取
+		if dsType, step, exists := index.GetTypeAndStep(endpoint, counter); exists {
+			filename := g.RrdFileName(g.Config().RRD.Storage, md5, dsType, step)
+			if g.IsRrdFileExist(filename) {
+				if last, err := rrdtool.Last(filename); err == nil {
+					return last
+				}
+			}
+		}
+	}
 	return cmodel.NewRRDData(item.Timestamp, item.Value)
 }
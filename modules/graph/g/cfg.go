@@ -2,6 +2,7 @@ package g
 
 import (
 	"encoding/json"
+	"fmt"
 	log "github.com/Sirupsen/logrus"
 	"sync/atomic"
 	"unsafe"
@@ -12,6 +13,14 @@ import (
 type File struct {
 	Filename string
 	Body     []byte
+	LastTs   int64 // timestamp of the last item in file, the cached items not after it are dropped by receiver
+}
+
+// RrdFile is an rrd file pushed to its new owner by rebalancing
+type RrdFile struct {
+	Key    string // rrd cache key
+	Body   []byte
+	LastTs int64
 }
 
 type HttpConfig struct {
@@ -26,6 +35,7 @@ type RpcConfig struct {
 
 type RRDConfig struct {
 	Storage string `json:"storage"`
+	Backend string `json:"backend"` // rrdtool or columnar, all nodes of a cluster must use the same backend
 }
 
 type DBConfig struct {
@@ -33,20 +43,54 @@ type DBConfig struct {
 	MaxIdle int    `json:"maxIdle"`
 }
 
+type RingConfig struct {
+	Version  int               `json:"version"`
+	Replicas int               `json:"replicas"`
+	Cluster  map[string]string `json:"cluster"`
+}
+
+// RebalanceConfig moves the rrd files from the ring of "from" to the ring of "to".
+// All graph nodes of both rings have the same config except node.
+type RebalanceConfig struct {
+	Enabled     bool        `json:"enabled"`
+	Node        string      `json:"node"`        // name of this node in the rings
+	Concurrency int         `json:"concurrency"` // number of pushing workers
+	From        *RingConfig `json:"from"`
+	To          *RingConfig `json:"to"`
+}
+
+// AntiEntropyConfig repairs the rrd files of this node by the replicas, i.e. the other addresses of
+// the same graph node in transfer
+type AntiEntropyConfig struct {
+	Enabled  bool     `json:"enabled"`
+	Peers    []string `json:"peers"`    // rpc addresses of the replicas
+	Interval int      `json:"interval"` // seconds between two rounds
+	MaxLag   int      `json:"maxLag"`   // seconds, the file is pulled if it is older than the replica by more than it
+	Batch    int      `json:"batch"`    // number of counters compared per rpc
+}
+
 type GlobalConfig struct {
-	Pid         string      `json:"pid"`
-	Debug       bool        `json:"debug"`
-	Http        *HttpConfig `json:"http"`
-	Rpc         *RpcConfig  `json:"rpc"`
-	RRD         *RRDConfig  `json:"rrd"`
-	DB          *DBConfig   `json:"db"`
-	CallTimeout int32       `json:"callTimeout"`
+	Pid         string           `json:"pid"`
+	Debug       bool             `json:"debug"`
+	Http        *HttpConfig      `json:"http"`
+	Rpc         *RpcConfig       `json:"rpc"`
+	RRD         *RRDConfig       `json:"rrd"`
+	DB          *DBConfig        `json:"db"`
+	CallTimeout int32            `json:"callTimeout"`
+	Retention   *RetentionConfig `json:"retention"`
 	Migrate     struct {
 		Concurrency int               `json:"concurrency"` //number of multiple worker per node
 		Enabled     bool              `json:"enabled"`
 		Replicas    int               `json:"replicas"`
 		Cluster     map[string]string `json:"cluster"`
 	} `json:"migrate"`
+	Rebalance   *RebalanceConfig   `json:"rebalance"`
+	AntiEntropy *AntiEntropyConfig `json:"antiEntropy"`
+}
+
+// Migrating is true if the missing rrd files are pulled from the other nodes, by migrate or by rebalance
+func (this *GlobalConfig) Migrating() bool {
+	return this.Migrate.Enabled || (this.Rebalance != nil && this.Rebalance.Enabled)
 }
 
 var (
@@ -80,12 +124,93 @@ func ParseConfig(cfg string) {
 		log.Fatalln("parse config file", cfg, "error:", err.Error())
 	}
 
+	if c.Retention != nil {
+		if err := c.Retention.compile(); err != nil {
+			log.Fatalln("parse config file", cfg, "error:", err.Error())
+		}
+	}
+
+	switch c.RRD.Backend {
+	case "":
+		c.RRD.Backend = RRD_BACKEND_RRDTOOL
+	case RRD_BACKEND_RRDTOOL, RRD_BACKEND_COLUMNAR:
+	default:
+		log.Fatalln("parse config file", cfg, "error: unknown rrd backend", c.RRD.Backend)
+	}
+
 	if c.Migrate.Enabled && len(c.Migrate.Cluster) == 0 {
 		c.Migrate.Enabled = false
 	}
 
+	if err := checkRebalanceConfig(&c); err != nil {
+		log.Fatalln("parse config file", cfg, "error:", err.Error())
+	}
+
+	checkAntiEntropyConfig(&c)
+
 	// set config
 	atomic.StorePointer(&ptr, unsafe.Pointer(&c))
 
 	log.Println("g.ParseConfig ok, file", cfg)
 }
+
+func checkRebalanceConfig(c *GlobalConfig) error {
+	r := c.Rebalance
+	if r == nil || !r.Enabled {
+		return nil
+	}
+	if c.Migrate.Enabled {
+		return fmt.Errorf("migrate and rebalance can't be enabled at the same time")
+	}
+	if r.From == nil || r.To == nil || len(r.From.Cluster) == 0 || len(r.To.Cluster) == 0 {
+		return fmt.Errorf("rings of rebalance are needed")
+	}
+	if r.To.Version <= r.From.Version {
+		return fmt.Errorf("version of rebalance.to must be greater than rebalance.from")
+	}
+	_, inFrom := r.From.Cluster[r.Node]
+	_, inTo := r.To.Cluster[r.Node]
+	if !inFrom && !inTo {
+		return fmt.Errorf("node %q of rebalance is not in the rings", r.Node)
+	}
+	for node, addr := range r.To.Cluster {
+		if fromAddr, ok := r.From.Cluster[node]; ok && fromAddr != addr {
+			return fmt.Errorf("node %s has different addresses in the rings", node)
+		}
+	}
+	if r.Concurrency <= 0 {
+		r.Concurrency = 2
+	}
+	return nil
+}
+
+func checkAntiEntropyConfig(c *GlobalConfig) {
+	ae := c.AntiEntropy
+	if ae == nil {
+		return
+	}
+	if len(ae.Peers) == 0 {
+		ae.Enabled = false
+	}
+	if ae.Interval <= 0 {
+		ae.Interval = 3600
+	}
+	if ae.MaxLag <= 0 {
+		ae.MaxLag = 3600
+	}
+	if ae.Batch <= 0 {
+		ae.Batch = 200
+	}
+}
+
+// DisableRebalance cuts over the rebalancing, the rrd files are not pulled or pushed any more
+func DisableRebalance() {
+	c := *Config()
+	if c.Rebalance == nil {
+		return
+	}
+	rebalance := *c.Rebalance
+	rebalance.Enabled = false
+	c.Rebalance = &rebalance
+	atomic.StorePointer(&ptr, unsafe.Pointer(&c))
+}
@@ -19,9 +19,12 @@ import (
 // 0.5.3 fix bug of last&last_raw
 // 0.5.4 fix bug of Query.merge
 // 0.5.5 use commom(rm model), fix sync disk
+// 0.5.7 support online rebalancing with ring versions
+// 0.5.8 support anti-entropy between replicas
+// 0.5.9 add storage backends, support columnar storage
 
 const (
-	VERSION         = "0.5.6"
+	VERSION         = "0.5.9"
 	GAUGE           = "GAUGE"
 	DERIVE          = "DERIVE"
 	COUNTER         = "COUNTER"
@@ -30,6 +33,12 @@ const (
 	DEFAULT_STEP    = 60      //s
 	MIN_STEP        = 30      //s
 )
+
+// 存储后端
+const (
+	RRD_BACKEND_RRDTOOL  = "rrdtool"
+	RRD_BACKEND_COLUMNAR = "columnar"
+)
 const (
 	GRAPH_F_MISS uint32 = 1 << iota
 	GRAPH_F_ERR
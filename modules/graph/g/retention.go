@@ -0,0 +1,192 @@
+package g
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	cutils "github.com/Cepave/open-falcon-backend/common/utils"
+)
+
+// RETENTION POLICY
+// 归档策略, 仅在创建rrd文件时生效, 已存在的rrd文件保持原有的归档方式
+
+type RetentionArchive struct {
+	Steps  int      `json:"steps"`  // 多少个原始点合并成一个点, 1表示原始数据
+	Points int      `json:"points"` // 保存的点数
+	CFs    []string `json:"cf"`     // 合并函数: AVERAGE, MAX, MIN, LAST
+}
+
+type RetentionPolicy struct {
+	Name string `json:"name"`
+	// Regular expressions for matching counters, empty one matches everything
+	Endpoint string              `json:"endpoint"`
+	Metric   string              `json:"metric"`
+	Tags     string              `json:"tags"` // matched with sorted tags, e.g. "a=1,b=2"
+	Archives []*RetentionArchive `json:"archives"`
+
+	endpointRegexp *regexp.Regexp
+	metricRegexp   *regexp.Regexp
+	tagsRegexp     *regexp.Regexp
+}
+
+type RetentionConfig struct {
+	// Policies are matched by the order of configuration, the first matched one wins.
+	// DefaultRetentionPolicy is used if none of them is matched.
+	Policies []*RetentionPolicy `json:"policies"`
+}
+
+var DefaultRetentionPolicy = &RetentionPolicy{
+	Name: "default",
+	Archives: []*RetentionArchive{
+		{Steps: 1, Points: 720, CFs: []string{"AVERAGE"}},                 // 1m一个点存12h
+		{Steps: 5, Points: 576, CFs: []string{"AVERAGE", "MAX", "MIN"}},   // 5m一个点存2d
+		{Steps: 20, Points: 504, CFs: []string{"AVERAGE", "MAX", "MIN"}},  // 20m一个点存7d
+		{Steps: 180, Points: 766, CFs: []string{"AVERAGE", "MAX", "MIN"}}, // 3h一个点存3month
+		{Steps: 720, Points: 730, CFs: []string{"AVERAGE", "MAX", "MIN"}}, // 12h一个点存1year
+	},
+}
+
+var validCFs = map[string]bool{
+	"AVERAGE": true,
+	"MAX":     true,
+	"MIN":     true,
+	"LAST":    true,
+}
+
+// Span returns the seconds covered by the longest archive, with the step of counter
+func (p *RetentionPolicy) Span(step int) int64 {
+	span := int64(0)
+	for _, archive := range p.Archives {
+		if s := int64(archive.Steps) * int64(archive.Points) * int64(step); s > span {
+			span = s
+		}
+	}
+	return span
+}
+
+// RawPoints returns the number of points of un-consolidated data
+func (p *RetentionPolicy) RawPoints() int {
+	for _, archive := range p.Archives {
+		if archive.Steps == 1 {
+			return archive.Points
+		}
+	}
+	return 0
+}
+
+func (p *RetentionPolicy) Match(endpoint string, metric string, tags string) bool {
+	if p.endpointRegexp != nil && !p.endpointRegexp.MatchString(endpoint) {
+		return false
+	}
+	if p.metricRegexp != nil && !p.metricRegexp.MatchString(metric) {
+		return false
+	}
+	if p.tagsRegexp != nil && !p.tagsRegexp.MatchString(tags) {
+		return false
+	}
+	return true
+}
+
+func (p *RetentionPolicy) compile() error {
+	var err error
+
+	if p.Name == "" {
+		return fmt.Errorf("retention policy needs a name")
+	}
+	if len(p.Archives) == 0 {
+		return fmt.Errorf("retention policy[%s] has no archive", p.Name)
+	}
+
+	for _, archive := range p.Archives {
+		if archive.Steps < 1 || archive.Points < 1 {
+			return fmt.Errorf("retention policy[%s] has invalid archive. steps: %d, points: %d", p.Name, archive.Steps, archive.Points)
+		}
+		if len(archive.CFs) == 0 {
+			archive.CFs = []string{"AVERAGE"}
+		}
+		for i, cf := range archive.CFs {
+			archive.CFs[i] = strings.ToUpper(cf)
+			if !validCFs[archive.CFs[i]] {
+				return fmt.Errorf("retention policy[%s] has unknown consolidation function: %s", p.Name, cf)
+			}
+		}
+	}
+
+	if p.endpointRegexp, err = compileOptionalRegexp(p.Endpoint); err != nil {
+		return fmt.Errorf("retention policy[%s] has bad endpoint pattern: %v", p.Name, err)
+	}
+	if p.metricRegexp, err = compileOptionalRegexp(p.Metric); err != nil {
+		return fmt.Errorf("retention policy[%s] has bad metric pattern: %v", p.Name, err)
+	}
+	if p.tagsRegexp, err = compileOptionalRegexp(p.Tags); err != nil {
+		return fmt.Errorf("retention policy[%s] has bad tags pattern: %v", p.Name, err)
+	}
+
+	return nil
+}
+
+func (c *RetentionConfig) compile() error {
+	names := make(map[string]bool)
+	for _, p := range c.Policies {
+		if err := p.compile(); err != nil {
+			return err
+		}
+		if names[p.Name] {
+			return fmt.Errorf("duplicated retention policy: %s", p.Name)
+		}
+		names[p.Name] = true
+	}
+	return nil
+}
+
+// GetPolicy returns the policy by name, nil if there is no such policy
+func (c *RetentionConfig) GetPolicy(name string) *RetentionPolicy {
+	if name == DefaultRetentionPolicy.Name {
+		return DefaultRetentionPolicy
+	}
+	if c == nil {
+		return nil
+	}
+	for _, p := range c.Policies {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+func (c *RetentionConfig) Resolve(endpoint string, metric string, tags map[string]string) *RetentionPolicy {
+	if c == nil || len(c.Policies) == 0 {
+		return DefaultRetentionPolicy
+	}
+
+	sortedTags := cutils.SortedTags(tags)
+	for _, p := range c.Policies {
+		if p.Match(endpoint, metric, sortedTags) {
+			return p
+		}
+	}
+	return DefaultRetentionPolicy
+}
+
+// ResolveRetentionPolicy finds the policy of the counter by current configuration
+func ResolveRetentionPolicy(endpoint string, metric string, tags map[string]string) *RetentionPolicy {
+	return Config().Retention.Resolve(endpoint, metric, tags)
+}
+
+// ResolveRetentionPolicyByCounter is same as ResolveRetentionPolicy, with counter as "metric/tags"
+func ResolveRetentionPolicyByCounter(endpoint string, counter string) *RetentionPolicy {
+	metric, tags := counter, ""
+	if idx := strings.Index(counter, "/"); idx >= 0 {
+		metric, tags = counter[:idx], counter[idx+1:]
+	}
+	return ResolveRetentionPolicy(endpoint, metric, cutils.DictedTagstring(tags))
+}
+
+func compileOptionalRegexp(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	return regexp.Compile(pattern)
+}
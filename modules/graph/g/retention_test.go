@@ -0,0 +1,119 @@
+package g
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testRetentionConfig() *RetentionConfig {
+	return &RetentionConfig{Policies: []*RetentionPolicy{
+		{
+			Name:     "short-lived",
+			Metric:   `^test\.`,
+			Archives: []*RetentionArchive{{Steps: 1, Points: 60, CFs: []string{"average"}}},
+		},
+		{
+			Name: "db",
+			Tags: `(^|,)service=db(,|$)`,
+			Archives: []*RetentionArchive{
+				{Steps: 1, Points: 2880},
+				{Steps: 60, Points: 720, CFs: []string{"AVERAGE", "MAX"}},
+			},
+		},
+		{
+			Name:     "host-01",
+			Endpoint: `^host-01$`,
+			Archives: []*RetentionArchive{{Steps: 5, Points: 100}},
+		},
+	}}
+}
+
+func TestResolveRetentionPolicy(t *testing.T) {
+	c := testRetentionConfig()
+	if err := c.compile(); err != nil {
+		t.Fatal(err)
+	}
+	if cfs := c.Policies[0].Archives[0].CFs; len(cfs) != 1 || cfs[0] != "AVERAGE" {
+		t.Errorf("the consolidation function is not normalized: %v", cfs)
+	}
+	if cfs := c.Policies[1].Archives[0].CFs; len(cfs) != 1 || cfs[0] != "AVERAGE" {
+		t.Errorf("the default consolidation function is not AVERAGE: %v", cfs)
+	}
+
+	for _, r := range []struct {
+		endpoint string
+		metric   string
+		tags     map[string]string
+		expected string
+	}{
+		{"host-02", "test.qps", nil, "short-lived"},
+		// 按配置的顺序, 第一个匹配的策略生效
+		{"host-01", "test.qps", map[string]string{"service": "db"}, "short-lived"},
+		{"host-02", "mysql.qps", map[string]string{"port": "3306", "service": "db"}, "db"},
+		{"host-02", "mysql.qps", map[string]string{"service": "dbproxy"}, "default"},
+		{"host-01", "cpu.idle", nil, "host-01"},
+		{"host-011", "cpu.idle", nil, "default"},
+	} {
+		if p := c.Resolve(r.endpoint, r.metric, r.tags); p.Name != r.expected {
+			t.Errorf("%s/%s %v: expected %s, got %s", r.endpoint, r.metric, r.tags, r.expected, p.Name)
+		}
+	}
+
+	var empty *RetentionConfig
+	if p := empty.Resolve("host-01", "cpu.idle", nil); p != DefaultRetentionPolicy {
+		t.Errorf("expected the default policy, got %s", p.Name)
+	}
+	if c.GetPolicy("db") != c.Policies[1] || c.GetPolicy("default") != DefaultRetentionPolicy || c.GetPolicy("none") != nil {
+		t.Error("unexpected policy by name")
+	}
+
+	if n := c.Policies[1].RawPoints(); n != 2880 {
+		t.Errorf("expected 2880 raw points, got %d", n)
+	}
+	if n := c.Policies[2].RawPoints(); n != 0 {
+		t.Errorf("expected no raw points, got %d", n)
+	}
+	if span := c.Policies[1].Span(60); span != 60*720*60 {
+		t.Errorf("expected span of 30 days, got %d", span)
+	}
+	if span := DefaultRetentionPolicy.Span(60); span != 720*730*60 {
+		t.Errorf("expected span of 1 year, got %d", span)
+	}
+}
+
+func TestResolveRetentionPolicyByCounter(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "graph")
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "cfg.json")
+	cfg := `{"rrd": {"storage": "` + filepath.Join(dir, "data") + `"}, "retention": {"policies": [
+		{"name": "db", "tags": "(^|,)service=db(,|$)", "archives": [{"steps": 1, "points": 2880}]}]}}`
+	if err := ioutil.WriteFile(filename, []byte(cfg), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ParseConfig(filename)
+
+	if p := ResolveRetentionPolicyByCounter("host-01", "mysql.qps/port=3306,service=db"); p.Name != "db" {
+		t.Errorf("expected db, got %s", p.Name)
+	}
+	if p := ResolveRetentionPolicyByCounter("host-01", "mysql.qps"); p != DefaultRetentionPolicy {
+		t.Errorf("expected the default policy, got %s", p.Name)
+	}
+}
+
+func TestCompileRetentionConfig(t *testing.T) {
+	archives := []*RetentionArchive{{Steps: 1, Points: 60}}
+	for _, c := range []*RetentionConfig{
+		{Policies: []*RetentionPolicy{{Archives: archives}}},
+		{Policies: []*RetentionPolicy{{Name: "empty"}}},
+		{Policies: []*RetentionPolicy{{Name: "steps", Archives: []*RetentionArchive{{Steps: 0, Points: 60}}}}},
+		{Policies: []*RetentionPolicy{{Name: "cf", Archives: []*RetentionArchive{{Steps: 1, Points: 60, CFs: []string{"SUM"}}}}}},
+		{Policies: []*RetentionPolicy{{Name: "regexp", Metric: "(", Archives: archives}}},
+		{Policies: []*RetentionPolicy{{Name: "dup", Archives: archives}, {Name: "dup", Archives: archives}}},
+	} {
+		if err := c.compile(); err == nil {
+			t.Errorf("expected error of %+v", c.Policies[0])
+		}
+	}
+}
@@ -9,9 +9,17 @@ import (
 )
 
 // RRDTOOL UTILS
-// 监控数据对应的rrd文件名称
+// 监控数据对应的rrd文件名称, 扩展名由存储后端决定
 func RrdFileName(baseDir string, md5 string, dsType string, step int) string {
-	return fmt.Sprintf("%s/%s/%s_%s_%d.rrd", baseDir, md5[0:2], md5, dsType, step)
+	return fmt.Sprintf("%s/%s/%s_%s_%d.%s", baseDir, md5[0:2], md5, dsType, step, RrdFileExt())
+}
+
+// 存储后端的文件扩展名
+func RrdFileExt() string {
+	if cfg := Config(); cfg != nil && cfg.RRD.Backend == RRD_BACKEND_COLUMNAR {
+		return "col"
+	}
+	return "rrd"
 }
 
 // rrd文件是否存在
@@ -24,6 +24,8 @@ func init() {
 	configDebugRoutes()
 	configProcRoutes()
 	configIndexRoutes()
+	configRetentionRoutes()
+	configRebalanceRoutes()
 	Close_chan = make(chan int, 1)
 	Close_done_chan = make(chan int, 1)
 }
@@ -78,13 +80,20 @@ func Start() {
 		return
 	}
 
-	if g.Config().Migrate.Enabled {
+	if g.Config().Migrating() {
 		http.HandleFunc("/counter/migrate",
 			func(w http.ResponseWriter, r *http.Request) {
 				RenderDataJson(w, rrdtool.GetCounter())
 			})
 	}
 
+	if cfg := g.Config().AntiEntropy; cfg != nil && cfg.Enabled {
+		http.HandleFunc("/counter/antientropy",
+			func(w http.ResponseWriter, r *http.Request) {
+				RenderDataJson(w, rrdtool.GetAntiEntropyStat())
+			})
+	}
+
 	addr := g.Config().Http.Listen
 	if addr == "" {
 		return
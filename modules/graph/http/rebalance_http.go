@@ -0,0 +1,39 @@
+package http
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/Cepave/open-falcon-backend/modules/graph/g"
+	"github.com/Cepave/open-falcon-backend/modules/graph/rrdtool"
+)
+
+func configRebalanceRoutes() {
+	http.HandleFunc("/rebalance/progress", func(w http.ResponseWriter, r *http.Request) {
+		RenderDataJson(w, rrdtool.GetRebalanceProgress())
+	})
+
+	// 重新读取配置文件并开始扩容, 不需要重启graph
+	http.HandleFunc("/rebalance/start", func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.RemoteAddr, "127.0.0.1") {
+			RenderDataJson(w, "no privilege")
+			return
+		}
+		g.ParseConfig(g.ConfigFile)
+		if err := rrdtool.StartRebalance(); err != nil {
+			RenderMsgJson(w, err.Error())
+			return
+		}
+		RenderDataJson(w, "ok")
+	})
+
+	// transfer和query切换到新环之后, 停止拉取和推送rrd文件
+	http.HandleFunc("/rebalance/cutover", func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.RemoteAddr, "127.0.0.1") {
+			RenderDataJson(w, "no privilege")
+			return
+		}
+		g.DisableRebalance()
+		RenderDataJson(w, "ok")
+	})
+}
@@ -0,0 +1,40 @@
+package http
+
+import (
+	"net/http"
+
+	cutils "github.com/Cepave/open-falcon-backend/common/utils"
+	"github.com/Cepave/open-falcon-backend/modules/graph/g"
+)
+
+func configRetentionRoutes() {
+	// all of the configured policies
+	http.HandleFunc("/retention/policies", func(w http.ResponseWriter, r *http.Request) {
+		policies := []*g.RetentionPolicy{}
+		if cfg := g.Config().Retention; cfg != nil {
+			policies = append(policies, cfg.Policies...)
+		}
+		policies = append(policies, g.DefaultRetentionPolicy)
+
+		RenderDataJson(w, policies)
+	})
+
+	// the policy resolved for a counter: e=endpoint&m=metric&t=tags
+	http.HandleFunc("/retention/policy", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+
+		if !(len(r.Form["e"]) > 0 && len(r.Form["m"]) > 0) {
+			RenderDataJson(w, "bad args")
+			return
+		}
+		endpoint := r.Form["e"][0]
+		metric := r.Form["m"][0]
+
+		tags := make(map[string]string)
+		if len(r.Form["t"]) > 0 {
+			tags = cutils.DictedTagstring(r.Form["t"][0])
+		}
+
+		RenderDataJson(w, g.ResolveRetentionPolicy(endpoint, metric, tags))
+	})
+}
@@ -5,6 +5,7 @@ import (
 	log "github.com/Sirupsen/logrus"
 
 	cmodel "github.com/Cepave/open-falcon-backend/common/model"
+	cutils "github.com/Cepave/open-falcon-backend/common/utils"
 	"github.com/Cepave/open-falcon-backend/modules/graph/g"
 )
 
@@ -74,3 +75,44 @@ func GetIndexedItemCache(endpoint string, metric string, tags map[string]string,
 	r = icitem.Item
 	return
 }
+
+// IndexedItems returns the last items of the counters in the index cache, i.e. the counters received recently
+func IndexedItems() []*cmodel.GraphItem {
+	keys := indexedItemCache.Keys()
+	items := make([]*cmodel.GraphItem, 0, len(keys))
+	for _, key := range keys {
+		cached := indexedItemCache.Get(key)
+		if cached == nil {
+			continue
+		}
+		items = append(items, cached.(*IndexCacheItem).Item)
+	}
+	return items
+}
+
+// CounterPKs returns the primary keys(endpoint/counter) of the checksums by scanning the counters in db,
+// for the counters not in the index cache
+func CounterPKs(checksums map[string]bool) (map[string]string, error) {
+	dbConn, err := g.GetDbConn("CounterPKs")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := dbConn.Query("SELECT e.endpoint, c.counter FROM endpoint_counter c JOIN endpoint e ON c.endpoint_id = e.id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ret := make(map[string]string)
+	for rows.Next() {
+		var endpoint, counter string
+		if err := rows.Scan(&endpoint, &counter); err != nil {
+			return nil, err
+		}
+		pk := cutils.PK2(endpoint, counter)
+		if md5 := cutils.Md5(pk); checksums[md5] {
+			ret[md5] = pk
+		}
+	}
+	return ret, rows.Err()
+}
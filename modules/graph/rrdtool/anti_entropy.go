@@ -0,0 +1,214 @@
+package rrdtool
+
+import (
+	"math"
+	"net/rpc"
+	"os"
+	"sync/atomic"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	cmodel "github.com/Cepave/open-falcon-backend/common/model"
+	"github.com/Cepave/open-falcon-backend/modules/graph/g"
+	"github.com/Cepave/open-falcon-backend/modules/graph/index"
+	"github.com/Cepave/open-falcon-backend/modules/graph/storage"
+)
+
+// 同一个graph节点的多个副本(transfer中的多个地址)会收到相同的数据, 但副本宕机期间的数据会缺失.
+// 定期比较副本之间rrd文件的最后更新时间, 从副本拉取本节点缺失的文件; 落后的文件只合并副本上更新的数据,
+// 本节点已有的数据不会被副本覆盖
+var antiEntropyStat = &AntiEntropyStat{}
+
+type AntiEntropyStat struct {
+	Rounds    int64 `json:"rounds"`
+	LastRound int64 `json:"last_round"`
+	Compared  int64 `json:"compared"`
+	Missing   int64 `json:"missing"` // the file is missing in this node
+	Lagging   int64 `json:"lagging"` // the file is older than the replica by more than maxLag
+	Repaired  int64 `json:"repaired"`
+	Failed    int64 `json:"failed"`
+}
+
+func GetAntiEntropyStat() *AntiEntropyStat {
+	return &AntiEntropyStat{
+		Rounds:    atomic.LoadInt64(&antiEntropyStat.Rounds),
+		LastRound: atomic.LoadInt64(&antiEntropyStat.LastRound),
+		Compared:  atomic.LoadInt64(&antiEntropyStat.Compared),
+		Missing:   atomic.LoadInt64(&antiEntropyStat.Missing),
+		Lagging:   atomic.LoadInt64(&antiEntropyStat.Lagging),
+		Repaired:  atomic.LoadInt64(&antiEntropyStat.Repaired),
+		Failed:    atomic.LoadInt64(&antiEntropyStat.Failed),
+	}
+}
+
+func antiEntropy() {
+	interval := g.Config().AntiEntropy.Interval
+	for {
+		time.Sleep(time.Duration(interval) * time.Second)
+
+		cfg := g.Config()
+		// 扩容时文件在节点之间移动, 跳过
+		if cfg.AntiEntropy == nil || !cfg.AntiEntropy.Enabled || cfg.Migrating() {
+			continue
+		}
+
+		interval = cfg.AntiEntropy.Interval
+
+		keys := indexedRrdKeys()
+		for _, peer := range cfg.AntiEntropy.Peers {
+			if err := repairFrom(peer, keys, cfg.AntiEntropy); err != nil {
+				log.Printf("anti entropy with %s fail: %v", peer, err)
+			}
+		}
+		atomic.AddInt64(&antiEntropyStat.Rounds, 1)
+		atomic.StoreInt64(&antiEntropyStat.LastRound, time.Now().Unix())
+	}
+}
+
+func indexedRrdKeys() []string {
+	items := index.IndexedItems()
+	keys := make([]string, 0, len(items))
+	for _, item := range items {
+		keys = append(keys, g.FormRrdCacheKey(item.Checksum(), item.DsType, item.Step))
+	}
+	return keys
+}
+
+// repairFrom compares the rrd files with the replica by batch, and pulls the missing or lagging files
+func repairFrom(peer string, keys []string, cfg *g.AntiEntropyConfig) error {
+	client, err := dial(peer, time.Second)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	baseDir := g.Config().RRD.Storage
+	timeout := time.Duration(g.Config().CallTimeout) * time.Millisecond
+	for i := 0; i < len(keys); i += cfg.Batch {
+		end := i + cfg.Batch
+		if end > len(keys) {
+			end = len(keys)
+		}
+		batch := keys[i:end]
+
+		remote := make(map[string]int64)
+		if err = rpc_call(client, "Graph.LastUpdates", batch, &remote, timeout); err != nil {
+			return err
+		}
+		for _, key := range batch {
+			remoteTs, ok := remote[key]
+			if !ok {
+				// 副本上缺失的文件由副本自己拉取
+				continue
+			}
+			atomic.AddInt64(&antiEntropyStat.Compared, 1)
+
+			md5, dsType, step, _ := g.SplitRrdCacheKey(key)
+			filename := g.RrdFileName(baseDir, md5, dsType, step)
+			if !g.IsRrdFileExist(filename) {
+				atomic.AddInt64(&antiEntropyStat.Missing, 1)
+			} else if last, err := Last(filename); err != nil || last.Timestamp >= remoteTs-int64(cfg.MaxLag) {
+				continue
+			} else {
+				atomic.AddInt64(&antiEntropyStat.Lagging, 1)
+			}
+
+			if err = pullFile(client, key, filename, dsType, step, timeout); err != nil {
+				atomic.AddInt64(&antiEntropyStat.Failed, 1)
+				log.Printf("pull rrd of %s from %s fail: %v", key, peer, err)
+				if err == rpc.ErrShutdown {
+					return err
+				}
+				continue
+			}
+			atomic.AddInt64(&antiEntropyStat.Repaired, 1)
+		}
+	}
+	return nil
+}
+
+func pullFile(client *rpc.Client, key string, filename string, dsType string, step int, timeout time.Duration) error {
+	var rrdfile g.File
+	if err := rpc_call(client, "Graph.GetRrd", key, &rrdfile, timeout); err != nil {
+		return err
+	}
+
+	lastTs := rrdfile.LastTs
+	if !g.IsRrdFileExist(filename) {
+		if err := ReplaceFile(filename, rrdfile.Body); err != nil {
+			return err
+		}
+	} else {
+		var err error
+		if lastTs, err = MergeFile(filename, rrdfile.Body, dsType, step); err != nil {
+			return err
+		}
+	}
+	// 已经写入文件的数据
+	dropCachedItems(key, lastTs)
+	return nil
+}
+
+// mergeFile appends the points of the replica after the last update of the local file,
+// the body of the replica is written to a temporary file for reading
+func mergeFile(filename string, body []byte, dsType string, step int) (int64, error) {
+	local, err := storage.Backend().Last(filename)
+	if err != nil {
+		return 0, err
+	}
+
+	tmp := filename + ".peer"
+	if err = replaceFile(tmp, body, 0644); err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp)
+
+	remote, err := storage.Backend().Last(tmp)
+	if err != nil {
+		return 0, err
+	}
+	if remote.Timestamp <= local.Timestamp {
+		return 0, nil
+	}
+	values, err := storage.Backend().Fetch(tmp, "AVERAGE", local.Timestamp, remote.Timestamp, step)
+	if err != nil {
+		return 0, err
+	}
+
+	items := mergedItems(local, values, dsType, step)
+	if len(items) == 0 {
+		return 0, nil
+	}
+	if err = storage.Backend().Update(filename, items); err != nil {
+		return 0, err
+	}
+	return items[len(items)-1].Timestamp, nil
+}
+
+// mergedItems converts the values fetched from the replica into the items written after the local last value.
+// The fetched values of COUNTER and DERIVE are rates, the raw values are accumulated from the local last value.
+func mergedItems(local *cmodel.RRDData, values []*cmodel.RRDData, dsType string, step int) []*cmodel.GraphItem {
+	isCounter := dsType == "COUNTER" || dsType == "DERIVE"
+	last := float64(local.Value)
+	if isCounter && math.IsNaN(last) {
+		return nil
+	}
+
+	items := []*cmodel.GraphItem{}
+	lastTs := local.Timestamp
+	for _, v := range values {
+		if v == nil || v.Timestamp <= lastTs || math.IsNaN(float64(v.Value)) {
+			continue
+		}
+		value := float64(v.Value)
+		if isCounter {
+			// 缺失的点按后一个点的速率计算
+			last += value * float64(v.Timestamp-lastTs)
+			value = last
+		}
+		items = append(items, &cmodel.GraphItem{DsType: dsType, Step: step, Timestamp: v.Timestamp, Value: value})
+		lastTs = v.Timestamp
+	}
+	return items
+}
@@ -0,0 +1,45 @@
+package rrdtool
+
+import (
+	"math"
+	"testing"
+
+	cmodel "github.com/Cepave/open-falcon-backend/common/model"
+)
+
+func TestMergedItems(t *testing.T) {
+	nan := math.NaN()
+	values := []*cmodel.RRDData{
+		cmodel.NewRRDData(1500000000, 5),
+		cmodel.NewRRDData(1500000060, 1),
+		cmodel.NewRRDData(1500000120, nan),
+		cmodel.NewRRDData(1500000180, 2),
+	}
+
+	// GAUGE直接写入副本的值, 本地已有的时间点不覆盖
+	local := cmodel.NewRRDData(1500000000, 7)
+	items := mergedItems(local, values, "GAUGE", 60)
+	if len(items) != 2 || items[0].Timestamp != 1500000060 || items[0].Value != 1 || items[1].Value != 2 {
+		t.Errorf("unexpected GAUGE items: %v", items)
+	}
+
+	// COUNTER从本地最后的原始值开始累加速率
+	local = cmodel.NewRRDData(1500000000, 1000)
+	items = mergedItems(local, values, "COUNTER", 60)
+	if len(items) != 2 || items[0].Value != 1060 || items[1].Timestamp != 1500000180 || items[1].Value != 1060+2*120 {
+		t.Errorf("unexpected COUNTER items: %v", items)
+	}
+	for _, item := range items {
+		if item.DsType != "COUNTER" || item.Step != 60 {
+			t.Errorf("unexpected item: %v", item)
+		}
+	}
+
+	// 本地没有原始值时无法计算
+	if items := mergedItems(cmodel.NewRRDData(1500000000, nan), values, "DERIVE", 60); len(items) != 0 {
+		t.Errorf("expected no item, got %v", items)
+	}
+	if items := mergedItems(cmodel.NewRRDData(1500000180, 1), values, "GAUGE", 60); len(items) != 0 {
+		t.Errorf("expected no item, got %v", items)
+	}
+}
@@ -47,17 +47,21 @@ const (
 )
 
 var (
-	Consistent       *consistent.Consistent
-	Net_task_ch      map[string]chan *Net_task_t
-	clients          map[string][]*rpc.Client
 	flushrrd_timeout int32
 	stat_cnt         [STAT_SIZE]uint64
+	// 迁移或扩容时的旧环和各节点的任务队列, 查询和刷盘时无锁读取, 只能整体替换
+	migration atomic.Value
 )
 
-func init() {
-	Consistent = consistent.New()
-	Net_task_ch = make(map[string]chan *Net_task_t)
-	clients = make(map[string][]*rpc.Client)
+type migration_t struct {
+	ring        *consistent.Consistent
+	self        string // 扩容时本节点的名字, 迁移时为空
+	net_task_ch map[string]chan *Net_task_t
+}
+
+func currentMigration() *migration_t {
+	m, _ := migration.Load().(*migration_t)
+	return m
 }
 
 func GetCounter() (ret string) {
@@ -89,27 +93,88 @@ func dial(address string, timeout time.Duration) (*rpc.Client, error) {
 }
 
 func migrate_start(cfg *g.GlobalConfig) {
-	var err error
-	var i int
 	if cfg.Migrate.Enabled {
-		Consistent.NumberOfReplicas = cfg.Migrate.Replicas
+		m, err := newMigration(cfg.Migrate.Cluster, cfg.Migrate.Replicas, cfg.Migrate.Concurrency, "")
+		if err != nil {
+			log.Fatalln(err)
+		}
+		migration.Store(m)
+	}
+}
 
-		for node, addr := range cfg.Migrate.Cluster {
-			Consistent.Add(node)
-			Net_task_ch[node] = make(chan *Net_task_t, 16)
-			clients[node] = make([]*rpc.Client, cfg.Migrate.Concurrency)
+// newMigration dials all nodes of the ring except self, the workers are started only if all nodes are dialed
+func newMigration(cluster map[string]string, replicas int, concurrency int, self string) (*migration_t, error) {
+	ring := consistent.New()
+	ring.NumberOfReplicas = replicas
 
-			for i = 0; i < cfg.Migrate.Concurrency; i++ {
-				if clients[node][i], err = dial(addr, time.Second); err != nil {
-					log.Fatalf("node:%s addr:%s err:%s\n", node, addr, err)
+	conns := make(map[string][]*rpc.Client)
+	for node, addr := range cluster {
+		ring.Add(node)
+		if node == self {
+			continue
+		}
+		cs, err := dial_node(addr, concurrency)
+		if err != nil {
+			for _, cs := range conns {
+				for _, c := range cs {
+					c.Close()
 				}
-				go net_task_worker(i, Net_task_ch[node], &clients[node][i], addr)
 			}
+			return nil, fmt.Errorf("node:%s addr:%s err:%s", node, addr, err)
 		}
+		conns[node] = cs
+	}
+
+	m := &migration_t{
+		ring:        ring,
+		self:        self,
+		net_task_ch: make(map[string]chan *Net_task_t),
+	}
+	for node, cs := range conns {
+		m.net_task_ch[node] = start_net_workers(cluster[node], cs, self != "")
+	}
+	return m, nil
+}
+
+func dial_node(addr string, concurrency int) ([]*rpc.Client, error) {
+	conns := make([]*rpc.Client, 0, concurrency)
+	for i := 0; i < concurrency; i++ {
+		conn, err := dial(addr, time.Second)
+		if err != nil {
+			for _, c := range conns {
+				c.Close()
+			}
+			return nil, err
+		}
+		conns = append(conns, conn)
+	}
+	return conns, nil
+}
+
+func start_net_workers(addr string, conns []*rpc.Client, rebalancing bool) chan *Net_task_t {
+	ch := make(chan *Net_task_t, 16)
+	for i := range conns {
+		go net_task_worker(i, ch, &conns[i], addr, rebalancing)
+	}
+	return ch
+}
+
+// SourceNode returns the task queue of the node which has the rrd file of pk before migrating,
+// remote is false if it is this node or not migrating
+func SourceNode(pk string) (tasks chan *Net_task_t, remote bool) {
+	m := currentMigration()
+	if m == nil {
+		return nil, false
+	}
+	node, err := m.ring.Get(pk)
+	if err != nil || node == m.self {
+		return nil, false
 	}
+	tasks, remote = m.net_task_ch[node]
+	return
 }
 
-func net_task_worker(idx int, ch chan *Net_task_t, client **rpc.Client, addr string) {
+func net_task_worker(idx int, ch chan *Net_task_t, client **rpc.Client, addr string, rebalancing bool) {
 	var err error
 	for {
 		select {
@@ -131,7 +196,8 @@ func net_task_worker(idx int, ch chan *Net_task_t, client **rpc.Client, addr str
 					atomic.AddUint64(&stat_cnt[QUERY_S_SUCCESS], 1)
 				}
 			} else if task.Method == NET_TASK_M_PULL {
-				if atomic.LoadInt32(&flushrrd_timeout) != 0 {
+				// 扩容时原节点也会收到这些数据, 不能发送给原节点
+				if atomic.LoadInt32(&flushrrd_timeout) != 0 && !rebalancing {
 					// hope this more faster than fetch_rrd
 					if err = send_data(client, task.Key, addr); err != nil {
 						pfc.Meter("migrate.sendbusy.err", 1)
@@ -294,6 +360,8 @@ func fetch_rrd(client **rpc.Client, key string, addr string) error {
 			if err = <-done; err != nil {
 				goto out
 			} else {
+				// 原节点已经写入文件的数据
+				dropCachedItems(key, rrdfile.LastTs)
 				flag &= ^g.GRAPH_F_MISS
 				goto out
 			}
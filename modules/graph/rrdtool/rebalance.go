@@ -0,0 +1,328 @@
+package rrdtool
+
+import (
+	"errors"
+	"net/rpc"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Cepave/consistent"
+	log "github.com/Sirupsen/logrus"
+
+	cmodel "github.com/Cepave/open-falcon-backend/common/model"
+	"github.com/Cepave/open-falcon-backend/modules/graph/g"
+	"github.com/Cepave/open-falcon-backend/modules/graph/index"
+	"github.com/Cepave/open-falcon-backend/modules/graph/store"
+)
+
+// 扩容时, 旧环(rebalance.from)的节点上缺失的文件从旧环的节点拉取;
+// 本节点在旧环上拥有, 在新环(rebalance.to)上属于其他节点的文件, 推送给新的节点
+var (
+	rebalanced int32
+	progress   = &rebalanceState{}
+)
+
+type RebalanceProgress struct {
+	Node        string `json:"node"`
+	FromVersion int    `json:"from_version"`
+	ToVersion   int    `json:"to_version"`
+	Running     bool   `json:"running"`
+	Start       string `json:"start"`
+	End         string `json:"end"`
+
+	Scanned    int64 `json:"scanned"`    // files in the storage
+	Unresolved int64 `json:"unresolved"` // the counter of the file is not in the index
+	Moving     int64 `json:"moving"`     // counters moved to the other nodes
+	Pushed     int64 `json:"pushed"`
+	Existed    int64 `json:"existed"` // the new node has the file already
+	Missing    int64 `json:"missing"` // no file in this node
+	Failed     int64 `json:"failed"`
+}
+
+type rebalanceState struct {
+	sync.Mutex
+	RebalanceProgress
+}
+
+func (this *rebalanceState) set(f func(p *RebalanceProgress)) {
+	this.Lock()
+	defer this.Unlock()
+	f(&this.RebalanceProgress)
+}
+
+// StartRebalance starts the pulling and pushing of rebalance, it can be started once
+func StartRebalance() error {
+	cfg := g.Config()
+	r := cfg.Rebalance
+	if r == nil || !r.Enabled {
+		return errors.New("rebalance is not enabled")
+	}
+	if cfg.Migrate.Enabled {
+		return errors.New("migrate is enabled")
+	}
+	if !atomic.CompareAndSwapInt32(&rebalanced, 0, 1) {
+		return errors.New("rebalance has been started")
+	}
+
+	// 所有节点连接成功后才替换旧环, 失败时不再拉取文件, 可以重试
+	m, err := newMigration(r.From.Cluster, r.From.Replicas, r.Concurrency, r.Node)
+	if err != nil {
+		g.DisableRebalance()
+		atomic.StoreInt32(&rebalanced, 0)
+		return err
+	}
+	to := consistent.New()
+	to.NumberOfReplicas = r.To.Replicas
+	for node := range r.To.Cluster {
+		to.Add(node)
+	}
+	migration.Store(m)
+
+	go pushMovedFiles(r, m.ring, to)
+	log.Printf("rebalance started, node %s, version %d -> %d", r.Node, r.From.Version, r.To.Version)
+	return nil
+}
+
+func GetRebalanceProgress() *RebalanceProgress {
+	progress.Lock()
+	defer progress.Unlock()
+	ret := progress.RebalanceProgress
+	ret.Scanned = atomic.LoadInt64(&progress.Scanned)
+	ret.Unresolved = atomic.LoadInt64(&progress.Unresolved)
+	ret.Moving = atomic.LoadInt64(&progress.Moving)
+	ret.Pushed = atomic.LoadInt64(&progress.Pushed)
+	ret.Existed = atomic.LoadInt64(&progress.Existed)
+	ret.Missing = atomic.LoadInt64(&progress.Missing)
+	ret.Failed = atomic.LoadInt64(&progress.Failed)
+	return &ret
+}
+
+type moveTask struct {
+	key string // rrd cache key
+	pk  string
+	to  string
+}
+
+// pushMovedFiles pushes the files in the storage, of which the counters are moved to the other nodes.
+// The idle counters are not in the index cache, their primary keys are resolved by the db.
+func pushMovedFiles(r *g.RebalanceConfig, from *consistent.Consistent, to *consistent.Consistent) {
+	progress.set(func(p *RebalanceProgress) {
+		p.Node, p.FromVersion, p.ToVersion = r.Node, r.From.Version, r.To.Version
+		p.Running = true
+		p.Start = time.Now().Format("2006-01-02 15:04:05")
+	})
+
+	tasks := make(chan *moveTask, 1024)
+	wg := new(sync.WaitGroup)
+	for i := 0; i < r.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pushWorker(tasks, r.To.Cluster)
+		}()
+	}
+
+	storage := g.Config().RRD.Storage
+	keys, err := storedKeys(storage)
+	if err != nil {
+		log.Printf("walk %s fail: %v", storage, err)
+	}
+	pks := resolvePKs(keys)
+	atomic.StoreInt64(&progress.Scanned, int64(len(keys)))
+	for _, key := range keys {
+		// cut over
+		if !g.Config().Migrating() {
+			break
+		}
+		md5, _, _, _ := g.SplitRrdCacheKey(key)
+		pk, ok := pks[md5]
+		if !ok {
+			atomic.AddInt64(&progress.Unresolved, 1)
+			continue
+		}
+		fromNode, err := from.Get(pk)
+		if err != nil || fromNode != r.Node {
+			continue
+		}
+		toNode, err := to.Get(pk)
+		if err != nil || toNode == r.Node {
+			continue
+		}
+		atomic.AddInt64(&progress.Moving, 1)
+		tasks <- &moveTask{key: key, pk: pk, to: toNode}
+	}
+	close(tasks)
+	wg.Wait()
+
+	progress.set(func(p *RebalanceProgress) {
+		p.Running = false
+		p.End = time.Now().Format("2006-01-02 15:04:05")
+	})
+	log.Printf("rebalance pushing done, %+v", GetRebalanceProgress())
+}
+
+// storedKeys walks the storage, and returns the rrd cache keys of the files of the backend
+func storedKeys(storage string) ([]string, error) {
+	ext := "." + g.RrdFileExt()
+	var keys []string
+	err := filepath.Walk(storage, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || filepath.Ext(path) != ext {
+			return nil
+		}
+		key := strings.TrimSuffix(info.Name(), ext)
+		if _, _, _, err := g.SplitRrdCacheKey(key); err == nil {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	return keys, err
+}
+
+// resolvePKs returns md5 => primary key of the counters of the keys, by the index cache and the db
+func resolvePKs(keys []string) map[string]string {
+	pks := make(map[string]string)
+	for _, item := range index.IndexedItems() {
+		pks[item.Checksum()] = item.PrimaryKey()
+	}
+
+	missing := make(map[string]bool)
+	for _, key := range keys {
+		if md5, _, _, err := g.SplitRrdCacheKey(key); err == nil && pks[md5] == "" {
+			missing[md5] = true
+		}
+	}
+	if len(missing) == 0 {
+		return pks
+	}
+	found, err := index.CounterPKs(missing)
+	if err != nil {
+		log.Printf("resolve the counters of %d files fail: %v", len(missing), err)
+	}
+	for md5, pk := range found {
+		pks[md5] = pk
+	}
+	return pks
+}
+
+func pushWorker(tasks chan *moveTask, cluster map[string]string) {
+	clients := make(map[string]*rpc.Client)
+	defer func() {
+		for _, client := range clients {
+			client.Close()
+		}
+	}()
+
+	for task := range tasks {
+		var err error
+		for i := 0; i < 3; i++ {
+			client, ok := clients[task.to]
+			if !ok {
+				if client, err = dial(cluster[task.to], time.Second); err != nil {
+					continue
+				}
+				clients[task.to] = client
+			}
+			if err = pushFile(client, task.key); err == nil {
+				break
+			}
+			client.Close()
+			delete(clients, task.to)
+		}
+		if err != nil {
+			atomic.AddInt64(&progress.Failed, 1)
+			log.Printf("push rrd of %s to %s fail: %v", task.pk, task.to, err)
+		}
+	}
+}
+
+// pushFile flushes the cached items, and pushes the rrd file to the new node by Graph.PutRrd
+func pushFile(client *rpc.Client, key string) error {
+	cfg := g.Config()
+	md5, dsType, step, err := g.SplitRrdCacheKey(key)
+	if err != nil {
+		return err
+	}
+	filename := g.RrdFileName(cfg.RRD.Storage, md5, dsType, step)
+
+	// 在刷盘之前取, 之后收到的数据不在文件中
+	lastTs := store.GetLastItem(md5).Timestamp
+	if items := store.GraphItems.PopAll(key); len(items) > 0 {
+		FlushFile(filename, items)
+	}
+	if !g.IsRrdFileExist(filename) {
+		atomic.AddInt64(&progress.Missing, 1)
+		return nil
+	}
+	body, err := ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	file := &g.RrdFile{Key: key, Body: body, LastTs: lastTs}
+	resp := &cmodel.SimpleRpcResponse{}
+	err = rpc_call(client, "Graph.PutRrd", file, resp, time.Duration(cfg.CallTimeout)*time.Millisecond)
+	if err != nil {
+		return err
+	}
+	if resp.Code == 1 {
+		atomic.AddInt64(&progress.Existed, 1)
+	} else {
+		atomic.AddInt64(&progress.Pushed, 1)
+	}
+	return nil
+}
+
+// ReceiveFile writes the rrd file pushed by the old node, existed is true if the file exists
+func ReceiveFile(file *g.RrdFile) (existed bool, err error) {
+	md5, dsType, step, err := g.SplitRrdCacheKey(file.Key)
+	if err != nil {
+		return false, err
+	}
+	filename := g.RrdFileName(g.Config().RRD.Storage, md5, dsType, step)
+	if g.IsRrdFileExist(filename) {
+		return true, nil
+	}
+
+	done := make(chan error, 1)
+	io_task_chan <- &io_task_t{
+		method: IO_TASK_M_WRITE,
+		args:   &g.File{Filename: filename, Body: file.Body},
+		done:   done,
+	}
+	if err = <-done; err != nil {
+		if os.IsExist(err) {
+			return true, nil
+		}
+		return false, err
+	}
+
+	dropCachedItems(file.Key, file.LastTs)
+	if flag, err := store.GraphItems.GetFlag(file.Key); err == nil {
+		store.GraphItems.SetFlag(file.Key, flag&^g.GRAPH_F_MISS)
+	}
+	return false, nil
+}
+
+// dropCachedItems drops the cached items which are in the file from the other node already
+func dropCachedItems(key string, lastTs int64) {
+	if lastTs <= 0 {
+		return
+	}
+	items := store.GraphItems.PopAll(key)
+	kept := make([]*cmodel.GraphItem, 0, len(items))
+	for _, item := range items {
+		if item.Timestamp > lastTs {
+			kept = append(kept, item)
+		}
+	}
+	if len(kept) > 0 {
+		store.GraphItems.PushAll(key, kept)
+	}
+}
@@ -0,0 +1,179 @@
+package rrdtool
+
+import (
+	"io/ioutil"
+	"net"
+	"net/rpc"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	cmodel "github.com/Cepave/open-falcon-backend/common/model"
+	cutils "github.com/Cepave/open-falcon-backend/common/utils"
+	"github.com/Cepave/open-falcon-backend/modules/graph/g"
+	"github.com/Cepave/open-falcon-backend/modules/graph/store"
+)
+
+var startIoWorker sync.Once
+
+// initTestStorage parses a config with a temporary storage, and starts the io worker
+func initTestStorage(t *testing.T, rebalancing bool) string {
+	dir, err := ioutil.TempDir("", "graph")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := `{"callTimeout": 1000, "rrd": {"storage": "` + filepath.Join(dir, "data") + `"}}`
+	if rebalancing {
+		cfg = `{"callTimeout": 1000, "rrd": {"storage": "` + filepath.Join(dir, "data") + `"},
+			"rebalance": {"enabled": true, "node": "graph-01",
+				"from": {"version": 1, "replicas": 500, "cluster": {"graph-00": "127.0.0.1:6070"}},
+				"to": {"version": 2, "replicas": 500, "cluster": {"graph-00": "127.0.0.1:6070", "graph-01": "127.0.0.1:6071"}}}}`
+	}
+	filename := filepath.Join(dir, "cfg.json")
+	if err := ioutil.WriteFile(filename, []byte(cfg), 0644); err != nil {
+		t.Fatal(err)
+	}
+	g.ParseConfig(filename)
+	startIoWorker.Do(func() { go ioWorker() })
+	return dir
+}
+
+func testItem(endpoint string, ts int64) *cmodel.GraphItem {
+	return &cmodel.GraphItem{Endpoint: endpoint, Metric: "cpu.idle", Value: 1, Timestamp: ts, DsType: "GAUGE", Step: 60}
+}
+
+func TestStoredKeys(t *testing.T) {
+	dir := initTestStorage(t, false)
+	defer os.RemoveAll(dir)
+	storage := g.Config().RRD.Storage
+
+	var expected []string
+	for _, endpoint := range []string{"host-1", "host-2"} {
+		md5 := cutils.Md5(endpoint + "/cpu.idle")
+		filename := g.RrdFileName(storage, md5, "GAUGE", 60)
+		os.MkdirAll(filepath.Dir(filename), 0755)
+		ioutil.WriteFile(filename, []byte("rrd"), 0644)
+		expected = append(expected, g.FormRrdCacheKey(md5, "GAUGE", 60))
+	}
+	// the temporary file and the file of other backends are skipped
+	ioutil.WriteFile(filepath.Join(storage, "ab", "tmp.rrd.tmp"), []byte("tmp"), 0644)
+	ioutil.WriteFile(filepath.Join(storage, "ab", "ab_GAUGE_60.col"), []byte("col"), 0644)
+
+	keys, err := storedKeys(storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(keys)
+	sort.Strings(expected)
+	if len(keys) != 2 || keys[0] != expected[0] || keys[1] != expected[1] {
+		t.Errorf("unexpected keys: %v", keys)
+	}
+}
+
+func TestReceiveFile(t *testing.T) {
+	dir := initTestStorage(t, true)
+	defer os.RemoveAll(dir)
+
+	item := testItem("host-receive", 0)
+	md5 := item.Checksum()
+	key := g.FormRrdCacheKey(md5, item.DsType, item.Step)
+	// the items received by the new node before the file is pushed
+	for _, ts := range []int64{60, 120, 180} {
+		store.GraphItems.PushFront(key, testItem("host-receive", ts), md5, g.Config())
+	}
+	if flag, _ := store.GraphItems.GetFlag(key); flag&g.GRAPH_F_MISS == 0 {
+		t.Fatal("the counter should be missing")
+	}
+
+	existed, err := ReceiveFile(&g.RrdFile{Key: key, Body: []byte("rrd"), LastTs: 120})
+	if err != nil || existed {
+		t.Fatalf("unexpected result: %v %v", existed, err)
+	}
+	body, _ := ioutil.ReadFile(g.RrdFileName(g.Config().RRD.Storage, md5, item.DsType, item.Step))
+	if string(body) != "rrd" {
+		t.Errorf("unexpected file: %q", body)
+	}
+	items, flag := store.GraphItems.FetchAll(key)
+	if len(items) != 1 || items[0].Timestamp != 180 || flag&g.GRAPH_F_MISS != 0 {
+		t.Errorf("unexpected cached items: %v, flag %d", items, flag)
+	}
+
+	if existed, err := ReceiveFile(&g.RrdFile{Key: key, Body: []byte("other")}); err != nil || !existed {
+		t.Errorf("expected existed, got %v %v", existed, err)
+	}
+	if _, err := ReceiveFile(&g.RrdFile{Key: "bad-key"}); err == nil {
+		t.Error("expected error of the bad key")
+	}
+}
+
+// fakeGraph receives the files pushed by Graph.PutRrd
+type fakeGraph struct {
+	sync.Mutex
+	files map[string]*g.RrdFile
+}
+
+func (this *fakeGraph) PutRrd(file g.RrdFile, resp *cmodel.SimpleRpcResponse) error {
+	this.Lock()
+	defer this.Unlock()
+	if _, ok := this.files[file.Key]; ok {
+		resp.Code = 1
+		return nil
+	}
+	this.files[file.Key] = &file
+	return nil
+}
+
+func TestPushFile(t *testing.T) {
+	dir := initTestStorage(t, true)
+	defer os.RemoveAll(dir)
+
+	fake := &fakeGraph{files: make(map[string]*g.RrdFile)}
+	server := rpc.NewServer()
+	server.RegisterName("Graph", fake)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go server.Accept(ln)
+	client, err := dial(ln.Addr().String(), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	item := testItem("host-push", 0)
+	md5 := item.Checksum()
+	key := g.FormRrdCacheKey(md5, item.DsType, item.Step)
+	filename := g.RrdFileName(g.Config().RRD.Storage, md5, item.DsType, item.Step)
+	os.MkdirAll(filepath.Dir(filename), 0755)
+	ioutil.WriteFile(filename, []byte("rrd"), 0644)
+
+	pushed := atomic.LoadInt64(&progress.Pushed)
+	if err := pushFile(client, key); err != nil {
+		t.Fatal(err)
+	}
+	if file := fake.files[key]; file == nil || string(file.Body) != "rrd" {
+		t.Errorf("unexpected pushed file: %+v", file)
+	}
+	if atomic.LoadInt64(&progress.Pushed) != pushed+1 {
+		t.Error("pushed is not counted")
+	}
+
+	existed := atomic.LoadInt64(&progress.Existed)
+	if err := pushFile(client, key); err != nil || atomic.LoadInt64(&progress.Existed) != existed+1 {
+		t.Errorf("existed is not counted, err: %v", err)
+	}
+
+	// the counter without file
+	missing := atomic.LoadInt64(&progress.Missing)
+	other := testItem("host-none", 0)
+	if err := pushFile(client, g.FormRrdCacheKey(other.Checksum(), other.DsType, other.Step)); err != nil ||
+		atomic.LoadInt64(&progress.Missing) != missing+1 {
+		t.Errorf("missing is not counted, err: %v", err)
+	}
+}
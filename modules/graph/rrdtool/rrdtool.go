@@ -2,16 +2,20 @@ package rrdtool
 
 import (
 	"errors"
+	"fmt"
 	log "github.com/Sirupsen/logrus"
-	"math"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync/atomic"
 	"time"
 
 	cmodel "github.com/Cepave/open-falcon-backend/common/model"
-	"github.com/open-falcon/rrdlite"
 	"github.com/toolkits/file"
 
 	"github.com/Cepave/open-falcon-backend/modules/graph/g"
+	"github.com/Cepave/open-falcon-backend/modules/graph/storage"
 	"github.com/Cepave/open-falcon-backend/modules/graph/store"
 )
 
@@ -39,6 +43,26 @@ type readfile_t struct {
 	data     []byte
 }
 
+type last_t struct {
+	filename string
+	data     *cmodel.RRDData
+}
+
+type mergefile_t struct {
+	filename string
+	body     []byte
+	dsType   string
+	step     int
+	lastTs   int64
+}
+
+type rawstart_t struct {
+	filename string
+	step     int
+	now      int64
+	ts       int64
+}
+
 func Start() {
 	cfg := g.Config()
 	var err error
@@ -46,8 +70,19 @@ func Start() {
 	if err = file.EnsureDirRW(cfg.RRD.Storage); err != nil {
 		log.Fatalln("rrdtool.Start error, bad data dir "+cfg.RRD.Storage+",", err)
 	}
+	if err = checkBackend(cfg.RRD.Storage, cfg.RRD.Backend); err != nil {
+		log.Fatalln("rrdtool.Start error,", err)
+	}
 
 	migrate_start(cfg)
+	if cfg.AntiEntropy != nil && cfg.AntiEntropy.Enabled {
+		go antiEntropy()
+	}
+	if cfg.Rebalance != nil && cfg.Rebalance.Enabled {
+		if err = StartRebalance(); err != nil {
+			log.Fatalln("rrdtool.Start error, start rebalance fail,", err)
+		}
+	}
 
 	// sync disk
 	go syncDisk()
@@ -55,66 +90,23 @@ func Start() {
 	log.Println("rrdtool.Start ok")
 }
 
-// RRA.Point.Size
-const (
-	RRA1PointCnt   = 720 // 1m一个点存12h
-	RRA5PointCnt   = 576 // 5m一个点存2d
-	RRA20PointCnt  = 504 // 20m一个点存7d
-	RRA180PointCnt = 766 // 3h一个点存3month
-	RRA720PointCnt = 730 // 12h一个点存1year
-)
-
-func create(filename string, item *cmodel.GraphItem) error {
-	now := time.Now()
-	start := now.Add(time.Duration(-24) * time.Hour)
-	step := uint(item.Step)
-
-	c := rrdlite.NewCreator(filename, start, step)
-	c.DS("metric", item.DsType, item.Heartbeat, item.Min, item.Max)
-
-	// 设置各种归档策略
-	// 1分钟一个点存 12小时
-	c.RRA("AVERAGE", 0.5, 1, RRA1PointCnt)
-
-	// 5m一个点存2d
-	c.RRA("AVERAGE", 0.5, 5, RRA5PointCnt)
-	c.RRA("MAX", 0.5, 5, RRA5PointCnt)
-	c.RRA("MIN", 0.5, 5, RRA5PointCnt)
-
-	// 20m一个点存7d
-	c.RRA("AVERAGE", 0.5, 20, RRA20PointCnt)
-	c.RRA("MAX", 0.5, 20, RRA20PointCnt)
-	c.RRA("MIN", 0.5, 20, RRA20PointCnt)
+// 数据目录中记录写入文件的存储后端, 文件名的扩展名由当前配置的后端决定,
+// 切换rrd.backend之后已有的文件不会被读取, 所以拒绝使用已有的数据目录
+const backendMarker = ".backend"
 
-	// 3小时一个点存3个月
-	c.RRA("AVERAGE", 0.5, 180, RRA180PointCnt)
-	c.RRA("MAX", 0.5, 180, RRA180PointCnt)
-	c.RRA("MIN", 0.5, 180, RRA180PointCnt)
-
-	// 12小时一个点存1year
-	c.RRA("AVERAGE", 0.5, 720, RRA720PointCnt)
-	c.RRA("MAX", 0.5, 720, RRA720PointCnt)
-	c.RRA("MIN", 0.5, 720, RRA720PointCnt)
-
-	return c.Create(true)
-}
-
-func update(filename string, items []*cmodel.GraphItem) error {
-	u := rrdlite.NewUpdater(filename)
-
-	for _, item := range items {
-		v := math.Abs(item.Value)
-		if v > 1e+300 || (v < 1e-300 && v > 0) {
-			continue
-		}
-		if item.DsType == "DERIVE" || item.DsType == "COUNTER" {
-			u.Cache(item.Timestamp, int(item.Value))
-		} else {
-			u.Cache(item.Timestamp, item.Value)
-		}
+func checkBackend(dir string, backend string) error {
+	filename := filepath.Join(dir, backendMarker)
+	bs, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return ioutil.WriteFile(filename, []byte(backend), 0644)
 	}
-
-	return u.Update()
+	if err != nil {
+		return err
+	}
+	if prev := strings.TrimSpace(string(bs)); prev != backend {
+		return fmt.Errorf("the files in %s are written by backend %s instead of %s, use a new rrd.storage for the backend", dir, prev, backend)
+	}
+	return nil
 }
 
 // flush to disk from memory
@@ -133,13 +125,13 @@ func flushrrd(filename string, items []*cmodel.GraphItem) error {
 			return err
 		}
 
-		err = create(filename, items[0])
+		err = storage.Backend().Create(filename, items[0])
 		if err != nil {
 			return err
 		}
 	}
 
-	return update(filename, items)
+	return storage.Backend().Update(filename, items)
 }
 
 func ReadFile(filename string) ([]byte, error) {
@@ -155,6 +147,60 @@ func ReadFile(filename string) ([]byte, error) {
 	return task.args.(*readfile_t).data, err
 }
 
+// ReplaceFile writes the file pulled from the other node, the local file is replaced
+func ReplaceFile(filename string, body []byte) error {
+	done := make(chan error, 1)
+	io_task_chan <- &io_task_t{
+		method: IO_TASK_M_REPLACE,
+		args:   &g.File{Filename: filename, Body: body},
+		done:   done,
+	}
+	return <-done
+}
+
+// MergeFile writes the points of the file pulled from the other node, which are newer than the local file,
+// into the local file. lastTs is the timestamp of the last point merged, 0 if there is none
+func MergeFile(filename string, body []byte, dsType string, step int) (lastTs int64, err error) {
+	done := make(chan error, 1)
+	task := &io_task_t{
+		method: IO_TASK_M_MERGE,
+		args:   &mergefile_t{filename: filename, body: body, dsType: dsType, step: step},
+		done:   done,
+	}
+
+	io_task_chan <- task
+	err = <-done
+	return task.args.(*mergefile_t).lastTs, err
+}
+
+// Last returns the last value written into the file
+func Last(filename string) (*cmodel.RRDData, error) {
+	done := make(chan error, 1)
+	task := &io_task_t{
+		method: IO_TASK_M_LAST,
+		args:   &last_t{filename: filename},
+		done:   done,
+	}
+
+	io_task_chan <- task
+	err := <-done
+	return task.args.(*last_t).data, err
+}
+
+// RawStart returns the timestamp since which the data of the file is not consolidated
+func RawStart(filename string, step int, now int64) (int64, error) {
+	done := make(chan error, 1)
+	task := &io_task_t{
+		method: IO_TASK_M_RAW_START,
+		args:   &rawstart_t{filename: filename, step: step, now: now},
+		done:   done,
+	}
+
+	io_task_chan <- task
+	err := <-done
+	return task.args.(*rawstart_t).ts, err
+}
+
 func FlushFile(filename string, items []*cmodel.GraphItem) error {
 	done := make(chan error, 1)
 	io_task_chan <- &io_task_t{
@@ -187,37 +233,6 @@ func Fetch(filename string, cf string, start, end int64, step int) ([]*cmodel.RR
 	return task.args.(*fetch_t).data, err
 }
 
-func fetch(filename string, cf string, start, end int64, step int) ([]*cmodel.RRDData, error) {
-	start_t := time.Unix(start, 0)
-	end_t := time.Unix(end, 0)
-	step_t := time.Duration(step) * time.Second
-
-	fetchRes, err := rrdlite.Fetch(filename, cf, start_t, end_t, step_t)
-	if err != nil {
-		return []*cmodel.RRDData{}, err
-	}
-
-	defer fetchRes.FreeValues()
-
-	values := fetchRes.Values()
-	size := len(values)
-	ret := make([]*cmodel.RRDData, size)
-
-	start_ts := fetchRes.Start.Unix()
-	step_s := fetchRes.Step.Seconds()
-
-	for i, val := range values {
-		ts := start_ts + int64(i+1)*int64(step_s)
-		d := &cmodel.RRDData{
-			Timestamp: ts,
-			Value:     cmodel.JsonFloat(val),
-		}
-		ret[i] = d
-	}
-
-	return ret, nil
-}
-
 func FlushAll(force bool) {
 	n := store.GraphItems.Size / 10
 	for i := 0; i < store.GraphItems.Size; i++ {
@@ -252,11 +267,18 @@ func PullByKey(key string) {
 	if item == nil {
 		return
 	}
-	node, err := Consistent.Get(item.PrimaryKey())
-	if err != nil {
+	// 扩容还没有开始, 下次刷盘时再拉取
+	if currentMigration() == nil {
+		return
+	}
+	tasks, remote := SourceNode(item.PrimaryKey())
+	if !remote {
+		// 文件的原节点是本节点, 即新的数据, 直接刷入本地
+		store.GraphItems.SetFlag(key, 0)
+		CommitByKey(key)
 		return
 	}
-	Net_task_ch[node] <- &Net_task_t{
+	tasks <- &Net_task_t{
 		Method: NET_TASK_M_PULL,
 		Key:    key,
 		Done:   done,
@@ -287,7 +309,7 @@ func FlushRRD(idx int, force bool) {
 		flag, _ := store.GraphItems.GetFlag(key)
 
 		//write err data to local filename
-		if force == false && g.Config().Migrate.Enabled && flag&g.GRAPH_F_MISS != 0 {
+		if force == false && g.Config().Migrating() && flag&g.GRAPH_F_MISS != 0 {
 			if time.Since(begin) > time.Millisecond*g.FLUSH_DISK_STEP {
 				atomic.StoreInt32(&flushrrd_timeout, 1)
 			}
@@ -0,0 +1,25 @@
+package rrdtool
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestCheckBackend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "graph")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := checkBackend(dir, "rrdtool"); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkBackend(dir, "rrdtool"); err != nil {
+		t.Errorf("unexpected error of the same backend: %v", err)
+	}
+	if err := checkBackend(dir, "columnar"); err == nil {
+		t.Error("expected error of switching backend")
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/Cepave/open-falcon-backend/modules/graph/g"
+	"github.com/Cepave/open-falcon-backend/modules/graph/storage"
 	"github.com/Cepave/open-falcon-backend/modules/graph/store"
 	"github.com/toolkits/file"
 )
@@ -18,6 +19,10 @@ const (
 	IO_TASK_M_WRITE
 	IO_TASK_M_FLUSH
 	IO_TASK_M_FETCH
+	IO_TASK_M_REPLACE
+	IO_TASK_M_LAST
+	IO_TASK_M_RAW_START
+	IO_TASK_M_MERGE
 )
 
 type io_task_t struct {
@@ -71,6 +76,20 @@ func writeFile(filename string, data []byte, perm os.FileMode) error {
 	return err
 }
 
+// replaceFile writes data to a temporary file, and renames it to filename
+func replaceFile(filename string, data []byte, perm os.FileMode) error {
+	if err := file.InsureDir(file.Dir(filename)); err != nil {
+		return err
+	}
+	tmp := filename + ".tmp"
+	os.Remove(tmp)
+	if err := writeFile(tmp, data, perm); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
+
 func ioWorker() {
 	var err error
 	for {
@@ -96,7 +115,27 @@ func ioWorker() {
 				}
 			} else if task.method == IO_TASK_M_FETCH {
 				if args, ok := task.args.(*fetch_t); ok {
-					args.data, err = fetch(args.filename, args.cf, args.start, args.end, args.step)
+					args.data, err = storage.Backend().Fetch(args.filename, args.cf, args.start, args.end, args.step)
+					task.done <- err
+				}
+			} else if task.method == IO_TASK_M_REPLACE {
+				//filename may exist
+				if args, ok := task.args.(*g.File); ok {
+					task.done <- replaceFile(args.Filename, args.Body, 0644)
+				}
+			} else if task.method == IO_TASK_M_LAST {
+				if args, ok := task.args.(*last_t); ok {
+					args.data, err = storage.Backend().Last(args.filename)
+					task.done <- err
+				}
+			} else if task.method == IO_TASK_M_RAW_START {
+				if args, ok := task.args.(*rawstart_t); ok {
+					args.ts, err = storage.Backend().RawStart(args.filename, args.step, args.now)
+					task.done <- err
+				}
+			} else if task.method == IO_TASK_M_MERGE {
+				if args, ok := task.args.(*mergefile_t); ok {
+					args.lastTs, err = mergeFile(args.filename, args.body, args.dsType, args.step)
 					task.done <- err
 				}
 			}
@@ -0,0 +1,536 @@
+package storage
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"os"
+	"strconv"
+
+	cmodel "github.com/Cepave/open-falcon-backend/common/model"
+
+	"github.com/Cepave/open-falcon-backend/modules/graph/g"
+	"github.com/Cepave/open-falcon-backend/modules/graph/storage/gorilla"
+)
+
+// columnarStorage keeps the raw data in an append-only file per counter, without consolidation.
+// Each flush appends a chunk of points compressed by gorilla:
+//
+//	file:    magic("FGC1") | uint32 size | header(json)  | chunk ...
+//	chunk:   uint32 size   | payload     | uint32 size   | uint32 crc32(payload)
+//	payload: int64 first timestamp | int64 last timestamp | uint32 count | gorilla bytes
+//
+// The size at the end of chunk makes the chunks readable from the latest one.
+//
+// The data older than the retention(the span of the longest archive of the retention policy) is dropped
+// by compaction, which rewrites the file with the chunks regrouped by columnarChunkSpan.
+// The small chunks at the tail are merged by the same way once there are columnarMergeChunks of them,
+// whether the data expires or not.
+type columnarStorage struct{}
+
+const (
+	columnarMagic    = "FGC1"
+	chunkPayloadHead = 20
+	// the compacted chunks hold the points of a day at most
+	columnarChunkSpan = 86400
+	// the file is compacted after the expired data exceeds 1/columnarCompactRatio of the retention
+	columnarCompactRatio = 10
+	// the chunks smaller than columnarSmallChunk bytes at the tail are merged when there are so many of them
+	columnarSmallChunk  = 4096
+	columnarMergeChunks = 16
+)
+
+var errNoChunk = errors.New("no data in file")
+
+type columnarHeader struct {
+	DsType    string `json:"dstype"`
+	Step      int    `json:"step"`
+	Heartbeat int    `json:"heartbeat"`
+	Min       string `json:"min"`
+	Max       string `json:"max"`
+	Retention int64  `json:"retention,omitempty"` // seconds, 0 means the data is kept forever
+}
+
+type chunk struct {
+	offset int64 // offset of the chunk in file
+	size   int64 // total size of the chunk
+	first  int64
+	last   int64
+	count  int
+	data   []byte
+}
+
+func (this *chunk) points() ([]gorilla.Point, error) {
+	return gorilla.Decode(this.data, this.count)
+}
+
+type columnarFile struct {
+	f         *os.File
+	header    *columnarHeader
+	dataStart int64
+	size      int64
+}
+
+func (this *columnarStorage) Create(filename string, item *cmodel.GraphItem) error {
+	retention := int64(0)
+	if cfg := g.Config(); cfg != nil {
+		retention = cfg.Retention.Resolve(item.Endpoint, item.Metric, item.Tags).Span(item.Step)
+	}
+	return createColumnar(filename, item, retention)
+}
+
+func createColumnar(filename string, item *cmodel.GraphItem, retention int64) error {
+	header, err := json.Marshal(&columnarHeader{
+		DsType:    item.DsType,
+		Step:      item.Step,
+		Heartbeat: item.Heartbeat,
+		Min:       item.Min,
+		Max:       item.Max,
+		Retention: retention,
+	})
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, 8+len(header))
+	copy(buf, columnarMagic)
+	binary.BigEndian.PutUint32(buf[4:], uint32(len(header)))
+	copy(buf[8:], header)
+
+	return writeColumnar(filename, buf, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+}
+
+func writeColumnar(filename string, data []byte, flag int) error {
+	f, err := os.OpenFile(filename, flag, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	return err
+}
+
+func openColumnar(filename string, flag int) (*columnarFile, error) {
+	f, err := os.OpenFile(filename, flag, 0644)
+	if err != nil {
+		return nil, err
+	}
+	cf := &columnarFile{f: f}
+	if err = cf.readHeader(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return cf, nil
+}
+
+func (this *columnarFile) Close() error {
+	return this.f.Close()
+}
+
+func (this *columnarFile) readHeader() error {
+	stat, err := this.f.Stat()
+	if err != nil {
+		return err
+	}
+	this.size = stat.Size()
+
+	buf := make([]byte, 8)
+	if _, err = this.f.ReadAt(buf, 0); err != nil {
+		return err
+	}
+	if string(buf[:4]) != columnarMagic {
+		return errors.New("bad magic of columnar file")
+	}
+	size := int64(binary.BigEndian.Uint32(buf[4:]))
+	if 8+size > this.size {
+		return errors.New("bad header of columnar file")
+	}
+	header := make([]byte, size)
+	if _, err = this.f.ReadAt(header, 8); err != nil {
+		return err
+	}
+	this.header = &columnarHeader{}
+	if err = json.Unmarshal(header, this.header); err != nil {
+		return err
+	}
+	if this.header.Step <= 0 {
+		return errors.New("bad step of columnar file")
+	}
+	if this.header.Heartbeat <= 0 {
+		this.header.Heartbeat = this.header.Step * 2
+	}
+	this.dataStart = 8 + size
+	return nil
+}
+
+// chunkBefore reads the chunk which ends at end
+func (this *columnarFile) chunkBefore(end int64) (*chunk, error) {
+	if end-this.dataStart < 12+chunkPayloadHead {
+		return nil, errNoChunk
+	}
+	footer := make([]byte, 8)
+	if _, err := this.f.ReadAt(footer, end-8); err != nil {
+		return nil, err
+	}
+	size := int64(binary.BigEndian.Uint32(footer))
+	if size < chunkPayloadHead || end-12-size < this.dataStart {
+		return nil, errors.New("bad chunk size")
+	}
+	return this.readChunk(end - 12 - size)
+}
+
+// readChunk reads the chunk which starts at offset
+func (this *columnarFile) readChunk(offset int64) (*chunk, error) {
+	if this.size-offset < 12+chunkPayloadHead {
+		return nil, errNoChunk
+	}
+	head := make([]byte, 4)
+	if _, err := this.f.ReadAt(head, offset); err != nil {
+		return nil, err
+	}
+	size := int64(binary.BigEndian.Uint32(head))
+	if size < chunkPayloadHead || offset+12+size > this.size {
+		return nil, errors.New("bad chunk size")
+	}
+
+	buf := make([]byte, size+8)
+	if _, err := this.f.ReadAt(buf, offset+4); err != nil {
+		return nil, err
+	}
+	payload, footer := buf[:size], buf[size:]
+	if int64(binary.BigEndian.Uint32(footer)) != size || binary.BigEndian.Uint32(footer[4:]) != crc32.ChecksumIEEE(payload) {
+		return nil, errors.New("bad chunk checksum")
+	}
+	return &chunk{
+		offset: offset,
+		size:   size + 12,
+		first:  int64(binary.BigEndian.Uint64(payload)),
+		last:   int64(binary.BigEndian.Uint64(payload[8:])),
+		count:  int(binary.BigEndian.Uint32(payload[16:])),
+		data:   payload[chunkPayloadHead:],
+	}, nil
+}
+
+// tail returns the end of the valid chunks and the last timestamp in file.
+// If the last chunk is broken(e.g. by crash when writing), the chunks are checked from the first one.
+func (this *columnarFile) tail() (end int64, lastTs int64, err error) {
+	c, err := this.chunkBefore(this.size)
+	if err == nil {
+		return this.size, c.last, nil
+	}
+	if err == errNoChunk && this.size == this.dataStart {
+		return this.size, 0, nil
+	}
+
+	end = this.dataStart
+	for {
+		if c, err = this.readChunk(end); err != nil {
+			return end, lastTs, nil
+		}
+		end += c.size
+		lastTs = c.last
+	}
+}
+
+func encodeChunk(first, last int64, e *gorilla.Encoder) []byte {
+	data := e.Bytes()
+	size := chunkPayloadHead + len(data)
+
+	chunk := make([]byte, 12+size)
+	binary.BigEndian.PutUint32(chunk, uint32(size))
+	payload := chunk[4 : 4+size]
+	binary.BigEndian.PutUint64(payload, uint64(first))
+	binary.BigEndian.PutUint64(payload[8:], uint64(last))
+	binary.BigEndian.PutUint32(payload[16:], uint32(e.Len()))
+	copy(payload[chunkPayloadHead:], data)
+	binary.BigEndian.PutUint32(chunk[4+size:], uint32(size))
+	binary.BigEndian.PutUint32(chunk[8+size:], crc32.ChecksumIEEE(payload))
+	return chunk
+}
+
+func (this *columnarStorage) Update(filename string, items []*cmodel.GraphItem) error {
+	cf, err := openColumnar(filename, os.O_RDWR)
+	if err != nil {
+		return err
+	}
+	defer cf.Close()
+
+	end, lastTs, err := cf.tail()
+	if err != nil {
+		return err
+	}
+	if end < cf.size {
+		// 丢弃损坏的chunk
+		if err = cf.f.Truncate(end); err != nil {
+			return err
+		}
+	}
+
+	e := gorilla.NewEncoder()
+	first := int64(0)
+	for _, item := range items {
+		// 同rrd, 丢弃已经写入的时间点
+		if item.Timestamp <= lastTs {
+			continue
+		}
+		v := math.Abs(item.Value)
+		if v > 1e+300 || (v < 1e-300 && v > 0) {
+			continue
+		}
+		if e.Len() == 0 {
+			first = item.Timestamp
+		}
+		e.Append(item.Timestamp, item.Value)
+		lastTs = item.Timestamp
+	}
+	if e.Len() == 0 {
+		return nil
+	}
+
+	data := encodeChunk(first, lastTs, e)
+	if _, err = cf.f.WriteAt(data, end); err != nil {
+		return err
+	}
+	cf.size = end + int64(len(data))
+
+	if retention := cf.header.Retention; retention > 0 {
+		c, err := cf.readChunk(cf.dataStart)
+		if err == nil && c.first < lastTs-retention-retention/columnarCompactRatio {
+			return cf.compact(filename, lastTs-retention, cf.dataStart)
+		}
+	}
+	if from, n := cf.smallChunks(lastTs); n >= columnarMergeChunks {
+		return cf.compact(filename, 0, from)
+	}
+	return nil
+}
+
+// smallChunks returns the offset and the number of the small chunks at the tail,
+// which are in the span of columnarChunkSpan before lastTs
+func (this *columnarFile) smallChunks(lastTs int64) (from int64, n int) {
+	from = this.size
+	for {
+		c, err := this.chunkBefore(from)
+		if err != nil || c.size >= columnarSmallChunk || lastTs-c.first >= columnarChunkSpan {
+			return from, n
+		}
+		from = c.offset
+		n++
+	}
+}
+
+// compact copies the chunks before from as they are, drops the points not after expire in the others,
+// and regroups the rest into chunks of columnarChunkSpan.
+// The compacted file is written to a temporary file and renamed, the file is never broken by crash.
+func (this *columnarFile) compact(filename string, expire int64, from int64) error {
+	buf := make([]byte, from)
+	if _, err := this.f.ReadAt(buf, 0); err != nil {
+		return err
+	}
+
+	e := gorilla.NewEncoder()
+	first, last := int64(0), int64(0)
+	for off := from; off < this.size; {
+		c, err := this.readChunk(off)
+		if err != nil {
+			return err
+		}
+		off += c.size
+		if c.last <= expire {
+			continue
+		}
+		points, err := c.points()
+		if err != nil {
+			return err
+		}
+		for _, p := range points {
+			if p.Ts <= expire {
+				continue
+			}
+			if e.Len() > 0 && p.Ts-first >= columnarChunkSpan {
+				buf = append(buf, encodeChunk(first, last, e)...)
+				e = gorilla.NewEncoder()
+			}
+			if e.Len() == 0 {
+				first = p.Ts
+			}
+			e.Append(p.Ts, p.Value)
+			last = p.Ts
+		}
+	}
+	if e.Len() > 0 {
+		buf = append(buf, encodeChunk(first, last, e)...)
+	}
+
+	tmp := filename + ".compact"
+	if err := writeColumnar(tmp, buf, os.O_WRONLY|os.O_CREATE|os.O_TRUNC); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
+
+func (this *columnarStorage) Fetch(filename string, cf string, start, end int64, step int) ([]*cmodel.RRDData, error) {
+	file, err := openColumnar(filename, os.O_RDONLY)
+	if err != nil {
+		return []*cmodel.RRDData{}, err
+	}
+	defer file.Close()
+	header := file.header
+	if step <= 0 {
+		step = header.Step
+	}
+
+	// 与rrd相同, 第i个值的时间戳为 start + (i+1)*step, 值为 (ts-step, ts] 之间的数据
+	first := start - start%int64(step) + int64(step)
+	if end < first {
+		return []*cmodel.RRDData{}, nil
+	}
+	size := int((end-first)/int64(step)) + 1
+
+	// 从最新的chunk开始读, 计算速率时需要前一个点
+	from := first - int64(step) - int64(header.Heartbeat)
+	chunks := []*chunk{}
+	for off := file.size; ; {
+		c, err := file.chunkBefore(off)
+		if err != nil {
+			break
+		}
+		if c.first <= end {
+			chunks = append(chunks, c)
+		}
+		if c.first <= from {
+			break
+		}
+		off = c.offset
+	}
+
+	points := []gorilla.Point{}
+	for i := len(chunks) - 1; i >= 0; i-- {
+		ps, err := chunks[i].points()
+		if err != nil {
+			return []*cmodel.RRDData{}, err
+		}
+		points = append(points, ps...)
+	}
+
+	buckets := make([]*consolidator, size)
+	for _, p := range pointValues(header, points) {
+		if p.Ts <= first-int64(step) || p.Ts > end {
+			continue
+		}
+		idx := int((p.Ts - first + int64(step) - 1) / int64(step))
+		if idx >= size {
+			continue
+		}
+		if buckets[idx] == nil {
+			buckets[idx] = &consolidator{}
+		}
+		buckets[idx].add(p.Value)
+	}
+
+	ret := make([]*cmodel.RRDData, size)
+	for i := range ret {
+		value := math.NaN()
+		if buckets[i] != nil {
+			value = buckets[i].value(cf)
+		}
+		ret[i] = cmodel.NewRRDData(first+int64(i*step), value)
+	}
+	return ret, nil
+}
+
+// pointValues converts the raw points into values: the rates of DERIVE and COUNTER.
+// The values out of [min, max] are dropped.
+func pointValues(header *columnarHeader, points []gorilla.Point) []gorilla.Point {
+	min, errMin := strconv.ParseFloat(header.Min, 64)
+	max, errMax := strconv.ParseFloat(header.Max, 64)
+
+	ret := make([]gorilla.Point, 0, len(points))
+	for i, p := range points {
+		value := p.Value
+		if header.DsType == g.DERIVE || header.DsType == g.COUNTER {
+			if i == 0 {
+				continue
+			}
+			prev := points[i-1]
+			dt := p.Ts - prev.Ts
+			if dt <= 0 || dt > int64(header.Heartbeat) {
+				continue
+			}
+			value = (p.Value - prev.Value) / float64(dt)
+			// 计数器重置
+			if header.DsType == g.COUNTER && value < 0 {
+				continue
+			}
+		}
+		if math.IsNaN(value) || (errMin == nil && value < min) || (errMax == nil && value > max) {
+			continue
+		}
+		ret = append(ret, gorilla.Point{Ts: p.Ts, Value: value})
+	}
+	return ret
+}
+
+type consolidator struct {
+	n    int
+	sum  float64
+	min  float64
+	max  float64
+	last float64
+}
+
+func (this *consolidator) add(v float64) {
+	if this.n == 0 || v < this.min {
+		this.min = v
+	}
+	if this.n == 0 || v > this.max {
+		this.max = v
+	}
+	this.n++
+	this.sum += v
+	this.last = v
+}
+
+func (this *consolidator) value(cf string) float64 {
+	switch cf {
+	case "MAX":
+		return this.max
+	case "MIN":
+		return this.min
+	case "LAST":
+		return this.last
+	}
+	return this.sum / float64(this.n)
+}
+
+func (this *columnarStorage) Last(filename string) (*cmodel.RRDData, error) {
+	file, err := openColumnar(filename, os.O_RDONLY)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	c, err := file.chunkBefore(file.size)
+	if err != nil {
+		return nil, err
+	}
+	points, err := c.points()
+	if err != nil {
+		return nil, err
+	}
+	if len(points) == 0 {
+		return nil, errNoChunk
+	}
+	last := points[len(points)-1]
+	return cmodel.NewRRDData(last.Ts, last.Value), nil
+}
+
+// the raw data is kept
+func (this *columnarStorage) RawStart(filename string, step int, now int64) (int64, error) {
+	return 0, nil
+}
@@ -0,0 +1,223 @@
+package storage
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	cmodel "github.com/Cepave/open-falcon-backend/common/model"
+)
+
+func newColumnarFile(t *testing.T, dsType string) (string, func()) {
+	dir, err := ioutil.TempDir("", "columnar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(dir, "counter.col")
+	item := &cmodel.GraphItem{DsType: dsType, Step: 60, Heartbeat: 120, Min: "U", Max: "U"}
+	if err := (&columnarStorage{}).Create(filename, item); err != nil {
+		t.Fatal(err)
+	}
+	return filename, func() { os.RemoveAll(dir) }
+}
+
+func items(dsType string, start int64, values ...float64) []*cmodel.GraphItem {
+	ret := []*cmodel.GraphItem{}
+	for i, v := range values {
+		ret = append(ret, &cmodel.GraphItem{DsType: dsType, Step: 60, Timestamp: start + int64(i*60), Value: v})
+	}
+	return ret
+}
+
+func TestColumnarGauge(t *testing.T) {
+	filename, clean := newColumnarFile(t, "GAUGE")
+	defer clean()
+	s := &columnarStorage{}
+
+	if _, err := s.Last(filename); err == nil {
+		t.Error("expected error of empty file")
+	}
+	if err := s.Update(filename, items("GAUGE", 600, 1, 2, 3)); err != nil {
+		t.Fatal(err)
+	}
+	// the written timestamps are dropped
+	if err := s.Update(filename, items("GAUGE", 660, 20, 30, 4, 5)); err != nil {
+		t.Fatal(err)
+	}
+
+	last, err := s.Last(filename)
+	if err != nil || last.Timestamp != 840 || last.Value != 5 {
+		t.Fatalf("unexpected last: %v %v", last, err)
+	}
+
+	values, err := s.Fetch(filename, "AVERAGE", 480, 900, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []float64{math.NaN(), 1, 2, 3, 4, 5, math.NaN()}
+	if len(values) != len(expected) {
+		t.Fatalf("expected %d values, got %d", len(expected), len(values))
+	}
+	for i, v := range values {
+		if v.Timestamp != 540+int64(i*60) {
+			t.Errorf("unexpected timestamp of %d: %d", i, v.Timestamp)
+		}
+		if e := expected[i]; !(math.IsNaN(e) && math.IsNaN(float64(v.Value))) && float64(v.Value) != e {
+			t.Errorf("unexpected value at %d: %v", v.Timestamp, v.Value)
+		}
+	}
+
+	// consolidated by 120s
+	values, _ = s.Fetch(filename, "MAX", 540, 780, 120)
+	if len(values) != 2 || values[0].Timestamp != 600 || values[0].Value != 1 || values[1].Value != 3 {
+		t.Errorf("unexpected consolidated values: %v %v", values[0], values[1])
+	}
+}
+
+func TestColumnarCounter(t *testing.T) {
+	filename, clean := newColumnarFile(t, "COUNTER")
+	defer clean()
+	s := &columnarStorage{}
+
+	s.Update(filename, items("COUNTER", 600, 0, 600, 1200))
+	// counter reset, and a gap over the heartbeat
+	s.Update(filename, items("COUNTER", 780, 60))
+	s.Update(filename, items("COUNTER", 1020, 660, 1260))
+
+	values, err := s.Fetch(filename, "AVERAGE", 600, 1080, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rates := map[int64]float64{}
+	for _, v := range values {
+		if !math.IsNaN(float64(v.Value)) {
+			rates[v.Timestamp] = float64(v.Value)
+		}
+	}
+	if len(rates) != 3 || rates[660] != 10 || rates[720] != 10 || rates[1080] != 10 {
+		t.Errorf("unexpected rates: %v", rates)
+	}
+}
+
+func TestColumnarBrokenTail(t *testing.T) {
+	filename, clean := newColumnarFile(t, "GAUGE")
+	defer clean()
+	s := &columnarStorage{}
+
+	s.Update(filename, items("GAUGE", 600, 1, 2))
+	f, _ := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND, 0644)
+	f.Write([]byte{0, 0, 0, 40, 1, 2, 3})
+	f.Close()
+
+	if err := s.Update(filename, items("GAUGE", 720, 3)); err != nil {
+		t.Fatal(err)
+	}
+	values, _ := s.Fetch(filename, "AVERAGE", 540, 720, 60)
+	if len(values) != 3 || values[0].Value != 1 || values[2].Value != 3 {
+		t.Errorf("unexpected values: %v", values)
+	}
+}
+
+func TestColumnarCompact(t *testing.T) {
+	dir, err := ioutil.TempDir("", "columnar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "counter.col")
+	// 保存1小时的原始数据
+	item := &cmodel.GraphItem{DsType: "GAUGE", Step: 60, Heartbeat: 120, Min: "U", Max: "U"}
+	if err := createColumnar(filename, item, 3600); err != nil {
+		t.Fatal(err)
+	}
+	s := &columnarStorage{}
+
+	// 每10分钟刷盘一次, 共2小时
+	start := int64(86400 * 100)
+	for i := 0; i < 12; i++ {
+		values := make([]float64, 10)
+		for j := range values {
+			values[j] = float64(i*10 + j)
+		}
+		if err := s.Update(filename, items("GAUGE", start+int64(i*600), values...)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	last, err := s.Last(filename)
+	if err != nil || last.Timestamp != start+119*60 || last.Value != 119 {
+		t.Fatalf("unexpected last: %v %v", last, err)
+	}
+	values, err := s.Fetch(filename, "AVERAGE", start-60, start+119*60, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 最后一次压缩在写入第12个数据块时, 保留之前1小时的数据
+	expire := start + 119*60 - 3600
+	for _, v := range values {
+		expired := v.Timestamp <= expire
+		if expired != math.IsNaN(float64(v.Value)) {
+			t.Errorf("unexpected value at %d: %v", v.Timestamp, v.Value)
+		}
+		if !expired && float64(v.Value) != float64((v.Timestamp-start)/60) {
+			t.Errorf("unexpected value at %d: %v", v.Timestamp, v.Value)
+		}
+	}
+
+	// 压缩后的数据块按天合并
+	file, err := openColumnar(filename, os.O_RDONLY)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	chunks := 0
+	for off := file.dataStart; off < file.size; chunks++ {
+		c, err := file.readChunk(off)
+		if err != nil {
+			t.Fatal(err)
+		}
+		off += c.size
+	}
+	if chunks != 1 || file.header.Retention != 3600 {
+		t.Errorf("expected 1 chunk, got %d(retention: %d)", chunks, file.header.Retention)
+	}
+	if _, err := os.Stat(filename + ".compact"); !os.IsNotExist(err) {
+		t.Error("the temporary file is not removed")
+	}
+}
+
+func TestColumnarMerge(t *testing.T) {
+	filename, clean := newColumnarFile(t, "GAUGE")
+	defer clean()
+	s := &columnarStorage{}
+
+	// 每分钟刷盘一次, 不过期的数据也会合并小的数据块
+	start := int64(86400 * 100)
+	n := columnarMergeChunks*2 + 3
+	for i := 0; i < n; i++ {
+		if err := s.Update(filename, items("GAUGE", start+int64(i*60), float64(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	values, err := s.Fetch(filename, "AVERAGE", start-60, start+int64(n-1)*60, 60)
+	if err != nil || len(values) != n {
+		t.Fatalf("unexpected values: %d %v", len(values), err)
+	}
+	for i, v := range values {
+		if float64(v.Value) != float64(i) {
+			t.Errorf("unexpected value at %d: %v", v.Timestamp, v.Value)
+		}
+	}
+
+	file, err := openColumnar(filename, os.O_RDONLY)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, small := file.smallChunks(start + int64(n-1)*60); small >= columnarMergeChunks {
+		t.Errorf("expected less than %d chunks, got %d", columnarMergeChunks, small)
+	}
+}
@@ -0,0 +1,307 @@
+// Package gorilla compresses the points of a series as in "Gorilla: A Fast, Scalable,
+// In-Memory Time Series Database": delta-of-delta timestamps and XOR'd values.
+package gorilla
+
+import (
+	"errors"
+	"math"
+)
+
+type Point struct {
+	Ts    int64
+	Value float64
+}
+
+var ErrShortBuffer = errors.New("gorilla: short buffer")
+
+type bitWriter struct {
+	buf   []byte
+	count uint8 // free bits in the last byte
+}
+
+func (w *bitWriter) writeBit(bit bool) {
+	if w.count == 0 {
+		w.buf = append(w.buf, 0)
+		w.count = 8
+	}
+	w.count--
+	if bit {
+		w.buf[len(w.buf)-1] |= 1 << w.count
+	}
+}
+
+func (w *bitWriter) writeBits(u uint64, n int) {
+	for n > 0 {
+		n--
+		w.writeBit(u>>uint(n)&1 == 1)
+	}
+}
+
+type bitReader struct {
+	buf   []byte
+	pos   int   // index of the current byte
+	count uint8 // unread bits in the current byte
+}
+
+func newBitReader(b []byte) *bitReader {
+	return &bitReader{buf: b, count: 8}
+}
+
+func (r *bitReader) readBit() (bool, error) {
+	if r.count == 0 {
+		r.pos++
+		r.count = 8
+	}
+	if r.pos >= len(r.buf) {
+		return false, ErrShortBuffer
+	}
+	r.count--
+	return r.buf[r.pos]>>r.count&1 == 1, nil
+}
+
+func (r *bitReader) readBits(n int) (uint64, error) {
+	var u uint64
+	for i := 0; i < n; i++ {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		u <<= 1
+		if bit {
+			u |= 1
+		}
+	}
+	return u, nil
+}
+
+// delta-of-delta的编码: 控制位, 数值的位数
+var dodBuckets = []struct {
+	control uint64
+	nbits   int
+	bits    int
+}{
+	{control: 0x2, nbits: 2, bits: 7},  // 10
+	{control: 0x6, nbits: 3, bits: 9},  // 110
+	{control: 0xe, nbits: 4, bits: 12}, // 1110
+}
+
+// Encoder appends the points of which the timestamps are ascending
+type Encoder struct {
+	w bitWriter
+	n int
+
+	ts     int64
+	delta  int64
+	val    uint64
+	leader uint8
+	trail  uint8
+}
+
+func NewEncoder() *Encoder {
+	return &Encoder{}
+}
+
+func (e *Encoder) Append(ts int64, value float64) {
+	v := math.Float64bits(value)
+	switch e.n {
+	case 0:
+		e.w.writeBits(uint64(ts), 64)
+		e.w.writeBits(v, 64)
+		e.leader = 0xff
+	case 1:
+		e.delta = ts - e.ts
+		e.w.writeBits(uint64(e.delta), 64)
+		e.writeValue(v)
+	default:
+		delta := ts - e.ts
+		e.writeDod(delta - e.delta)
+		e.delta = delta
+		e.writeValue(v)
+	}
+	e.ts = ts
+	e.val = v
+	e.n++
+}
+
+func (e *Encoder) writeDod(dod int64) {
+	if dod == 0 {
+		e.w.writeBit(false)
+		return
+	}
+	for _, b := range dodBuckets {
+		// 有符号数, [-2^(bits-1)+1, 2^(bits-1)]
+		if dod > -(1<<uint(b.bits-1)) && dod <= 1<<uint(b.bits-1) {
+			e.w.writeBits(b.control, b.nbits)
+			e.w.writeBits(uint64(dod)&(1<<uint(b.bits)-1), b.bits)
+			return
+		}
+	}
+	e.w.writeBits(0xf, 4) // 1111
+	e.w.writeBits(uint64(dod), 64)
+}
+
+func (e *Encoder) writeValue(v uint64) {
+	xor := v ^ e.val
+	if xor == 0 {
+		e.w.writeBit(false)
+		return
+	}
+	e.w.writeBit(true)
+
+	leader := uint8(leadingZeros(xor))
+	trail := uint8(trailingZeros(xor))
+	if leader > 31 {
+		leader = 31
+	}
+	// 沿用上一个值的有效位区间
+	if e.leader != 0xff && leader >= e.leader && trail >= e.trail {
+		e.w.writeBit(false)
+		e.w.writeBits(xor>>e.trail, 64-int(e.leader)-int(e.trail))
+		return
+	}
+
+	e.leader, e.trail = leader, trail
+	sigbits := 64 - int(leader) - int(trail)
+	e.w.writeBit(true)
+	e.w.writeBits(uint64(leader), 5)
+	// 有效位数为64时记为0
+	e.w.writeBits(uint64(sigbits)&0x3f, 6)
+	e.w.writeBits(xor>>trail, sigbits)
+}
+
+// Len returns the number of points
+func (e *Encoder) Len() int {
+	return e.n
+}
+
+func (e *Encoder) Bytes() []byte {
+	return e.w.buf
+}
+
+// Decode decodes n points from b
+func Decode(b []byte, n int) ([]Point, error) {
+	points := make([]Point, 0, n)
+	if n == 0 {
+		return points, nil
+	}
+	r := newBitReader(b)
+
+	u, err := r.readBits(64)
+	if err != nil {
+		return nil, err
+	}
+	ts := int64(u)
+	val, err := r.readBits(64)
+	if err != nil {
+		return nil, err
+	}
+	points = append(points, Point{Ts: ts, Value: math.Float64frombits(val)})
+
+	var (
+		delta         int64
+		leader, trail uint8
+	)
+	for i := 1; i < n; i++ {
+		if i == 1 {
+			if u, err = r.readBits(64); err != nil {
+				return nil, err
+			}
+			delta = int64(u)
+		} else {
+			dod, err := readDod(r)
+			if err != nil {
+				return nil, err
+			}
+			delta += dod
+		}
+		ts += delta
+
+		if val, leader, trail, err = readValue(r, val, leader, trail); err != nil {
+			return nil, err
+		}
+		points = append(points, Point{Ts: ts, Value: math.Float64frombits(val)})
+	}
+	return points, nil
+}
+
+func readDod(r *bitReader) (int64, error) {
+	nbits := 0
+	for nbits < 4 {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		if !bit {
+			break
+		}
+		nbits++
+	}
+	if nbits == 0 {
+		return 0, nil
+	}
+	if nbits == 4 {
+		u, err := r.readBits(64)
+		return int64(u), err
+	}
+
+	size := dodBuckets[nbits-1].bits
+	u, err := r.readBits(size)
+	if err != nil {
+		return 0, err
+	}
+	// 符号扩展
+	if u > 1<<uint(size-1) {
+		return int64(u) - 1<<uint(size), nil
+	}
+	return int64(u), nil
+}
+
+func readValue(r *bitReader, prev uint64, leader, trail uint8) (uint64, uint8, uint8, error) {
+	bit, err := r.readBit()
+	if err != nil || !bit {
+		return prev, leader, trail, err
+	}
+	if bit, err = r.readBit(); err != nil {
+		return 0, 0, 0, err
+	}
+	if bit {
+		u, err := r.readBits(5)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		leader = uint8(u)
+		if u, err = r.readBits(6); err != nil {
+			return 0, 0, 0, err
+		}
+		sigbits := uint8(u)
+		if sigbits == 0 {
+			sigbits = 64
+		}
+		trail = 64 - leader - sigbits
+	}
+
+	u, err := r.readBits(64 - int(leader) - int(trail))
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	return prev ^ u<<trail, leader, trail, nil
+}
+
+// leadingZeros 和 trailingZeros 用于x不为0的情况, go1.7没有math/bits
+func leadingZeros(x uint64) int {
+	n := 0
+	for x&(1<<63) == 0 {
+		x <<= 1
+		n++
+	}
+	return n
+}
+
+func trailingZeros(x uint64) int {
+	n := 0
+	for x&1 == 0 {
+		x >>= 1
+		n++
+	}
+	return n
+}
@@ -0,0 +1,79 @@
+package gorilla
+
+import (
+	"math"
+	"testing"
+)
+
+func roundTrip(t *testing.T, points []Point) {
+	e := NewEncoder()
+	for _, p := range points {
+		e.Append(p.Ts, p.Value)
+	}
+	decoded, err := Decode(e.Bytes(), e.Len())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != len(points) {
+		t.Fatalf("expected %d points, got %d", len(points), len(decoded))
+	}
+	for i, p := range points {
+		d := decoded[i]
+		if d.Ts != p.Ts || math.Float64bits(d.Value) != math.Float64bits(p.Value) {
+			t.Fatalf("point %d: expected %v, got %v", i, p, d)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	roundTrip(t, nil)
+	roundTrip(t, []Point{{1500000000, 1.5}})
+
+	points := []Point{}
+	ts := int64(1500000000)
+	for i := 0; i < 200; i++ {
+		points = append(points, Point{ts, 100 + float64(i%7)*0.25})
+		ts += 60
+	}
+	roundTrip(t, points)
+
+	// irregular timestamps and values
+	ts = 1500000000
+	points = points[:0]
+	for i, gap := range []int64{60, 61, 59, 60, 3600, 1, 60, 1 << 40, 60, 300, 2000, 60} {
+		ts += gap
+		values := []float64{0, -1, math.MaxFloat64, math.SmallestNonzeroFloat64, math.NaN(), math.Inf(-1), 123456789, 1e-300, 42}
+		points = append(points, Point{ts, values[i%len(values)]})
+	}
+	roundTrip(t, points)
+}
+
+func TestCompression(t *testing.T) {
+	e := NewEncoder()
+	for i := 0; i < 1000; i++ {
+		e.Append(1500000000+int64(i)*60, 42)
+	}
+	// 2 bits per point after the first one
+	if size := len(e.Bytes()); size > 16+8+250 {
+		t.Errorf("bad compression: %d bytes", size)
+	}
+	if _, err := Decode(e.Bytes()[:10], e.Len()); err != ErrShortBuffer {
+		t.Errorf("expected short buffer, got %v", err)
+	}
+}
+
+func TestZeros(t *testing.T) {
+	for _, c := range []struct {
+		x             uint64
+		leader, trail int
+	}{
+		{1, 63, 0},
+		{1 << 63, 0, 63},
+		{0xf0, 56, 4},
+		{math.MaxUint64, 0, 0},
+	} {
+		if l, r := leadingZeros(c.x), trailingZeros(c.x); l != c.leader || r != c.trail {
+			t.Errorf("%x: expect %d/%d, got %d/%d", c.x, c.leader, c.trail, l, r)
+		}
+	}
+}
@@ -0,0 +1,357 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	cmodel "github.com/Cepave/open-falcon-backend/common/model"
+	"github.com/open-falcon/rrdlite"
+
+	"github.com/Cepave/open-falcon-backend/modules/graph/g"
+)
+
+const relayoutUpdateBatch = 1024
+
+type rrdArchiveInfo struct {
+	cf        string
+	pdpPerRow int
+	rows      int
+}
+
+type rrdFileInfo struct {
+	step       int
+	lastUpdate int64
+	dsType     string
+	heartbeat  int
+	min        string
+	max        string
+	archives   []*rrdArchiveInfo // sorted by pdpPerRow
+}
+
+// archivesOf returns the archives of cf, from the finest to the coarsest
+func (this *rrdFileInfo) archivesOf(cf string) []*rrdArchiveInfo {
+	archives := []*rrdArchiveInfo{}
+	for _, archive := range this.archives {
+		if archive.cf == cf {
+			archives = append(archives, archive)
+		}
+	}
+	return archives
+}
+
+func (this *rrdFileInfo) hasArchive(cf string, pdpPerRow int) bool {
+	for _, archive := range this.archives {
+		if archive.cf == cf && archive.pdpPerRow == pdpPerRow {
+			return true
+		}
+	}
+	return false
+}
+
+// Relayout rebuilds the rrd file(src) into a new file(dst) with the archives of policy.
+//
+// The data of src is read from the finest AVERAGE archive which covers the time range,
+// then expanded to the base step and written into dst, so the consolidated archives of dst are re-computed.
+// The rows which have MAX and MIN archives of the same resolution are expanded to points of which the
+// maximum, minimum and average are kept, so the MAX/MIN history survives as well.
+//
+// This function works on files directly, the graph process must not be writing the src file.
+func Relayout(src string, dst string, policy *g.RetentionPolicy) error {
+	info, err := loadRrdFileInfo(src)
+	if err != nil {
+		return err
+	}
+	if len(info.archivesOf("AVERAGE")) == 0 {
+		return fmt.Errorf("%s: there is no AVERAGE archive", src)
+	}
+
+	points, err := readAllPoints(src, info)
+	if err != nil {
+		return err
+	}
+
+	item := &cmodel.GraphItem{
+		DsType:    info.dsType,
+		Step:      info.step,
+		Heartbeat: info.heartbeat,
+		Min:       info.min,
+		Max:       info.max,
+	}
+
+	start := time.Unix(info.lastUpdate, 0).Add(-24 * time.Hour)
+	if len(points) > 0 {
+		start = time.Unix(points[0].Timestamp-int64(info.step), 0)
+	}
+
+	if _, err := os.Stat(dst); err == nil {
+		return fmt.Errorf("destination file %s already exists", dst)
+	}
+
+	c := rrdlite.NewCreator(dst, start, uint(info.step))
+	c.DS("metric", item.DsType, item.Heartbeat, item.Min, item.Max)
+	for _, archive := range policy.Archives {
+		for _, cf := range archive.CFs {
+			c.RRA(cf, 0.5, archive.Steps, archive.Points)
+		}
+	}
+	if err := c.Create(false); err != nil {
+		return err
+	}
+
+	return writeAllPoints(dst, info, points)
+}
+
+func loadRrdFileInfo(filename string) (*rrdFileInfo, error) {
+	raw, err := rrdlite.Info(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &rrdFileInfo{
+		step:       infoInt(raw["step"]),
+		lastUpdate: int64(infoInt(raw["last_update"])),
+		dsType:     infoDsString(raw["ds.type"]),
+		heartbeat:  infoInt(infoDsValue(raw["ds.minimal_heartbeat"])),
+		min:        infoDsLimit(raw["ds.min"]),
+		max:        infoDsLimit(raw["ds.max"]),
+	}
+	if info.step <= 0 {
+		return nil, fmt.Errorf("%s: cannot get step of rrd file", filename)
+	}
+	if info.dsType == "" {
+		return nil, fmt.Errorf("%s: cannot get type of data source", filename)
+	}
+	if info.heartbeat <= 0 {
+		info.heartbeat = info.step * 2
+	}
+
+	cfs, _ := raw["rra.cf"].([]interface{})
+	rows, _ := raw["rra.rows"].([]interface{})
+	pdps, _ := raw["rra.pdp_per_row"].([]interface{})
+	for i, cf := range cfs {
+		name, ok := cf.(string)
+		if !ok || i >= len(rows) || i >= len(pdps) {
+			continue
+		}
+		info.archives = append(info.archives, &rrdArchiveInfo{
+			cf:        name,
+			pdpPerRow: infoInt(pdps[i]),
+			rows:      infoInt(rows[i]),
+		})
+	}
+	sort.Stable(archivesByPdp(info.archives))
+
+	return info, nil
+}
+
+type archivesByPdp []*rrdArchiveInfo
+
+func (this archivesByPdp) Len() int           { return len(this) }
+func (this archivesByPdp) Less(i, j int) bool { return this[i].pdpPerRow < this[j].pdpPerRow }
+func (this archivesByPdp) Swap(i, j int)      { this[i], this[j] = this[j], this[i] }
+
+// readAllPoints reads points(by base step) from the oldest to the latest
+func readAllPoints(filename string, info *rrdFileInfo) ([]*cmodel.RRDData, error) {
+	step := int64(info.step)
+	end := info.lastUpdate - info.lastUpdate%step
+
+	/**
+	 * Every archive covers the time range which is not covered by finer archives
+	 */
+	windows := [][]*cmodel.RRDData{}
+	for _, archive := range info.archivesOf("AVERAGE") {
+		archiveStep := step * int64(archive.pdpPerRow)
+		start := info.lastUpdate - int64(archive.rows)*archiveStep
+		start -= start % archiveStep
+		if start >= end {
+			continue
+		}
+
+		data, err := fetch(filename, "AVERAGE", start, end, int(archiveStep))
+		if err != nil {
+			return nil, err
+		}
+		maxData, minData, err := fetchExtremes(filename, info, archive.pdpPerRow, start, end, data)
+		if err != nil {
+			return nil, err
+		}
+
+		window := []*cmodel.RRDData{}
+		for i, d := range data {
+			if d.Timestamp > end {
+				break
+			}
+			values := []float64{}
+			if maxData != nil {
+				values = expandRow(float64(d.Value), float64(maxData[i].Value), float64(minData[i].Value), archive.pdpPerRow)
+			}
+			j := 0
+			for ts := d.Timestamp - archiveStep + step; ts <= d.Timestamp; ts += step {
+				v := d.Value
+				if j < len(values) {
+					v = cmodel.JsonFloat(values[j])
+				}
+				j++
+				if ts <= start {
+					continue
+				}
+				window = append(window, &cmodel.RRDData{Timestamp: ts, Value: v})
+			}
+		}
+		windows = append(windows, window)
+
+		end = start
+	}
+	// :~)
+
+	points := []*cmodel.RRDData{}
+	for i := len(windows) - 1; i >= 0; i-- {
+		points = append(points, windows[i]...)
+	}
+	return points, nil
+}
+
+// fetchExtremes returns the MAX and MIN rows aligned with the AVERAGE rows(avg),
+// nil if the file has no such archives of the resolution
+func fetchExtremes(filename string, info *rrdFileInfo, pdpPerRow int, start, end int64, avg []*cmodel.RRDData) (
+	[]*cmodel.RRDData, []*cmodel.RRDData, error) {
+	if pdpPerRow < 2 || !info.hasArchive("MAX", pdpPerRow) || !info.hasArchive("MIN", pdpPerRow) {
+		return nil, nil, nil
+	}
+
+	archiveStep := info.step * pdpPerRow
+	maxData, err := fetch(filename, "MAX", start, end, archiveStep)
+	if err != nil {
+		return nil, nil, err
+	}
+	minData, err := fetch(filename, "MIN", start, end, archiveStep)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(maxData) != len(avg) || len(minData) != len(avg) {
+		return nil, nil, nil
+	}
+	for i := range avg {
+		if maxData[i].Timestamp != avg[i].Timestamp || minData[i].Timestamp != avg[i].Timestamp {
+			return nil, nil, nil
+		}
+	}
+	return maxData, minData, nil
+}
+
+// expandRow returns n points of which the average, maximum and minimum are avg, max and min.
+// The maximum goes first and the minimum goes last, the others share the rest of the sum.
+// The points are all avg if max or min is unknown.
+func expandRow(avg, max, min float64, n int) []float64 {
+	values := make([]float64, n)
+	for i := range values {
+		values[i] = avg
+	}
+	if n < 2 || math.IsNaN(avg) || math.IsNaN(max) || math.IsNaN(min) || max < min {
+		return values
+	}
+
+	values[0], values[n-1] = max, min
+	if n > 2 {
+		rest := (avg*float64(n) - max - min) / float64(n-2)
+		// 只有不一致的数据(例如部分点为unknown)才会超出范围
+		rest = math.Min(math.Max(rest, min), max)
+		for i := 1; i < n-1; i++ {
+			values[i] = rest
+		}
+	}
+	return values
+}
+
+func writeAllPoints(filename string, info *rrdFileInfo, points []*cmodel.RRDData) error {
+	isCounter := info.dsType == g.DERIVE || info.dsType == g.COUNTER
+
+	/**
+	 * Values of DERIVE/COUNTER are rates,
+	 * the raw counter is rebuilt by integrating the rates.
+	 */
+	var counter float64
+	lastTs := int64(0)
+	// :~)
+
+	u := rrdlite.NewUpdater(filename)
+	cached := 0
+	for _, p := range points {
+		v := float64(p.Value)
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			continue
+		}
+
+		if isCounter {
+			if lastTs == 0 || p.Timestamp-lastTs > int64(info.heartbeat) {
+				// Starts a new counter after a gap, the first update only gives the base
+				u.Cache(p.Timestamp-int64(info.step), int(counter))
+				cached++
+			}
+			counter += v * float64(info.step)
+			u.Cache(p.Timestamp, int(counter))
+		} else {
+			u.Cache(p.Timestamp, v)
+		}
+		lastTs = p.Timestamp
+		cached++
+
+		if cached >= relayoutUpdateBatch {
+			if err := u.Update(); err != nil {
+				return err
+			}
+			u = rrdlite.NewUpdater(filename)
+			cached = 0
+		}
+	}
+
+	if cached > 0 {
+		return u.Update()
+	}
+	return nil
+}
+
+func infoInt(v interface{}) int {
+	switch n := v.(type) {
+	case int:
+		return n
+	case uint:
+		return int(n)
+	case int64:
+		return int(n)
+	case uint64:
+		return int(n)
+	case float64:
+		return int(n)
+	case string:
+		i, _ := strconv.Atoi(n)
+		return i
+	}
+	return 0
+}
+
+// the values of data source are keyed by the name of data source("metric")
+func infoDsValue(v interface{}) interface{} {
+	if m, ok := v.(map[string]interface{}); ok {
+		return m["metric"]
+	}
+	return v
+}
+
+func infoDsString(v interface{}) string {
+	s, _ := infoDsValue(v).(string)
+	return s
+}
+
+func infoDsLimit(v interface{}) string {
+	f, ok := infoDsValue(v).(float64)
+	if !ok || math.IsNaN(f) {
+		return "U"
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
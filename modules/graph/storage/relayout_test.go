@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	cmodel "github.com/Cepave/open-falcon-backend/common/model"
+
+	"github.com/Cepave/open-falcon-backend/modules/graph/g"
+)
+
+func TestExpandRow(t *testing.T) {
+	for _, c := range []struct {
+		avg, max, min float64
+		n             int
+	}{
+		{28, 100, 10, 5},
+		{5, 9, 1, 20},
+		{3, 5, 1, 2},
+		{7, 7, 7, 5},
+	} {
+		values := expandRow(c.avg, c.max, c.min, c.n)
+		if len(values) != c.n {
+			t.Fatalf("expected %d values, got %d", c.n, len(values))
+		}
+		sum, max, min := 0.0, math.Inf(-1), math.Inf(1)
+		for _, v := range values {
+			sum += v
+			max = math.Max(max, v)
+			min = math.Min(min, v)
+		}
+		if math.Abs(sum/float64(c.n)-c.avg) > 1e-9 || max != c.max || min != c.min {
+			t.Errorf("%+v: unexpected values %v", c, values)
+		}
+	}
+
+	// MAX/MIN未知时只保留平均值
+	for _, v := range expandRow(3, math.NaN(), 1, 5) {
+		if v != 3 {
+			t.Errorf("expected the average, got %v", v)
+		}
+	}
+}
+
+var relayoutSrcPolicy = &g.RetentionPolicy{
+	Name: "src",
+	Archives: []*g.RetentionArchive{
+		{Steps: 1, Points: 60, CFs: []string{"AVERAGE"}},
+		{Steps: 5, Points: 100, CFs: []string{"AVERAGE", "MAX", "MIN"}},
+	},
+}
+
+var relayoutDstPolicy = &g.RetentionPolicy{
+	Name: "dst",
+	Archives: []*g.RetentionArchive{
+		{Steps: 1, Points: 30, CFs: []string{"AVERAGE"}},
+		{Steps: 5, Points: 100, CFs: []string{"AVERAGE", "MAX", "MIN"}},
+	},
+}
+
+func TestRelayout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "relayout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "src.rrd")
+	dst := filepath.Join(dir, "dst.rrd")
+
+	// 每5分钟里有一个100, 其他都是10
+	now := time.Now().Unix()
+	base := now - now%300 - 300*60
+	item := &cmodel.GraphItem{DsType: "GAUGE", Step: 60, Heartbeat: 120, Min: "U", Max: "U"}
+	if err := createWithPolicy(src, item, relayoutSrcPolicy); err != nil {
+		t.Fatal(err)
+	}
+	values := make([]float64, 300)
+	for i := range values {
+		values[i] = 10
+		if i%5 == 2 {
+			values[i] = 100
+		}
+	}
+	s := &rrdStorage{}
+	if err := s.Update(src, items("GAUGE", base+60, values...)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Relayout(src, dst, relayoutDstPolicy); err != nil {
+		t.Fatal(err)
+	}
+	if err := Relayout(src, dst, relayoutDstPolicy); err == nil {
+		t.Error("expected error of the existing destination")
+	}
+
+	// 原始数据之外的部分, 各个合并函数的结果都保留了
+	end := base + 300*60 - 60*60
+	for _, cf := range []string{"AVERAGE", "MAX", "MIN"} {
+		expected, err := s.Fetch(src, cf, base+600, end, 300)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := s.Fetch(dst, cf, base+600, end, 300)
+		if err != nil {
+			t.Fatal(err)
+		}
+		compared := 0
+		for i := range expected {
+			if i >= len(got) || got[i].Timestamp != expected[i].Timestamp {
+				t.Fatalf("%s: the timestamps are not aligned", cf)
+			}
+			if math.IsNaN(float64(expected[i].Value)) {
+				continue
+			}
+			compared++
+			if math.Abs(float64(got[i].Value-expected[i].Value)) > 1e-6 {
+				t.Errorf("%s at %d: expected %v, got %v", cf, expected[i].Timestamp, expected[i].Value, got[i].Value)
+			}
+		}
+		if compared == 0 {
+			t.Errorf("%s: nothing is compared", cf)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	cmodel "github.com/Cepave/open-falcon-backend/common/model"
+	"github.com/open-falcon/rrdlite"
+
+	"github.com/Cepave/open-falcon-backend/modules/graph/g"
+)
+
+// rrdStorage keeps the data in rrd files, consolidated by the retention policies
+type rrdStorage struct{}
+
+func (this *rrdStorage) Create(filename string, item *cmodel.GraphItem) error {
+	policy := g.ResolveRetentionPolicy(item.Endpoint, item.Metric, item.Tags)
+	return createWithPolicy(filename, item, policy)
+}
+
+// 按照归档策略创建rrd文件
+func createWithPolicy(filename string, item *cmodel.GraphItem, policy *g.RetentionPolicy) error {
+	now := time.Now()
+	start := now.Add(time.Duration(-24) * time.Hour)
+	step := uint(item.Step)
+
+	c := rrdlite.NewCreator(filename, start, step)
+	c.DS("metric", item.DsType, item.Heartbeat, item.Min, item.Max)
+
+	// 设置各种归档策略
+	for _, archive := range policy.Archives {
+		for _, cf := range archive.CFs {
+			c.RRA(cf, 0.5, archive.Steps, archive.Points)
+		}
+	}
+
+	return c.Create(true)
+}
+
+func (this *rrdStorage) Update(filename string, items []*cmodel.GraphItem) error {
+	u := rrdlite.NewUpdater(filename)
+
+	for _, item := range items {
+		v := math.Abs(item.Value)
+		if v > 1e+300 || (v < 1e-300 && v > 0) {
+			continue
+		}
+		if item.DsType == "DERIVE" || item.DsType == "COUNTER" {
+			u.Cache(item.Timestamp, int(item.Value))
+		} else {
+			u.Cache(item.Timestamp, item.Value)
+		}
+	}
+
+	return u.Update()
+}
+
+func (this *rrdStorage) Fetch(filename string, cf string, start, end int64, step int) ([]*cmodel.RRDData, error) {
+	return fetch(filename, cf, start, end, step)
+}
+
+func fetch(filename string, cf string, start, end int64, step int) ([]*cmodel.RRDData, error) {
+	start_t := time.Unix(start, 0)
+	end_t := time.Unix(end, 0)
+	step_t := time.Duration(step) * time.Second
+
+	fetchRes, err := rrdlite.Fetch(filename, cf, start_t, end_t, step_t)
+	if err != nil {
+		return []*cmodel.RRDData{}, err
+	}
+
+	defer fetchRes.FreeValues()
+
+	values := fetchRes.Values()
+	size := len(values)
+	ret := make([]*cmodel.RRDData, size)
+
+	start_ts := fetchRes.Start.Unix()
+	step_s := fetchRes.Step.Seconds()
+
+	for i, val := range values {
+		ts := start_ts + int64(i+1)*int64(step_s)
+		d := &cmodel.RRDData{
+			Timestamp: ts,
+			Value:     cmodel.JsonFloat(val),
+		}
+		ret[i] = d
+	}
+
+	return ret, nil
+}
+
+func (this *rrdStorage) Last(filename string) (*cmodel.RRDData, error) {
+	info, err := rrdlite.Info(filename)
+	if err != nil {
+		return nil, err
+	}
+	value := math.NaN()
+	switch v := infoDsValue(info["ds.last_ds"]).(type) {
+	case float64:
+		value = v
+	case string:
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			value = f
+		}
+	}
+	return cmodel.NewRRDData(int64(infoInt(info["last_update"])), value), nil
+}
+
+// the data of the raw archive(steps=1) is not consolidated, the archives are read from the file
+// since the policy may be changed after the file is created
+func (this *rrdStorage) RawStart(filename string, step int, now int64) (int64, error) {
+	info, err := loadRrdFileInfo(filename)
+	if err != nil {
+		return 0, err
+	}
+	lastUpTs := now - now%int64(step)
+	return lastUpTs - int64(info.rawPoints()*step), nil
+}
+
+// rawPoints returns the number of points of un-consolidated data
+func (this *rrdFileInfo) rawPoints() int {
+	points := 0
+	for _, archive := range this.archives {
+		if archive.pdpPerRow == 1 && archive.rows > points {
+			points = archive.rows
+		}
+	}
+	return points
+}
@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	cmodel "github.com/Cepave/open-falcon-backend/common/model"
+
+	"github.com/Cepave/open-falcon-backend/modules/graph/g"
+)
+
+func TestRawStart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rrd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "counter.rrd")
+
+	policy := &g.RetentionPolicy{
+		Name: "test",
+		Archives: []*g.RetentionArchive{
+			{Steps: 1, Points: 60, CFs: []string{"AVERAGE"}},
+			{Steps: 5, Points: 100, CFs: []string{"AVERAGE", "MAX", "MIN"}},
+		},
+	}
+	item := &cmodel.GraphItem{DsType: "GAUGE", Step: 60, Heartbeat: 120, Min: "U", Max: "U"}
+	if err := createWithPolicy(filename, item, policy); err != nil {
+		t.Fatal(err)
+	}
+
+	// 按文件实际的归档计算原始数据的起点
+	s := &rrdStorage{}
+	now := time.Now().Unix()
+	if ts, err := s.RawStart(filename, 60, now); err != nil || ts != now-now%60-60*60 {
+		t.Errorf("unexpected raw start: %d %v", ts, err)
+	}
+	if _, err := s.RawStart(filepath.Join(dir, "none.rrd"), 60, now); err == nil {
+		t.Error("expected error of the missing file")
+	}
+	if ts, err := (&columnarStorage{}).RawStart(filename, 60, now); err != nil || ts != 0 {
+		t.Errorf("the raw data of columnar files is kept, got %d %v", ts, err)
+	}
+}
@@ -0,0 +1,34 @@
+// Package storage persists the data of each counter in a file under rrd.storage of graph.
+// The backend is selected by rrd.backend, all nodes of a cluster must use the same backend.
+package storage
+
+import (
+	cmodel "github.com/Cepave/open-falcon-backend/common/model"
+
+	"github.com/Cepave/open-falcon-backend/modules/graph/g"
+)
+
+// Storage is the backend of the counter files. The files are read and written by
+// the io worker of rrdtool only, so the implementations need not be safe for concurrent use.
+type Storage interface {
+	// Create creates the file of the counter of item
+	Create(filename string, item *cmodel.GraphItem) error
+	// Update writes the items, of which the timestamps are ascending, into the file
+	Update(filename string, items []*cmodel.GraphItem) error
+	// Fetch returns the values consolidated by cf in (start, end] with step, the timestamps are continuous
+	Fetch(filename string, cf string, start, end int64, step int) ([]*cmodel.RRDData, error)
+	// Last returns the last raw value written into the file
+	Last(filename string) (*cmodel.RRDData, error)
+	// RawStart returns the timestamp since which the data of the file is not consolidated
+	RawStart(filename string, step int, now int64) (int64, error)
+}
+
+var backends = map[string]Storage{
+	g.RRD_BACKEND_RRDTOOL:  &rrdStorage{},
+	g.RRD_BACKEND_COLUMNAR: &columnarStorage{},
+}
+
+// Backend returns the storage configured by rrd.backend
+func Backend() Storage {
+	return backends[g.Config().RRD.Backend]
+}
@@ -151,7 +151,7 @@ func (this *GraphItemMap) PushFront(key string,
 		safeList := &SafeLinkedList{L: list.New()}
 		safeList.L.PushFront(item)
 
-		if cfg.Migrate.Enabled && !g.IsRrdFileExist(g.RrdFileName(
+		if cfg.Migrating() && !g.IsRrdFileExist(g.RrdFileName(
 			cfg.RRD.Storage, md5, item.DsType, item.Step)) {
 			safeList.Flag = g.GRAPH_F_MISS
 		}
@@ -0,0 +1,70 @@
+// relayout rebuilds rrd files of graph with a retention policy configured in cfg.json.
+//
+// It works on files directly, please stop graph(or work on copied files) before running it:
+//
+//	relayout -c cfg.json -policy important /home/work/data/6070/ab/ab1d...._GAUGE_60.rrd
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Cepave/open-falcon-backend/modules/graph/g"
+	"github.com/Cepave/open-falcon-backend/modules/graph/storage"
+)
+
+func main() {
+	cfgFile := flag.String("c", "cfg.json", "configuration file of graph")
+	policyName := flag.String("policy", "", "name of retention policy")
+	replace := flag.Bool("replace", false, "replace the original file(which is kept as *.bak)")
+	flag.Parse()
+
+	if *policyName == "" || flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: relayout -c cfg.json -policy <name> [-replace] <rrd file>...")
+		os.Exit(1)
+	}
+
+	g.ParseConfig(*cfgFile)
+	if g.Config().RRD.Backend != g.RRD_BACKEND_RRDTOOL {
+		fmt.Fprintf(os.Stderr, "retention policies are not used by the backend: %s\n", g.Config().RRD.Backend)
+		os.Exit(1)
+	}
+
+	policy := g.Config().Retention.GetPolicy(*policyName)
+	if policy == nil {
+		fmt.Fprintf(os.Stderr, "retention policy not found: %s\n", *policyName)
+		os.Exit(1)
+	}
+
+	failed := 0
+	for _, src := range flag.Args() {
+		if err := relayoutFile(src, policy, *replace); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", src, err)
+			failed++
+			continue
+		}
+		fmt.Printf("%s: ok\n", src)
+	}
+
+	if failed > 0 {
+		os.Exit(2)
+	}
+}
+
+func relayoutFile(src string, policy *g.RetentionPolicy, replace bool) error {
+	dst := src + ".new"
+	if err := storage.Relayout(src, dst, policy); err != nil {
+		os.Remove(dst)
+		return err
+	}
+
+	if !replace {
+		return nil
+	}
+
+	if err := os.Rename(src, src+".bak"); err != nil {
+		return err
+	}
+	return os.Rename(dst, src)
+}
@@ -24,6 +24,7 @@ func (this *SafeExpressionCache) Init() {
 	if err != nil {
 		return
 	}
+	es = filterInvalidExpressions(es)
 
 	this.Lock()
 	defer this.Unlock()
@@ -0,0 +1,85 @@
+package cache
+
+import (
+	"sync"
+
+	"github.com/Cepave/open-falcon-backend/common/judgefunc"
+	"github.com/Cepave/open-falcon-backend/common/model"
+	log "github.com/Sirupsen/logrus"
+)
+
+// InvalidJudgeFunc is a strategy/expression whose function cannot be parsed,
+// it is not delivered to judge.
+type InvalidJudgeFunc struct {
+	Type     string `json:"type"` // "strategy" or "expression"
+	Id       int    `json:"id"`
+	Func     string `json:"func"`
+	Operator string `json:"op"`
+	Error    string `json:"error"`
+}
+
+type SafeInvalidJudgeFuncs struct {
+	sync.RWMutex
+	strategies  []*InvalidJudgeFunc
+	expressions []*InvalidJudgeFunc
+}
+
+var InvalidJudgeFuncs = &SafeInvalidJudgeFuncs{
+	strategies:  []*InvalidJudgeFunc{},
+	expressions: []*InvalidJudgeFunc{},
+}
+
+func (this *SafeInvalidJudgeFuncs) GetAll() []*InvalidJudgeFunc {
+	this.RLock()
+	defer this.RUnlock()
+
+	ret := make([]*InvalidJudgeFunc, 0, len(this.strategies)+len(this.expressions))
+	ret = append(ret, this.strategies...)
+	ret = append(ret, this.expressions...)
+	return ret
+}
+
+// filterInvalidStrategies removes strategies with invalid function from the map
+func filterInvalidStrategies(m map[int]*model.Strategy) {
+	invalid := []*InvalidJudgeFunc{}
+	for id, s := range m {
+		err := judgefunc.Validate(s.Func, s.Operator)
+		if err == nil {
+			continue
+		}
+
+		log.Printf("[ERROR] invalid function of strategy id=%d: %v", id, err)
+		invalid = append(invalid, &InvalidJudgeFunc{
+			Type: "strategy", Id: id, Func: s.Func, Operator: s.Operator, Error: err.Error(),
+		})
+		delete(m, id)
+	}
+
+	InvalidJudgeFuncs.Lock()
+	defer InvalidJudgeFuncs.Unlock()
+	InvalidJudgeFuncs.strategies = invalid
+}
+
+// filterInvalidExpressions returns expressions with valid function
+func filterInvalidExpressions(es []*model.Expression) []*model.Expression {
+	valid := make([]*model.Expression, 0, len(es))
+	invalid := []*InvalidJudgeFunc{}
+	for _, e := range es {
+		err := judgefunc.Validate(e.Func, e.Operator)
+		if err == nil {
+			valid = append(valid, e)
+			continue
+		}
+
+		log.Printf("[ERROR] invalid function of expression id=%d: %v", e.Id, err)
+		invalid = append(invalid, &InvalidJudgeFunc{
+			Type: "expression", Id: e.Id, Func: e.Func, Operator: e.Operator, Error: err.Error(),
+		})
+	}
+
+	InvalidJudgeFuncs.Lock()
+	defer InvalidJudgeFuncs.Unlock()
+	InvalidJudgeFuncs.expressions = invalid
+
+	return valid
+}
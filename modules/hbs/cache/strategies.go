@@ -28,6 +28,7 @@ func (this *SafeStrategies) Init(tpls map[int]*model.Template) {
 	if err != nil {
 		return
 	}
+	filterInvalidStrategies(m)
 
 	this.Lock()
 	defer this.Unlock()
@@ -96,7 +96,7 @@ func QueryStrategies(tpls map[int]*model.Template) (map[int]*model.Strategy, err
 
 func QueryBuiltinMetrics(tids string) ([]*model.BuiltinMetric, error) {
 	sql := fmt.Sprintf(
-		"select metric, tags from strategy where tpl_id in (%s) and metric in ('net.port.listen', 'proc.num', 'du.bs', 'url.check.health')",
+		"select metric, tags from strategy where tpl_id in (%s) and (metric in ('net.port.listen', 'proc.num', 'du.bs', 'url.check.health') or metric like 'proc.%%' or metric like 'http.check.%%' or metric like 'tcp.check.%%' or metric like 'dns.check.%%' or metric like 'tls.check.%%' or metric like 'log.match.%%')",
 		tids,
 	)
 
@@ -9,6 +9,7 @@ import (
 func configProcRoutes(router *gin.Engine) {
 	router.GET("/expressions", gin.WrapF(expressions))
 	router.GET("/plugins/", gin.WrapF(plugins))
+	router.GET("/judge/funcs/invalid", gin.WrapF(invalidJudgeFuncs))
 }
 
 func expressions(w http.ResponseWriter, r *http.Request) {
@@ -19,3 +20,8 @@ func plugins(w http.ResponseWriter, r *http.Request) {
 	hostname := r.URL.Path[len("/plugins/"):]
 	RenderDataJson(w, cache.GetPlugins(hostname))
 }
+
+// strategies/expressions which are not delivered to judge because of invalid function
+func invalidJudgeFuncs(w http.ResponseWriter, r *http.Request) {
+	RenderDataJson(w, cache.InvalidJudgeFuncs.GetAll())
+}
@@ -49,6 +49,19 @@ func (t *Agent) ReportStatus(args *model.AgentReportRequest, reply *model.Simple
 	return nil
 }
 
+// ReportCommand records the remote commands executed by the agents for auditing
+func (t *Agent) ReportCommand(args *model.AgentCommandReport, reply *model.SimpleRpcResponse) (err error) {
+	defer rpc.HandleError(&err)()
+
+	if args.Hostname == "" {
+		reply.Code = 1
+		return nil
+	}
+
+	log.WithField("audit", "agent.command").Infoln(args)
+	return nil
+}
+
 // 需要checksum一下来减少网络开销？其实白名单通常只会有一个或者没有，无需checksum
 func (t *Agent) TrustableIps(args *model.NullRpcRequest, ips *string) (err error) {
 	defer rpc.HandleError(&err)()
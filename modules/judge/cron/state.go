@@ -0,0 +1,57 @@
+package cron
+
+import (
+	"time"
+
+	"github.com/Cepave/open-falcon-backend/modules/judge/g"
+	"github.com/Cepave/open-falcon-backend/modules/judge/store"
+	log "github.com/Sirupsen/logrus"
+)
+
+// 定期将报警状态落盘, 避免重启judge后丢失PROBLEM状态(恢复通知不发出, 或者重复报警)
+func StoreState(pid chan string) {
+
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorf("run time panic: %v", r)
+			pid <- "StoreState"
+			return
+		}
+	}()
+
+	duration := time.Duration(g.Config().Alarm.StoreInterval) * time.Second
+	for {
+		time.Sleep(duration)
+		DumpState()
+	}
+}
+
+// DumpState writes events(and history if enabled) into local files
+func DumpState() {
+	cfg := g.Config().Alarm
+	if !cfg.StoreEventToFile {
+		return
+	}
+
+	start := time.Now()
+	if err := g.StoreLastEvents(); err != nil {
+		log.Errorf("store events into %s fail: %v", cfg.EventsStoreFilePath, err)
+	}
+
+	if cfg.StoreHistory {
+		if err := store.StoreHistory(cfg.HistoryStoreFilePath); err != nil {
+			log.Errorf("store history into %s fail: %v", cfg.HistoryStoreFilePath, err)
+		}
+	}
+	log.Debugf("dump judge state into local file, elapsed: %v", time.Since(start))
+}
+
+// 启动时恢复历史数据, 需要在HistoryBigMap初始化之后调用
+func LoadState() {
+	cfg := g.Config().Alarm
+	if !cfg.StoreEventToFile || !cfg.StoreHistory {
+		return
+	}
+
+	store.LoadHistory(cfg.HistoryStoreFilePath, time.Now().Unix()-cfg.StoreMaxAge)
+}
@@ -0,0 +1,80 @@
+package cron
+
+import (
+	"container/list"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Cepave/open-falcon-backend/common/model"
+	"github.com/Cepave/open-falcon-backend/modules/judge/g"
+	"github.com/Cepave/open-falcon-backend/modules/judge/store"
+)
+
+func initStateConfig(t *testing.T, storeHistory bool) (string, func()) {
+	dir, err := ioutil.TempDir("", "judge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(dir, "cfg.json")
+	cfg := fmt.Sprintf(`{"root_dir": "%s", "alarm": {"store_event_to_file": true, "store_max_age": 600, "store_history": %v}}`, dir, storeHistory)
+	if err := ioutil.WriteFile(filename, []byte(cfg), 0644); err != nil {
+		t.Fatal(err)
+	}
+	g.ParseConfig(filename)
+
+	g.LastEvents = &g.SafeEventMap{M: make(map[string]*model.Event)}
+	store.HistoryBigMap = make(map[string]*store.JudgeItemMap)
+	store.InitHistoryBigMap()
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func TestDumpAndLoadState(t *testing.T) {
+	_, clean := initStateConfig(t, true)
+	defer clean()
+
+	now := time.Now().Unix()
+	L := &store.SafeLinkedList{L: list.New()}
+	for i := int64(20); i >= 0; i-- {
+		L.PushFront(&model.JudgeItem{Timestamp: now - i*60, Value: float64(i)})
+	}
+	store.HistoryBigMap["ab"].Set("ab01", L)
+	g.LastEvents.Set("s_1_abc", &model.Event{Id: "s_1_abc", Status: "PROBLEM", EventTime: now})
+	DumpState()
+
+	store.InitHistoryBigMap()
+	LoadState()
+	// store_max_age之前的历史数据被丢弃
+	L, ok := store.HistoryBigMap["ab"].Get("ab01")
+	if !ok || L.Len() != 11 {
+		t.Fatalf("expected 11 items of the last 10 minutes, got %v", L)
+	}
+	if items := L.ToSlice(); items[0].Timestamp != now || items[10].Timestamp != now-600 {
+		t.Errorf("unexpected items: %v, %v", items[0], items[10])
+	}
+	if _, err := os.Stat(g.Config().Alarm.EventsStoreFilePath); err != nil {
+		t.Errorf("events are not stored: %v", err)
+	}
+}
+
+func TestDumpStateWithoutHistory(t *testing.T) {
+	_, clean := initStateConfig(t, false)
+	defer clean()
+
+	L := &store.SafeLinkedList{L: list.New()}
+	L.PushFront(&model.JudgeItem{Timestamp: time.Now().Unix(), Value: 1})
+	store.HistoryBigMap["ab"].Set("ab01", L)
+	DumpState()
+	if _, err := os.Stat(g.Config().Alarm.HistoryStoreFilePath); !os.IsNotExist(err) {
+		t.Errorf("history should not be stored: %v", err)
+	}
+
+	store.InitHistoryBigMap()
+	LoadState()
+	if _, ok := store.HistoryBigMap["ab"].Get("ab01"); ok {
+		t.Error("history should not be loaded")
+	}
+}
@@ -3,9 +3,9 @@ package cron
 import (
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"time"
 
+	"github.com/Cepave/open-falcon-backend/common/judgefunc"
 	"github.com/Cepave/open-falcon-backend/common/model"
 	"github.com/Cepave/open-falcon-backend/modules/judge/g"
 	log "github.com/Sirupsen/logrus"
@@ -25,35 +25,11 @@ func SyncStrategies(pid chan string) {
 	for {
 		syncStrategies()
 		syncExpression()
-		dumpAllJudgedEvents()
+		updateHistoryRequirement()
 		time.Sleep(duration)
 	}
 }
 
-//dump current events into file, can solve the problem of huge alarm triggered when restart judge
-func dumpAllJudgedEvents() {
-	event := g.LastEvents.GetAll()
-	if len(event) == 0 {
-		return
-	}
-	var tmpStore []*model.Event
-	for _, value := range event {
-		tmpStore = append(tmpStore, value)
-	}
-	data, err := json.Marshal(tmpStore)
-	if err != nil {
-		log.Error(err.Error())
-	}
-
-	filepath := g.Config().Alarm.EventsStoreFilePath
-
-	err = ioutil.WriteFile(filepath, data, 0644)
-	if err != nil {
-		log.Error(err.Error())
-	}
-	log.Debug("dumpAllJudgedEvents into local file.")
-}
-
 func syncStrategies() {
 	var strategiesResponse model.StrategiesResponse
 	err := g.HbsClient.Call("Hbs.GetStrategies", model.NullRpcRequest{}, &strategiesResponse)
@@ -114,3 +90,29 @@ func rebuildExpressionMap(expressionResponse *model.ExpressionResponse) {
 
 	g.ExpressionMap.ReInit(m)
 }
+
+// 根据strategy/expression的判断函数, 计算每个key需要保留的历史数据(点数及时间窗口)
+func updateHistoryRequirement() {
+	requirementOf := func(funcStr string) g.HistoryRequirement {
+		spec, err := judgefunc.Parse(funcStr)
+		if err != nil {
+			return g.HistoryRequirement{}
+		}
+		return g.HistoryRequirement{Limit: spec.Limit, Window: spec.Window}
+	}
+
+	strategies := make(map[string]g.HistoryRequirement)
+	for key, ss := range g.StrategyMap.Get() {
+		for _, s := range ss {
+			strategies[key] = strategies[key].Max(requirementOf(s.Func))
+		}
+	}
+	expressions := make(map[string]g.HistoryRequirement)
+	for key, es := range g.ExpressionMap.Get() {
+		for _, e := range es {
+			expressions[key] = expressions[key].Max(requirementOf(e.Func))
+		}
+	}
+
+	g.HistoryRequirements.ReInit(strategies, expressions)
+}
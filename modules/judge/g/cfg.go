@@ -36,13 +36,20 @@ type RedisConfig struct {
 }
 
 type AlarmConfig struct {
-	Enabled             bool         `json:"enabled"`
-	MinInterval         int64        `json:"minInterval"`
-	QueuePattern        string       `json:"queuePattern"`
-	AllowReSet          bool         `json:"allow_reset"`
-	StoreEventToFile    bool         `json:"store_event_to_file"`
-	EventsStoreFilePath string       `json:"events_store_file_path"`
-	Redis               *RedisConfig `json:"redis"`
+	Enabled             bool   `json:"enabled"`
+	MinInterval         int64  `json:"minInterval"`
+	QueuePattern        string `json:"queuePattern"`
+	AllowReSet          bool   `json:"allow_reset"`
+	StoreEventToFile    bool   `json:"store_event_to_file"`
+	EventsStoreFilePath string `json:"events_store_file_path"`
+	// 报警状态落盘的间隔(秒), 进程收到SIGTERM/SIGINT时也会落盘
+	StoreInterval int64 `json:"store_interval"`
+	// 启动加载时, 丢弃早于此时长(秒)的event/历史数据
+	StoreMaxAge int64 `json:"store_max_age"`
+	// 是否同时保存各个counter的历史数据, 避免重启后judge需要重新积累数据
+	StoreHistory         bool         `json:"store_history"`
+	HistoryStoreFilePath string       `json:"history_store_file_path"`
+	Redis                *RedisConfig `json:"redis"`
 }
 
 type GlobalConfig struct {
@@ -95,10 +102,26 @@ func ParseConfig(cfg string) {
 		c.RootDir = filepath.Dir(os.Args[0])
 	}
 
+	if c.Alarm.EventsStoreFilePath == "" {
+		c.Alarm.EventsStoreFilePath = DefaultEventsStoreFile
+	}
+	if c.Alarm.HistoryStoreFilePath == "" {
+		c.Alarm.HistoryStoreFilePath = DefaultHistoryStoreFile
+	}
+	if c.Alarm.StoreInterval <= 0 {
+		c.Alarm.StoreInterval = DefaultStoreInterval
+	}
+	if c.Alarm.StoreMaxAge <= 0 {
+		c.Alarm.StoreMaxAge = DefaultStoreMaxAge
+	}
+
 	//when the file path is not set to full path, will use the working directory as the store perfix
 	if !strings.HasPrefix(c.Alarm.EventsStoreFilePath, "/") {
 		c.Alarm.EventsStoreFilePath = c.RootDir + "/" + c.Alarm.EventsStoreFilePath
 	}
+	if !strings.HasPrefix(c.Alarm.HistoryStoreFilePath, "/") {
+		c.Alarm.HistoryStoreFilePath = c.RootDir + "/" + c.Alarm.HistoryStoreFilePath
+	}
 
 	configLock.Lock()
 	defer configLock.Unlock()
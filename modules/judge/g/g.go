@@ -7,8 +7,9 @@ import (
 // change log
 // 2.0.1: bugfix HistoryData limit
 // 2.0.2: clean stale data
+// 2.0.3: persist alert state across restarts
 const (
-	VERSION = "2.0.2"
+	VERSION = "2.0.3"
 )
 
 func init() {
@@ -0,0 +1,94 @@
+package g
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Cepave/open-falcon-backend/common/model"
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	DefaultEventsStoreFile  = "events_cache.json"
+	DefaultHistoryStoreFile = "history_cache.json"
+	DefaultStoreInterval    = 60        // 秒
+	DefaultStoreMaxAge      = 86400 * 7 // 秒, 与历史数据的清理周期一致
+)
+
+// 从落盘文件恢复LastEvents, 使judge重启后仍然知道哪些event处于PROBLEM状态,
+// 恢复通知和CurrentStep的计数不会因为重启而丢失
+func InitLastEvents() {
+	if !Config().Alarm.StoreEventToFile {
+		return
+	}
+
+	path := Config().Alarm.EventsStoreFilePath
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Errorf("read events file %s fail: %v", path, err)
+		}
+		return
+	}
+
+	var events []*model.Event
+	if err := json.Unmarshal(data, &events); err != nil {
+		log.Errorf("parse events file %s fail: %v", path, err)
+		return
+	}
+
+	before := time.Now().Unix() - Config().Alarm.StoreMaxAge
+	discarded := 0
+	for _, event := range events {
+		if event == nil || event.EventTime < before {
+			discarded++
+			continue
+		}
+		LastEvents.Set(event.Id, event)
+	}
+
+	log.Infof("init lastEvent of %s, %d events is inserted, %d expired events is discarded", path, len(events)-discarded, discarded)
+}
+
+// StoreLastEvents dumps current events into file
+func StoreLastEvents() error {
+	data, err := json.Marshal(LastEvents.Snapshot())
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomically(Config().Alarm.EventsStoreFilePath, data)
+}
+
+// WriteFileAtomically writes data into a temporary file then renames it,
+// so a crash during writing never leaves a broken file behind
+func WriteFileAtomically(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
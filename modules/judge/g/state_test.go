@@ -0,0 +1,82 @@
+package g
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Cepave/open-falcon-backend/common/model"
+)
+
+// initStateConfig parses a config which stores the state in a temporary directory
+func initStateConfig(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "judge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(dir, "cfg.json")
+	cfg := `{"root_dir": "` + dir + `", "alarm": {"store_event_to_file": true, "store_max_age": 3600}}`
+	if err := ioutil.WriteFile(filename, []byte(cfg), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ParseConfig(filename)
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func TestLastEventsRoundTrip(t *testing.T) {
+	dir, clean := initStateConfig(t)
+	defer clean()
+	if path := Config().Alarm.EventsStoreFilePath; path != filepath.Join(dir, DefaultEventsStoreFile) {
+		t.Fatalf("unexpected events file: %s", path)
+	}
+
+	now := time.Now().Unix()
+	LastEvents = &SafeEventMap{M: make(map[string]*model.Event)}
+	LastEvents.Set("s_1_abc", &model.Event{Id: "s_1_abc", Status: "PROBLEM", CurrentStep: 3, EventTime: now - 60})
+	// 超过store_max_age的event在加载时丢弃
+	LastEvents.Set("s_2_abc", &model.Event{Id: "s_2_abc", Status: "PROBLEM", EventTime: now - 3601})
+	if err := StoreLastEvents(); err != nil {
+		t.Fatal(err)
+	}
+
+	LastEvents = &SafeEventMap{M: make(map[string]*model.Event)}
+	InitLastEvents()
+	if event, ok := LastEvents.Get("s_1_abc"); !ok || event.Status != "PROBLEM" || event.CurrentStep != 3 || event.EventTime != now-60 {
+		t.Errorf("unexpected event: %v", event)
+	}
+	if _, ok := LastEvents.Get("s_2_abc"); ok {
+		t.Error("the expired event should be discarded")
+	}
+
+	// 临时文件不会残留
+	files, _ := filepath.Glob(filepath.Join(dir, DefaultEventsStoreFile+".tmp*"))
+	if len(files) != 0 {
+		t.Errorf("unexpected temporary files: %v", files)
+	}
+}
+
+func TestLoadCorruptEvents(t *testing.T) {
+	_, clean := initStateConfig(t)
+	defer clean()
+
+	path := Config().Alarm.EventsStoreFilePath
+	LastEvents = &SafeEventMap{M: make(map[string]*model.Event)}
+
+	// 文件不存在
+	InitLastEvents()
+	if n := len(LastEvents.GetAll()); n != 0 {
+		t.Errorf("expected no event, got %d", n)
+	}
+
+	for _, data := range []string{`[{"id": "s_1_abc", "eventTime": `, `{"id": "s_1_abc"}`, `[null]`} {
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		InitLastEvents()
+		if n := len(LastEvents.GetAll()); n != 0 {
+			t.Errorf("%s: expected no event, got %d", data, n)
+		}
+	}
+}
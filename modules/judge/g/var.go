@@ -1,14 +1,10 @@
 package g
 
 import (
-	"encoding/json"
-	"io/ioutil"
-	"os"
 	"sync"
 	"time"
 
 	"github.com/Cepave/open-falcon-backend/common/model"
-	log "github.com/Sirupsen/logrus"
 )
 
 type SafeStrategyMap struct {
@@ -36,42 +32,62 @@ var (
 	LastEvents    = &SafeEventMap{M: make(map[string]*model.Event)}
 )
 
-func InitHbsClient() {
-	HbsClient = &SingleConnRpcClient{
-		RpcServers: Config().Hbs.Servers,
-		Timeout:    time.Duration(Config().Hbs.Timeout) * time.Millisecond,
+// HistoryRequirement 判断函数所需的历史数据
+type HistoryRequirement struct {
+	Limit  int   // 最多的点数(#N)
+	Window int64 // 最长的时间窗口(秒)
+}
+
+func (this HistoryRequirement) Max(other HistoryRequirement) HistoryRequirement {
+	if other.Limit > this.Limit {
+		this.Limit = other.Limit
 	}
+	if other.Window > this.Window {
+		this.Window = other.Window
+	}
+	return this
 }
 
-func InitLastEvents() {
+// 每个strategy/expression的key所需的历史数据, 由当前所有的strategy/expression计算得出,
+// 只有长窗口的counter才保留更多的数据
+type SafeHistoryRequirements struct {
+	sync.RWMutex
+	Strategies  map[string]HistoryRequirement // endpoint/metric => requirement
+	Expressions map[string]HistoryRequirement // metric/tag=value => requirement
+}
 
-	if !Config().Alarm.StoreEventToFile {
-		return
-	}
+var HistoryRequirements = &SafeHistoryRequirements{
+	Strategies:  make(map[string]HistoryRequirement),
+	Expressions: make(map[string]HistoryRequirement),
+}
+
+func (this *SafeHistoryRequirements) ReInit(strategies map[string]HistoryRequirement, expressions map[string]HistoryRequirement) {
+	this.Lock()
+	defer this.Unlock()
+	this.Strategies = strategies
+	this.Expressions = expressions
+}
 
-	filepath := Config().Alarm.EventsStoreFilePath
-	_, err := os.Stat(filepath)
-	if err == nil {
-		data, err := ioutil.ReadFile(filepath)
-		if err != nil {
-			log.Error(err.Error())
-		}
-		var v []*model.Event
-		err = json.Unmarshal(data, &v)
-		if err != nil {
-			log.Error(err.Error())
-		}
-		for _, event := range v {
-			LastEvents.Set(event.Id, event)
-		}
-	} else {
-		log.Error(err.Error())
+// Of returns the requirement of the strategies and expressions which may judge the item,
+// the keys are the same as store.CheckStrategy and store.CheckExpression
+func (this *SafeHistoryRequirements) Of(item *model.JudgeItem) HistoryRequirement {
+	this.RLock()
+	defer this.RUnlock()
+
+	req := this.Strategies[item.Endpoint+"/"+item.Metric]
+	if len(this.Expressions) == 0 {
+		return req
+	}
+	for k, v := range item.Tags {
+		req = req.Max(this.Expressions[item.Metric+"/"+k+"="+v])
 	}
+	return req.Max(this.Expressions[item.Metric+"/endpoint="+item.Endpoint])
+}
 
-	if err != nil {
-		log.Error(err.Error())
-	} else if len(LastEvents.GetAll()) != 0 {
-		log.Infof("init lastEvent of %s , %d events is inserted", filepath, len(LastEvents.GetAll()))
+func InitHbsClient() {
+	HbsClient = &SingleConnRpcClient{
+		RpcServers: Config().Hbs.Servers,
+		Timeout:    time.Duration(Config().Hbs.Timeout) * time.Millisecond,
 	}
 }
 
@@ -105,6 +121,17 @@ func (this *SafeEventMap) GetAll() map[string]*model.Event {
 	return this.M
 }
 
+// Snapshot returns the copy of events, which is safe to be iterated
+func (this *SafeEventMap) Snapshot() []*model.Event {
+	this.RLock()
+	defer this.RUnlock()
+	ret := make([]*model.Event, 0, len(this.M))
+	for _, event := range this.M {
+		ret = append(ret, event)
+	}
+	return ret
+}
+
 func (this *SafeEventMap) Get(key string) (*model.Event, bool) {
 	this.RLock()
 	defer this.RUnlock()
@@ -0,0 +1,36 @@
+package g
+
+import (
+	"testing"
+
+	"github.com/Cepave/open-falcon-backend/common/model"
+)
+
+func TestHistoryRequirementsOf(t *testing.T) {
+	HistoryRequirements.ReInit(
+		map[string]HistoryRequirement{
+			"host-1/cpu.idle": {Limit: 10},
+			"host-2/cpu.idle": {Limit: 3, Window: 3600},
+		},
+		map[string]HistoryRequirement{
+			"cpu.idle/service=db":      {Limit: 20},
+			"cpu.idle/endpoint=host-3": {Window: 600},
+		},
+	)
+
+	for _, c := range []struct {
+		item     *model.JudgeItem
+		expected HistoryRequirement
+	}{
+		{&model.JudgeItem{Endpoint: "host-1", Metric: "cpu.idle"}, HistoryRequirement{Limit: 10}},
+		{&model.JudgeItem{Endpoint: "host-2", Metric: "cpu.idle", Tags: map[string]string{"service": "db"}}, HistoryRequirement{Limit: 20, Window: 3600}},
+		{&model.JudgeItem{Endpoint: "host-3", Metric: "cpu.idle"}, HistoryRequirement{Window: 600}},
+		// 其他counter不受长窗口的影响
+		{&model.JudgeItem{Endpoint: "host-1", Metric: "mem.free"}, HistoryRequirement{}},
+		{&model.JudgeItem{Endpoint: "host-4", Metric: "cpu.idle", Tags: map[string]string{"service": "web"}}, HistoryRequirement{}},
+	} {
+		if req := HistoryRequirements.Of(c.item); req != c.expected {
+			t.Errorf("%s/%s %v: expected %+v, got %+v", c.item.Endpoint, c.item.Metric, c.item.Tags, c.expected, req)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"syscall"
 
 	"github.com/Cepave/open-falcon-backend/common/logruslog"
 	"github.com/Cepave/open-falcon-backend/common/vipercfg"
@@ -33,6 +34,7 @@ func main() {
 	g.InitLastEvents()
 
 	store.InitHistoryBigMap()
+	cron.LoadState()
 
 	supervisorChn := make(chan string)
 
@@ -41,12 +43,15 @@ func main() {
 
 	go cron.SyncStrategies(supervisorChn)
 	go cron.CleanStale(supervisorChn)
+	go cron.StoreState(supervisorChn)
 
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 
 	select {
 	case sig := <-c:
+		// keep the alarm state, so the restart is invisible to alarm
+		cron.DumpState()
 		if sig.String() == "^C" {
 			os.Exit(3)
 		}
@@ -64,6 +69,9 @@ func main() {
 		} else if sup == "CleanStale" {
 			log.Errorf("%s dead will unknown reason, will restart the this rotuine", sup)
 			go cron.SyncStrategies(supervisorChn)
+		} else if sup == "StoreState" {
+			log.Errorf("%s dead will unknown reason, will restart the this rotuine", sup)
+			go cron.StoreState(supervisorChn)
 		} else {
 			log.Fatalf("got worng params of supervisorChn -> %v .", sup)
 		}
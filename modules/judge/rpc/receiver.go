@@ -18,8 +18,15 @@ func (this *Judge) Send(items []*model.JudgeItem, resp *model.SimpleRpcResponse)
 	// 把当前时间的计算放在最外层，是为了减少获取时间时的系统调用开销
 	now := time.Now().Unix()
 	for _, item := range items {
+		// 判断函数需要更多的历史数据时, 多保留一些
+		// diff(#N)需要N+1个点, COUNTER类型计算速率时还要再多一个点
+		req := g.HistoryRequirements.Of(item)
+		maxCount := remain
+		if req.Limit+2 > maxCount {
+			maxCount = req.Limit + 2
+		}
 		pk := item.PrimaryKey()
-		store.HistoryBigMap[pk[0:2]].PushFrontAndMaintain(pk, item, remain, now)
+		store.HistoryBigMap[pk[0:2]].PushFrontAndMaintain(pk, item, maxCount, req.Window, now)
 	}
 	return nil
 }
@@ -1,11 +1,11 @@
 package store
 
 import (
-	"fmt"
-	"github.com/Cepave/open-falcon-backend/common/model"
 	"math"
-	"strconv"
-	"strings"
+	"sort"
+
+	"github.com/Cepave/open-falcon-backend/common/judgefunc"
+	"github.com/Cepave/open-falcon-backend/common/model"
 )
 
 type Function interface {
@@ -15,18 +15,19 @@ type Function interface {
 type MaxFunction struct {
 	Function
 	Limit      int
+	Window     int64
 	Operator   string
 	RightValue float64
 }
 
 func (this MaxFunction) Compute(L *SafeLinkedList) (vs []*model.HistoryData, leftValue float64, isTriggered bool, isEnough bool) {
-	vs, isEnough = L.HistoryData(this.Limit)
+	vs, isEnough = historyData(L, this.Limit, this.Window)
 	if !isEnough {
 		return
 	}
 
 	max := vs[0].Value
-	for i := 1; i < this.Limit; i++ {
+	for i := 1; i < len(vs); i++ {
 		if max < vs[i].Value {
 			max = vs[i].Value
 		}
@@ -40,18 +41,19 @@ func (this MaxFunction) Compute(L *SafeLinkedList) (vs []*model.HistoryData, lef
 type MinFunction struct {
 	Function
 	Limit      int
+	Window     int64
 	Operator   string
 	RightValue float64
 }
 
 func (this MinFunction) Compute(L *SafeLinkedList) (vs []*model.HistoryData, leftValue float64, isTriggered bool, isEnough bool) {
-	vs, isEnough = L.HistoryData(this.Limit)
+	vs, isEnough = historyData(L, this.Limit, this.Window)
 	if !isEnough {
 		return
 	}
 
 	min := vs[0].Value
-	for i := 1; i < this.Limit; i++ {
+	for i := 1; i < len(vs); i++ {
 		if min > vs[i].Value {
 			min = vs[i].Value
 		}
@@ -65,18 +67,19 @@ func (this MinFunction) Compute(L *SafeLinkedList) (vs []*model.HistoryData, lef
 type AllFunction struct {
 	Function
 	Limit      int
+	Window     int64
 	Operator   string
 	RightValue float64
 }
 
 func (this AllFunction) Compute(L *SafeLinkedList) (vs []*model.HistoryData, leftValue float64, isTriggered bool, isEnough bool) {
-	vs, isEnough = L.HistoryData(this.Limit)
+	vs, isEnough = historyData(L, this.Limit, this.Window)
 	if !isEnough {
 		return
 	}
 
 	isTriggered = true
-	for i := 0; i < this.Limit; i++ {
+	for i := 0; i < len(vs); i++ {
 		isTriggered = checkIsTriggered(vs[i].Value, this.Operator, this.RightValue)
 		if !isTriggered {
 			break
@@ -90,18 +93,19 @@ func (this AllFunction) Compute(L *SafeLinkedList) (vs []*model.HistoryData, lef
 type SumFunction struct {
 	Function
 	Limit      int
+	Window     int64
 	Operator   string
 	RightValue float64
 }
 
 func (this SumFunction) Compute(L *SafeLinkedList) (vs []*model.HistoryData, leftValue float64, isTriggered bool, isEnough bool) {
-	vs, isEnough = L.HistoryData(this.Limit)
+	vs, isEnough = historyData(L, this.Limit, this.Window)
 	if !isEnough {
 		return
 	}
 
 	sum := 0.0
-	for i := 0; i < this.Limit; i++ {
+	for i := 0; i < len(vs); i++ {
 		sum += vs[i].Value
 	}
 
@@ -113,22 +117,23 @@ func (this SumFunction) Compute(L *SafeLinkedList) (vs []*model.HistoryData, lef
 type AvgFunction struct {
 	Function
 	Limit      int
+	Window     int64
 	Operator   string
 	RightValue float64
 }
 
 func (this AvgFunction) Compute(L *SafeLinkedList) (vs []*model.HistoryData, leftValue float64, isTriggered bool, isEnough bool) {
-	vs, isEnough = L.HistoryData(this.Limit)
+	vs, isEnough = historyData(L, this.Limit, this.Window)
 	if !isEnough {
 		return
 	}
 
 	sum := 0.0
-	for i := 0; i < this.Limit; i++ {
+	for i := 0; i < len(vs); i++ {
 		sum += vs[i].Value
 	}
 
-	leftValue = sum / float64(this.Limit)
+	leftValue = sum / float64(len(vs))
 	isTriggered = checkIsTriggered(leftValue, this.Operator, this.RightValue)
 	return
 }
@@ -206,34 +211,194 @@ func (this PDiffFunction) Compute(L *SafeLinkedList) (vs []*model.HistoryData, l
 	return
 }
 
-// @str: e.g. all(#3) sum(#3) avg(#10) diff(#10)
+// PercentileFunction: p95(#10), p99(15m)
+type PercentileFunction struct {
+	Function
+	Limit      int
+	Window     int64
+	Percentile float64
+	Operator   string
+	RightValue float64
+}
+
+func (this PercentileFunction) Compute(L *SafeLinkedList) (vs []*model.HistoryData, leftValue float64, isTriggered bool, isEnough bool) {
+	vs, isEnough = historyData(L, this.Limit, this.Window)
+	if !isEnough {
+		return
+	}
+
+	values := make([]float64, len(vs))
+	for i, v := range vs {
+		values[i] = v.Value
+	}
+	sort.Float64s(values)
+
+	// nearest-rank method
+	rank := int(math.Ceil(this.Percentile / 100.0 * float64(len(values))))
+	if rank < 1 {
+		rank = 1
+	}
+
+	leftValue = values[rank-1]
+	isTriggered = checkIsTriggered(leftValue, this.Operator, this.RightValue)
+	return
+}
+
+// StddevFunction: stddev(#10), stddev(10m)
+type StddevFunction struct {
+	Function
+	Limit      int
+	Window     int64
+	Operator   string
+	RightValue float64
+}
+
+func (this StddevFunction) Compute(L *SafeLinkedList) (vs []*model.HistoryData, leftValue float64, isTriggered bool, isEnough bool) {
+	vs, isEnough = historyData(L, this.Limit, this.Window)
+	if !isEnough {
+		return
+	}
+
+	size := float64(len(vs))
+	sum := 0.0
+	for _, v := range vs {
+		sum += v.Value
+	}
+	mean := sum / size
+
+	variance := 0.0
+	for _, v := range vs {
+		variance += (v.Value - mean) * (v.Value - mean)
+	}
+
+	leftValue = math.Sqrt(variance / size)
+	isTriggered = checkIsTriggered(leftValue, this.Operator, this.RightValue)
+	return
+}
+
+// CountOverFunction: count_over(#5,>,90) >= 3, 至少有3个点大于90
+type CountOverFunction struct {
+	Function
+	Limit         int
+	Window        int64
+	PointOperator string
+	PointValue    float64
+	Operator      string
+	RightValue    float64
+}
+
+func (this CountOverFunction) Compute(L *SafeLinkedList) (vs []*model.HistoryData, leftValue float64, isTriggered bool, isEnough bool) {
+	vs, isEnough = historyData(L, this.Limit, this.Window)
+	if !isEnough {
+		return
+	}
+
+	count := 0
+	for _, v := range vs {
+		if checkIsTriggered(v.Value, this.PointOperator, this.PointValue) {
+			count++
+		}
+	}
+
+	leftValue = float64(count)
+	isTriggered = checkIsTriggered(leftValue, this.Operator, this.RightValue)
+	return
+}
+
+// SlopeFunction: slope(10m), 每秒的变化量(最小二乘法线性回归)
+type SlopeFunction struct {
+	Function
+	Limit      int
+	Window     int64
+	Operator   string
+	RightValue float64
+}
+
+func (this SlopeFunction) Compute(L *SafeLinkedList) (vs []*model.HistoryData, leftValue float64, isTriggered bool, isEnough bool) {
+	vs, isEnough = historyData(L, this.Limit, this.Window)
+	if !isEnough {
+		return
+	}
+
+	if len(vs) < 2 {
+		isEnough = false
+		return
+	}
+
+	// 以最新点的时间为原点, 避免时间戳过大损失精度
+	base := vs[0].Timestamp
+	size := float64(len(vs))
+	var sumX, sumY, sumXY, sumXX float64
+	for _, v := range vs {
+		x := float64(v.Timestamp - base)
+		sumX += x
+		sumY += v.Value
+		sumXY += x * v.Value
+		sumXX += x * x
+	}
+
+	denominator := size*sumXX - sumX*sumX
+	if denominator == 0 {
+		isEnough = false
+		return
+	}
+
+	leftValue = (size*sumXY - sumX*sumY) / denominator
+	isTriggered = checkIsTriggered(leftValue, this.Operator, this.RightValue)
+	return
+}
+
+// 按点数(#N)或者时间窗口获取历史数据
+func historyData(L *SafeLinkedList, limit int, window int64) ([]*model.HistoryData, bool) {
+	if window > 0 {
+		return L.HistoryDataByDuration(window)
+	}
+	return L.HistoryData(limit)
+}
+
+// @str: e.g. all(#3) sum(#3) avg(#10) diff(#10) avg(5m) p95(#10) stddev(10m) count_over(#5,>,90) slope(10m)
 func ParseFuncFromString(str string, operator string, rightValue float64) (fn Function, err error) {
-	idx := strings.Index(str, "#")
-	limit, err := strconv.ParseInt(str[idx+1:len(str)-1], 10, 64)
+	spec, err := judgefunc.Parse(str)
 	if err != nil {
 		return nil, err
 	}
 
-	switch str[:idx-1] {
-	case "max":
-		fn = &MaxFunction{Limit: int(limit), Operator: operator, RightValue: rightValue}
-	case "min":
-		fn = &MinFunction{Limit: int(limit), Operator: operator, RightValue: rightValue}
-	case "all":
-		fn = &AllFunction{Limit: int(limit), Operator: operator, RightValue: rightValue}
-	case "sum":
-		fn = &SumFunction{Limit: int(limit), Operator: operator, RightValue: rightValue}
-	case "avg":
-		fn = &AvgFunction{Limit: int(limit), Operator: operator, RightValue: rightValue}
-	case "diff":
-		fn = &DiffFunction{Limit: int(limit), Operator: operator, RightValue: rightValue}
-	case "pdiff":
-		fn = &PDiffFunction{Limit: int(limit), Operator: operator, RightValue: rightValue}
-	default:
-		err = fmt.Errorf("not_supported_method")
+	return NewFunction(spec, operator, rightValue), nil
+}
+
+func NewFunction(spec *judgefunc.Spec, operator string, rightValue float64) Function {
+	limit, window := spec.Limit, spec.Window
+
+	switch spec.Name {
+	case judgefunc.Max:
+		return &MaxFunction{Limit: limit, Window: window, Operator: operator, RightValue: rightValue}
+	case judgefunc.Min:
+		return &MinFunction{Limit: limit, Window: window, Operator: operator, RightValue: rightValue}
+	case judgefunc.All:
+		return &AllFunction{Limit: limit, Window: window, Operator: operator, RightValue: rightValue}
+	case judgefunc.Sum:
+		return &SumFunction{Limit: limit, Window: window, Operator: operator, RightValue: rightValue}
+	case judgefunc.Avg:
+		return &AvgFunction{Limit: limit, Window: window, Operator: operator, RightValue: rightValue}
+	case judgefunc.Diff:
+		return &DiffFunction{Limit: limit, Operator: operator, RightValue: rightValue}
+	case judgefunc.PDiff:
+		return &PDiffFunction{Limit: limit, Operator: operator, RightValue: rightValue}
+	case judgefunc.Percentile:
+		return &PercentileFunction{Limit: limit, Window: window, Percentile: spec.Percentile, Operator: operator, RightValue: rightValue}
+	case judgefunc.Stddev:
+		return &StddevFunction{Limit: limit, Window: window, Operator: operator, RightValue: rightValue}
+	case judgefunc.CountOver:
+		return &CountOverFunction{
+			Limit: limit, Window: window,
+			PointOperator: spec.Operator, PointValue: spec.Value,
+			Operator: operator, RightValue: rightValue,
+		}
+	case judgefunc.Slope:
+		return &SlopeFunction{Limit: limit, Window: window, Operator: operator, RightValue: rightValue}
 	}
 
-	return
+	return nil
 }
 
 func checkIsTriggered(leftValue float64, operator string, rightValue float64) (isTriggered bool) {
@@ -0,0 +1,145 @@
+package store
+
+import (
+	"container/list"
+	"math"
+	"testing"
+
+	"github.com/Cepave/open-falcon-backend/common/model"
+)
+
+// newTestList returns the history of GAUGE points, one point per minute, the last value is the newest
+func newTestList(values ...float64) *SafeLinkedList {
+	L := &SafeLinkedList{L: list.New()}
+	for i, v := range values {
+		L.PushFront(&model.JudgeItem{JudgeType: "GAUGE", Timestamp: 1500000000 + int64(i)*60, Value: v})
+	}
+	return L
+}
+
+func compute(t *testing.T, str string, L *SafeLinkedList) (leftValue float64, isEnough bool) {
+	fn, err := ParseFuncFromString(str, ">", 0)
+	if err != nil {
+		t.Fatalf("parse %s fail: %v", str, err)
+	}
+	_, leftValue, _, isEnough = fn.Compute(L)
+	return
+}
+
+func TestComputeByLimit(t *testing.T) {
+	L := newTestList(1, 2, 3, 4, 5, 6, 7, 8, 9, 10)
+
+	for _, c := range []struct {
+		fn       string
+		expected float64
+	}{
+		{"p95(#10)", 10},
+		{"p50(#10)", 5},
+		{"p10(#10)", 1},
+		{"p50(#4)", 8}, // 7, 8, 9, 10
+		{"count_over(#5,>,7)", 3},
+		{"count_over(#5,<=,6)", 1},
+		{"slope(#10)", 1.0 / 60},
+		{"avg(#4)", 8.5},
+		{"max(#3)", 10},
+	} {
+		leftValue, isEnough := compute(t, c.fn, L)
+		if !isEnough || math.Abs(leftValue-c.expected) > 1e-9 {
+			t.Errorf("%s: expected %v, got %v(enough: %v)", c.fn, c.expected, leftValue, isEnough)
+		}
+	}
+
+	if _, isEnough := compute(t, "p95(#20)", L); isEnough {
+		t.Error("p95(#20) should not be enough with 10 points")
+	}
+}
+
+func TestComputeStddev(t *testing.T) {
+	leftValue, isEnough := compute(t, "stddev(#8)", newTestList(2, 4, 4, 4, 5, 5, 7, 9))
+	if !isEnough || math.Abs(leftValue-2) > 1e-9 {
+		t.Errorf("expected 2, got %v(enough: %v)", leftValue, isEnough)
+	}
+	leftValue, isEnough = compute(t, "stddev(#3)", newTestList(5, 5, 5))
+	if !isEnough || leftValue != 0 {
+		t.Errorf("expected 0, got %v(enough: %v)", leftValue, isEnough)
+	}
+}
+
+func TestComputeSlope(t *testing.T) {
+	// 每分钟下降3
+	leftValue, isEnough := compute(t, "slope(10m)", newTestList(100, 97, 94, 91, 88, 85, 82, 79, 76, 73, 70, 67))
+	if !isEnough || math.Abs(leftValue+3.0/60) > 1e-9 {
+		t.Errorf("expected %v, got %v(enough: %v)", -3.0/60, leftValue, isEnough)
+	}
+
+	// 窗口内少于2个点无法计算斜率
+	if _, isEnough := compute(t, "slope(30s)", newTestList(1, 2)); isEnough {
+		t.Error("slope of 1 point should not be enough")
+	}
+}
+
+func TestComputeByWindow(t *testing.T) {
+	// 11个点, 覆盖了10分钟
+	L := newTestList(0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10)
+
+	for _, c := range []struct {
+		fn       string
+		expected float64
+	}{
+		{"avg(5m)", 8},  // 6, 7, 8, 9, 10
+		{"sum(3m)", 27}, // 8, 9, 10
+		{"min(10m)", 1}, // 窗口之外的点不计算在内
+		{"p50(5m)", 8},  // 6, 7, 8, 9, 10
+		{"count_over(5m,>,7)", 3},
+		{"stddev(2m)", 0.5},
+		{"slope(5m)", 1.0 / 60},
+	} {
+		leftValue, isEnough := compute(t, c.fn, L)
+		if !isEnough || math.Abs(leftValue-c.expected) > 1e-9 {
+			t.Errorf("%s: expected %v, got %v(enough: %v)", c.fn, c.expected, leftValue, isEnough)
+		}
+	}
+
+	// 历史数据未覆盖整个窗口
+	for _, fn := range []string{"avg(601s)", "max(15m)", "p95(1h)", "slope(11m)"} {
+		if _, isEnough := compute(t, fn, L); isEnough {
+			t.Errorf("%s should not be enough", fn)
+		}
+	}
+}
+
+func TestComputeCounterByWindow(t *testing.T) {
+	// COUNTER按速率计算, 每分钟增加120, 即每秒2
+	L := &SafeLinkedList{L: list.New()}
+	for i := int64(0); i <= 10; i++ {
+		L.PushFront(&model.JudgeItem{JudgeType: "COUNTER", Timestamp: 1500000000 + i*60, Value: float64(i * 120)})
+	}
+	leftValue, isEnough := compute(t, "avg(5m)", L)
+	if !isEnough || math.Abs(leftValue-2) > 1e-9 {
+		t.Errorf("expected 2, got %v(enough: %v)", leftValue, isEnough)
+	}
+}
+
+func TestPushFrontAndMaintain(t *testing.T) {
+	L := &SafeLinkedList{L: list.New()}
+	for i := int64(0); i < 20; i++ {
+		L.PushFrontAndMaintain(&model.JudgeItem{JudgeType: "GAUGE", Timestamp: 1500000000 + i*60, Value: 1}, 3, 300)
+	}
+	// 5分钟之内的5个点, 再加上窗口之外的一个点
+	if L.Len() != 6 {
+		t.Errorf("expected 6 points, got %d", L.Len())
+	}
+	if _, isEnough := compute(t, "avg(5m)", L); !isEnough {
+		t.Error("avg(5m) should be enough")
+	}
+
+	if L.PushFrontAndMaintain(&model.JudgeItem{JudgeType: "GAUGE", Timestamp: 1500000000, Value: 1}, 3, 300) {
+		t.Error("the old point should be dropped")
+	}
+
+	// 不按时间窗口时, 只保留maxCount个点
+	L.PushFrontAndMaintain(&model.JudgeItem{JudgeType: "GAUGE", Timestamp: 1600000000, Value: 1}, 3, 0)
+	if L.Len() != 3 {
+		t.Errorf("expected 3 points, got %d", L.Len())
+	}
+}
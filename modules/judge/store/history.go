@@ -72,9 +72,9 @@ func (this *JudgeItemMap) CleanStale(before int64) {
 	this.BatchDelete(keys)
 }
 
-func (this *JudgeItemMap) PushFrontAndMaintain(key string, val *model.JudgeItem, maxCount int, now int64) {
+func (this *JudgeItemMap) PushFrontAndMaintain(key string, val *model.JudgeItem, maxCount int, maxAge int64, now int64) {
 	if linkedList, exists := this.Get(key); exists {
-		needJudge := linkedList.PushFrontAndMaintain(val, maxCount)
+		needJudge := linkedList.PushFrontAndMaintain(val, maxCount, maxAge)
 		if needJudge {
 			Judge(linkedList, val, now)
 		}
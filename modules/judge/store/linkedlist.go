@@ -92,14 +92,69 @@ func (this *SafeLinkedList) HistoryData(limit int) ([]*model.HistoryData, bool)
 	return vs, isEnough
 }
 
+// @param window 时间窗口(秒), 返回最新点之前window秒内的数据
+// @return bool isEnough 历史数据是否覆盖了整个时间窗口
+func (this *SafeLinkedList) HistoryDataByDuration(window int64) ([]*model.HistoryData, bool) {
+	if window < 1 {
+		return []*model.HistoryData{}, false
+	}
+
+	this.RLock()
+	defer this.RUnlock()
+
+	firstElement := this.L.Front()
+	if firstElement == nil {
+		return []*model.HistoryData{}, false
+	}
+
+	firstItem := firstElement.Value.(*model.JudgeItem)
+	startTs := firstItem.Timestamp - window
+	judgeType := firstItem.JudgeType[0]
+	isGauge := judgeType == 'G' || judgeType == 'g'
+
+	vs := []*model.HistoryData{}
+	isEnough := false
+	for currentElement := firstElement; currentElement != nil; currentElement = currentElement.Next() {
+		currentItem := currentElement.Value.(*model.JudgeItem)
+		if currentItem.Timestamp <= startTs {
+			// 有窗口之外的点, 说明历史数据已经覆盖了整个窗口
+			isEnough = true
+			break
+		}
+
+		if isGauge {
+			vs = append(vs, &model.HistoryData{Timestamp: currentItem.Timestamp, Value: currentItem.Value})
+			continue
+		}
+
+		nextElement := currentElement.Next()
+		if nextElement == nil {
+			break
+		}
+		nextItem := nextElement.Value.(*model.JudgeItem)
+		vs = append(vs, &model.HistoryData{
+			Timestamp: currentItem.Timestamp,
+			Value:     (currentItem.Value - nextItem.Value) / float64(currentItem.Timestamp-nextItem.Timestamp),
+		})
+	}
+
+	if len(vs) == 0 {
+		isEnough = false
+	}
+
+	return vs, isEnough
+}
+
 func (this *SafeLinkedList) PushFront(v interface{}) *list.Element {
 	this.Lock()
 	defer this.Unlock()
 	return this.L.PushFront(v)
 }
 
+// @param maxCount 至少保留的点数
+// @param maxAge 至少保留的时间窗口(秒), 窗口之外再多保留一个点, 用于判断历史数据是否覆盖了整个窗口
 // @return needJudge 如果是false不需要做judge，因为新上来的数据不合法
-func (this *SafeLinkedList) PushFrontAndMaintain(v *model.JudgeItem, maxCount int) bool {
+func (this *SafeLinkedList) PushFrontAndMaintain(v *model.JudgeItem, maxCount int, maxAge int64) bool {
 	this.Lock()
 	defer this.Unlock()
 
@@ -118,9 +173,15 @@ func (this *SafeLinkedList) PushFrontAndMaintain(v *model.JudgeItem, maxCount in
 		return true
 	}
 
-	del := sz - maxCount
-	for i := 0; i < del; i++ {
+	startTs := v.Timestamp - maxAge
+	for sz > maxCount {
+		// 倒数第二个点已经在窗口之外, 最后一个点就不再需要了
+		prev := this.L.Back().Prev()
+		if maxAge > 0 && prev != nil && prev.Value.(*model.JudgeItem).Timestamp > startTs {
+			break
+		}
 		this.L.Remove(this.L.Back())
+		sz--
 	}
 
 	return true
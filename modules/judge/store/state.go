@@ -0,0 +1,78 @@
+package store
+
+import (
+	"container/list"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+
+	"github.com/Cepave/open-falcon-backend/common/model"
+	"github.com/Cepave/open-falcon-backend/modules/judge/g"
+	log "github.com/Sirupsen/logrus"
+)
+
+// StoreHistory dumps the history of all counters into file,
+// the format is pk => [newest item, ..., oldest item]
+func StoreHistory(path string) error {
+	history := make(map[string][]*model.JudgeItem)
+	for _, itemMap := range HistoryBigMap {
+		itemMap.RLock()
+		for key, L := range itemMap.M {
+			if items := L.ToSlice(); len(items) > 0 {
+				history[key] = items
+			}
+		}
+		itemMap.RUnlock()
+	}
+
+	data, err := json.Marshal(history)
+	if err != nil {
+		return err
+	}
+	return g.WriteFileAtomically(path, data)
+}
+
+// LoadHistory restores the history of counters from file, items older than before are discarded.
+// HistoryBigMap must be initialized before calling this function.
+func LoadHistory(path string, before int64) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Errorf("read history file %s fail: %v", path, err)
+		}
+		return
+	}
+
+	var history map[string][]*model.JudgeItem
+	if err := json.Unmarshal(data, &history); err != nil {
+		log.Errorf("parse history file %s fail: %v", path, err)
+		return
+	}
+
+	loaded := 0
+	for key, items := range history {
+		if len(key) < 2 {
+			continue
+		}
+		itemMap, ok := HistoryBigMap[key[0:2]]
+		if !ok {
+			continue
+		}
+
+		L := list.New()
+		for _, item := range items {
+			if item == nil || item.Timestamp < before {
+				break
+			}
+			L.PushBack(item)
+		}
+		if L.Len() == 0 {
+			continue
+		}
+
+		itemMap.Set(key, &SafeLinkedList{L: L})
+		loaded++
+	}
+
+	log.Infof("init history of %s, %d counters is inserted", path, loaded)
+}
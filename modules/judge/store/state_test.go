@@ -0,0 +1,88 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Cepave/open-falcon-backend/common/model"
+)
+
+func initTestHistory() {
+	HistoryBigMap = make(map[string]*JudgeItemMap)
+	InitHistoryBigMap()
+}
+
+func TestHistoryRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "judge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "history.json")
+
+	initTestHistory()
+	HistoryBigMap["ab"].Set("ab01", newTestList(1, 2, 3, 4))
+	HistoryBigMap["cd"].Set("cd01", newTestList(5))
+	if err := StoreHistory(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// 1500000000之后的点: 2, 3, 4
+	initTestHistory()
+	LoadHistory(path, 1500000060)
+	L, ok := HistoryBigMap["ab"].Get("ab01")
+	if !ok {
+		t.Fatal("the history of ab01 is not loaded")
+	}
+	items := L.ToSlice()
+	if len(items) != 3 || items[0].Value != 4 || items[2].Value != 2 || items[2].Timestamp != 1500000060 {
+		t.Errorf("unexpected items: %v", items)
+	}
+	// 全部过期的counter不加载
+	if _, ok := HistoryBigMap["cd"].Get("cd01"); ok {
+		t.Error("the expired history of cd01 should be discarded")
+	}
+}
+
+func TestLoadCorruptHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "judge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "history.json")
+
+	initTestHistory()
+	LoadHistory(path, 0)
+
+	for _, data := range []string{
+		`{"ab01": [{"timestamp": 1500000000`,
+		`["ab01"]`,
+		// 无效的key和空的历史数据被忽略
+		`{"a": [{"timestamp": 1500000000}], "zz01": [{"timestamp": 1500000000}], "ab01": [], "cd01": [null]}`,
+	} {
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		LoadHistory(path, 0)
+		for prefix, itemMap := range HistoryBigMap {
+			if n := itemMap.Len(); n != 0 {
+				t.Errorf("%s: expected no history in %s, got %d", data, prefix, n)
+			}
+		}
+	}
+
+	var item *model.JudgeItem
+	if err := ioutil.WriteFile(path, []byte(`{"ab01": [{"timestamp": 1500000000, "value": 1}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	LoadHistory(path, 0)
+	if L, ok := HistoryBigMap["ab"].Get("ab01"); ok {
+		item = L.ToSlice()[0]
+	}
+	if item == nil || item.Value != 1 {
+		t.Errorf("unexpected item: %v", item)
+	}
+}
@@ -2,6 +2,7 @@ package g
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
 	"sync"
@@ -43,6 +44,15 @@ type GraphConfig struct {
 	MaxIdle     int32             `json:"maxIdle"`
 	Replicas    int32             `json:"replicas"`
 	Cluster     map[string]string `json:"cluster"`
+	HedgeDelay  int32             `json:"hedgeDelay"` // 单位是毫秒, 查询副本的间隔
+	Version     int               `json:"version"`
+	Next        *GraphRingConfig  `json:"next"` // 扩容graph时的新环, 当前环查不到数据时从新环查询
+}
+
+type GraphRingConfig struct {
+	Version  int               `json:"version"`
+	Replicas int32             `json:"replicas"`
+	Cluster  map[string]string `json:"cluster"`
 }
 
 type ApiConfig struct {
@@ -161,3 +171,38 @@ func ParseConfig(cfg string) {
 	logger.InitLogger(c.Debug)
 	log.Println("g.ParseConfig ok, file", cfg)
 }
+
+// ReadGraphRings reads the rings of graph from the config file again, for reloading
+func ReadGraphRings() (*GraphConfig, error) {
+	configContent, err := file.ToTrimString(ConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	var c struct {
+		Graph *GraphConfig `json:"graph"`
+	}
+	if err := json.Unmarshal([]byte(configContent), &c); err != nil {
+		return nil, err
+	}
+	if c.Graph == nil || len(c.Graph.Cluster) == 0 {
+		return nil, fmt.Errorf("no graph cluster in config file")
+	}
+	if next := c.Graph.Next; next != nil && (next.Version <= c.Graph.Version || len(next.Cluster) == 0) {
+		return nil, fmt.Errorf("next graph ring must have nodes and a version greater than %d", c.Graph.Version)
+	}
+	return c.Graph, nil
+}
+
+// SetGraphRings replaces the rings of graph in the global config, the other fields of graph are kept
+func SetGraphRings(rings *GraphConfig) {
+	configLock.Lock()
+	defer configLock.Unlock()
+	c := *config
+	graph := *c.Graph
+	graph.Version = rings.Version
+	graph.Replicas = rings.Replicas
+	graph.Cluster = rings.Cluster
+	graph.Next = rings.Next
+	c.Graph = &graph
+	config = &c
+}
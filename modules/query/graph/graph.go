@@ -4,11 +4,14 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"strings"
+	"sync"
 	"time"
 
 	cmodel "github.com/Cepave/open-falcon-backend/common/model"
 	cutils "github.com/Cepave/open-falcon-backend/common/utils"
 	"github.com/Cepave/open-falcon-backend/modules/query/g"
+	"github.com/Cepave/open-falcon-backend/modules/query/proc"
 	log "github.com/Sirupsen/logrus"
 	rings "github.com/toolkits/consistent/rings"
 	nset "github.com/toolkits/container/set"
@@ -21,10 +24,22 @@ var (
 	GraphConnPools *spool.SafeRpcConnPools
 )
 
-// 服务节点的一致性哈希环
+// 副本未在hedgeDelay内返回时, 查询下一个副本
+const DefaultHedgeDelay = 100 * time.Millisecond
+
+// 服务节点的一致性哈希环和环上的节点, 重新加载时整体替换
 // pk -> node
+type nodeRings struct {
+	ring    *rings.ConsistentHashNodeRing
+	cluster map[string]string
+	// 扩容graph时的新环, 没有扩容时为nil
+	next        *rings.ConsistentHashNodeRing
+	nextCluster map[string]string
+}
+
 var (
-	GraphNodeRing *rings.ConsistentHashNodeRing
+	graphRings     *nodeRings
+	graphRingsLock = new(sync.RWMutex)
 )
 
 func Start() {
@@ -41,13 +56,97 @@ func Start() {
 }
 
 func QueryOne(para cmodel.GraphQueryParam) (resp *cmodel.GraphQueryResponse, err error) {
-	start, end := para.Start, para.End
-	endpoint, counter := para.Endpoint, para.Counter
-
-	pool, addr, err := selectPool(endpoint, counter)
+	r := currentNodeRings()
+	addrs, err := selectAddrs(r.ring, r.cluster, para.Endpoint, para.Counter)
 	if err != nil {
 		return nil, err
 	}
+	resp, err = queryReplicas(addrs, para)
+
+	// 扩容graph时, 数据可能已经在新环的节点上
+	if (err != nil || len(resp.Values) == 0) && r.next != nil {
+		nextAddrs, nextErr := selectAddrs(r.next, r.nextCluster, para.Endpoint, para.Counter)
+		if nextErr != nil || strings.Join(nextAddrs, ",") == strings.Join(addrs, ",") {
+			return resp, err
+		}
+		if nextResp, nextErr := queryReplicas(nextAddrs, para); nextErr == nil && len(nextResp.Values) > 0 {
+			return nextResp, nil
+		}
+	}
+	return resp, err
+}
+
+// queryReplicas queries the replicas of a graph node by hedged requests: the next replica is queried
+// if the previous ones fail, return missing points or do not respond in hedgeDelay.
+// The series without missing points is returned at once, otherwise the series of the replicas are merged.
+func queryReplicas(addrs []string, para cmodel.GraphQueryParam) (*cmodel.GraphQueryResponse, error) {
+	type ChResult struct {
+		Err  error
+		Resp *cmodel.GraphQueryResponse
+	}
+	ch := make(chan *ChResult, len(addrs))
+	launched, pending := 0, 0
+	launch := func() {
+		addr := addrs[launched]
+		launched++
+		pending++
+		go func() {
+			pool, found := GraphConnPools.Get(addr)
+			if !found {
+				ch <- &ChResult{Err: fmt.Errorf("%s, addr not found", addr)}
+				return
+			}
+			resp, err := queryOne(pool, addr, para)
+			ch <- &ChResult{Err: err, Resp: resp}
+		}()
+	}
+
+	hedgeDelay := time.Duration(g.Config().Graph.HedgeDelay) * time.Millisecond
+	if hedgeDelay <= 0 {
+		hedgeDelay = DefaultHedgeDelay
+	}
+	hedge := time.NewTimer(hedgeDelay)
+	defer hedge.Stop()
+
+	var (
+		best    *cmodel.GraphQueryResponse
+		lastErr error
+	)
+	launch()
+	for pending > 0 {
+		select {
+		case <-hedge.C:
+			if launched < len(addrs) {
+				proc.GraphHedgedQueryCnt.Incr()
+				launch()
+				hedge.Reset(hedgeDelay)
+			}
+		case r := <-ch:
+			pending--
+			if r.Err != nil {
+				lastErr = r.Err
+			} else {
+				if best != nil {
+					proc.GraphReplicaMergeCnt.Incr()
+				}
+				if best = mergeSeries(best, r.Resp); isComplete(best, time.Now().Unix()) {
+					return best, nil
+				}
+			}
+			if launched < len(addrs) {
+				proc.GraphHedgedQueryCnt.Incr()
+				launch()
+			}
+		}
+	}
+	if best == nil {
+		return nil, lastErr
+	}
+	return best, nil
+}
+
+func queryOne(pool *spool.ConnPool, addr string, para cmodel.GraphQueryParam) (resp *cmodel.GraphQueryResponse, err error) {
+	start, end := para.Start, para.End
 
 	conn, err := pool.Fetch()
 	if err != nil {
@@ -161,58 +260,35 @@ func Info(para cmodel.GraphInfoParam) (resp *cmodel.GraphFullyInfo, err error) {
 }
 
 func Last(para cmodel.GraphLastParam) (r *cmodel.GraphLastResp, err error) {
-	endpoint, counter := para.Endpoint, para.Counter
+	return lastReplicas("Graph.Last", para)
+}
 
-	pool, addr, err := selectPool(endpoint, counter)
-	if err != nil {
-		return nil, err
-	}
+func LastRaw(para cmodel.GraphLastParam) (r *cmodel.GraphLastResp, err error) {
+	return lastReplicas("Graph.LastRaw", para)
+}
 
-	conn, err := pool.Fetch()
+// lastReplicas tries the replicas of the graph node one by one, until one of them returns the last item
+func lastReplicas(method string, para cmodel.GraphLastParam) (r *cmodel.GraphLastResp, err error) {
+	nr := currentNodeRings()
+	addrs, err := selectAddrs(nr.ring, nr.cluster, para.Endpoint, para.Counter)
 	if err != nil {
 		return nil, err
 	}
 
-	rpcConn := conn.(spool.RpcClient)
-	if rpcConn.Closed() {
-		pool.ForceClose(conn)
-		return nil, errors.New("conn closed")
-	}
-
-	type ChResult struct {
-		Err  error
-		Resp *cmodel.GraphLastResp
-	}
-	ch := make(chan *ChResult, 1)
-	go func() {
-		resp := &cmodel.GraphLastResp{}
-		err := rpcConn.Call("Graph.Last", para, resp)
-		ch <- &ChResult{Err: err, Resp: resp}
-	}()
-
-	select {
-	case <-time.After(time.Duration(g.Config().Graph.CallTimeout) * time.Millisecond):
-		pool.ForceClose(conn)
-		return nil, fmt.Errorf("%s, call timeout. proc: %s", addr, pool.Proc())
-	case r := <-ch:
-		if r.Err != nil {
-			pool.ForceClose(conn)
-			return r.Resp, fmt.Errorf("%s, call failed, err %v. proc: %s", addr, r.Err, pool.Proc())
-		} else {
-			pool.Release(conn)
-			return r.Resp, nil
+	for _, addr := range addrs {
+		pool, found := GraphConnPools.Get(addr)
+		if !found {
+			err = fmt.Errorf("%s, addr not found", addr)
+			continue
+		}
+		if r, err = lastOne(pool, addr, method, para); err == nil && r.Value != nil {
+			return r, nil
 		}
 	}
+	return r, err
 }
 
-func LastRaw(para cmodel.GraphLastParam) (r *cmodel.GraphLastResp, err error) {
-	endpoint, counter := para.Endpoint, para.Counter
-
-	pool, addr, err := selectPool(endpoint, counter)
-	if err != nil {
-		return nil, err
-	}
-
+func lastOne(pool *spool.ConnPool, addr string, method string, para cmodel.GraphLastParam) (r *cmodel.GraphLastResp, err error) {
 	conn, err := pool.Fetch()
 	if err != nil {
 		return nil, err
@@ -231,7 +307,7 @@ func LastRaw(para cmodel.GraphLastParam) (r *cmodel.GraphLastResp, err error) {
 	ch := make(chan *ChResult, 1)
 	go func() {
 		resp := &cmodel.GraphLastResp{}
-		err := rpcConn.Call("Graph.LastRaw", para, resp)
+		err := rpcConn.Call(method, para, resp)
 		ch <- &ChResult{Err: err, Resp: resp}
 	}()
 
@@ -250,40 +326,110 @@ func LastRaw(para cmodel.GraphLastParam) (r *cmodel.GraphLastResp, err error) {
 	}
 }
 
+// selectPool selects the pool of the first replica of the graph node
 func selectPool(endpoint, counter string) (rpool *spool.ConnPool, raddr string, rerr error) {
-	pkey := cutils.PK2(endpoint, counter)
-	node, err := GraphNodeRing.GetNode(pkey)
+	r := currentNodeRings()
+	addrs, err := selectAddrs(r.ring, r.cluster, endpoint, counter)
 	if err != nil {
 		return nil, "", err
 	}
 
-	addr, found := g.Config().Graph.Cluster[node]
+	pool, found := GraphConnPools.Get(addrs[0])
 	if !found {
-		return nil, "", errors.New("node not found")
+		return nil, addrs[0], errors.New("addr not found")
 	}
 
-	pool, found := GraphConnPools.Get(addr)
-	if !found {
-		return nil, addr, errors.New("addr not found")
+	return pool, addrs[0], nil
+}
+
+// selectAddrs selects the addresses of all the replicas of the graph node
+func selectAddrs(ring *rings.ConsistentHashNodeRing, cluster map[string]string, endpoint, counter string) ([]string, error) {
+	node, err := ring.GetNode(cutils.PK2(endpoint, counter))
+	if err != nil {
+		return nil, err
 	}
 
-	return pool, addr, nil
+	addrs := splitAddrs(cluster[node])
+	if len(addrs) == 0 {
+		return nil, errors.New("node not found")
+	}
+	return addrs, nil
 }
 
 // internal functions
 func initConnPools() {
 	cfg := g.Config()
+	GraphConnPools = spool.CreateSafeRpcConnPools(cfg.Graph.MaxConns, cfg.Graph.MaxIdle,
+		cfg.Graph.ConnTimeout, cfg.Graph.CallTimeout, graphAddrs(cfg.Graph))
+}
 
+// graphAddrs returns the addresses of all the replicas in the current ring and the next ring
+func graphAddrs(cfg *g.GraphConfig) []string {
 	// TODO 为了得到Slice,这里做的太复杂了
 	graphInstances := nset.NewSafeSet()
-	for _, address := range cfg.Graph.Cluster {
-		graphInstances.Add(address)
+	for _, addrs := range cfg.Cluster {
+		for _, address := range splitAddrs(addrs) {
+			graphInstances.Add(address)
+		}
 	}
-	GraphConnPools = spool.CreateSafeRpcConnPools(cfg.Graph.MaxConns, cfg.Graph.MaxIdle,
-		cfg.Graph.ConnTimeout, cfg.Graph.CallTimeout, graphInstances.ToSlice())
+	if cfg.Next != nil {
+		for _, addrs := range cfg.Next.Cluster {
+			for _, address := range splitAddrs(addrs) {
+				graphInstances.Add(address)
+			}
+		}
+	}
+	return graphInstances.ToSlice()
 }
 
 func initNodeRings() {
-	cfg := g.Config()
-	GraphNodeRing = rings.NewConsistentHashNodesRing(cfg.Graph.Replicas, cutils.KeysOfMap(cfg.Graph.Cluster))
+	r := newNodeRings(g.Config().Graph)
+	graphRingsLock.Lock()
+	graphRings = r
+	graphRingsLock.Unlock()
+}
+
+func newNodeRings(cfg *g.GraphConfig) *nodeRings {
+	r := &nodeRings{
+		ring:    rings.NewConsistentHashNodesRing(cfg.Replicas, cutils.KeysOfMap(cfg.Cluster)),
+		cluster: cfg.Cluster,
+	}
+	if cfg.Next != nil {
+		r.next = rings.NewConsistentHashNodesRing(cfg.Next.Replicas, cutils.KeysOfMap(cfg.Next.Cluster))
+		r.nextCluster = cfg.Next.Cluster
+	}
+	return r
+}
+
+func currentNodeRings() *nodeRings {
+	graphRingsLock.RLock()
+	defer graphRingsLock.RUnlock()
+	return graphRings
+}
+
+// ReloadNodeRings reads the graph rings from the config file, to start or cut over a rebalancing of graph
+// without restarting query. The addresses must have connection pools, i.e. be in the config on start.
+func ReloadNodeRings() error {
+	cfg, err := g.ReadGraphRings()
+	if err != nil {
+		return err
+	}
+	for _, addr := range graphAddrs(cfg) {
+		if _, found := GraphConnPools.Get(addr); !found {
+			return fmt.Errorf("graph %s is not started, restart is needed", addr)
+		}
+	}
+
+	r := newNodeRings(cfg)
+	graphRingsLock.Lock()
+	graphRings = r
+	graphRingsLock.Unlock()
+	g.SetGraphRings(cfg)
+
+	if cfg.Next != nil {
+		log.Printf("graph rings are reloaded, version %d, querying next version %d", cfg.Version, cfg.Next.Version)
+	} else {
+		log.Printf("graph rings are reloaded, version %d", cfg.Version)
+	}
+	return nil
 }
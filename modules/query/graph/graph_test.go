@@ -0,0 +1,85 @@
+package graph
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Cepave/open-falcon-backend/modules/query/g"
+)
+
+func writeGraphConfig(t *testing.T, filename string, content string) {
+	if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReloadNodeRings(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "query")
+	defer os.RemoveAll(dir)
+	g.ConfigFile = filepath.Join(dir, "cfg.json")
+
+	g.SetConfig(&g.GlobalConfig{Graph: &g.GraphConfig{
+		CallTimeout: 1000,
+		Replicas:    500,
+		Version:     1,
+		Cluster:     map[string]string{"graph-00": "10.0.0.1:6070"},
+		Next: &g.GraphRingConfig{
+			Version:  2,
+			Replicas: 500,
+			Cluster:  map[string]string{"graph-00": "10.0.0.1:6070", "graph-01": "10.0.0.2:6070,10.0.0.3:6070"},
+		},
+	}})
+	initNodeRings()
+	initConnPools()
+	// the pools of the next ring are created on start
+	for _, addr := range []string{"10.0.0.1:6070", "10.0.0.2:6070", "10.0.0.3:6070"} {
+		if _, found := GraphConnPools.Get(addr); !found {
+			t.Errorf("pool of %s is not created", addr)
+		}
+	}
+	if r := currentNodeRings(); r.next == nil || len(r.nextCluster) != 2 {
+		t.Fatalf("unexpected next ring: %+v", r)
+	}
+
+	// cut over
+	writeGraphConfig(t, g.ConfigFile, `{"graph": {"version": 2, "replicas": 500,
+		"cluster": {"graph-00": "10.0.0.1:6070", "graph-01": "10.0.0.2:6070,10.0.0.3:6070"}}}`)
+	if err := ReloadNodeRings(); err != nil {
+		t.Fatal(err)
+	}
+	r := currentNodeRings()
+	if r.next != nil || len(r.cluster) != 2 {
+		t.Errorf("unexpected rings after cutting over: %+v", r)
+	}
+	cfg := g.Config().Graph
+	if cfg.Version != 2 || cfg.Next != nil || cfg.CallTimeout != 1000 {
+		t.Errorf("unexpected config after cutting over: %+v", cfg)
+	}
+	for _, endpoint := range []string{"host-1", "host-2", "host-3", "host-4"} {
+		addrs, err := selectAddrs(r.ring, r.cluster, endpoint, "cpu.idle")
+		if err != nil || len(addrs) == 0 {
+			t.Errorf("select addrs of %s fail: %v %v", endpoint, addrs, err)
+		}
+	}
+
+	// the address without pool
+	writeGraphConfig(t, g.ConfigFile, `{"graph": {"version": 2, "replicas": 500,
+		"cluster": {"graph-00": "10.0.0.1:6070"},
+		"next": {"version": 3, "replicas": 500, "cluster": {"graph-00": "10.0.0.1:6070", "graph-02": "10.0.0.4:6070"}}}}`)
+	if err := ReloadNodeRings(); err == nil {
+		t.Error("expected error of the address not started")
+	}
+	if currentNodeRings() != r || g.Config().Graph.Version != 2 {
+		t.Error("the rings are changed by the failed reloading")
+	}
+
+	// bad version of the next ring
+	writeGraphConfig(t, g.ConfigFile, `{"graph": {"version": 2, "replicas": 500,
+		"cluster": {"graph-00": "10.0.0.1:6070"},
+		"next": {"version": 2, "replicas": 500, "cluster": {"graph-00": "10.0.0.1:6070"}}}}`)
+	if err := ReloadNodeRings(); err == nil {
+		t.Error("expected error of the version")
+	}
+}
@@ -0,0 +1,88 @@
+package graph
+
+import (
+	"math"
+	"strings"
+
+	cmodel "github.com/Cepave/open-falcon-backend/common/model"
+)
+
+// 一个graph节点可以配置多个地址(逗号隔开), 即该节点的多个副本
+func splitAddrs(addrs string) []string {
+	ret := []string{}
+	for _, addr := range strings.Split(addrs, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			ret = append(ret, addr)
+		}
+	}
+	return ret
+}
+
+func validPoints(values []*cmodel.RRDData) int {
+	n := 0
+	for _, v := range values {
+		if v != nil && !math.IsNaN(float64(v.Value)) {
+			n++
+		}
+	}
+	return n
+}
+
+// isComplete is true if the series has no missing point, the other replicas are not needed.
+// The trailing bucket which is still in progress at now is always missing on every replica, it is ignored.
+func isComplete(resp *cmodel.GraphQueryResponse, now int64) bool {
+	if resp == nil || len(resp.Values) == 0 {
+		return false
+	}
+	values := resp.Values
+	if last := values[len(values)-1]; last != nil && math.IsNaN(float64(last.Value)) && inProgress(resp, last.Timestamp, now) {
+		values = values[:len(values)-1]
+	}
+	return len(values) > 0 && validPoints(values) == len(values)
+}
+
+// inProgress is true if the data of bucket at ts may not have arrived yet
+func inProgress(resp *cmodel.GraphQueryResponse, ts int64, now int64) bool {
+	step := int64(resp.Step)
+	if step <= 0 {
+		step = 60
+	}
+	return ts > now-step
+}
+
+// mergeSeries merges the series of two replicas: the one with more valid points is kept,
+// and its missing points are filled by the other one
+func mergeSeries(a, b *cmodel.GraphQueryResponse) *cmodel.GraphQueryResponse {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	if validPoints(b.Values) > validPoints(a.Values) {
+		a, b = b, a
+	}
+
+	others := make(map[int64]cmodel.JsonFloat, len(b.Values))
+	for _, v := range b.Values {
+		if v != nil && !math.IsNaN(float64(v.Value)) {
+			others[v.Timestamp] = v.Value
+		}
+	}
+	values := make([]*cmodel.RRDData, 0, len(a.Values))
+	for _, v := range a.Values {
+		if v == nil {
+			continue
+		}
+		if math.IsNaN(float64(v.Value)) {
+			if val, ok := others[v.Timestamp]; ok {
+				v = &cmodel.RRDData{Timestamp: v.Timestamp, Value: val}
+			}
+		}
+		values = append(values, v)
+	}
+
+	merged := *a
+	merged.Values = values
+	return &merged
+}
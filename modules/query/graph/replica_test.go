@@ -0,0 +1,79 @@
+package graph
+
+import (
+	"math"
+	"testing"
+
+	cmodel "github.com/Cepave/open-falcon-backend/common/model"
+)
+
+func series(values ...float64) *cmodel.GraphQueryResponse {
+	resp := &cmodel.GraphQueryResponse{Endpoint: "host", Counter: "cpu.idle"}
+	for i, v := range values {
+		resp.Values = append(resp.Values, &cmodel.RRDData{Timestamp: int64(60 * i), Value: cmodel.JsonFloat(v)})
+	}
+	return resp
+}
+
+func TestSplitAddrs(t *testing.T) {
+	addrs := splitAddrs("10.0.0.1:6070, 10.0.0.2:6070,")
+	if len(addrs) != 2 || addrs[0] != "10.0.0.1:6070" || addrs[1] != "10.0.0.2:6070" {
+		t.Errorf("unexpected addrs: %v", addrs)
+	}
+}
+
+func TestMergeSeries(t *testing.T) {
+	nan := math.NaN()
+	a := series(1, nan, nan, 4)
+	b := series(nan, 2, 3, nan)
+	c := series(1, nan, 3, 4)
+
+	now := int64(3600)
+	if isComplete(a, now) || isComplete(series(), now) || !isComplete(series(1, 2), now) {
+		t.Error("unexpected completeness")
+	}
+
+	merged := mergeSeries(a, c)
+	if validPoints(merged.Values) != 3 || float64(merged.Values[2].Value) != 3 || merged.Endpoint != "host" {
+		t.Errorf("unexpected merged series: %v", merged.Values)
+	}
+	merged = mergeSeries(merged, b)
+	if !isComplete(merged, now) || float64(merged.Values[1].Value) != 2 {
+		t.Errorf("series is not completed: %v", merged.Values)
+	}
+	// the series of replicas are not modified
+	if validPoints(a.Values) != 2 || validPoints(c.Values) != 3 {
+		t.Error("series of replica is modified")
+	}
+	if mergeSeries(nil, b) != b || mergeSeries(a, nil) != a {
+		t.Error("unexpected merge with nil")
+	}
+
+	// the nil points are skipped
+	d := series(1, nan, 3)
+	d.Values = append(d.Values, nil)
+	merged = mergeSeries(d, series(nan, nan, nan, nan, 5))
+	if len(merged.Values) != 3 || !math.IsNaN(float64(merged.Values[1].Value)) {
+		t.Errorf("unexpected merged series with nil: %v", merged.Values)
+	}
+}
+
+func TestIsCompleteInProgress(t *testing.T) {
+	nan := math.NaN()
+	s := series(1, 2, nan) // the last bucket is at 120
+	s.Step = 60
+
+	// 最后一个点还在当前周期内, 数据未到齐, 不影响完整性
+	if !isComplete(s, 150) || !isComplete(s, 179) {
+		t.Error("the trailing bucket in progress should be ignored")
+	}
+	if isComplete(s, 180) {
+		t.Error("the trailing bucket is missing after a step")
+	}
+	if isComplete(series(1, nan, nan), 150) {
+		t.Error("only the trailing bucket is ignored")
+	}
+	if isComplete(series(nan), 30) {
+		t.Error("the series without valid point is not complete")
+	}
+}
@@ -285,4 +285,13 @@ func configGraphRoutes() {
 		StdRender(w, data, nil)
 	})
 
+	// 重新读取配置文件中graph的环, 开始或者切换graph的扩容, 不需要重启query
+	http.HandleFunc("/graph/ring/reload", func(w http.ResponseWriter, r *http.Request) {
+		if err := graph.ReloadNodeRings(); err != nil {
+			RenderMsgJson(w, "reload graph rings fail: "+err.Error())
+			return
+		}
+		RenderDataJson(w, "ok")
+	})
+
 }
@@ -19,6 +19,10 @@ var (
 	LastRequestItemCnt        = nproc.NewSCounterQps("LastRequestItemCnt")
 	LastRawRequestItemCnt     = nproc.NewSCounterQps("LastRawRequestItemCnt")
 
+	// 查询graph副本
+	GraphHedgedQueryCnt  = nproc.NewSCounterQps("GraphHedgedQueryCnt")
+	GraphReplicaMergeCnt = nproc.NewSCounterQps("GraphReplicaMergeCnt")
+
 	// TODO http request delay
 )
 
@@ -41,5 +45,9 @@ func GetAll() []interface{} {
 	ret = append(ret, LastRequestItemCnt.Get())
 	ret = append(ret, LastRawRequestItemCnt.Get())
 
+	// graph replicas
+	ret = append(ret, GraphHedgedQueryCnt.Get())
+	ret = append(ret, GraphReplicaMergeCnt.Get())
+
 	return ret
 }
@@ -0,0 +1,59 @@
+package cron
+
+import (
+	"time"
+
+	"github.com/Cepave/open-falcon-backend/modules/sender/g"
+	"github.com/Cepave/open-falcon-backend/modules/sender/model"
+	"github.com/Cepave/open-falcon-backend/modules/sender/proc"
+	"github.com/Cepave/open-falcon-backend/modules/sender/provider"
+	"github.com/Cepave/open-falcon-backend/modules/sender/redis"
+	log "github.com/Sirupsen/logrus"
+)
+
+// name of provider => pool
+var Pools = make(map[string]*provider.Pool)
+
+func InitProviders() {
+	for name, cfg := range g.Config().Providers {
+		p, err := provider.New(cfg.Type, cfg.Config)
+		if err != nil {
+			log.Fatalln("init provider", name, "fail:", err)
+		}
+		Pools[name] = provider.NewPool(name, p, cfg.Workers, cfg.Rate)
+	}
+}
+
+// Consume reads each queue of routes and sends the messages by its provider
+func Consume() {
+	for queue, name := range g.Config().Routes {
+		go consume(queue, Pools[name])
+	}
+}
+
+func consume(queue string, pool *provider.Pool) {
+	for {
+		L := redis.PopAll(queue)
+		if len(L) == 0 {
+			time.Sleep(time.Millisecond * 200)
+			continue
+		}
+		for _, msg := range L {
+			pool.Submit(msg, func(msg *model.Message, err error) {
+				sent(pool.Name, msg, err)
+			})
+		}
+	}
+}
+
+func sent(name string, msg *model.Message, err error) {
+	if err != nil {
+		log.Println("send by", name, "fail:", err)
+	}
+
+	proc.IncreCount(name, err)
+
+	if g.Config().Debug {
+		log.Println("=="+name+"==>>>>", msg)
+	}
+}
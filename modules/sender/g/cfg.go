@@ -38,6 +38,16 @@ type ApiConfig struct {
 	Serverchan string `json:"serverchan"`
 }
 
+// ProviderConfig is an instance of provider, Type is the registered name of provider implementation
+type ProviderConfig struct {
+	Type string `json:"type"`
+	// number of messages being sent at the same time
+	Workers int `json:"workers"`
+	// at most so many messages are sent per second, 0 means no limit
+	Rate   float64         `json:"rate"`
+	Config json.RawMessage `json:"config"`
+}
+
 type GlobalConfig struct {
 	Debug  bool          `json:"debug"`
 	Http   *HttpConfig   `json:"http"`
@@ -45,6 +55,34 @@ type GlobalConfig struct {
 	Queue  *QueueConfig  `json:"queue"`
 	Worker *WorkerConfig `json:"worker"`
 	Api    *ApiConfig    `json:"api"`
+	// name of provider => config
+	Providers map[string]*ProviderConfig `json:"providers"`
+	// redis queue => name of provider
+	Routes map[string]string `json:"routes"`
+}
+
+// legacyProviders converts queue/worker/api to providers and routes,
+// which are used if "providers" is not configured
+func legacyProviders(c *GlobalConfig) (map[string]*ProviderConfig, map[string]string) {
+	providers := make(map[string]*ProviderConfig)
+	routes := make(map[string]string)
+	if c.Queue == nil || c.Worker == nil || c.Api == nil {
+		return providers, routes
+	}
+
+	add := func(name string, queue string, workers int, url string) {
+		if queue == "" {
+			return
+		}
+		config, _ := json.Marshal(map[string]string{"url": url})
+		providers[name] = &ProviderConfig{Type: name, Workers: workers, Config: config}
+		routes[queue] = name
+	}
+	add("sms", c.Queue.Sms, c.Worker.Sms, c.Api.Sms)
+	add("mail", c.Queue.Mail, c.Worker.Mail, c.Api.Mail)
+	add("qq", c.Queue.QQ, c.Worker.QQ, c.Api.QQ)
+	add("serverchan", c.Queue.Serverchan, c.Worker.Serverchan, c.Api.Serverchan)
+	return providers, routes
 }
 
 var (
@@ -80,6 +118,14 @@ func ParseConfig(cfg string) {
 	if err != nil {
 		log.Fatalln("parse config file:", cfg, "fail:", err)
 	}
+	if len(c.Providers) == 0 {
+		c.Providers, c.Routes = legacyProviders(&c)
+	}
+	for queue, name := range c.Routes {
+		if _, ok := c.Providers[name]; !ok {
+			log.Fatalln("provider", name, "of queue", queue, "is not configured")
+		}
+	}
 
 	configLock.Lock()
 	defer configLock.Unlock()
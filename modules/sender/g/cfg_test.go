@@ -0,0 +1,76 @@
+package g
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLegacyProviders(t *testing.T) {
+	c := &GlobalConfig{
+		Queue:  &QueueConfig{Sms: "/sms", Mail: "/mail", QQ: "", Serverchan: "/serverchan"},
+		Worker: &WorkerConfig{Sms: 10, Mail: 50, QQ: 5, Serverchan: 2},
+		Api:    &ApiConfig{Sms: "http://sms", Mail: "http://mail", QQ: "http://qq", Serverchan: "http://serverchan"},
+	}
+	providers, routes := legacyProviders(c)
+
+	expectedRoutes := map[string]string{"/sms": "sms", "/mail": "mail", "/serverchan": "serverchan"}
+	if len(routes) != len(expectedRoutes) {
+		t.Errorf("unexpected routes: %v", routes)
+	}
+	for queue, name := range expectedRoutes {
+		if routes[queue] != name {
+			t.Errorf("queue %s: expected provider %s, got %s", queue, name, routes[queue])
+		}
+	}
+
+	// the queue of qq is not configured
+	if len(providers) != 3 || providers["qq"] != nil {
+		t.Errorf("unexpected providers: %v", providers)
+	}
+	for name, worker := range map[string]int{"sms": 10, "mail": 50, "serverchan": 2} {
+		p := providers[name]
+		if p == nil || p.Type != name || p.Workers != worker || p.Rate != 0 {
+			t.Errorf("unexpected provider %s: %+v", name, p)
+			continue
+		}
+		var config map[string]string
+		if err := json.Unmarshal(p.Config, &config); err != nil || config["url"] != "http://"+name {
+			t.Errorf("unexpected config of %s: %s", name, p.Config)
+		}
+	}
+
+	if providers, routes := legacyProviders(&GlobalConfig{Queue: c.Queue}); len(providers) != 0 || len(routes) != 0 {
+		t.Errorf("expected nothing without worker and api, got %v %v", providers, routes)
+	}
+}
+
+func TestParseConfigProviders(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "sender")
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "cfg.json")
+
+	// the providers override queue/worker/api
+	cfg := `{"queue": {"sms": "/sms", "mail": "/mail"}, "worker": {"sms": 10, "mail": 50}, "api": {"sms": "http://sms", "mail": "http://mail"},
+		"providers": {"smtp": {"type": "smtp", "workers": 5, "rate": 2, "config": {"addr": "127.0.0.1:25", "from": "falcon@example.com"}}},
+		"routes": {"/mail": "smtp"}}`
+	if err := ioutil.WriteFile(filename, []byte(cfg), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ParseConfig(filename)
+	c := Config()
+	if len(c.Providers) != 1 || c.Providers["smtp"].Rate != 2 || len(c.Routes) != 1 || c.Routes["/mail"] != "smtp" {
+		t.Errorf("unexpected providers %v and routes %v", c.Providers, c.Routes)
+	}
+
+	cfg = `{"queue": {"sms": "/sms"}, "worker": {"sms": 10}, "api": {"sms": "http://sms"}}`
+	if err := ioutil.WriteFile(filename, []byte(cfg), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ParseConfig(filename)
+	if c := Config(); len(c.Providers) != 1 || c.Providers["sms"] == nil || c.Routes["/sms"] != "sms" {
+		t.Errorf("unexpected legacy providers %v and routes %v", c.Providers, c.Routes)
+	}
+}
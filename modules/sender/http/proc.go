@@ -9,7 +9,12 @@ import (
 func configProcRoutes() {
 
 	http.HandleFunc("/count", func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte(fmt.Sprintf("sms:%v, mail:%v, qq:%v", proc.GetSmsCount(), proc.GetMailCount(), proc.GetQQCount())))
+		w.Write([]byte(fmt.Sprintf("sms:%v, mail:%v, qq:%v", proc.GetCount("sms"), proc.GetCount("mail"), proc.GetCount("qq"))))
+	})
+
+	// counters of all providers
+	http.HandleFunc("/counters", func(w http.ResponseWriter, r *http.Request) {
+		RenderDataJson(w, proc.GetCounters())
 	})
 
 }
@@ -31,14 +31,11 @@ func main() {
 	vipercfg.Load()
 	g.ParseConfig(vipercfg.Config().GetString("config"))
 	logruslog.Init()
-	cron.InitWorker()
+	cron.InitProviders()
 	redis.InitConnPool()
 
 	go http.Start()
-	go cron.ConsumeSms()
-	go cron.ConsumeMail()
-	go cron.ConsumeQQ()
-	go cron.ConsumeServerchan()
+	go cron.Consume()
 
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
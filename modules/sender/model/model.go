@@ -4,38 +4,14 @@ import (
 	"fmt"
 )
 
-type Sms struct {
-	Tos     string `json:"tos"`
-	Content string `json:"content"`
-}
-
-type Mail struct {
-	Tos     string `json:"tos"`
-	Subject string `json:"subject"`
-	Content string `json:"content"`
-}
-
-type QQ struct {
-	Tos     string `json:"tos"`
-	Subject string `json:"subject"`
-	Content string `json:"content"`
-}
-
-type Serverchan struct {
+// Message is written into redis queues by alarm, Subject is empty for sms
+type Message struct {
 	Tos     string `json:"tos"`
 	Subject string `json:"subject"`
 	Content string `json:"content"`
 }
 
-func (this *Sms) String() string {
-	return fmt.Sprintf(
-		"<Tos:%s, Content:%s>",
-		this.Tos,
-		this.Content,
-	)
-}
-
-func (this *Mail) String() string {
+func (this *Message) String() string {
 	return fmt.Sprintf(
 		"<Tos:%s, Subject:%s, Content:%s>",
 		this.Tos,
@@ -1,39 +1,51 @@
 package proc
 
 import (
-	"sync/atomic"
+	"sync"
 )
 
-var smsCount, mailCount, qqCount, serverchanCount uint32
-
-func GetSmsCount() uint32 {
-	return atomic.LoadUint32(&smsCount)
-}
-
-func GetMailCount() uint32 {
-	return atomic.LoadUint32(&mailCount)
-}
-
-func GetQQCount() uint32 {
-	return atomic.LoadUint32(&qqCount)
-}
-
-func GetServerchanCount() uint32 {
-	return atomic.LoadUint32(&serverchanCount)
+// Counter is the number of messages sent by a provider
+type Counter struct {
+	Sent   uint64 `json:"sent"`
+	Failed uint64 `json:"failed"`
 }
 
-func IncreSmsCount() {
-	atomic.AddUint32(&smsCount, 1)
-}
-
-func IncreMailCount() {
-	atomic.AddUint32(&mailCount, 1)
-}
-
-func IncreQQCount() {
-	atomic.AddUint32(&qqCount, 1)
-}
+var (
+	counters     = make(map[string]*Counter)
+	countersLock = new(sync.RWMutex)
+)
 
-func IncreServerchanCount() {
-	atomic.AddUint32(&serverchanCount, 1)
+func IncreCount(provider string, err error) {
+	countersLock.Lock()
+	defer countersLock.Unlock()
+
+	c, ok := counters[provider]
+	if !ok {
+		c = &Counter{}
+		counters[provider] = c
+	}
+	c.Sent++
+	if err != nil {
+		c.Failed++
+	}
+}
+
+func GetCount(provider string) uint64 {
+	countersLock.RLock()
+	defer countersLock.RUnlock()
+	if c, ok := counters[provider]; ok {
+		return c.Sent
+	}
+	return 0
+}
+
+// GetCounters returns a copy of counters, name of provider => counter
+func GetCounters() map[string]Counter {
+	countersLock.RLock()
+	defer countersLock.RUnlock()
+	ret := make(map[string]Counter, len(counters))
+	for name, c := range counters {
+		ret[name] = *c
+	}
+	return ret
 }
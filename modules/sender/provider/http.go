@@ -0,0 +1,122 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Cepave/open-falcon-backend/modules/sender/model"
+)
+
+func init() {
+	Register("http", newHttpProvider)
+}
+
+type httpConfig struct {
+	Url string `json:"url"`
+	// POST(default) or PUT
+	Method string `json:"method"`
+	// form(default) or json
+	ContentType string            `json:"content_type"`
+	Headers     map[string]string `json:"headers"`
+	// renames the fields, e.g. {"tos": "phones"}, keys are tos, subject and content
+	Fields map[string]string `json:"fields"`
+	// sends the message to each of tos separately
+	SplitTos bool `json:"split_tos"`
+	// seconds, default 10
+	Timeout int `json:"timeout"`
+}
+
+// httpProvider is the generic form of the sms/mail providers,
+// the api which is not compatible with them can be adapted by configuration
+type httpProvider struct {
+	config *httpConfig
+	client *http.Client
+}
+
+func newHttpProvider(config json.RawMessage) (Provider, error) {
+	c := &httpConfig{Method: "POST", ContentType: "form", Timeout: 10}
+	if err := decodeConfig(config, c); err != nil {
+		return nil, err
+	}
+	if c.Url == "" {
+		return nil, errors.New("url is needed")
+	}
+	if c.Method != "POST" && c.Method != "PUT" {
+		return nil, fmt.Errorf("method: only accept [POST, PUT], got %s", c.Method)
+	}
+	if c.ContentType != "form" && c.ContentType != "json" {
+		return nil, fmt.Errorf("content_type: only accept [form, json], got %s", c.ContentType)
+	}
+	return &httpProvider{
+		config: c,
+		client: &http.Client{Timeout: time.Duration(c.Timeout) * time.Second},
+	}, nil
+}
+
+func (this *httpProvider) field(name string) string {
+	if renamed, ok := this.config.Fields[name]; ok && renamed != "" {
+		return renamed
+	}
+	return name
+}
+
+func (this *httpProvider) Send(msg *model.Message) error {
+	if !this.config.SplitTos {
+		return this.send(msg.Tos, msg)
+	}
+	for _, to := range strings.Split(msg.Tos, ",") {
+		if to = strings.TrimSpace(to); to == "" {
+			continue
+		}
+		if err := this.send(to, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (this *httpProvider) send(tos string, msg *model.Message) error {
+	fields := map[string]string{
+		this.field("tos"):     tos,
+		this.field("subject"): msg.Subject,
+		this.field("content"): msg.Content,
+	}
+
+	var body []byte
+	var contentType string
+	if this.config.ContentType == "json" {
+		bs, err := json.Marshal(fields)
+		if err != nil {
+			return err
+		}
+		body, contentType = bs, "application/json"
+	} else {
+		values := url.Values{}
+		for k, v := range fields {
+			values.Set(k, v)
+		}
+		body, contentType = []byte(values.Encode()), "application/x-www-form-urlencoded"
+	}
+
+	req, err := http.NewRequest(this.config.Method, this.config.Url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range this.config.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := this.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return checkResponse(resp)
+}
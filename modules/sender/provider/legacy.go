@@ -0,0 +1,128 @@
+package provider
+
+import (
+	"encoding/json"
+	"errors"
+	"os/exec"
+	"time"
+
+	"github.com/Cepave/open-falcon-backend/modules/sender/model"
+	"github.com/toolkits/net/httplib"
+)
+
+// The providers of the company's own sms/mail http apis, qq and serverchan,
+// which are configured by "api" of cfg.json before providers are introduced.
+func init() {
+	Register("sms", newSmsProvider)
+	Register("mail", newMailProvider)
+	Register("qq", newQQProvider)
+	Register("serverchan", newServerchanProvider)
+}
+
+type urlConfig struct {
+	Url string `json:"url"`
+}
+
+func parseUrlConfig(config json.RawMessage) (*urlConfig, error) {
+	c := &urlConfig{}
+	if err := decodeConfig(config, c); err != nil {
+		return nil, err
+	}
+	if c.Url == "" {
+		return nil, errors.New("url is needed")
+	}
+	return c, nil
+}
+
+// smsProvider posts form: tos(phones, comma separated), content
+type smsProvider struct {
+	url string
+}
+
+func newSmsProvider(config json.RawMessage) (Provider, error) {
+	c, err := parseUrlConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return &smsProvider{url: c.Url}, nil
+}
+
+func (this *smsProvider) Send(msg *model.Message) error {
+	r := httplib.Post(this.url).SetTimeout(5*time.Second, 2*time.Minute)
+	r.Param("tos", msg.Tos)
+	r.Param("content", msg.Content)
+	_, err := r.String()
+	return err
+}
+
+// mailProvider posts form: tos(emails, comma separated), subject, content
+type mailProvider struct {
+	url string
+}
+
+func newMailProvider(config json.RawMessage) (Provider, error) {
+	c, err := parseUrlConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return &mailProvider{url: c.Url}, nil
+}
+
+func (this *mailProvider) Send(msg *model.Message) error {
+	r := httplib.Post(this.url).SetTimeout(5*time.Second, 2*time.Minute)
+	r.Param("tos", msg.Tos)
+	r.Param("subject", msg.Subject)
+	r.Param("content", msg.Content)
+	_, err := r.String()
+	return err
+}
+
+// qqProvider runs the script with url, subject and content
+type qqProvider struct {
+	url    string
+	script string
+}
+
+func newQQProvider(config json.RawMessage) (Provider, error) {
+	c := &struct {
+		Url    string `json:"url"`
+		Script string `json:"script"`
+	}{Script: "./qq_sms.sh"}
+	if err := decodeConfig(config, c); err != nil {
+		return nil, err
+	}
+	if c.Url == "" {
+		return nil, errors.New("url is needed")
+	}
+	return &qqProvider{url: c.Url, script: c.Script}, nil
+}
+
+func (this *qqProvider) Send(msg *model.Message) error {
+	cmd := exec.Command("/bin/bash", this.script, this.url, msg.Subject, msg.Content)
+	return cmd.Run()
+}
+
+// serverchanProvider posts form: text(subject), desp(content) to <url>/<sckey>.send, tos is the sckey
+type serverchanProvider struct {
+	url string
+}
+
+func newServerchanProvider(config json.RawMessage) (Provider, error) {
+	c, err := parseUrlConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return &serverchanProvider{url: c.Url}, nil
+}
+
+func (this *serverchanProvider) Send(msg *model.Message) error {
+	sckey := msg.Tos
+	if len(sckey) <= 5 {
+		return nil
+	}
+	r := httplib.Post(this.url+"/"+sckey+".send").SetTimeout(5*time.Second, 2*time.Minute)
+	r.Param("text", msg.Subject)
+	r.Param("desp", msg.Content)
+	_, err := r.String()
+	return err
+}
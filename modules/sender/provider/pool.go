@@ -0,0 +1,49 @@
+package provider
+
+import (
+	"time"
+
+	"github.com/Cepave/open-falcon-backend/modules/sender/model"
+)
+
+// Pool sends messages by a provider with limited workers and rate
+type Pool struct {
+	Name     string
+	provider Provider
+	workers  chan struct{}
+	ticks    <-chan time.Time
+}
+
+// NewPool: workers <= 0 means 1, rate <= 0 means no limit of messages per second
+func NewPool(name string, p Provider, workers int, rate float64) *Pool {
+	if workers <= 0 {
+		workers = 1
+	}
+	pool := &Pool{
+		Name:     name,
+		provider: p,
+		workers:  make(chan struct{}, workers),
+	}
+	if rate > 0 {
+		pool.ticks = time.Tick(time.Duration(float64(time.Second) / rate))
+	}
+	return pool
+}
+
+// Submit blocks until a worker is available(and the rate allows), then sends the message asynchronously.
+// done is called with the result of sending.
+func (this *Pool) Submit(msg *model.Message, done func(msg *model.Message, err error)) {
+	if this.ticks != nil {
+		<-this.ticks
+	}
+	this.workers <- struct{}{}
+	go func() {
+		defer func() {
+			<-this.workers
+		}()
+		err := this.provider.Send(msg)
+		if done != nil {
+			done(msg, err)
+		}
+	}()
+}
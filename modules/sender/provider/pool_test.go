@@ -0,0 +1,73 @@
+package provider
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Cepave/open-falcon-backend/modules/sender/model"
+)
+
+func TestPoolWorkers(t *testing.T) {
+	p := &fakeProvider{delay: 20 * time.Millisecond}
+	pool := NewPool("fake", p, 3, 0)
+
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	failed := 0
+	for i := 0; i < 12; i++ {
+		wg.Add(1)
+		msg := &model.Message{Tos: "a", Content: "hello"}
+		if i%4 == 0 {
+			msg.Tos = ""
+		}
+		pool.Submit(msg, func(msg *model.Message, err error) {
+			defer wg.Done()
+			if err != nil {
+				lock.Lock()
+				failed++
+				lock.Unlock()
+			}
+		})
+	}
+	wg.Wait()
+
+	if len(p.sent) != 12 || failed != 3 {
+		t.Errorf("expected 12 messages sent and 3 failed, got %d and %d", len(p.sent), failed)
+	}
+	if p.busiest != 3 {
+		t.Errorf("expected 3 messages being sent at the same time, got %d", p.busiest)
+	}
+
+	// workers <= 0 means 1
+	p = &fakeProvider{delay: time.Millisecond}
+	pool = NewPool("fake", p, 0, 0)
+	wg.Add(5)
+	for i := 0; i < 5; i++ {
+		pool.Submit(&model.Message{Tos: "a"}, func(*model.Message, error) { wg.Done() })
+	}
+	wg.Wait()
+	if p.busiest != 1 {
+		t.Errorf("expected 1 worker, got %d", p.busiest)
+	}
+}
+
+func TestPoolRate(t *testing.T) {
+	p := &fakeProvider{}
+	pool := NewPool("fake", p, 10, 50)
+
+	var wg sync.WaitGroup
+	start := time.Now()
+	wg.Add(6)
+	for i := 0; i < 6; i++ {
+		pool.Submit(&model.Message{Tos: "a"}, func(*model.Message, error) { wg.Done() })
+	}
+	wg.Wait()
+
+	// 50 messages per second, one message per 20ms
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("6 messages are sent in %v, faster than the rate", elapsed)
+	}
+	// done can be nil
+	pool.Submit(&model.Message{Tos: "a"}, nil)
+}
@@ -0,0 +1,65 @@
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/Cepave/open-falcon-backend/modules/sender/model"
+)
+
+// Provider sends messages by a channel, e.g. sms, mail, slack.
+// Send is called by multiple workers concurrently.
+type Provider interface {
+	Send(msg *model.Message) error
+}
+
+// Factory builds a provider from the "config" of provider in cfg.json
+type Factory func(config json.RawMessage) (Provider, error)
+
+var (
+	factories     = make(map[string]Factory)
+	factoriesLock = new(sync.RWMutex)
+)
+
+// Register makes a provider implementation available by the type name,
+// it is supposed to be called in init() of the implementation.
+func Register(typ string, factory Factory) {
+	factoriesLock.Lock()
+	defer factoriesLock.Unlock()
+	if _, ok := factories[typ]; ok {
+		panic("provider: Register called twice for " + typ)
+	}
+	factories[typ] = factory
+}
+
+func New(typ string, config json.RawMessage) (Provider, error) {
+	factoriesLock.RLock()
+	factory, ok := factories[typ]
+	factoriesLock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown provider type: %s", typ)
+	}
+	return factory(config)
+}
+
+// Types returns the registered type names, sorted
+func Types() []string {
+	factoriesLock.RLock()
+	defer factoriesLock.RUnlock()
+	ret := make([]string, 0, len(factories))
+	for typ := range factories {
+		ret = append(ret, typ)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// decodeConfig unmarshals config into v, empty config leaves v unchanged
+func decodeConfig(config json.RawMessage, v interface{}) error {
+	if len(config) == 0 {
+		return nil
+	}
+	return json.Unmarshal(config, v)
+}
@@ -0,0 +1,83 @@
+package provider
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Cepave/open-falcon-backend/modules/sender/model"
+)
+
+// fakeProvider records the messages, Send takes delay
+type fakeProvider struct {
+	sync.Mutex
+	delay   time.Duration
+	sending int32
+	busiest int32
+	sent    []*model.Message
+}
+
+func (this *fakeProvider) Send(msg *model.Message) error {
+	n := atomic.AddInt32(&this.sending, 1)
+	defer atomic.AddInt32(&this.sending, -1)
+	this.Lock()
+	if n > this.busiest {
+		this.busiest = n
+	}
+	this.Unlock()
+
+	time.Sleep(this.delay)
+
+	this.Lock()
+	defer this.Unlock()
+	this.sent = append(this.sent, msg)
+	if msg.Tos == "" {
+		return errors.New("no receiver")
+	}
+	return nil
+}
+
+func TestRegister(t *testing.T) {
+	var got json.RawMessage
+	Register("test-fake", func(config json.RawMessage) (Provider, error) {
+		got = config
+		return &fakeProvider{}, nil
+	})
+
+	p, err := New("test-fake", json.RawMessage(`{"url": "http://127.0.0.1"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := p.(*fakeProvider); !ok || string(got) != `{"url": "http://127.0.0.1"}` {
+		t.Errorf("unexpected provider %T, config %s", p, got)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected panic of registering twice")
+			}
+		}()
+		Register("test-fake", nil)
+	}()
+
+	if _, err := New("none", nil); err == nil {
+		t.Error("expected error of unknown type")
+	}
+	// the config is checked by the factory
+	if _, err := New("smtp", json.RawMessage(`{"addr": "127.0.0.1:25"}`)); err == nil {
+		t.Error("expected error of the smtp config without from")
+	}
+	if _, err := New("sms", nil); err == nil {
+		t.Error("expected error of the sms config without url")
+	}
+
+	types := strings.Join(Types(), ",")
+	if types != "http,mail,qq,serverchan,slack,sms,smtp,test-fake" {
+		t.Errorf("unexpected types: %s", types)
+	}
+}
@@ -0,0 +1,89 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/Cepave/open-falcon-backend/modules/sender/model"
+)
+
+func init() {
+	Register("slack", newSlackProvider)
+}
+
+type slackConfig struct {
+	// url of incoming webhook, Mattermost is compatible
+	Url string `json:"url"`
+	// overrides the channel of webhook if it is not empty
+	Channel   string `json:"channel"`
+	Username  string `json:"username"`
+	IconEmoji string `json:"icon_emoji"`
+	// seconds, default 10
+	Timeout int `json:"timeout"`
+}
+
+// slackProvider posts messages to the incoming webhook of Slack, tos is ignored
+type slackProvider struct {
+	config *slackConfig
+	client *http.Client
+}
+
+func newSlackProvider(config json.RawMessage) (Provider, error) {
+	c := &slackConfig{Timeout: 10}
+	if err := decodeConfig(config, c); err != nil {
+		return nil, err
+	}
+	if c.Url == "" {
+		return nil, errors.New("url is needed")
+	}
+	return &slackProvider{
+		config: c,
+		client: &http.Client{Timeout: time.Duration(c.Timeout) * time.Second},
+	}, nil
+}
+
+type slackPayload struct {
+	Text      string `json:"text"`
+	Channel   string `json:"channel,omitempty"`
+	Username  string `json:"username,omitempty"`
+	IconEmoji string `json:"icon_emoji,omitempty"`
+}
+
+func (this *slackProvider) Send(msg *model.Message) error {
+	text := msg.Content
+	if msg.Subject != "" {
+		text = msg.Subject + "\n" + msg.Content
+	}
+	body, err := json.Marshal(&slackPayload{
+		Text:      text,
+		Channel:   this.config.Channel,
+		Username:  this.config.Username,
+		IconEmoji: this.config.IconEmoji,
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := this.client.Post(this.config.Url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return checkResponse(resp)
+}
+
+// checkResponse returns an error with the beginning of body if the status is not 2xx
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil
+	}
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("%s: %s", resp.Status, body)
+}
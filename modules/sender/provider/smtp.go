@@ -0,0 +1,154 @@
+package provider
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/Cepave/open-falcon-backend/modules/sender/model"
+)
+
+func init() {
+	Register("smtp", newSmtpProvider)
+}
+
+type smtpConfig struct {
+	// host:port
+	Addr     string `json:"addr"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	From     string `json:"from"`
+	// none, starttls or tls
+	TLS                string `json:"tls"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+	// seconds of sending a mail, including dialing, default 10
+	Timeout int `json:"timeout"`
+	// default text/plain
+	ContentType string `json:"content_type"`
+}
+
+// smtpProvider sends mails by the smtp server directly, tos are the comma separated addresses
+type smtpProvider struct {
+	config *smtpConfig
+	host   string
+}
+
+func newSmtpProvider(config json.RawMessage) (Provider, error) {
+	c := &smtpConfig{TLS: "none", Timeout: 10, ContentType: "text/plain"}
+	if err := decodeConfig(config, c); err != nil {
+		return nil, err
+	}
+	if c.Addr == "" || c.From == "" {
+		return nil, errors.New("addr and from are needed")
+	}
+	host, _, err := net.SplitHostPort(c.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("bad addr %s: %v", c.Addr, err)
+	}
+	switch c.TLS {
+	case "none", "starttls", "tls":
+	default:
+		return nil, fmt.Errorf("tls: only accept [none, starttls, tls], got %s", c.TLS)
+	}
+	return &smtpProvider{config: c, host: host}, nil
+}
+
+func (this *smtpProvider) Send(msg *model.Message) error {
+	tos := []string{}
+	for _, to := range strings.Split(msg.Tos, ",") {
+		if to = strings.TrimSpace(to); to != "" {
+			tos = append(tos, to)
+		}
+	}
+	if len(tos) == 0 {
+		return nil
+	}
+
+	client, err := this.dial()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if this.config.Username != "" {
+		auth := smtp.PlainAuth("", this.config.Username, this.config.Password, this.host)
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(this.config.From); err != nil {
+		return err
+	}
+	for _, to := range tos {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(this.mail(tos, msg)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+func (this *smtpProvider) dial() (*smtp.Client, error) {
+	timeout := time.Duration(this.config.Timeout) * time.Second
+	tlsConfig := &tls.Config{ServerName: this.host, InsecureSkipVerify: this.config.InsecureSkipVerify}
+
+	var conn net.Conn
+	var err error
+	if this.config.TLS == "tls" {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", this.config.Addr, tlsConfig)
+	} else {
+		conn, err = net.DialTimeout("tcp", this.config.Addr, timeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// a new connection is dialed for every mail, so the deadline bounds the whole conversation of Send,
+	// a server which stops responding cannot block the worker
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	client, err := smtp.NewClient(conn, this.host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if this.config.TLS == "starttls" {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+	return client, nil
+}
+
+func (this *smtpProvider) mail(tos []string, msg *model.Message) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", this.config.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(tos, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: %s; charset=UTF-8\r\n", this.config.ContentType)
+	buf.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(strings.Replace(msg.Content, "\n", "\r\n", -1))
+	return buf.Bytes()
+}
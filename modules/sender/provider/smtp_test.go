@@ -0,0 +1,169 @@
+package provider
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Cepave/open-falcon-backend/modules/sender/model"
+)
+
+func TestNewSmtpProvider(t *testing.T) {
+	for _, config := range []string{
+		`{"from": "falcon@example.com"}`,
+		`{"addr": "127.0.0.1:25"}`,
+		`{"addr": "127.0.0.1", "from": "falcon@example.com"}`,
+		`{"addr": "127.0.0.1:25", "from": "falcon@example.com", "tls": "ssl"}`,
+		`{"addr": 25}`,
+	} {
+		if _, err := newSmtpProvider(json.RawMessage(config)); err == nil {
+			t.Errorf("expected error of %s", config)
+		}
+	}
+
+	p, err := newSmtpProvider(json.RawMessage(`{"addr": "smtp.example.com:587", "from": "falcon@example.com", "tls": "starttls"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := p.(*smtpProvider)
+	if s.host != "smtp.example.com" || s.config.Timeout != 10 || s.config.ContentType != "text/plain" {
+		t.Errorf("unexpected provider: %s %+v", s.host, s.config)
+	}
+}
+
+func TestSmtpMail(t *testing.T) {
+	p, _ := newSmtpProvider(json.RawMessage(`{"addr": "127.0.0.1:25", "from": "falcon@example.com", "content_type": "text/html"}`))
+	mail := string(p.(*smtpProvider).mail([]string{"a@example.com", "b@example.com"}, &model.Message{
+		Subject: "[P0][PROBLEM] 磁盘满了",
+		Content: "line1\nline2",
+	}))
+
+	header, body := mail, ""
+	if idx := strings.Index(mail, "\r\n\r\n"); idx >= 0 {
+		header, body = mail[:idx], mail[idx+4:]
+	}
+	for _, line := range []string{
+		"From: falcon@example.com",
+		"To: a@example.com, b@example.com",
+		"Subject: =?utf-8?q?[P0][PROBLEM]_=E7=A3=81=E7=9B=98=E6=BB=A1=E4=BA=86?=",
+		"MIME-Version: 1.0",
+		"Content-Type: text/html; charset=UTF-8",
+		"Content-Transfer-Encoding: 8bit",
+	} {
+		if !strings.Contains(header+"\r\n", line+"\r\n") {
+			t.Errorf("header %q is missing in:\n%s", line, header)
+		}
+	}
+	if !strings.Contains(header, "\r\nDate: ") {
+		t.Error("header Date is missing")
+	}
+	if body != "line1\r\nline2" {
+		t.Errorf("unexpected body: %q", body)
+	}
+}
+
+// fakeSmtpServer accepts one session without authentication, returns the commands and the data
+func fakeSmtpServer(t *testing.T) (string, chan []string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := make(chan []string, 1)
+	go func() {
+		defer ln.Close()
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		lines := []string{}
+		r := bufio.NewReader(conn)
+		conn.Write([]byte("220 localhost ESMTP\r\n"))
+		inData := false
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				break
+			}
+			line = strings.TrimRight(line, "\r\n")
+			lines = append(lines, line)
+			switch {
+			case inData:
+				if line == "." {
+					inData = false
+					conn.Write([]byte("250 OK\r\n"))
+				}
+			case strings.HasPrefix(line, "DATA"):
+				inData = true
+				conn.Write([]byte("354 go ahead\r\n"))
+			case strings.HasPrefix(line, "QUIT"):
+				conn.Write([]byte("221 bye\r\n"))
+				session <- lines
+				return
+			default:
+				conn.Write([]byte("250 OK\r\n"))
+			}
+		}
+		session <- lines
+	}()
+	return ln.Addr().String(), session
+}
+
+func TestSmtpSend(t *testing.T) {
+	addr, session := fakeSmtpServer(t)
+	p, err := newSmtpProvider(json.RawMessage(`{"addr": "` + addr + `", "from": "falcon@example.com"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.Send(&model.Message{Tos: "a@example.com, ,b@example.com", Subject: "test", Content: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Join(<-session, "\n")
+	for _, expected := range []string{
+		"MAIL FROM:<falcon@example.com>",
+		"RCPT TO:<a@example.com>",
+		"RCPT TO:<b@example.com>",
+		"To: a@example.com, b@example.com",
+		"Subject: test",
+		"hello",
+	} {
+		if !strings.Contains(lines, expected) {
+			t.Errorf("%q is not sent:\n%s", expected, lines)
+		}
+	}
+
+	// nothing is sent without receivers
+	if err := p.Send(&model.Message{Tos: " , "}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSmtpSendTimeout(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	// the server accepts the connection but never greets
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			defer conn.Close()
+			time.Sleep(5 * time.Second)
+		}
+	}()
+
+	p, _ := newSmtpProvider(json.RawMessage(`{"addr": "` + ln.Addr().String() + `", "from": "falcon@example.com", "timeout": 1}`))
+	start := time.Now()
+	if err := p.Send(&model.Message{Tos: "a@example.com", Subject: "test"}); err == nil {
+		t.Error("expected timeout error")
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("Send is blocked for %v", elapsed)
+	}
+}
@@ -2,6 +2,7 @@ package g
 
 import (
 	"encoding/json"
+	"fmt"
 	"strings"
 	"sync"
 
@@ -49,6 +50,29 @@ type GraphConfig struct {
 	Replicas    int                     `json:"replicas"`
 	Cluster     map[string]string       `json:"cluster"`
 	ClusterList map[string]*ClusterNode `json:"clusterList"`
+	Version     int                     `json:"version"` // version of the ring of cluster
+	Next        *GraphRingConfig        `json:"next"`    // the ring being rebalanced to, data is written to both rings
+}
+
+type GraphRingConfig struct {
+	Version     int                     `json:"version"`
+	Replicas    int                     `json:"replicas"`
+	Cluster     map[string]string       `json:"cluster"`
+	ClusterList map[string]*ClusterNode `json:"clusterList"`
+}
+
+// AllNodes returns the graph nodes of cluster and the next ring
+func (this *GraphConfig) AllNodes() map[string]*ClusterNode {
+	nodes := make(map[string]*ClusterNode, len(this.ClusterList))
+	for name, node := range this.ClusterList {
+		nodes[name] = node
+	}
+	if this.Next != nil {
+		for name, node := range this.Next.ClusterList {
+			nodes[name] = node
+		}
+	}
+	return nodes
 }
 
 type TsdbConfig struct {
@@ -96,6 +120,140 @@ type StagingConfig struct {
 	Filters     []string `json:"filters"`
 }
 
+// Batches which cannot be delivered to judge/graph are spilled to disk,
+// and replayed in order once the backend answers ping again.
+type SpillConfig struct {
+	Enabled      bool   `json:"enabled"`
+	Dir          string `json:"dir"`
+	SegmentSize  int64  `json:"segmentSize"`  // MB, size of one segment file
+	MaxSize      int64  `json:"maxSize"`      // MB, disk budget of each backend node
+	PingInterval int    `json:"pingInterval"` // sec
+}
+
+// Samples of Prometheus remote write are converted to metric values,
+// the labels except the endpoint label and the dropped ones become tags.
+type PrometheusConfig struct {
+	Enabled         bool     `json:"enabled"`
+	EndpointLabel   string   `json:"endpointLabel"`   // label of endpoint, default "instance"
+	StripPort       bool     `json:"stripPort"`       // "host:9100" => "host"
+	DefaultEndpoint string   `json:"defaultEndpoint"` // used if the endpoint label is absent, the sample is dropped if it is empty too
+	DropLabels      []string `json:"dropLabels"`
+	Step            int      `json:"step"` // sec, scrape interval of prometheus
+	// metric names with these suffixes are COUNTER, others are GAUGE
+	CounterSuffixes []string `json:"counterSuffixes"`
+	// metric name => GAUGE/COUNTER, takes precedence over the suffixes
+	Types map[string]string `json:"types"`
+}
+
+// Graphite plaintext lines(tcp/udp) and pickles(tcp) are mapped to endpoint, metric and tags by templates,
+// see receiver/graphite for the syntax of templates.
+type GraphiteConfig struct {
+	Enabled         bool     `json:"enabled"`
+	TcpListen       string   `json:"tcpListen"`    // plaintext over tcp, empty means disabled
+	UdpListen       string   `json:"udpListen"`    // plaintext over udp, empty means disabled
+	PickleListen    string   `json:"pickleListen"` // pickle over tcp, empty means disabled
+	Timeout         int      `json:"timeout"`      // sec, idle tcp connections are closed
+	Batch           int      `json:"batch"`        // at most so many values are received at once
+	Step            int      `json:"step"`         // sec
+	Separator       string   `json:"separator"`    // joins the parts of endpoint and metric, default "."
+	DefaultEndpoint string   `json:"defaultEndpoint"`
+	Templates       []string `json:"templates"`
+}
+
+// StatsD(with the tags of DogStatsD) events are aggregated and flushed every step seconds
+type StatsdConfig struct {
+	Enabled         bool   `json:"enabled"`
+	UdpListen       string `json:"udpListen"` // empty means disabled
+	TcpListen       string `json:"tcpListen"` // empty means disabled
+	Timeout         int    `json:"timeout"`   // sec, idle tcp connections are closed
+	Step            int    `json:"step"`      // sec, the flush interval
+	EndpointTag     string `json:"endpointTag"`
+	DefaultEndpoint string `json:"defaultEndpoint"` // used if the event has no endpoint tag, empty means the address of sender
+	Percentiles     []int  `json:"percentiles"`     // of timers
+	// gauges are flushed only if they are updated in the interval, otherwise the last values are kept and flushed
+	DeleteGauges bool `json:"deleteGauges"`
+}
+
+// The data points received by /write(influx line protocol) and /api/put(opentsdb) are mapped by tags
+type IngestConfig struct {
+	Enabled         bool     `json:"enabled"`
+	EndpointTag     string   `json:"endpointTag"`     // default "host"
+	DefaultEndpoint string   `json:"defaultEndpoint"` // used if the endpoint tag is absent, the data point is dropped if it is empty too
+	DropTags        []string `json:"dropTags"`
+	Step            int      `json:"step"` // sec
+	// metric => GAUGE/COUNTER, others are GAUGE
+	Types map[string]string `json:"types"`
+	// only for influx, the metric is <measurement><separator><field>, or <measurement> if the field is valueField
+	Separator  string `json:"separator"`
+	ValueField string `json:"valueField"`
+}
+
+// RecordingRule aggregates the matched series per step window, e.g.
+//
+//	{"name": "idc.net.if.in.bytes", "endpoint": "cluster", "expr": "sum by (idc) (metric=net.if.in.bytes, tags iface=eth0)"}
+type RecordingRule struct {
+	Name     string `json:"name"`     // metric of emitted series
+	Endpoint string `json:"endpoint"` // endpoint of emitted series
+	Expr     string `json:"expr"`
+}
+
+type RecordingConfig struct {
+	Enabled bool `json:"enabled"`
+	// sec, a window is evaluated after its end plus delay, for the late data
+	Delay int              `json:"delay"`
+	Rules []*RecordingRule `json:"rules"`
+	// 多个transfer时每条规则只在一个transfer(owner)上聚合, 其他transfer将匹配的数据转发给owner.
+	// peers为所有transfer的name => rpc地址, 各transfer必须相同; node为本transfer在peers中的name.
+	// peers为空时只能部署一个开启recording的transfer
+	Node  string            `json:"node"`
+	Peers map[string]string `json:"peers"`
+}
+
+// QuotaLimit is the limit of samples and distinct counters, 0 means no limit
+type QuotaLimit struct {
+	Rate   int `json:"rate"`   // samples/sec, averaged over the sliding window
+	Series int `json:"series"` // distinct counters
+}
+
+// PrefixLimit limits the metrics with the name prefix, summed over all endpoints
+type PrefixLimit struct {
+	Prefix string `json:"prefix"`
+	QuotaLimit
+}
+
+type LimitConfig struct {
+	Enabled   bool           `json:"enabled"`
+	Window    int            `json:"window"`    // sec, the sliding window of rate
+	SeriesTtl int            `json:"seriesTtl"` // sec, the counter not received for so long is not counted
+	Endpoint  QuotaLimit     `json:"endpoint"`  // per endpoint
+	Prefixes  []*PrefixLimit `json:"prefixes"`
+}
+
+// RelabelRule rewrites or drops the matched series, e.g.
+//
+//	{"match": {"metric": "app\\..*", "tags": {"pid": ".+"}}, "action": "drop_tag", "source": "pid"}
+type RelabelRule struct {
+	Match       *RelabelMatch `json:"match"`
+	Action      string        `json:"action"`
+	Source      string        `json:"source"` // __endpoint__, __metric__ or tag
+	Regex       string        `json:"regex"`
+	Target      string        `json:"target"` // __endpoint__, __metric__ or tag
+	Replacement string        `json:"replacement"`
+	Modulus     uint64        `json:"modulus"`
+}
+
+// RelabelMatch is the regexps which must match the whole endpoint, metric and tags
+type RelabelMatch struct {
+	Endpoint string            `json:"endpoint"`
+	Metric   string            `json:"metric"`
+	Tags     map[string]string `json:"tags"`
+}
+
+type RelabelConfig struct {
+	Enabled bool           `json:"enabled"`
+	Rules   []*RelabelRule `json:"rules"`
+}
+
 type GlobalConfig struct {
 	Debug    bool            `json:"debug"`
 	MinStep  int             `json:"minStep"` //最小周期,单位sec
@@ -108,6 +266,18 @@ type GlobalConfig struct {
 	Influxdb *InfluxdbConfig `json:"influxdb"`
 	NqmRest  *NqmRestConfig  `json:"nqmRest"`
 	Staging  *StagingConfig  `json:"staging"`
+	Spill    *SpillConfig    `json:"spill"`
+
+	Prometheus *PrometheusConfig `json:"prometheus"`
+	Graphite   *GraphiteConfig   `json:"graphite"`
+	Statsd     *StatsdConfig     `json:"statsd"`
+
+	InfluxWrite *IngestConfig `json:"influxWrite"`
+	OpentsdbPut *IngestConfig `json:"opentsdbPut"`
+
+	Recording *RecordingConfig `json:"recording"`
+	Limit     *LimitConfig     `json:"limit"`
+	Relabel   *RelabelConfig   `json:"relabel"`
 }
 
 var (
@@ -147,6 +317,18 @@ func ParseConfig(cfg string) {
 	// split cluster config
 	c.Judge.ClusterList = formatClusterItems(c.Judge.Cluster)
 	c.Graph.ClusterList = formatClusterItems(c.Graph.Cluster)
+	if err := formatGraphRings(c.Graph); err != nil {
+		log.Fatalln("parse config file:", cfg, "fail:", err)
+	}
+
+	c.Prometheus = formatPrometheusConfig(c.Prometheus)
+	c.Graphite = formatGraphiteConfig(c.Graphite)
+	c.Statsd = formatStatsdConfig(c.Statsd)
+	c.InfluxWrite = formatIngestConfig(c.InfluxWrite)
+	c.OpentsdbPut = formatIngestConfig(c.OpentsdbPut)
+	c.Recording = formatRecordingConfig(c.Recording)
+	c.Limit = formatLimitConfig(c.Limit)
+	c.Relabel = formatRelabelConfig(c.Relabel)
 
 	configLock.Lock()
 	defer configLock.Unlock()
@@ -178,3 +360,223 @@ func formatClusterItems(cluster map[string]string) map[string]*ClusterNode {
 
 	return ret
 }
+
+// formatGraphRings checks the next ring, a node in both rings must have the same addresses
+func formatGraphRings(c *GraphConfig) error {
+	if c.Next == nil {
+		return nil
+	}
+	if c.Next.Version <= c.Version {
+		return fmt.Errorf("version of next graph ring must be greater than %d", c.Version)
+	}
+	c.Next.ClusterList = formatClusterItems(c.Next.Cluster)
+	for name, node := range c.Next.ClusterList {
+		if current, ok := c.ClusterList[name]; ok && strings.Join(current.Addrs, ",") != strings.Join(node.Addrs, ",") {
+			return fmt.Errorf("graph node %s has different addresses in next ring", name)
+		}
+	}
+	return nil
+}
+
+func formatPrometheusConfig(c *PrometheusConfig) *PrometheusConfig {
+	if c == nil {
+		c = &PrometheusConfig{}
+	}
+	if c.EndpointLabel == "" {
+		c.EndpointLabel = "instance"
+	}
+	if c.Step <= 0 {
+		c.Step = DEFAULT_STEP
+	}
+	if c.CounterSuffixes == nil {
+		c.CounterSuffixes = []string{"_total", "_count", "_sum", "_bucket"}
+	}
+	for metric, typ := range c.Types {
+		if typ != GAUGE && typ != COUNTER {
+			log.Fatalln("type of prometheus metric", metric, "should be GAUGE or COUNTER, not", typ)
+		}
+	}
+	return c
+}
+
+func formatGraphiteConfig(c *GraphiteConfig) *GraphiteConfig {
+	if c == nil {
+		c = &GraphiteConfig{}
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = 3600
+	}
+	if c.Batch <= 0 {
+		c.Batch = 1000
+	}
+	if c.Step <= 0 {
+		c.Step = DEFAULT_STEP
+	}
+	if c.Separator == "" {
+		c.Separator = "."
+	}
+	return c
+}
+
+func formatStatsdConfig(c *StatsdConfig) *StatsdConfig {
+	if c == nil {
+		c = &StatsdConfig{}
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = 3600
+	}
+	if c.Step <= 0 {
+		c.Step = DEFAULT_STEP
+	}
+	if c.EndpointTag == "" {
+		c.EndpointTag = "host"
+	}
+	if c.Percentiles == nil {
+		c.Percentiles = []int{90, 99}
+	}
+	for _, p := range c.Percentiles {
+		if p <= 0 || p > 100 {
+			log.Fatalln("percentile of statsd should be in 1 ~ 100, not", p)
+		}
+	}
+	return c
+}
+
+func formatIngestConfig(c *IngestConfig) *IngestConfig {
+	if c == nil {
+		c = &IngestConfig{}
+	}
+	if c.EndpointTag == "" {
+		c.EndpointTag = "host"
+	}
+	if c.Step <= 0 {
+		c.Step = DEFAULT_STEP
+	}
+	if c.Separator == "" {
+		c.Separator = "."
+	}
+	if c.ValueField == "" {
+		c.ValueField = "value"
+	}
+	for metric, typ := range c.Types {
+		if typ != GAUGE && typ != COUNTER {
+			log.Fatalln("type of metric", metric, "should be GAUGE or COUNTER, not", typ)
+		}
+	}
+	return c
+}
+
+func formatRecordingConfig(c *RecordingConfig) *RecordingConfig {
+	if c == nil {
+		c = &RecordingConfig{}
+	}
+	if c.Delay <= 0 {
+		c.Delay = 30
+	}
+	return c
+}
+
+func formatLimitConfig(c *LimitConfig) *LimitConfig {
+	if c == nil {
+		c = &LimitConfig{}
+	}
+	if c.Window <= 0 {
+		c.Window = 60
+	}
+	if c.SeriesTtl <= 0 {
+		c.SeriesTtl = 3600
+	}
+	return c
+}
+
+func formatRelabelConfig(c *RelabelConfig) *RelabelConfig {
+	if c == nil {
+		c = &RelabelConfig{}
+	}
+	return c
+}
+
+// ReadRecordingConfig reads the recording rules from the config file again, for reloading
+func ReadRecordingConfig() (*RecordingConfig, error) {
+	configContent, err := file.ToTrimString(ConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	var c struct {
+		Recording *RecordingConfig `json:"recording"`
+	}
+	if err := json.Unmarshal([]byte(configContent), &c); err != nil {
+		return nil, err
+	}
+	return formatRecordingConfig(c.Recording), nil
+}
+
+// SetRecordingConfig replaces the recording rules of the global config
+func SetRecordingConfig(recording *RecordingConfig) {
+	configLock.Lock()
+	defer configLock.Unlock()
+	c := *config
+	c.Recording = recording
+	config = &c
+}
+
+// ReadRelabelConfig reads the relabel rules from the config file again, for reloading
+func ReadRelabelConfig() (*RelabelConfig, error) {
+	configContent, err := file.ToTrimString(ConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	var c struct {
+		Relabel *RelabelConfig `json:"relabel"`
+	}
+	if err := json.Unmarshal([]byte(configContent), &c); err != nil {
+		return nil, err
+	}
+	return formatRelabelConfig(c.Relabel), nil
+}
+
+// SetRelabelConfig replaces the relabel rules of the global config
+func SetRelabelConfig(relabel *RelabelConfig) {
+	configLock.Lock()
+	defer configLock.Unlock()
+	c := *config
+	c.Relabel = relabel
+	config = &c
+}
+
+// ReadGraphRings reads the graph rings from the config file again, for reloading
+func ReadGraphRings() (*GraphConfig, error) {
+	configContent, err := file.ToTrimString(ConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	var c struct {
+		Graph *GraphConfig `json:"graph"`
+	}
+	if err := json.Unmarshal([]byte(configContent), &c); err != nil {
+		return nil, err
+	}
+	if c.Graph == nil {
+		return nil, fmt.Errorf("no graph in config file")
+	}
+	c.Graph.ClusterList = formatClusterItems(c.Graph.Cluster)
+	if err := formatGraphRings(c.Graph); err != nil {
+		return nil, err
+	}
+	return c.Graph, nil
+}
+
+// SetGraphRings replaces the rings of graph in the global config, the other fields of graph are kept
+func SetGraphRings(rings *GraphConfig) {
+	configLock.Lock()
+	defer configLock.Unlock()
+	c := *config
+	graph := *c.Graph
+	graph.Version = rings.Version
+	graph.Replicas = rings.Replicas
+	graph.Cluster = rings.Cluster
+	graph.ClusterList = rings.ClusterList
+	graph.Next = rings.Next
+	c.Graph = &graph
+	config = &c
+}
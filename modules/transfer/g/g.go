@@ -15,9 +15,17 @@ import (
 // 0.0.15: support tsdb
 // 0.0.16: support config of min step
 // 0.0.17: remove migrating, which is implemented in graph
+// 0.0.18: support prometheus remote write
+// 0.0.19: support graphite plaintext and pickle
+// 0.0.20: support statsd
+// 0.0.21: support influx line protocol and opentsdb put
+// 0.0.22: support recording rules
+// 0.0.23: support ingestion quotas
+// 0.0.24: support relabel rules
+// 0.0.25: support rebalancing graph with ring versions
 
 const (
-	VERSION      = "0.0.17"
+	VERSION      = "0.0.25"
 	GAUGE        = "GAUGE"
 	COUNTER      = "COUNTER"
 	DERIVE       = "DERIVE"
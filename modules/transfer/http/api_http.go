@@ -3,6 +3,7 @@ package http
 import (
 	"encoding/json"
 	trpc "github.com/Cepave/open-falcon-backend/modules/transfer/receiver/rpc"
+	"github.com/Cepave/open-falcon-backend/modules/transfer/relabel"
 	cmodel "github.com/open-falcon/common/model"
 	"net/http"
 )
@@ -27,4 +28,22 @@ func configApiHttpRoutes() {
 
 		RenderDataJson(w, reply)
 	})
+
+	// shows what the values would become by the relabel rules, the values are not sent
+	http.HandleFunc("/api/relabel/dryrun", func(w http.ResponseWriter, req *http.Request) {
+		if req.ContentLength == 0 {
+			http.Error(w, "blank body", http.StatusBadRequest)
+			return
+		}
+
+		decoder := json.NewDecoder(req.Body)
+		var metrics []*cmodel.MetricValue
+		err := decoder.Decode(&metrics)
+		if err != nil {
+			http.Error(w, "decode error", http.StatusBadRequest)
+			return
+		}
+
+		RenderDataJson(w, relabel.DryRun(metrics))
+	})
 }
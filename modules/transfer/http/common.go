@@ -5,6 +5,9 @@ import (
 	"net/http"
 
 	"github.com/Cepave/open-falcon-backend/modules/transfer/g"
+	"github.com/Cepave/open-falcon-backend/modules/transfer/recording"
+	"github.com/Cepave/open-falcon-backend/modules/transfer/relabel"
+	"github.com/Cepave/open-falcon-backend/modules/transfer/sender"
 	"github.com/toolkits/file"
 )
 
@@ -25,7 +28,33 @@ func configCommonRoutes() {
 		RenderDataJson(w, g.Config())
 	})
 
+	// only the recording rules and the relabel rules are reloaded, the others need restart
 	http.HandleFunc("/config/reload", func(w http.ResponseWriter, r *http.Request) {
-		RenderDataJson(w, "/config/reload is not suppored in transfer now. Please use restart instead.")
+		if err := recording.Reload(); err != nil {
+			RenderMsgJson(w, "reload recording rules fail: "+err.Error())
+			return
+		}
+		if err := relabel.Reload(); err != nil {
+			RenderMsgJson(w, "reload relabel rules fail: "+err.Error())
+			return
+		}
+		RenderDataJson(w, "recording rules and relabel rules are reloaded. The other configurations need restart.")
+	})
+
+	http.HandleFunc("/recording/rules", func(w http.ResponseWriter, r *http.Request) {
+		RenderDataJson(w, recording.Status())
+	})
+
+	http.HandleFunc("/graph/ring", func(w http.ResponseWriter, r *http.Request) {
+		RenderDataJson(w, sender.GetGraphRingStatus())
+	})
+
+	// starts or cuts over the rebalancing of graph by the rings in config file
+	http.HandleFunc("/graph/ring/reload", func(w http.ResponseWriter, r *http.Request) {
+		if err := sender.ReloadGraphRings(); err != nil {
+			RenderMsgJson(w, "reload graph rings fail: "+err.Error())
+			return
+		}
+		RenderDataJson(w, sender.GetGraphRingStatus())
 	})
 }
@@ -30,6 +30,8 @@ func startHttpServer() {
 	configProcHttpRoutes()
 	configDebugHttpRoutes()
 	configApiHttpRoutes()
+	configPrometheusHttpRoutes()
+	configIngestHttpRoutes()
 
 	s := &http.Server{
 		Addr:           addr,
@@ -0,0 +1,246 @@
+package http
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Cepave/open-falcon-backend/modules/transfer/g"
+	"github.com/Cepave/open-falcon-backend/modules/transfer/proc"
+	"github.com/Cepave/open-falcon-backend/modules/transfer/receiver/influx"
+	"github.com/Cepave/open-falcon-backend/modules/transfer/receiver/opentsdb"
+	trpc "github.com/Cepave/open-falcon-backend/modules/transfer/receiver/rpc"
+	cmodel "github.com/open-falcon/common/model"
+)
+
+// the longest line of influx line protocol
+const maxLineSize = 1024 * 1024
+
+// the max size of the request body, and of the body decompressed by gzip
+var (
+	maxIngestBodySize   int64 = 16 * 1024 * 1024
+	maxDecompressedSize int64 = 64 * 1024 * 1024
+)
+
+var errBodyTooLarge = errors.New("the request body is too large")
+
+func configIngestHttpRoutes() {
+	// influx line protocol, e.g. from telegraf
+	http.HandleFunc("/write", func(w http.ResponseWriter, req *http.Request) {
+		cfg := g.Config().InfluxWrite
+		if !cfg.Enabled {
+			http.Error(w, "influx write is disabled", http.StatusNotFound)
+			return
+		}
+
+		precision := req.URL.Query().Get("precision")
+		if _, err := influx.ToUnix(0, precision); err != nil {
+			renderJsonStatus(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		body, err := requestBody(req)
+		if err != nil {
+			renderJsonStatus(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		defer body.Close()
+
+		now := time.Now().Unix()
+		dropped := make(map[string]int)
+		metrics := []*cmodel.MetricValue{}
+		badLines, firstErr := 0, ""
+
+		scanner := bufio.NewScanner(body)
+		scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || line[0] == '#' {
+				continue
+			}
+			point, err := influx.ParseLine(line)
+			if err != nil {
+				if badLines++; firstErr == "" {
+					firstErr = fmt.Sprintf("unable to parse '%s': %v", line, err)
+				}
+				continue
+			}
+			metrics = append(metrics, influx.Convert(point, cfg, precision, now, dropped)...)
+		}
+		if err := scanner.Err(); err == errBodyTooLarge {
+			// the lines before the limit are not accepted either
+			renderJsonStatus(w, http.StatusRequestEntityTooLarge, map[string]string{"error": err.Error()})
+			return
+		} else if err != nil && firstErr == "" {
+			badLines++
+			firstErr = err.Error()
+		}
+
+		proc.InfluxInvalidCnt.IncrReason("bad_line", int64(badLines))
+		for reason, n := range dropped {
+			proc.InfluxInvalidCnt.IncrReason(reason, int64(n))
+		}
+
+		reply := &cmodel.TransferResponse{}
+		trpc.RecvMetricValues(metrics, reply, "influx")
+		proc.InfluxInvalidCnt.IncrReason("invalid", int64(reply.Invalid))
+
+		// the good lines are accepted even if some lines are bad, as influxdb does
+		if badLines > 0 {
+			renderJsonStatus(w, http.StatusBadRequest, map[string]string{"error": "partial write: " + firstErr})
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	// opentsdb put, e.g. from collectd
+	http.HandleFunc("/api/put", func(w http.ResponseWriter, req *http.Request) {
+		cfg := g.Config().OpentsdbPut
+		if !cfg.Enabled {
+			http.Error(w, "opentsdb put is disabled", http.StatusNotFound)
+			return
+		}
+
+		body, err := requestBody(req)
+		if err != nil {
+			renderTsdbError(w, err.Error())
+			return
+		}
+		defer body.Close()
+		bs, err := ioutil.ReadAll(body)
+		if err == errBodyTooLarge {
+			renderJsonStatus(w, http.StatusRequestEntityTooLarge, map[string]interface{}{
+				"error": map[string]interface{}{"code": http.StatusRequestEntityTooLarge, "message": err.Error()},
+			})
+			return
+		}
+		if err != nil {
+			renderTsdbError(w, err.Error())
+			return
+		}
+		points, err := opentsdb.DecodePut(bs)
+		if err != nil {
+			proc.OpentsdbInvalidCnt.IncrReason("bad_json", 1)
+			renderTsdbError(w, "unable to parse the request: "+err.Error())
+			return
+		}
+
+		type tsdbError struct {
+			Datapoint *opentsdb.DataPoint `json:"datapoint"`
+			Error     string              `json:"error"`
+		}
+		errs := []tsdbError{}
+		metrics := make([]*cmodel.MetricValue, 0, len(points))
+		for _, p := range points {
+			if p == nil {
+				continue
+			}
+			m, err := opentsdb.Convert(p, cfg)
+			if err != nil {
+				reason := "malformed"
+				if e, ok := err.(*opentsdb.InvalidError); ok {
+					reason = e.Reason
+				}
+				proc.OpentsdbInvalidCnt.IncrReason(reason, 1)
+				errs = append(errs, tsdbError{p, err.Error()})
+				continue
+			}
+			metrics = append(metrics, m)
+		}
+
+		reply := &cmodel.TransferResponse{}
+		trpc.RecvMetricValues(metrics, reply, "opentsdb")
+		proc.OpentsdbInvalidCnt.IncrReason("invalid", int64(reply.Invalid))
+
+		failed := len(errs) + reply.Invalid
+		status := http.StatusNoContent
+		if failed > 0 {
+			status = http.StatusBadRequest
+		}
+
+		query := req.URL.Query()
+		_, details := query["details"]
+		_, summary := query["summary"]
+		if details || summary {
+			if status == http.StatusNoContent {
+				status = http.StatusOK
+			}
+			resp := map[string]interface{}{
+				"success": len(metrics) - reply.Invalid,
+				"failed":  failed,
+			}
+			if details {
+				resp["errors"] = errs
+			}
+			renderJsonStatus(w, status, resp)
+			return
+		}
+		if failed > 0 {
+			renderTsdbError(w, fmt.Sprintf("%d data points failed, please use the 'details' flag for more information", failed))
+			return
+		}
+		w.WriteHeader(status)
+	})
+}
+
+// requestBody decompresses the gzip body, reading more than the limits returns errBodyTooLarge
+func requestBody(req *http.Request) (io.ReadCloser, error) {
+	body := newLimitedReader(req.Body, maxIngestBodySize)
+	if req.Header.Get("Content-Encoding") != "gzip" {
+		return body, nil
+	}
+	gz, err := gzip.NewReader(body)
+	if err != nil {
+		return nil, err
+	}
+	return newLimitedReader(gz, maxDecompressedSize), nil
+}
+
+// limitedReader returns errBodyTooLarge instead of EOF as io.LimitReader, when the body is longer than max
+type limitedReader struct {
+	r    io.Reader
+	c    io.Closer
+	read int64
+	max  int64
+}
+
+func newLimitedReader(rc io.ReadCloser, max int64) *limitedReader {
+	return &limitedReader{r: io.LimitReader(rc, max+1), c: rc, max: max}
+}
+
+func (this *limitedReader) Read(p []byte) (int, error) {
+	n, err := this.r.Read(p)
+	this.read += int64(n)
+	if this.read > this.max {
+		return n, errBodyTooLarge
+	}
+	return n, err
+}
+
+func (this *limitedReader) Close() error {
+	return this.c.Close()
+}
+
+func renderTsdbError(w http.ResponseWriter, msg string) {
+	renderJsonStatus(w, http.StatusBadRequest, map[string]interface{}{
+		"error": map[string]interface{}{"code": http.StatusBadRequest, "message": msg},
+	})
+}
+
+func renderJsonStatus(w http.ResponseWriter, status int, v interface{}) {
+	bs, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	w.Write(bs)
+}
@@ -0,0 +1,104 @@
+package http
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Cepave/open-falcon-backend/modules/transfer/g"
+)
+
+func gzipped(t *testing.T, bs []byte) []byte {
+	buf := &bytes.Buffer{}
+	zw := gzip.NewWriter(buf)
+	if _, err := zw.Write(bs); err != nil {
+		t.Fatal(err)
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+func readRequestBody(body []byte, gzipEncoded bool) ([]byte, error) {
+	req := httptest.NewRequest("POST", "/api/put", bytes.NewReader(body))
+	if gzipEncoded {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	rc, err := requestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return ioutil.ReadAll(rc)
+}
+
+// setSmallLimits returns the function to restore the limits
+func setSmallLimits() func() {
+	body, decompressed := maxIngestBodySize, maxDecompressedSize
+	maxIngestBodySize, maxDecompressedSize = 4096, 16384
+	return func() {
+		maxIngestBodySize, maxDecompressedSize = body, decompressed
+	}
+}
+
+func TestRequestBodyLimit(t *testing.T) {
+	defer setSmallLimits()()
+
+	exact := bytes.Repeat([]byte("a"), int(maxIngestBodySize))
+	if bs, err := readRequestBody(exact, false); err != nil || int64(len(bs)) != maxIngestBodySize {
+		t.Errorf("the body of max size should be read, got %d bytes, err %v", len(bs), err)
+	}
+	if _, err := readRequestBody(append(exact, 'a'), false); err != errBodyTooLarge {
+		t.Errorf("expected errBodyTooLarge, got %v", err)
+	}
+
+	// the gzip bomb, small compressed but large decompressed
+	bomb := gzipped(t, make([]byte, maxDecompressedSize+1))
+	if int64(len(bomb)) > maxIngestBodySize {
+		t.Fatalf("the compressed body should be small, got %d bytes", len(bomb))
+	}
+	if _, err := readRequestBody(bomb, true); err != errBodyTooLarge {
+		t.Errorf("expected errBodyTooLarge of the decompressed body, got %v", err)
+	}
+
+	// the compressed body is too large
+	random := make([]byte, maxIngestBodySize+1024)
+	rand.Read(random)
+	if _, err := readRequestBody(gzipped(t, random), true); err == nil {
+		t.Error("expected error of the compressed body")
+	}
+
+	if bs, err := readRequestBody(gzipped(t, []byte("cpu value=1")), true); err != nil || string(bs) != "cpu value=1" {
+		t.Errorf("unexpected body %q, err %v", bs, err)
+	}
+}
+
+func TestIngestTooLarge(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "transfer")
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "cfg.json")
+	cfg := `{"judge": {}, "graph": {}, "influxWrite": {"enabled": true}, "opentsdbPut": {"enabled": true}}`
+	if err := ioutil.WriteFile(filename, []byte(cfg), 0644); err != nil {
+		t.Fatal(err)
+	}
+	g.ParseConfig(filename)
+	configIngestHttpRoutes()
+	defer setSmallLimits()()
+
+	line := []byte("cpu,host=web-1 value=1\n")
+	body := gzipped(t, bytes.Repeat(line, int(maxDecompressedSize)/len(line)+1))
+	for _, path := range []string{"/write", "/api/put"} {
+		req := httptest.NewRequest("POST", path, bytes.NewReader(body))
+		req.Header.Set("Content-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		http.DefaultServeMux.ServeHTTP(w, req)
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("%s: expected 413, got %d %s", path, w.Code, w.Body.String())
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/Cepave/open-falcon-backend/modules/transfer/limit"
 	"github.com/Cepave/open-falcon-backend/modules/transfer/proc"
 	"github.com/Cepave/open-falcon-backend/modules/transfer/sender"
 	cutils "github.com/open-falcon/common/utils"
@@ -26,6 +27,21 @@ func configProcHttpRoutes() {
 		RenderDataJson(w, map[string]interface{}{"min_step": sender.MinStep})
 	})
 
+	// spill queues of judge/graph
+	http.HandleFunc("/proc/spill", func(w http.ResponseWriter, r *http.Request) {
+		RenderDataJson(w, sender.GetSpillStatus())
+	})
+
+	// the endpoints with the most counters, ?n=20
+	http.HandleFunc("/proc/limit/top", func(w http.ResponseWriter, r *http.Request) {
+		n, err := strconv.Atoi(r.FormValue("n"))
+		if err != nil || n <= 0 {
+			n = 20
+		}
+		endpoints, prefixes := limit.Top(n)
+		RenderDataJson(w, map[string]interface{}{"endpoints": endpoints, "prefixes": prefixes})
+	})
+
 	// trace
 	http.HandleFunc("/trace/", func(w http.ResponseWriter, r *http.Request) {
 		urlParam := r.URL.Path[len("/trace/"):]
@@ -0,0 +1,54 @@
+package http
+
+import (
+	"io/ioutil"
+	"net/http"
+
+	"github.com/Cepave/open-falcon-backend/modules/transfer/g"
+	"github.com/Cepave/open-falcon-backend/modules/transfer/proc"
+	"github.com/Cepave/open-falcon-backend/modules/transfer/receiver/prometheus"
+	trpc "github.com/Cepave/open-falcon-backend/modules/transfer/receiver/rpc"
+	log "github.com/Sirupsen/logrus"
+	cmodel "github.com/open-falcon/common/model"
+)
+
+// the max size of the snappy compressed body of remote write
+const maxPromBodySize = 8 * 1024 * 1024
+
+func configPrometheusHttpRoutes() {
+	// receiver of prometheus remote write
+	http.HandleFunc("/api/v1/write", func(w http.ResponseWriter, req *http.Request) {
+		cfg := g.Config().Prometheus
+		if !cfg.Enabled {
+			http.Error(w, "prometheus remote write is disabled", http.StatusNotFound)
+			return
+		}
+
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, req.Body, maxPromBodySize))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		writeReq, err := prometheus.DecodeWriteRequest(body)
+		if err == prometheus.ErrTooLarge {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			// a bad request is not retried by prometheus
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		metrics, dropped := prometheus.Convert(writeReq, cfg)
+		proc.PromDropCnt.IncrBy(int64(dropped))
+
+		reply := &cmodel.TransferResponse{}
+		trpc.RecvMetricValues(metrics, reply, "prometheus")
+		if g.Config().Debug && (dropped > 0 || reply.Invalid > 0) {
+			log.Debugf("prometheus remote write: %d samples are dropped, %s", dropped, reply)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
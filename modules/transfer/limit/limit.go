@@ -0,0 +1,296 @@
+package limit
+
+import (
+	"hash/fnv"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Cepave/open-falcon-backend/modules/transfer/g"
+	cmodel "github.com/open-falcon/common/model"
+)
+
+// reasons of rejection, which are counted in proc.LimitRejectCnt
+const (
+	EndpointRate   = "endpoint_rate"
+	EndpointSeries = "endpoint_series"
+	PrefixRate     = "prefix_rate"
+	PrefixSeries   = "prefix_series"
+)
+
+const buckets = 10
+
+// rateWindow counts the samples of the sliding window by buckets
+type rateWindow struct {
+	width  int64
+	counts [buckets]int64
+	starts [buckets]int64
+}
+
+func newRateWindow(window int64) *rateWindow {
+	width := window / buckets
+	if width <= 0 {
+		width = 1
+	}
+	return &rateWindow{width: width}
+}
+
+// span is the length of the window in seconds, which is rounded to the buckets
+func (this *rateWindow) span() int64 {
+	return this.width * buckets
+}
+
+func (this *rateWindow) count(now int64) int64 {
+	var sum int64
+	oldest := now - this.span()
+	for i := range this.counts {
+		if this.starts[i] > oldest {
+			sum += this.counts[i]
+		}
+	}
+	return sum
+}
+
+func (this *rateWindow) add(now int64, n int64) {
+	start := now - now%this.width
+	i := (now / this.width) % buckets
+	if this.starts[i] != start {
+		this.starts[i] = start
+		this.counts[i] = 0
+	}
+	this.counts[i] += n
+}
+
+type quota struct {
+	limit    g.QuotaLimit
+	rate     *rateWindow
+	series   map[string]int64 // pk => last received
+	rejected int64
+}
+
+func newQuota(limit g.QuotaLimit, window int64) *quota {
+	return &quota{limit: limit, rate: newRateWindow(window), series: make(map[string]int64)}
+}
+
+// check returns the reason if the sample of pk exceeds the quota
+func (this *quota) check(pk string, now int64, rateReason, seriesReason string) string {
+	if this.limit.Rate > 0 && this.rate.count(now) >= int64(this.limit.Rate)*this.rate.span() {
+		return rateReason
+	}
+	if this.limit.Series > 0 && len(this.series) >= this.limit.Series {
+		if _, ok := this.series[pk]; !ok {
+			return seriesReason
+		}
+	}
+	return ""
+}
+
+func (this *quota) accept(pk string, now int64) {
+	this.rate.add(now, 1)
+	this.series[pk] = now
+}
+
+func (this *quota) expire(before int64) {
+	for pk, ts := range this.series {
+		if ts < before {
+			delete(this.series, pk)
+		}
+	}
+}
+
+// the endpoints are sharded by hash, every shard has its own lock
+const shards = 32
+
+type endpointShard struct {
+	sync.Mutex
+	quotas map[string]*quota
+}
+
+type prefixQuota struct {
+	sync.Mutex
+	prefix string
+	*quota
+}
+
+// Limiter enforces the quotas per endpoint and per metric name prefix.
+// The lock of endpoint shard is always taken before the lock of prefix.
+type Limiter struct {
+	window    int64
+	ttl       int64
+	endpoint  g.QuotaLimit
+	endpoints [shards]*endpointShard
+	prefixes  []*prefixQuota
+}
+
+func NewLimiter(cfg *g.LimitConfig) *Limiter {
+	this := &Limiter{
+		window:   int64(cfg.Window),
+		ttl:      int64(cfg.SeriesTtl),
+		endpoint: cfg.Endpoint,
+	}
+	for i := range this.endpoints {
+		this.endpoints[i] = &endpointShard{quotas: make(map[string]*quota)}
+	}
+	for _, p := range cfg.Prefixes {
+		this.prefixes = append(this.prefixes, &prefixQuota{prefix: p.Prefix, quota: newQuota(p.QuotaLimit, this.window)})
+	}
+	return this
+}
+
+func (this *Limiter) shard(endpoint string) *endpointShard {
+	h := fnv.New32a()
+	h.Write([]byte(endpoint))
+	return this.endpoints[h.Sum32()%shards]
+}
+
+// Allow accepts the sample and returns "", or returns the reason of rejection.
+// The sample is accounted to its endpoint and to the first matched prefix.
+func (this *Limiter) Allow(d *cmodel.MetaData, now int64) string {
+	pk := d.PK()
+
+	var pq *prefixQuota
+	for _, p := range this.prefixes {
+		if strings.HasPrefix(d.Metric, p.prefix) {
+			pq = p
+			break
+		}
+	}
+
+	shard := this.shard(d.Endpoint)
+	shard.Lock()
+	defer shard.Unlock()
+
+	eq, ok := shard.quotas[d.Endpoint]
+	if !ok {
+		eq = newQuota(this.endpoint, this.window)
+		shard.quotas[d.Endpoint] = eq
+	}
+
+	if reason := eq.check(pk, now, EndpointRate, EndpointSeries); reason != "" {
+		eq.rejected++
+		return reason
+	}
+	if pq != nil {
+		pq.Lock()
+		reason := pq.check(pk, now, PrefixRate, PrefixSeries)
+		if reason != "" {
+			pq.rejected++
+		} else {
+			pq.accept(pk, now)
+		}
+		pq.Unlock()
+		if reason != "" {
+			eq.rejected++
+			return reason
+		}
+	}
+	eq.accept(pk, now)
+	return ""
+}
+
+// Expire forgets the counters not received since now-ttl, and the idle endpoints
+func (this *Limiter) Expire(now int64) {
+	before := now - this.ttl
+	for _, shard := range this.endpoints {
+		shard.Lock()
+		for endpoint, eq := range shard.quotas {
+			eq.expire(before)
+			if len(eq.series) == 0 {
+				delete(shard.quotas, endpoint)
+			}
+		}
+		shard.Unlock()
+	}
+	for _, pq := range this.prefixes {
+		pq.Lock()
+		pq.expire(before)
+		pq.Unlock()
+	}
+}
+
+// Offender is the usage of an endpoint or a prefix
+type Offender struct {
+	Endpoint string  `json:"endpoint,omitempty"`
+	Prefix   string  `json:"prefix,omitempty"`
+	Series   int     `json:"series"`
+	Rate     float64 `json:"rate"` // samples/sec over the sliding window
+	Rejected int64   `json:"rejected"`
+}
+
+func (this *Limiter) offender(q *quota, now int64) *Offender {
+	return &Offender{
+		Series:   len(q.series),
+		Rate:     float64(q.rate.count(now)) / float64(q.rate.span()),
+		Rejected: q.rejected,
+	}
+}
+
+// Top returns the n endpoints with the most counters, and the usage of prefixes
+func (this *Limiter) Top(n int, now int64) (endpoints []*Offender, prefixes []*Offender) {
+	endpoints = []*Offender{}
+	for _, shard := range this.endpoints {
+		shard.Lock()
+		for endpoint, eq := range shard.quotas {
+			o := this.offender(eq, now)
+			o.Endpoint = endpoint
+			endpoints = append(endpoints, o)
+		}
+		shard.Unlock()
+	}
+	sort.Sort(bySeries(endpoints))
+	if n > 0 && len(endpoints) > n {
+		endpoints = endpoints[:n]
+	}
+
+	prefixes = make([]*Offender, 0, len(this.prefixes))
+	for _, pq := range this.prefixes {
+		pq.Lock()
+		o := this.offender(pq.quota, now)
+		pq.Unlock()
+		o.Prefix = pq.prefix
+		prefixes = append(prefixes, o)
+	}
+	return
+}
+
+type bySeries []*Offender
+
+func (s bySeries) Len() int      { return len(s) }
+func (s bySeries) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s bySeries) Less(i, j int) bool {
+	if s[i].Series != s[j].Series {
+		return s[i].Series > s[j].Series
+	}
+	return s[i].Endpoint < s[j].Endpoint
+}
+
+var limiter *Limiter
+
+func Start() {
+	cfg := g.Config().Limit
+	if !cfg.Enabled {
+		return
+	}
+	limiter = NewLimiter(cfg)
+	go func() {
+		for now := range time.Tick(time.Minute) {
+			limiter.Expire(now.Unix())
+		}
+	}()
+}
+
+// Allow checks the sample with the quotas, it always returns "" if limit is disabled
+func Allow(d *cmodel.MetaData, now int64) string {
+	if limiter == nil {
+		return ""
+	}
+	return limiter.Allow(d, now)
+}
+
+func Top(n int) (endpoints []*Offender, prefixes []*Offender) {
+	if limiter == nil {
+		return []*Offender{}, []*Offender{}
+	}
+	return limiter.Top(n, time.Now().Unix())
+}
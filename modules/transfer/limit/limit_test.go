@@ -0,0 +1,120 @@
+package limit
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/Cepave/open-falcon-backend/modules/transfer/g"
+	cmodel "github.com/open-falcon/common/model"
+)
+
+func item(endpoint, metric string, i int) *cmodel.MetaData {
+	return &cmodel.MetaData{Endpoint: endpoint, Metric: metric, Tags: map[string]string{"i": fmt.Sprint(i)}, Step: 60}
+}
+
+func TestSeriesLimit(t *testing.T) {
+	l := NewLimiter(&g.LimitConfig{Window: 60, SeriesTtl: 600, Endpoint: g.QuotaLimit{Series: 3}})
+
+	for i := 0; i < 3; i++ {
+		if reason := l.Allow(item("host-1", "cpu.idle", i), 1000); reason != "" {
+			t.Fatalf("series %d is rejected: %s", i, reason)
+		}
+	}
+	if reason := l.Allow(item("host-1", "cpu.idle", 3), 1000); reason != EndpointSeries {
+		t.Fatalf("expected %s, got %q", EndpointSeries, reason)
+	}
+	// the known series and the other endpoints are not affected
+	if reason := l.Allow(item("host-1", "cpu.idle", 0), 1001); reason != "" {
+		t.Fatalf("known series is rejected: %s", reason)
+	}
+	if reason := l.Allow(item("host-2", "cpu.idle", 3), 1001); reason != "" {
+		t.Fatalf("other endpoint is rejected: %s", reason)
+	}
+
+	// series 1 and 2 are expired
+	l.Expire(1601)
+	if reason := l.Allow(item("host-1", "cpu.idle", 3), 1700); reason != "" {
+		t.Fatalf("series is rejected after expiring: %s", reason)
+	}
+
+	endpoints, _ := l.Top(1, 1700)
+	if len(endpoints) != 1 || endpoints[0].Endpoint != "host-1" || endpoints[0].Series != 2 || endpoints[0].Rejected != 1 {
+		t.Fatalf("unexpected top: %+v", endpoints[0])
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	l := NewLimiter(&g.LimitConfig{Window: 10, SeriesTtl: 600, Endpoint: g.QuotaLimit{Rate: 2}})
+
+	// 2/sec over 10 seconds
+	for i := 0; i < 20; i++ {
+		if reason := l.Allow(item("host-1", "cpu.idle", 0), 1000); reason != "" {
+			t.Fatalf("sample %d is rejected: %s", i, reason)
+		}
+	}
+	if reason := l.Allow(item("host-1", "cpu.idle", 0), 1005); reason != EndpointRate {
+		t.Fatalf("expected %s, got %q", EndpointRate, reason)
+	}
+	// the samples of 1000 slide out of the window
+	if reason := l.Allow(item("host-1", "cpu.idle", 0), 1010); reason != "" {
+		t.Fatalf("sample is rejected after sliding: %s", reason)
+	}
+}
+
+func TestPrefixLimit(t *testing.T) {
+	l := NewLimiter(&g.LimitConfig{
+		Window:    60,
+		SeriesTtl: 600,
+		Prefixes: []*g.PrefixLimit{
+			{Prefix: "app.", QuotaLimit: g.QuotaLimit{Series: 2}},
+		},
+	})
+
+	l.Allow(item("host-1", "app.qps", 0), 1000)
+	l.Allow(item("host-2", "app.qps", 0), 1000)
+	if reason := l.Allow(item("host-3", "app.qps", 0), 1000); reason != PrefixSeries {
+		t.Fatalf("expected %s, got %q", PrefixSeries, reason)
+	}
+	if reason := l.Allow(item("host-3", "cpu.idle", 0), 1000); reason != "" {
+		t.Fatalf("unmatched metric is rejected: %s", reason)
+	}
+
+	_, prefixes := l.Top(10, 1000)
+	if len(prefixes) != 1 || prefixes[0].Series != 2 || prefixes[0].Rejected != 1 {
+		t.Fatalf("unexpected prefixes: %+v", prefixes)
+	}
+}
+
+func TestConcurrentAllow(t *testing.T) {
+	l := NewLimiter(&g.LimitConfig{
+		Window:    60,
+		SeriesTtl: 600,
+		Endpoint:  g.QuotaLimit{Series: 10},
+		Prefixes: []*g.PrefixLimit{
+			{Prefix: "app.", QuotaLimit: g.QuotaLimit{Series: 100}},
+		},
+	})
+
+	var wg sync.WaitGroup
+	for h := 0; h < 20; h++ {
+		wg.Add(1)
+		go func(h int) {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				l.Allow(item(fmt.Sprintf("host-%d", h), "app.qps", i), 1000)
+			}
+		}(h)
+	}
+	wg.Wait()
+
+	endpoints, prefixes := l.Top(0, 1000)
+	series, rejected := 0, int64(0)
+	for _, o := range endpoints {
+		series += o.Series
+		rejected += o.Rejected
+	}
+	if len(endpoints) != 20 || series != 100 || rejected != 300 || prefixes[0].Series != 100 {
+		t.Fatalf("unexpected usage: %d endpoints, %d series, %d rejected, prefixes %+v", len(endpoints), series, rejected, prefixes[0])
+	}
+}
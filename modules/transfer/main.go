@@ -8,8 +8,11 @@ import (
 	"github.com/Cepave/open-falcon-backend/common/vipercfg"
 	"github.com/Cepave/open-falcon-backend/modules/transfer/g"
 	"github.com/Cepave/open-falcon-backend/modules/transfer/http"
+	"github.com/Cepave/open-falcon-backend/modules/transfer/limit"
 	"github.com/Cepave/open-falcon-backend/modules/transfer/proc"
 	"github.com/Cepave/open-falcon-backend/modules/transfer/receiver"
+	"github.com/Cepave/open-falcon-backend/modules/transfer/recording"
+	"github.com/Cepave/open-falcon-backend/modules/transfer/relabel"
 	"github.com/Cepave/open-falcon-backend/modules/transfer/sender"
 )
 
@@ -37,6 +40,9 @@ func main() {
 	proc.Start()
 
 	sender.Start()
+	recording.Start()
+	limit.Start()
+	relabel.Start()
 	receiver.Start()
 
 	// http
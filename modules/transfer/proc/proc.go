@@ -22,6 +22,34 @@ var (
 	RpcRecvCnt    = nproc.NewSCounterQps("RpcRecvCnt")
 	HttpRecvCnt   = nproc.NewSCounterQps("HttpRecvCnt")
 	SocketRecvCnt = nproc.NewSCounterQps("SocketRecvCnt")
+	PromRecvCnt   = nproc.NewSCounterQps("PromRecvCnt")
+	PromDropCnt   = nproc.NewSCounterQps("PromDropCnt")
+
+	GraphiteTcpRecvCnt    = nproc.NewSCounterQps("GraphiteTcpRecvCnt")
+	GraphiteUdpRecvCnt    = nproc.NewSCounterQps("GraphiteUdpRecvCnt")
+	GraphitePickleRecvCnt = nproc.NewSCounterQps("GraphitePickleRecvCnt")
+	GraphiteInvalidCnt    = nproc.NewSCounterQps("GraphiteInvalidCnt")
+
+	StatsdEventCnt   = nproc.NewSCounterQps("StatsdEventCnt")
+	StatsdRecvCnt    = nproc.NewSCounterQps("StatsdRecvCnt")
+	StatsdInvalidCnt = nproc.NewSCounterQps("StatsdInvalidCnt")
+
+	InfluxRecvCnt      = nproc.NewSCounterQps("InfluxRecvCnt")
+	InfluxInvalidCnt   = NewReasonCounter("InfluxInvalidCnt")
+	OpentsdbRecvCnt    = nproc.NewSCounterQps("OpentsdbRecvCnt")
+	OpentsdbInvalidCnt = NewReasonCounter("OpentsdbInvalidCnt")
+
+	// 预聚合
+	RecordingEmitCnt = nproc.NewSCounterQps("RecordingEmitCnt")
+	RecordingLateCnt = nproc.NewSCounterQps("RecordingLateCnt")
+	// 转发给规则owner的数据
+	RecordingForwardCnt     = nproc.NewSCounterQps("RecordingForwardCnt")
+	RecordingForwardFailCnt = nproc.NewSCounterQps("RecordingForwardFailCnt")
+
+	// limit
+	LimitRejectCnt = NewReasonCounter("LimitRejectCnt")
+
+	RelabelDropCnt = nproc.NewSCounterQps("RelabelDropCnt")
 
 	SendToJudgeCnt      = nproc.NewSCounterQps("SendToJudgeCnt")
 	SendToTsdbCnt       = nproc.NewSCounterQps("SendToTsdbCnt")
@@ -41,6 +69,9 @@ var (
 	SendToNqmTcpconnDropCnt = nproc.NewSCounterQps("SendToNqmTcpconnDropCnt")
 	SendToStagingDropCnt    = nproc.NewSCounterQps("SendToStagingDropCnt")
 
+	// 扩容graph时, 同时写入新环节点的数据
+	SendToGraphDoubleWriteCnt = nproc.NewSCounterQps("SendToGraphDoubleWriteCnt")
+
 	SendToJudgeFailCnt      = nproc.NewSCounterQps("SendToJudgeFailCnt")
 	SendToTsdbFailCnt       = nproc.NewSCounterQps("SendToTsdbFailCnt")
 	SendToGraphFailCnt      = nproc.NewSCounterQps("SendToGraphFailCnt")
@@ -57,6 +88,21 @@ var (
 	InfluxdbQueuesCnt = nproc.NewSCounterBase("InfluxdbSendCacheCnt")
 	NqmRpcQueuesCnt   = nproc.NewSCounterBase("NqmRpcSendCacheCnt")
 	StagingQueuesCnt  = nproc.NewSCounterBase("StagingSendCacheCnt")
+
+	// 落盘缓存
+	SpillToJudgeCnt      = nproc.NewSCounterQps("SpillToJudgeCnt")
+	SpillToGraphCnt      = nproc.NewSCounterQps("SpillToGraphCnt")
+	ReplayToJudgeCnt     = nproc.NewSCounterQps("ReplayToJudgeCnt")
+	ReplayToGraphCnt     = nproc.NewSCounterQps("ReplayToGraphCnt")
+	ReplayToJudgeFailCnt = nproc.NewSCounterQps("ReplayToJudgeFailCnt")
+	ReplayToGraphFailCnt = nproc.NewSCounterQps("ReplayToGraphFailCnt")
+
+	JudgeSpillCnt     = nproc.NewSCounterBase("JudgeSpillCacheCnt")
+	GraphSpillCnt     = nproc.NewSCounterBase("GraphSpillCacheCnt")
+	JudgeSpillBytes   = nproc.NewSCounterBase("JudgeSpillCacheBytes")
+	GraphSpillBytes   = nproc.NewSCounterBase("GraphSpillCacheBytes")
+	JudgeSpillDropCnt = nproc.NewSCounterBase("JudgeSpillDropCnt")
+	GraphSpillDropCnt = nproc.NewSCounterBase("GraphSpillDropCnt")
 )
 
 func Start() {
@@ -71,6 +117,25 @@ func GetAll() []interface{} {
 	ret = append(ret, RpcRecvCnt.Get())
 	ret = append(ret, HttpRecvCnt.Get())
 	ret = append(ret, SocketRecvCnt.Get())
+	ret = append(ret, PromRecvCnt.Get())
+	ret = append(ret, PromDropCnt.Get())
+	ret = append(ret, GraphiteTcpRecvCnt.Get())
+	ret = append(ret, GraphiteUdpRecvCnt.Get())
+	ret = append(ret, GraphitePickleRecvCnt.Get())
+	ret = append(ret, GraphiteInvalidCnt.Get())
+	ret = append(ret, StatsdEventCnt.Get())
+	ret = append(ret, StatsdRecvCnt.Get())
+	ret = append(ret, StatsdInvalidCnt.Get())
+	ret = append(ret, InfluxRecvCnt.Get())
+	ret = append(ret, InfluxInvalidCnt.Get())
+	ret = append(ret, OpentsdbRecvCnt.Get())
+	ret = append(ret, OpentsdbInvalidCnt.Get())
+	ret = append(ret, RecordingEmitCnt.Get())
+	ret = append(ret, RecordingLateCnt.Get())
+	ret = append(ret, RecordingForwardCnt.Get())
+	ret = append(ret, RecordingForwardFailCnt.Get())
+	ret = append(ret, LimitRejectCnt.Get())
+	ret = append(ret, RelabelDropCnt.Get())
 
 	// send cnt
 	ret = append(ret, SendToJudgeCnt.Get())
@@ -86,6 +151,7 @@ func GetAll() []interface{} {
 	ret = append(ret, SendToJudgeDropCnt.Get())
 	ret = append(ret, SendToTsdbDropCnt.Get())
 	ret = append(ret, SendToGraphDropCnt.Get())
+	ret = append(ret, SendToGraphDoubleWriteCnt.Get())
 	ret = append(ret, SendToInfluxdbDropCnt.Get())
 	ret = append(ret, SendToNqmIcmpDropCnt.Get())
 	ret = append(ret, SendToNqmTcpDropCnt.Get())
@@ -110,5 +176,19 @@ func GetAll() []interface{} {
 	ret = append(ret, NqmRpcQueuesCnt.Get())
 	ret = append(ret, StagingQueuesCnt.Get())
 
+	// spill cnt
+	ret = append(ret, SpillToJudgeCnt.Get())
+	ret = append(ret, SpillToGraphCnt.Get())
+	ret = append(ret, ReplayToJudgeCnt.Get())
+	ret = append(ret, ReplayToGraphCnt.Get())
+	ret = append(ret, ReplayToJudgeFailCnt.Get())
+	ret = append(ret, ReplayToGraphFailCnt.Get())
+	ret = append(ret, JudgeSpillCnt.Get())
+	ret = append(ret, GraphSpillCnt.Get())
+	ret = append(ret, JudgeSpillBytes.Get())
+	ret = append(ret, GraphSpillBytes.Get())
+	ret = append(ret, JudgeSpillDropCnt.Get())
+	ret = append(ret, GraphSpillDropCnt.Get())
+
 	return ret
 }
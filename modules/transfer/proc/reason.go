@@ -0,0 +1,33 @@
+package proc
+
+import (
+	"sync"
+
+	nproc "github.com/toolkits/proc"
+)
+
+// ReasonCounter is a qps counter which also counts by reasons in Other
+type ReasonCounter struct {
+	*nproc.SCounterQps
+	lock    sync.Mutex
+	reasons map[string]int64
+}
+
+func NewReasonCounter(name string) *ReasonCounter {
+	return &ReasonCounter{
+		SCounterQps: nproc.NewSCounterQps(name),
+		reasons:     make(map[string]int64),
+	}
+}
+
+func (this *ReasonCounter) IncrReason(reason string, n int64) {
+	if n <= 0 {
+		return
+	}
+	this.IncrBy(n)
+
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.reasons[reason] += n
+	this.PutOther(reason, this.reasons[reason])
+}
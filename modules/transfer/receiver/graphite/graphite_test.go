@@ -0,0 +1,170 @@
+package graphite
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"github.com/Cepave/open-falcon-backend/modules/transfer/g"
+)
+
+func newTestParser(t *testing.T) *Parser {
+	p, err := NewParser(&g.GraphiteConfig{
+		Step:            60,
+		Separator:       ".",
+		DefaultEndpoint: "graphite",
+		Templates: []string{
+			"servers.*  .endpoint.metric*",
+			"switch.*.*.if  .region.endpoint..metric*  dc=sh",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestParseTemplate(t *testing.T) {
+	for _, bad := range []string{"", "a b c d", "endpoint", "metric*.endpoint", "servers.* metric* dc"} {
+		if _, err := ParseTemplate(bad); err == nil {
+			t.Errorf("template %q should be bad", bad)
+		}
+	}
+}
+
+func TestParseLine(t *testing.T) {
+	p := newTestParser(t)
+
+	cases := []struct {
+		line     string
+		endpoint string
+		metric   string
+		tags     string
+		ts       int64
+	}{
+		{"servers.web01.cpu.idle 98.5 1500000000", "web01", "cpu.idle", "", 1500000000},
+		{"switch.bj.sw01.if.eth0.in 10 -1", "sw01", "eth0.in", "dc=sh,region=bj", 100},
+		{"app.requests;env=prod;code=2,00 3", "graphite", "app.requests", "code=2_00,env=prod", 100},
+	}
+	for _, c := range cases {
+		v, err := p.ParseLine(c.line, 100)
+		if err != nil {
+			t.Errorf("parse %q fail: %v", c.line, err)
+			continue
+		}
+		if v.Endpoint != c.endpoint || v.Metric != c.metric || v.Tags != c.tags || v.Timestamp != c.ts ||
+			v.Type != g.GAUGE || v.Step != 60 {
+			t.Errorf("parse %q got %v", c.line, v)
+		}
+	}
+
+	for _, bad := range []string{"servers.web01.cpu", "a.b x 1", "a.b 1 y", "a.b NaN"} {
+		if _, err := p.ParseLine(bad, 100); err == nil {
+			t.Errorf("line %q should be bad", bad)
+		}
+	}
+}
+
+// [('servers.web01.cpu.idle', (1500000000, 98.5)), ('servers.web01.load;dc=sh', (1500000000.0, 3)), ('bad',)]
+// pickled by python3 with protocol 0, 2 and 4
+var pickles = map[int]string{
+	0: "(lp0\x0a(Vservers.web01.cpu.idle\x0ap1\x0a(I1500000000\x0aF98.5\x0atp2\x0atp3\x0aa(Vservers.web01.load;dc=sh\x0ap4\x0a(F1500000000.0\x0aI3\x0atp5\x0atp6\x0aa(Vbad\x0ap7\x0atp8\x0aa.",
+	2: "\x80\x02]q\x00(X\x16\x00\x00\x00servers.web01.cpu.idleq\x01J\x00/hYG@X\xa0\x00\x00\x00\x00\x00\x86q\x02\x86q\x03X\x18\x00\x00\x00servers.web01.load;dc=shq\x04GA\xd6Z\x0b\xc0\x00\x00\x00K\x03\x86q\x05\x86q\x06X\x03\x00\x00\x00badq\x07\x85q\x08e.",
+	4: "\x80\x04\x95b\x00\x00\x00\x00\x00\x00\x00]\x94(\x8c\x16servers.web01.cpu.idle\x94J\x00/hYG@X\xa0\x00\x00\x00\x00\x00\x86\x94\x86\x94\x8c\x18servers.web01.load;dc=sh\x94GA\xd6Z\x0b\xc0\x00\x00\x00K\x03\x86\x94\x86\x94\x8c\x03bad\x94\x85\x94e.",
+}
+
+func TestParsePickle(t *testing.T) {
+	p := newTestParser(t)
+	for protocol, data := range pickles {
+		values, invalid, err := p.ParsePickle([]byte(data), 100)
+		if err != nil {
+			t.Errorf("protocol %d: %v", protocol, err)
+			continue
+		}
+		if invalid != 1 || len(values) != 2 {
+			t.Errorf("protocol %d: expected 2 values and 1 invalid, got %d and %d", protocol, len(values), invalid)
+			continue
+		}
+		if v := values[0]; v.Endpoint != "web01" || v.Metric != "cpu.idle" || v.Value != 98.5 || v.Timestamp != 1500000000 {
+			t.Errorf("protocol %d: bad value %v", protocol, v)
+		}
+		if v := values[1]; v.Metric != "load" || v.Tags != "dc=sh" || v.Value != float64(3) {
+			t.Errorf("protocol %d: bad value %v", protocol, v)
+		}
+	}
+}
+
+func TestUnpicklePython2String(t *testing.T) {
+	obj, err := unpickle([]byte("(lp0\n(S'a.b\\'c'\np1\n(L1500000000L\nI-2\ntp2\ntp3\na."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	item := obj.([]interface{})[0].([]interface{})
+	point := item[1].([]interface{})
+	if item[0] != "a.b'c" || point[0] != int64(1500000000) || point[1] != int64(-2) {
+		t.Errorf("bad unpickled %v", obj)
+	}
+
+	if _, err := unpickle([]byte("cos\nsystem\n(S'ls'\ntR.")); err == nil {
+		t.Error("GLOBAL should not be supported")
+	}
+}
+
+func TestUnpickleMalformed(t *testing.T) {
+	for _, data := range []string{
+		"N(0t.",                                 // the item under the mark is popped
+		"N(01.",                                 // POP_MARK after popping below the mark
+		"](0e.",                                 // APPENDS without the list
+		"(e.",                                   // APPENDS to nothing
+		"K\x01\x86.",                            // TUPLE2 with one item
+		"0.",                                    // POP on empty stack
+		".",                                     // STOP on empty stack
+		"t.",                                    // TUPLE without mark
+		"a.",                                    // APPEND on empty stack
+		"K\x01a.",                               // APPEND to non-list
+		"h\x05.",                                // memo not found
+		"X\xff\xff\xff\x7fabc.",                 // truncated string
+		"\x8e\xff\xff\xff\xff\xff\xff\xff\xff.", // huge length
+		"\x8b\xff\xff\xff\xff.",                 // huge long
+		"S'abc\n.",                              // bad string
+		"S'\\x'\n.",                             // bad escape
+		"I12a\n.",                               // bad int
+		"(K\x01",                                // STOP not found
+		"\xff.",                                 // unsupported opcode
+		"p0\n.",                                 // PUT on empty stack
+	} {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Errorf("%q: panic %v", data, r)
+				}
+			}()
+			if obj, err := unpickle([]byte(data)); err == nil {
+				t.Errorf("%q: expected error, got %v", data, obj)
+			}
+		}()
+	}
+
+	p := newTestParser(t)
+	if _, _, err := p.ParsePickle([]byte("N(0t."), 100); err == nil {
+		t.Error("expected error of the malformed pickle")
+	}
+}
+
+func TestLineSplitter(t *testing.T) {
+	long := strings.Repeat("x", 40)
+	scanner := bufio.NewScanner(strings.NewReader("a 1 1\n" + long + "\nb 2 2\n" + long + long + "\r\nc 3 3"))
+	scanner.Buffer(make([]byte, 16), 32)
+	scanner.Split((&lineSplitter{max: 32}).split)
+
+	lines := []string{}
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(lines, "|") != "a 1 1|b 2 2|c 3 3" {
+		t.Errorf("unexpected lines: %q", lines)
+	}
+}
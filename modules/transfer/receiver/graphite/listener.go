@@ -0,0 +1,232 @@
+package graphite
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/Cepave/open-falcon-backend/modules/transfer/g"
+	"github.com/Cepave/open-falcon-backend/modules/transfer/proc"
+	trpc "github.com/Cepave/open-falcon-backend/modules/transfer/receiver/rpc"
+	log "github.com/Sirupsen/logrus"
+	cmodel "github.com/open-falcon/common/model"
+)
+
+const (
+	// same as MAX_LENGTH of carbon
+	maxPickleSize = 1024 * 1024
+	maxUdpPacket  = 65536
+	// the longer lines of plaintext are dropped
+	maxLineSize = 64 * 1024
+)
+
+func StartGraphite() {
+	cfg := g.Config().Graphite
+	if !cfg.Enabled {
+		return
+	}
+
+	parser, err := NewParser(cfg)
+	if err != nil {
+		log.Fatalf("graphite templates fail: %s", err)
+	}
+
+	if cfg.TcpListen != "" {
+		go listenTcp(cfg.TcpListen, func(conn net.Conn) {
+			handlePlaintext(conn, parser, cfg)
+		})
+	}
+	if cfg.PickleListen != "" {
+		go listenTcp(cfg.PickleListen, func(conn net.Conn) {
+			handlePickle(conn, parser, cfg)
+		})
+	}
+	if cfg.UdpListen != "" {
+		go listenUdp(cfg.UdpListen, parser)
+	}
+}
+
+func listenTcp(addr string, handle func(conn net.Conn)) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatalf("listen %s fail: %s", addr, err)
+	} else {
+		log.Println("graphite listening", addr)
+	}
+	defer listener.Close()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			log.Println("listener.Accept occur error:", err)
+			continue
+		}
+		go handle(conn)
+	}
+}
+
+func recv(values []*cmodel.MetricValue, from string) {
+	if len(values) == 0 {
+		return
+	}
+	reply := &cmodel.TransferResponse{}
+	trpc.RecvMetricValues(values, reply, from)
+	if reply.Invalid > 0 {
+		proc.GraphiteInvalidCnt.IncrBy(int64(reply.Invalid))
+	}
+}
+
+// handlePlaintext receives the lines in batches, a batch is sent when it is full or no more data is buffered
+func handlePlaintext(conn net.Conn, parser *Parser, cfg *g.GraphiteConfig) {
+	defer conn.Close()
+
+	timeout := time.Duration(cfg.Timeout) * time.Second
+	values := make([]*cmodel.MetricValue, 0, cfg.Batch)
+	flush := func() {
+		if len(values) > 0 {
+			recv(values, "graphite-tcp")
+			values = make([]*cmodel.MetricValue, 0, cfg.Batch)
+		}
+	}
+
+	// 读连接之前先发送已经解析的数据, 不必等到凑满一批
+	scanner := bufio.NewScanner(readFunc(func(p []byte) (int, error) {
+		flush()
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		return conn.Read(p)
+	}))
+	scanner.Buffer(make([]byte, 4096), maxLineSize)
+	scanner.Split((&lineSplitter{max: maxLineSize}).split)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			if v, err := parser.ParseLine(line, time.Now().Unix()); err != nil {
+				proc.GraphiteInvalidCnt.Incr()
+				log.Debugf("graphite: %s", err)
+			} else {
+				values = append(values, v)
+			}
+		}
+		if len(values) >= cfg.Batch {
+			flush()
+		}
+	}
+	flush()
+}
+
+type readFunc func(p []byte) (int, error)
+
+func (this readFunc) Read(p []byte) (int, error) {
+	return this(p)
+}
+
+// lineSplitter splits the lines as bufio.ScanLines, but drops the lines longer than max instead of failing the scanner
+type lineSplitter struct {
+	max      int
+	dropping bool
+}
+
+func (this *lineSplitter) split(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		if this.dropping {
+			this.dropping = false
+			return i + 1, nil, nil
+		}
+		return i + 1, data[:i], nil
+	}
+	if len(data) >= this.max {
+		if !this.dropping {
+			this.dropping = true
+			proc.GraphiteInvalidCnt.Incr()
+			log.Debugf("graphite: drop the line longer than %d bytes", this.max)
+		}
+		return len(data), nil, nil
+	}
+	if atEOF && len(data) > 0 {
+		if this.dropping {
+			return len(data), nil, nil
+		}
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+func handlePickle(conn net.Conn, parser *Parser, cfg *g.GraphiteConfig) {
+	defer conn.Close()
+	// the pickle is sent by the clients, a bug of unpickle must not crash the transfer
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorf("graphite: panic on pickle from %s: %v", conn.RemoteAddr(), r)
+			proc.GraphiteInvalidCnt.Incr()
+		}
+	}()
+
+	timeout := time.Duration(cfg.Timeout) * time.Second
+	reader := bufio.NewReader(conn)
+	header := make([]byte, 4)
+	for {
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		if _, err := io.ReadFull(reader, header); err != nil {
+			return
+		}
+		size := binary.BigEndian.Uint32(header)
+		if size > maxPickleSize {
+			log.Warnf("graphite: pickle of %s is too large: %d bytes", conn.RemoteAddr(), size)
+			return
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return
+		}
+
+		values, invalid, err := parser.ParsePickle(data, time.Now().Unix())
+		if err != nil {
+			log.Warnf("graphite: bad pickle from %s: %s", conn.RemoteAddr(), err)
+			proc.GraphiteInvalidCnt.Incr()
+			return
+		}
+		proc.GraphiteInvalidCnt.IncrBy(int64(invalid))
+		recv(values, "graphite-pickle")
+	}
+}
+
+func listenUdp(addr string, parser *Parser) {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		log.Fatalf("net.ResolveUDPAddr fail: %s", err)
+	}
+	conn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		log.Fatalf("listen %s fail: %s", addr, err)
+	} else {
+		log.Println("graphite listening", addr, "(udp)")
+	}
+	defer conn.Close()
+
+	buf := make([]byte, maxUdpPacket)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			log.Println("graphite: read udp fail:", err)
+			continue
+		}
+
+		now := time.Now().Unix()
+		values := []*cmodel.MetricValue{}
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			if line = strings.TrimSpace(line); line == "" {
+				continue
+			}
+			if v, err := parser.ParseLine(line, now); err != nil {
+				proc.GraphiteInvalidCnt.Incr()
+				log.Debugf("graphite: %s", err)
+			} else {
+				values = append(values, v)
+			}
+		}
+		recv(values, "graphite-udp")
+	}
+}
@@ -0,0 +1,102 @@
+package graphite
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/Cepave/open-falcon-backend/modules/transfer/g"
+	"github.com/Cepave/open-falcon-backend/modules/transfer/receiver/tagutil"
+	cmodel "github.com/open-falcon/common/model"
+)
+
+// Parser converts graphite data points to metric values
+type Parser struct {
+	templates       Templates
+	separator       string
+	defaultEndpoint string
+	step            int64
+}
+
+func NewParser(cfg *g.GraphiteConfig) (*Parser, error) {
+	templates, err := ParseTemplates(cfg.Templates)
+	if err != nil {
+		return nil, err
+	}
+	return &Parser{
+		templates:       templates,
+		separator:       cfg.Separator,
+		defaultEndpoint: cfg.DefaultEndpoint,
+		step:            int64(cfg.Step),
+	}, nil
+}
+
+// ParseLine parses the plaintext line: "path value [timestamp]", the timestamp which is absent or -1 means now.
+func (this *Parser) ParseLine(line string, now int64) (*cmodel.MetricValue, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 2 && len(fields) != 3 {
+		return nil, fmt.Errorf("bad line: %q", line)
+	}
+
+	value, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return nil, fmt.Errorf("bad value of line %q: %v", line, err)
+	}
+
+	ts := now
+	if len(fields) == 3 {
+		f, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad timestamp of line %q: %v", line, err)
+		}
+		if f != -1 {
+			ts = int64(f)
+		}
+	}
+	return this.Convert(fields[0], value, ts)
+}
+
+// Convert maps the path by templates, the path may have graphite tags: "a.b.c;tag1=v1;tag2=v2"
+func (this *Parser) Convert(path string, value float64, ts int64) (*cmodel.MetricValue, error) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return nil, errors.New("value is NaN or Inf")
+	}
+
+	extraTags := map[string]string{}
+	if i := strings.IndexByte(path, ';'); i >= 0 {
+		for _, kv := range strings.Split(path[i+1:], ";") {
+			pair := strings.SplitN(kv, "=", 2)
+			if len(pair) == 2 && pair[0] != "" && pair[1] != "" {
+				extraTags[pair[0]] = pair[1]
+			}
+		}
+		path = path[:i]
+	}
+
+	parts := strings.Split(path, ".")
+	endpoint, metric, tags := this.templates.Find(parts).Apply(parts, this.separator)
+	if metric == "" {
+		return nil, fmt.Errorf("no metric in path %s", path)
+	}
+	if endpoint == "" {
+		endpoint = this.defaultEndpoint
+	}
+	if endpoint == "" {
+		return nil, fmt.Errorf("no endpoint in path %s", path)
+	}
+	for k, v := range extraTags {
+		tags[k] = v
+	}
+
+	return &cmodel.MetricValue{
+		Endpoint:  endpoint,
+		Metric:    metric,
+		Value:     value,
+		Step:      this.step,
+		Type:      g.GAUGE,
+		Tags:      tagutil.Join(tags, nil),
+		Timestamp: ts,
+	}, nil
+}
@@ -0,0 +1,393 @@
+package graphite
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	cmodel "github.com/open-falcon/common/model"
+)
+
+// The pickle receiver of carbon accepts a 4 bytes big endian length header and a pickled list:
+//
+//	[(path, (timestamp, value)), ...]
+//
+// unpickle only supports the opcodes of lists, tuples, strings and numbers(protocol 0 ~ 4),
+// which are enough for it and never executes anything.
+
+var errPickleTruncated = errors.New("pickle: truncated data")
+
+func unpickle(data []byte) (interface{}, error) {
+	var stack []interface{}
+	var marks []int
+	memo := make(map[int]interface{})
+	pos := 0
+
+	read := func(n int) ([]byte, error) {
+		if n < 0 || pos+n > len(data) {
+			return nil, errPickleTruncated
+		}
+		b := data[pos : pos+n]
+		pos += n
+		return b, nil
+	}
+	readLine := func() (string, error) {
+		i := bytes.IndexByte(data[pos:], '\n')
+		if i < 0 {
+			return "", errPickleTruncated
+		}
+		line := string(data[pos : pos+i])
+		pos += i + 1
+		return line, nil
+	}
+	pop := func() (interface{}, error) {
+		if len(stack) == 0 {
+			return nil, errors.New("pickle: stack underflow")
+		}
+		v := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		return v, nil
+	}
+	popMark := func() ([]interface{}, error) {
+		if len(marks) == 0 {
+			return nil, errors.New("pickle: mark not found")
+		}
+		m := marks[len(marks)-1]
+		marks = marks[:len(marks)-1]
+		// the items under the mark are popped, e.g. N(0t.
+		if m > len(stack) {
+			return nil, errors.New("pickle: stack underflow")
+		}
+		items := append([]interface{}{}, stack[m:]...)
+		stack = stack[:m]
+		return items, nil
+	}
+	appendTo := func(items ...interface{}) error {
+		if len(stack) == 0 {
+			return errors.New("pickle: stack underflow")
+		}
+		l, ok := stack[len(stack)-1].([]interface{})
+		if !ok {
+			return errors.New("pickle: append to non-list")
+		}
+		stack[len(stack)-1] = append(l, items...)
+		return nil
+	}
+	length := func(n int) (int, error) {
+		b, err := read(n)
+		if err != nil {
+			return 0, err
+		}
+		switch n {
+		case 1:
+			return int(b[0]), nil
+		case 4:
+			return int(binary.LittleEndian.Uint32(b)), nil
+		default:
+			l := binary.LittleEndian.Uint64(b)
+			if l > uint64(len(data)) {
+				return 0, errPickleTruncated
+			}
+			return int(l), nil
+		}
+	}
+
+	for pos < len(data) {
+		op := data[pos]
+		pos++
+
+		var err error
+		switch op {
+		case 0x80: // PROTO
+			_, err = read(1)
+		case 0x95: // FRAME
+			_, err = read(8)
+		case '.': // STOP
+			return pop()
+		case '(': // MARK
+			marks = append(marks, len(stack))
+		case '0': // POP
+			_, err = pop()
+		case '1': // POP_MARK
+			_, err = popMark()
+		case '2': // DUP
+			if len(stack) == 0 {
+				return nil, errors.New("pickle: stack underflow")
+			}
+			stack = append(stack, stack[len(stack)-1])
+		case 'N': // NONE
+			stack = append(stack, nil)
+		case 0x88: // NEWTRUE
+			stack = append(stack, true)
+		case 0x89: // NEWFALSE
+			stack = append(stack, false)
+		case 'I': // INT
+			var line string
+			if line, err = readLine(); err == nil {
+				switch line {
+				case "01":
+					stack = append(stack, true)
+				case "00":
+					stack = append(stack, false)
+				default:
+					var i int64
+					i, err = strconv.ParseInt(line, 10, 64)
+					stack = append(stack, i)
+				}
+			}
+		case 'L': // LONG
+			var line string
+			if line, err = readLine(); err == nil {
+				var i int64
+				i, err = strconv.ParseInt(strings.TrimSuffix(line, "L"), 10, 64)
+				stack = append(stack, i)
+			}
+		case 'J': // BININT
+			var b []byte
+			if b, err = read(4); err == nil {
+				stack = append(stack, int64(int32(binary.LittleEndian.Uint32(b))))
+			}
+		case 'K': // BININT1
+			var b []byte
+			if b, err = read(1); err == nil {
+				stack = append(stack, int64(b[0]))
+			}
+		case 'M': // BININT2
+			var b []byte
+			if b, err = read(2); err == nil {
+				stack = append(stack, int64(binary.LittleEndian.Uint16(b)))
+			}
+		case 0x8a, 0x8b: // LONG1, LONG4
+			n := 1
+			if op == 0x8b {
+				n = 4
+			}
+			var l int
+			var b []byte
+			if l, err = length(n); err == nil {
+				if l > 8 {
+					return nil, errors.New("pickle: long is too large")
+				}
+				if b, err = read(l); err == nil {
+					var i int64
+					for j := l - 1; j >= 0; j-- {
+						i = i<<8 | int64(b[j])
+					}
+					if l > 0 && l < 8 && b[l-1]&0x80 != 0 {
+						i -= 1 << uint(8*l)
+					}
+					stack = append(stack, i)
+				}
+			}
+		case 'F': // FLOAT
+			var line string
+			if line, err = readLine(); err == nil {
+				var f float64
+				f, err = strconv.ParseFloat(line, 64)
+				stack = append(stack, f)
+			}
+		case 'G': // BINFLOAT
+			var b []byte
+			if b, err = read(8); err == nil {
+				stack = append(stack, math.Float64frombits(binary.BigEndian.Uint64(b)))
+			}
+		case 'S': // STRING
+			var line string
+			if line, err = readLine(); err == nil {
+				var s string
+				s, err = unquotePython(line)
+				stack = append(stack, s)
+			}
+		case 'V': // UNICODE
+			var line string
+			if line, err = readLine(); err == nil {
+				stack = append(stack, line)
+			}
+		case 'T', 'U', 'X', 'B', 'C', 0x8c, 0x8d, 0x8e: // strings and bytes
+			n := 4
+			switch op {
+			case 'U', 'C', 0x8c:
+				n = 1
+			case 0x8d, 0x8e:
+				n = 8
+			}
+			var l int
+			var b []byte
+			if l, err = length(n); err == nil {
+				if b, err = read(l); err == nil {
+					stack = append(stack, string(b))
+				}
+			}
+		case ']': // EMPTY_LIST
+			stack = append(stack, []interface{}{})
+		case ')': // EMPTY_TUPLE
+			stack = append(stack, []interface{}{})
+		case 'l', 't': // LIST, TUPLE
+			var items []interface{}
+			if items, err = popMark(); err == nil {
+				stack = append(stack, items)
+			}
+		case 0x85, 0x86, 0x87: // TUPLE1, TUPLE2, TUPLE3
+			n := int(op-0x85) + 1
+			if len(stack) < n {
+				return nil, errors.New("pickle: stack underflow")
+			}
+			items := append([]interface{}{}, stack[len(stack)-n:]...)
+			stack = append(stack[:len(stack)-n], items)
+		case 'a': // APPEND
+			var v interface{}
+			if v, err = pop(); err == nil {
+				err = appendTo(v)
+			}
+		case 'e': // APPENDS
+			var items []interface{}
+			if items, err = popMark(); err == nil {
+				err = appendTo(items...)
+			}
+		case 'p', 'q', 'r', 0x94: // PUT, BINPUT, LONG_BINPUT, MEMOIZE
+			if len(stack) == 0 {
+				return nil, errors.New("pickle: stack underflow")
+			}
+			var idx int
+			switch op {
+			case 'p':
+				var line string
+				if line, err = readLine(); err == nil {
+					idx, err = strconv.Atoi(line)
+				}
+			case 'q':
+				idx, err = length(1)
+			case 'r':
+				idx, err = length(4)
+			default:
+				idx = len(memo)
+			}
+			memo[idx] = stack[len(stack)-1]
+		case 'g', 'h', 'j': // GET, BINGET, LONG_BINGET
+			var idx int
+			switch op {
+			case 'g':
+				var line string
+				if line, err = readLine(); err == nil {
+					idx, err = strconv.Atoi(line)
+				}
+			case 'h':
+				idx, err = length(1)
+			default:
+				idx, err = length(4)
+			}
+			if err == nil {
+				v, ok := memo[idx]
+				if !ok {
+					return nil, fmt.Errorf("pickle: memo %d not found", idx)
+				}
+				stack = append(stack, v)
+			}
+		default:
+			return nil, fmt.Errorf("pickle: unsupported opcode 0x%02x", op)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nil, errors.New("pickle: STOP not found")
+}
+
+// unquotePython unquotes the repr of python 2 str, e.g. 'a\'b' or "a\x00"
+func unquotePython(s string) (string, error) {
+	if len(s) < 2 || (s[0] != '\'' && s[0] != '"') || s[len(s)-1] != s[0] {
+		return "", fmt.Errorf("pickle: bad string %s", s)
+	}
+	s = s[1 : len(s)-1]
+
+	var buf []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			buf = append(buf, s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			buf = append(buf, '\n')
+		case 't':
+			buf = append(buf, '\t')
+		case 'r':
+			buf = append(buf, '\r')
+		case 'x':
+			if i+2 >= len(s) {
+				return "", fmt.Errorf("pickle: bad escape in %s", s)
+			}
+			b, err := strconv.ParseUint(s[i+1:i+3], 16, 8)
+			if err != nil {
+				return "", err
+			}
+			buf = append(buf, byte(b))
+			i += 2
+		default:
+			buf = append(buf, s[i])
+		}
+	}
+	return string(buf), nil
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// ParsePickle converts the unpickled list of (path, (timestamp, value)), the bad items are counted by invalid.
+func (this *Parser) ParsePickle(data []byte, now int64) (values []*cmodel.MetricValue, invalid int, err error) {
+	obj, err := unpickle(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	items, ok := obj.([]interface{})
+	if !ok {
+		return nil, 0, errors.New("pickle: not a list")
+	}
+
+	for _, item := range items {
+		pair, ok := item.([]interface{})
+		if !ok || len(pair) != 2 {
+			invalid++
+			continue
+		}
+		path, ok := pair[0].(string)
+		point, ok2 := pair[1].([]interface{})
+		if !ok || !ok2 || len(point) != 2 {
+			invalid++
+			continue
+		}
+		ts, ok := toFloat(point[0])
+		value, ok2 := toFloat(point[1])
+		if !ok || !ok2 {
+			invalid++
+			continue
+		}
+
+		t := int64(ts)
+		if ts == -1 {
+			t = now
+		}
+		v, err := this.Convert(path, value, t)
+		if err != nil {
+			invalid++
+			continue
+		}
+		values = append(values, v)
+	}
+	return values, invalid, nil
+}
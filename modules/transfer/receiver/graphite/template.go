@@ -0,0 +1,147 @@
+package graphite
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Template maps the dotted path of graphite to endpoint, metric and tags like the templates of carbon.
+// The syntax is "[filter] template [tag1=v1,tag2=v2]", e.g.
+//
+//	servers.*.cpu.*  .endpoint.metric.metric          servers.web01.cpu.idle => endpoint: web01, metric: cpu.idle
+//	switch.*         .region.endpoint.metric*  dc=sh  switch.bj.sw01.if.eth0.in => endpoint: sw01, metric: if.eth0.in, tags: dc=sh,region=bj
+//
+// The parts of template(split by "."):
+//
+//	endpoint  the part of path belongs to endpoint
+//	metric    the part of path belongs to metric
+//	metric*   the rest parts of path belong to metric
+//	<name>    the part of path is the value of tag <name>
+//	(empty)   the part of path is ignored
+//
+// The filter matches the path part by part and "*" matches any part, a shorter filter matches the prefix of path.
+// Templates are tried in order and the first matched one is used, a template without filter matches any path.
+type Template struct {
+	filter []string
+	parts  []string
+	tags   map[string]string
+}
+
+// DefaultTemplate is used if no template matches, the whole path is metric
+var DefaultTemplate = &Template{parts: []string{"metric*"}, tags: map[string]string{}}
+
+func ParseTemplate(line string) (*Template, error) {
+	fields := strings.Fields(line)
+	t := &Template{tags: make(map[string]string)}
+
+	var tpl, tags string
+	switch len(fields) {
+	case 1:
+		tpl = fields[0]
+	case 2:
+		if strings.Contains(fields[1], "=") {
+			tpl, tags = fields[0], fields[1]
+		} else {
+			t.filter = strings.Split(fields[0], ".")
+			tpl = fields[1]
+		}
+	case 3:
+		t.filter = strings.Split(fields[0], ".")
+		tpl, tags = fields[1], fields[2]
+	default:
+		return nil, fmt.Errorf("bad template: %q", line)
+	}
+
+	t.parts = strings.Split(tpl, ".")
+	hasMetric := false
+	for i, part := range t.parts {
+		if part == "metric" || part == "metric*" {
+			hasMetric = true
+		}
+		if part == "metric*" && i != len(t.parts)-1 {
+			return nil, fmt.Errorf("bad template %q: metric* should be the last part", line)
+		}
+	}
+	if !hasMetric {
+		return nil, fmt.Errorf("bad template %q: no metric part", line)
+	}
+
+	if tags != "" {
+		for _, kv := range strings.Split(tags, ",") {
+			pair := strings.SplitN(kv, "=", 2)
+			if len(pair) != 2 || pair[0] == "" || pair[1] == "" {
+				return nil, fmt.Errorf("bad template %q: bad tag %q", line, kv)
+			}
+			t.tags[pair[0]] = pair[1]
+		}
+	}
+	return t, nil
+}
+
+func (this *Template) Match(path []string) bool {
+	if len(this.filter) > len(path) {
+		return false
+	}
+	for i, f := range this.filter {
+		if f != "*" && f != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Apply returns the endpoint, metric and tags of path, the endpoint is empty if the template has no endpoint part.
+func (this *Template) Apply(path []string, separator string) (endpoint string, metric string, tags map[string]string) {
+	endpoints, metrics := []string{}, []string{}
+	tagParts := make(map[string][]string)
+
+	for i, part := range this.parts {
+		if i >= len(path) {
+			break
+		}
+		switch part {
+		case "":
+		case "endpoint":
+			endpoints = append(endpoints, path[i])
+		case "metric":
+			metrics = append(metrics, path[i])
+		case "metric*":
+			metrics = append(metrics, path[i:]...)
+		default:
+			tagParts[part] = append(tagParts[part], path[i])
+		}
+	}
+
+	tags = make(map[string]string, len(this.tags)+len(tagParts))
+	for k, v := range this.tags {
+		tags[k] = v
+	}
+	for k, v := range tagParts {
+		tags[k] = strings.Join(v, separator)
+	}
+	return strings.Join(endpoints, separator), strings.Join(metrics, separator), tags
+}
+
+type Templates []*Template
+
+func ParseTemplates(lines []string) (Templates, error) {
+	ret := make(Templates, 0, len(lines))
+	for _, line := range lines {
+		t, err := ParseTemplate(line)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, t)
+	}
+	return ret, nil
+}
+
+// Find returns the first matched template, DefaultTemplate if none matches
+func (this Templates) Find(path []string) *Template {
+	for _, t := range this {
+		if t.Match(path) {
+			return t
+		}
+	}
+	return DefaultTemplate
+}
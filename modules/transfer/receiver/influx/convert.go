@@ -0,0 +1,78 @@
+package influx
+
+import (
+	"math"
+
+	"github.com/Cepave/open-falcon-backend/modules/transfer/g"
+	"github.com/Cepave/open-falcon-backend/modules/transfer/receiver/tagutil"
+	cmodel "github.com/open-falcon/common/model"
+)
+
+// reasons of dropped fields
+const (
+	ReasonNoEndpoint  = "no_endpoint"
+	ReasonStringField = "string_field"
+	ReasonBadValue    = "bad_value"
+)
+
+// Convert maps each numeric field of point to a metric value, bool fields are 1 or 0.
+// The dropped fields are counted by reasons.
+func Convert(p *Point, cfg *g.IngestConfig, precision string, now int64, dropped map[string]int) []*cmodel.MetricValue {
+	ts := now
+	if p.HasTime {
+		// the precision is checked before parsing the body
+		ts, _ = ToUnix(p.Timestamp, precision)
+	}
+
+	endpoint := p.Tags[cfg.EndpointTag]
+	if endpoint == "" {
+		endpoint = cfg.DefaultEndpoint
+	}
+	if endpoint == "" {
+		dropped[ReasonNoEndpoint] += len(p.Fields)
+		return nil
+	}
+
+	tagString := tagutil.Join(p.Tags, tagutil.DropSet(cfg.DropTags, cfg.EndpointTag))
+
+	ret := make([]*cmodel.MetricValue, 0, len(p.Fields))
+	for field, raw := range p.Fields {
+		var value float64
+		switch v := raw.(type) {
+		case float64:
+			value = v
+		case int64:
+			value = float64(v)
+		case bool:
+			if v {
+				value = 1
+			}
+		default:
+			dropped[ReasonStringField]++
+			continue
+		}
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			dropped[ReasonBadValue]++
+			continue
+		}
+
+		metric := p.Measurement
+		if field != cfg.ValueField {
+			metric = p.Measurement + cfg.Separator + field
+		}
+		counterType, ok := cfg.Types[metric]
+		if !ok {
+			counterType = g.GAUGE
+		}
+		ret = append(ret, &cmodel.MetricValue{
+			Endpoint:  endpoint,
+			Metric:    metric,
+			Value:     value,
+			Step:      int64(cfg.Step),
+			Type:      counterType,
+			Tags:      tagString,
+			Timestamp: ts,
+		})
+	}
+	return ret
+}
@@ -0,0 +1,82 @@
+package influx
+
+import (
+	"testing"
+
+	"github.com/Cepave/open-falcon-backend/modules/transfer/g"
+)
+
+func TestParseLine(t *testing.T) {
+	p, err := ParseLine(`cpu\,x,host=web01,region=us\ west usage_idle=98.5,cores=4i,ok=t,msg="a \"b\", c" 1500000000000000000`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Measurement != "cpu,x" || p.Tags["host"] != "web01" || p.Tags["region"] != "us west" {
+		t.Errorf("bad measurement or tags: %+v", p)
+	}
+	if p.Fields["usage_idle"] != 98.5 || p.Fields["cores"] != int64(4) || p.Fields["ok"] != true || p.Fields["msg"] != `a "b", c` {
+		t.Errorf("bad fields: %+v", p.Fields)
+	}
+	if !p.HasTime || p.Timestamp != 1500000000000000000 {
+		t.Errorf("bad timestamp: %+v", p)
+	}
+
+	p, err = ParseLine("mem free=1024")
+	if err != nil || p.HasTime || len(p.Tags) != 0 || p.Fields["free"] != float64(1024) {
+		t.Errorf("bad point: %+v, %v", p, err)
+	}
+
+	for _, bad := range []string{"cpu", "cpu value", "cpu,host value=1", "cpu value=x", `cpu value="x`, "cpu value=1 x", ",host=a value=1"} {
+		if _, err := ParseLine(bad); err == nil {
+			t.Errorf("line %q should be bad", bad)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	cfg := &g.IngestConfig{
+		EndpointTag: "host",
+		DropTags:    []string{"cpu"},
+		Step:        10,
+		Separator:   ".",
+		ValueField:  "value",
+		Types:       map[string]string{"net.bytes_recv": g.COUNTER},
+	}
+
+	p, _ := ParseLine(`net,host=web01,interface=eth0,cpu=0 bytes_recv=100i,value=3,up=true,name="eth0" 1500000000000`)
+	dropped := map[string]int{}
+	values := Convert(p, cfg, "ms", 100, dropped)
+	if len(values) != 3 || dropped[ReasonStringField] != 1 {
+		t.Fatalf("expected 3 values and 1 string field, got %v, %v", values, dropped)
+	}
+	got := map[string]float64{}
+	for _, v := range values {
+		if v.Endpoint != "web01" || v.Tags != "interface=eth0" || v.Timestamp != 1500000000 || v.Step != 10 {
+			t.Errorf("bad value: %v", v)
+		}
+		if (v.Metric == "net.bytes_recv") != (v.Type == g.COUNTER) {
+			t.Errorf("bad type: %v", v)
+		}
+		got[v.Metric] = v.Value.(float64)
+	}
+	if got["net.bytes_recv"] != 100 || got["net"] != 3 || got["net.up"] != 1 {
+		t.Errorf("bad values: %v", got)
+	}
+
+	p, _ = ParseLine("mem free=1,used=2")
+	if values := Convert(p, cfg, "", 100, dropped); len(values) != 0 || dropped[ReasonNoEndpoint] != 2 {
+		t.Errorf("expected 2 fields without endpoint, got %v, %v", values, dropped)
+	}
+}
+
+func TestToUnix(t *testing.T) {
+	cases := map[string]int64{"": 1500000000000000000, "u": 1500000000000000, "ms": 1500000000000, "s": 1500000000, "m": 25000000}
+	for precision, ts := range cases {
+		if got, err := ToUnix(ts, precision); err != nil || got != 1500000000 {
+			t.Errorf("precision %s: got %d, %v", precision, got, err)
+		}
+	}
+	if _, err := ToUnix(1, "d"); err == nil {
+		t.Error("precision d should be bad")
+	}
+}
@@ -0,0 +1,171 @@
+package influx
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Point is a line of influx line protocol:
+//
+//	<measurement>[,<tag>=<value>...] <field>=<value>[,<field>=<value>...] [timestamp]
+type Point struct {
+	Measurement string
+	Tags        map[string]string
+	// float64, int64, bool or string
+	Fields    map[string]interface{}
+	Timestamp int64 // in the precision of request
+	HasTime   bool
+}
+
+const (
+	measurementEscapes = ", "
+	keyEscapes         = ",= "
+)
+
+// scan reads s from i until an unescaped byte of stops, the escaped bytes are unescaped
+func scan(s string, i int, stops string, escapes string) (string, int) {
+	var buf []byte
+	for i < len(s) {
+		c := s[i]
+		if c == '\\' && i+1 < len(s) && strings.IndexByte(escapes, s[i+1]) >= 0 {
+			buf = append(buf, s[i+1])
+			i += 2
+			continue
+		}
+		if strings.IndexByte(stops, c) >= 0 {
+			break
+		}
+		buf = append(buf, c)
+		i++
+	}
+	return string(buf), i
+}
+
+func skipSpaces(s string, i int) int {
+	for i < len(s) && s[i] == ' ' {
+		i++
+	}
+	return i
+}
+
+func ParseLine(line string) (*Point, error) {
+	p := &Point{Tags: map[string]string{}, Fields: map[string]interface{}{}}
+
+	var i int
+	p.Measurement, i = scan(line, 0, ", ", measurementEscapes)
+	if p.Measurement == "" {
+		return nil, errors.New("missing measurement")
+	}
+
+	for i < len(line) && line[i] == ',' {
+		var key, value string
+		key, i = scan(line, i+1, "=, ", keyEscapes)
+		if i >= len(line) || line[i] != '=' || key == "" {
+			return nil, fmt.Errorf("bad tag of %s", p.Measurement)
+		}
+		value, i = scan(line, i+1, ", ", keyEscapes)
+		if value == "" {
+			return nil, fmt.Errorf("bad tag %s of %s", key, p.Measurement)
+		}
+		p.Tags[key] = value
+	}
+
+	i = skipSpaces(line, i)
+	for {
+		var key string
+		key, i = scan(line, i, "=, ", keyEscapes)
+		if i >= len(line) || line[i] != '=' || key == "" {
+			return nil, fmt.Errorf("bad field of %s", p.Measurement)
+		}
+		i++
+
+		var value interface{}
+		var err error
+		if i < len(line) && line[i] == '"' {
+			value, i, err = scanString(line, i+1)
+		} else {
+			var raw string
+			raw, i = scan(line, i, ", ", "")
+			value, err = parseFieldValue(raw)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("bad field %s of %s: %v", key, p.Measurement, err)
+		}
+		p.Fields[key] = value
+
+		if i >= len(line) || line[i] != ',' {
+			break
+		}
+		i++
+	}
+
+	i = skipSpaces(line, i)
+	if i < len(line) {
+		ts, err := strconv.ParseInt(strings.TrimSpace(line[i:]), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad timestamp of %s", p.Measurement)
+		}
+		p.Timestamp, p.HasTime = ts, true
+	}
+	return p, nil
+}
+
+// scanString reads the string field from i(after the opening quote) to the closing quote
+func scanString(s string, i int) (string, int, error) {
+	var buf []byte
+	for i < len(s) {
+		c := s[i]
+		if c == '\\' && i+1 < len(s) && (s[i+1] == '"' || s[i+1] == '\\') {
+			buf = append(buf, s[i+1])
+			i += 2
+			continue
+		}
+		if c == '"' {
+			return string(buf), i + 1, nil
+		}
+		buf = append(buf, c)
+		i++
+	}
+	return "", i, errors.New("unterminated string")
+}
+
+func parseFieldValue(raw string) (interface{}, error) {
+	if raw == "" {
+		return nil, errors.New("empty value")
+	}
+	switch raw {
+	case "t", "T", "true", "True", "TRUE":
+		return true, nil
+	case "f", "F", "false", "False", "FALSE":
+		return false, nil
+	}
+	switch raw[len(raw)-1] {
+	case 'i':
+		return strconv.ParseInt(raw[:len(raw)-1], 10, 64)
+	case 'u':
+		u, err := strconv.ParseUint(raw[:len(raw)-1], 10, 64)
+		return float64(u), err
+	}
+	return strconv.ParseFloat(raw, 64)
+}
+
+// ToUnix converts the timestamp in precision(n, u, ms, s, m, h) to unix seconds
+func ToUnix(ts int64, precision string) (int64, error) {
+	switch precision {
+	case "", "n", "ns":
+		return ts / 1e9, nil
+	case "u", "us", "µ":
+		return ts / 1e6, nil
+	case "ms":
+		return ts / 1e3, nil
+	case "s":
+		return ts, nil
+	case "m":
+		return ts * 60, nil
+	case "h":
+		return ts * 3600, nil
+	}
+	return 0, fmt.Errorf("bad precision: %s", precision)
+}
@@ -0,0 +1,101 @@
+package opentsdb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/Cepave/open-falcon-backend/modules/transfer/g"
+	"github.com/Cepave/open-falcon-backend/modules/transfer/receiver/tagutil"
+	cmodel "github.com/open-falcon/common/model"
+)
+
+// DataPoint is the body of /api/put of opentsdb
+type DataPoint struct {
+	Metric    string            `json:"metric"`
+	Timestamp int64             `json:"timestamp"` // sec or ms
+	Value     json.Number       `json:"value"`     // number or string of number
+	Tags      map[string]string `json:"tags"`
+}
+
+// reasons of invalid data points
+const (
+	ReasonNoMetric     = "no_metric"
+	ReasonNoEndpoint   = "no_endpoint"
+	ReasonBadValue     = "bad_value"
+	ReasonBadTimestamp = "bad_timestamp"
+)
+
+// InvalidError is the validation error of data point
+type InvalidError struct {
+	Reason  string
+	Message string
+}
+
+func (this *InvalidError) Error() string {
+	return this.Message
+}
+
+// DecodePut accepts a single data point or an array of them
+func DecodePut(body []byte) ([]*DataPoint, error) {
+	body = []byte(strings.TrimSpace(string(body)))
+	if len(body) == 0 {
+		return nil, errors.New("blank body")
+	}
+	if body[0] == '[' {
+		var points []*DataPoint
+		err := json.Unmarshal(body, &points)
+		return points, err
+	}
+	point := &DataPoint{}
+	if err := json.Unmarshal(body, point); err != nil {
+		return nil, err
+	}
+	return []*DataPoint{point}, nil
+}
+
+// Convert maps the tag cfg.EndpointTag to endpoint, the others(except the dropped ones) are tags
+func Convert(p *DataPoint, cfg *g.IngestConfig) (*cmodel.MetricValue, error) {
+	if p.Metric == "" {
+		return nil, &InvalidError{ReasonNoMetric, "metric is missing"}
+	}
+
+	endpoint := p.Tags[cfg.EndpointTag]
+	if endpoint == "" {
+		endpoint = cfg.DefaultEndpoint
+	}
+	if endpoint == "" {
+		return nil, &InvalidError{ReasonNoEndpoint, fmt.Sprintf("tag %s is missing", cfg.EndpointTag)}
+	}
+
+	value, err := strconv.ParseFloat(p.Value.String(), 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return nil, &InvalidError{ReasonBadValue, fmt.Sprintf("bad value: %q", p.Value.String())}
+	}
+
+	// opentsdb accepts timestamps in seconds(10 digits) or milliseconds(13 digits)
+	ts := p.Timestamp
+	if ts > 9999999999 {
+		ts /= 1000
+	}
+	if ts <= 0 {
+		return nil, &InvalidError{ReasonBadTimestamp, fmt.Sprintf("bad timestamp: %d", p.Timestamp)}
+	}
+
+	counterType, ok := cfg.Types[p.Metric]
+	if !ok {
+		counterType = g.GAUGE
+	}
+	return &cmodel.MetricValue{
+		Endpoint:  endpoint,
+		Metric:    p.Metric,
+		Value:     value,
+		Step:      int64(cfg.Step),
+		Type:      counterType,
+		Tags:      tagutil.Join(p.Tags, tagutil.DropSet(cfg.DropTags, cfg.EndpointTag)),
+		Timestamp: ts,
+	}, nil
+}
@@ -0,0 +1,51 @@
+package opentsdb
+
+import (
+	"testing"
+
+	"github.com/Cepave/open-falcon-backend/modules/transfer/g"
+)
+
+func TestDecodeAndConvert(t *testing.T) {
+	cfg := &g.IngestConfig{EndpointTag: "host", DropTags: []string{"dc"}, Step: 60}
+
+	points, err := DecodePut([]byte(`{"metric":"sys.cpu.user","timestamp":1500000000123,"value":"42.5","tags":{"host":"web01","cpu":"0","dc":"lga"}}`))
+	if err != nil || len(points) != 1 {
+		t.Fatalf("decode single point: %v, %v", points, err)
+	}
+	v, err := Convert(points[0], cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Endpoint != "web01" || v.Metric != "sys.cpu.user" || v.Value != 42.5 || v.Timestamp != 1500000000 ||
+		v.Tags != "cpu=0" || v.Type != g.GAUGE {
+		t.Errorf("bad value: %v", v)
+	}
+
+	points, err = DecodePut([]byte(` [
+		{"metric":"a","timestamp":1500000000,"value":1,"tags":{"host":"h"}},
+		{"metric":"","timestamp":1500000000,"value":1,"tags":{"host":"h"}},
+		{"metric":"a","timestamp":1500000000,"value":1,"tags":{}},
+		{"metric":"a","timestamp":0,"value":1,"tags":{"host":"h"}}
+	]`))
+	if err != nil || len(points) != 4 {
+		t.Fatalf("decode array: %v, %v", points, err)
+	}
+	reasons := []string{"", ReasonNoMetric, ReasonNoEndpoint, ReasonBadTimestamp}
+	for i, p := range points {
+		_, err := Convert(p, cfg)
+		if reasons[i] == "" {
+			if err != nil {
+				t.Errorf("point %d: %v", i, err)
+			}
+			continue
+		}
+		if e, ok := err.(*InvalidError); !ok || e.Reason != reasons[i] {
+			t.Errorf("point %d: expected reason %s, got %v", i, reasons[i], err)
+		}
+	}
+
+	if _, err := DecodePut([]byte(`{"metric":"a","value":"x"}`)); err == nil {
+		t.Error("value x should be bad")
+	}
+}
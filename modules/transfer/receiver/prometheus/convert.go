@@ -0,0 +1,82 @@
+package prometheus
+
+import (
+	"math"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/Cepave/open-falcon-backend/modules/transfer/g"
+	"github.com/Cepave/open-falcon-backend/modules/transfer/receiver/tagutil"
+	cmodel "github.com/open-falcon/common/model"
+)
+
+const metricNameLabel = "__name__"
+
+// Convert maps each sample to a metric value, the series without name or endpoint are dropped.
+// Stale markers(NaN) and infinite values are dropped too.
+func Convert(req *WriteRequest, cfg *g.PrometheusConfig) (values []*cmodel.MetricValue, dropped int) {
+	drop := tagutil.DropSet(cfg.DropLabels)
+
+	for _, ts := range req.Timeseries {
+		metric, endpoint, tags := "", "", []string{}
+		for _, l := range ts.Labels {
+			switch {
+			case l.Name == metricNameLabel:
+				metric = l.Value
+			case l.Name == cfg.EndpointLabel:
+				endpoint = l.Value
+			case drop[l.Name] || l.Value == "":
+			default:
+				tags = append(tags, tagutil.Pair(l.Name, l.Value))
+			}
+		}
+
+		if endpoint != "" && cfg.StripPort {
+			if host, _, err := net.SplitHostPort(endpoint); err == nil {
+				endpoint = host
+			}
+		}
+		if endpoint == "" {
+			endpoint = cfg.DefaultEndpoint
+		}
+		if metric == "" || endpoint == "" {
+			dropped += len(ts.Samples)
+			continue
+		}
+
+		sort.Strings(tags)
+		tagString := strings.Join(tags, ",")
+		counterType := CounterType(metric, cfg)
+
+		for _, s := range ts.Samples {
+			if math.IsNaN(s.Value) || math.IsInf(s.Value, 0) {
+				dropped++
+				continue
+			}
+			values = append(values, &cmodel.MetricValue{
+				Endpoint:  endpoint,
+				Metric:    metric,
+				Value:     s.Value,
+				Step:      int64(cfg.Step),
+				Type:      counterType,
+				Tags:      tagString,
+				Timestamp: s.Timestamp / 1000,
+			})
+		}
+	}
+	return
+}
+
+// CounterType infers GAUGE or COUNTER from the configured types or the suffix of metric name
+func CounterType(metric string, cfg *g.PrometheusConfig) string {
+	if typ, ok := cfg.Types[metric]; ok {
+		return typ
+	}
+	for _, suffix := range cfg.CounterSuffixes {
+		if strings.HasSuffix(metric, suffix) {
+			return g.COUNTER
+		}
+	}
+	return g.GAUGE
+}
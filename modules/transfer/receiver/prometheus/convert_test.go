@@ -0,0 +1,136 @@
+package prometheus
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/Cepave/open-falcon-backend/modules/transfer/g"
+	"github.com/golang/snappy"
+)
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	tmp := make([]byte, binary.MaxVarintLen64)
+	return append(buf, tmp[:binary.PutUvarint(tmp, v)]...)
+}
+
+func appendKey(buf []byte, field int, wire int) []byte {
+	return appendUvarint(buf, uint64(field<<3|wire))
+}
+
+func appendBytes(buf []byte, field int, data []byte) []byte {
+	buf = appendKey(buf, field, wireBytes)
+	buf = appendUvarint(buf, uint64(len(data)))
+	return append(buf, data...)
+}
+
+func marshalWriteRequest(req *WriteRequest) []byte {
+	var buf []byte
+	for _, ts := range req.Timeseries {
+		var tsBuf []byte
+		for _, l := range ts.Labels {
+			var lBuf []byte
+			lBuf = appendBytes(lBuf, 1, []byte(l.Name))
+			lBuf = appendBytes(lBuf, 2, []byte(l.Value))
+			tsBuf = appendBytes(tsBuf, 1, lBuf)
+		}
+		for _, s := range ts.Samples {
+			var sBuf []byte
+			sBuf = appendKey(sBuf, 1, wireFixed64)
+			fixed := make([]byte, 8)
+			binary.LittleEndian.PutUint64(fixed, math.Float64bits(s.Value))
+			sBuf = append(sBuf, fixed...)
+			sBuf = appendKey(sBuf, 2, wireVarint)
+			sBuf = appendUvarint(sBuf, uint64(s.Timestamp))
+			tsBuf = appendBytes(tsBuf, 2, sBuf)
+		}
+		buf = appendBytes(buf, 1, tsBuf)
+	}
+	return buf
+}
+
+func testConfig() *g.PrometheusConfig {
+	return &g.PrometheusConfig{
+		EndpointLabel:   "instance",
+		StripPort:       true,
+		DropLabels:      []string{"job"},
+		Step:            15,
+		CounterSuffixes: []string{"_total", "_count", "_sum", "_bucket"},
+		Types:           map[string]string{"process_cpu_seconds": g.COUNTER},
+	}
+}
+
+func TestDecodeAndConvert(t *testing.T) {
+	in := &WriteRequest{Timeseries: []*TimeSeries{
+		{
+			Labels: []Label{
+				{"__name__", "http_requests_total"},
+				{"instance", "web-01:9100"},
+				{"job", "node"},
+				{"path", "/a,b"},
+				{"code", "200"},
+			},
+			Samples: []Sample{{Value: 10, Timestamp: 1500000000123}, {Value: 12, Timestamp: 1500000015123}},
+		},
+		{
+			Labels:  []Label{{"__name__", "process_cpu_seconds"}, {"instance", "web-01:9100"}},
+			Samples: []Sample{{Value: 3.5, Timestamp: 1500000000000}},
+		},
+		{
+			Labels:  []Label{{"__name__", "up"}},
+			Samples: []Sample{{Value: 1, Timestamp: 1500000000000}},
+		},
+		{
+			Labels:  []Label{{"__name__", "memory_bytes"}, {"instance", "web-02"}},
+			Samples: []Sample{{Value: math.NaN(), Timestamp: 1500000000000}, {Value: 1024, Timestamp: 1500000000000}},
+		},
+	}}
+
+	req, err := DecodeWriteRequest(snappy.Encode(nil, marshalWriteRequest(in)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(req.Timeseries) != 4 || len(req.Timeseries[0].Labels) != 5 || req.Timeseries[0].Samples[1].Value != 12 {
+		t.Fatalf("bad decoded request: %+v", req.Timeseries[0])
+	}
+
+	values, dropped := Convert(req, testConfig())
+	if dropped != 2 {
+		t.Errorf("expected 2 dropped samples, got %d", dropped)
+	}
+	if len(values) != 4 {
+		t.Fatalf("expected 4 values, got %d", len(values))
+	}
+
+	v := values[0]
+	if v.Endpoint != "web-01" || v.Metric != "http_requests_total" || v.Type != g.COUNTER ||
+		v.Tags != "code=200,path=/a_b" || v.Timestamp != 1500000000 || v.Step != 15 || v.Value != float64(10) {
+		t.Errorf("bad value: %v", v)
+	}
+	if values[2].Type != g.COUNTER {
+		t.Errorf("type of process_cpu_seconds should be configured as COUNTER, got %s", values[2].Type)
+	}
+	if values[3].Type != g.GAUGE || values[3].Endpoint != "web-02" {
+		t.Errorf("bad value: %v", values[3])
+	}
+}
+
+func TestUnmarshalTruncated(t *testing.T) {
+	buf := marshalWriteRequest(&WriteRequest{Timeseries: []*TimeSeries{
+		{Labels: []Label{{"__name__", "up"}}, Samples: []Sample{{Value: 1, Timestamp: 1}}},
+	}})
+	if _, err := UnmarshalWriteRequest(buf[:len(buf)-3]); err == nil {
+		t.Error("expected error of truncated message")
+	}
+}
+
+func TestDecodeTooLarge(t *testing.T) {
+	// the decoded length in the header is checked before decoding
+	body := snappy.Encode(nil, make([]byte, MaxDecodedSize+1))
+	if _, err := DecodeWriteRequest(body); err != ErrTooLarge {
+		t.Errorf("expected ErrTooLarge, got %v", err)
+	}
+	if _, err := DecodeWriteRequest([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}); err == nil || err == ErrTooLarge {
+		t.Errorf("expected error of bad header, got %v", err)
+	}
+}
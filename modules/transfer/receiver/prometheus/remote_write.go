@@ -0,0 +1,180 @@
+package prometheus
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/golang/snappy"
+)
+
+// The messages of remote write protocol(prompb.WriteRequest), only the fields used by transfer are decoded.
+//
+//	message WriteRequest { repeated TimeSeries timeseries = 1; }
+//	message TimeSeries   { repeated Label labels = 1; repeated Sample samples = 2; }
+//	message Label        { string name = 1; string value = 2; }
+//	message Sample       { double value = 1; int64 timestamp = 2; }
+type WriteRequest struct {
+	Timeseries []*TimeSeries
+}
+
+type TimeSeries struct {
+	Labels  []Label
+	Samples []Sample
+}
+
+type Label struct {
+	Name  string
+	Value string
+}
+
+type Sample struct {
+	Value     float64
+	Timestamp int64 // ms
+}
+
+// protobuf wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var errTruncated = errors.New("prometheus: truncated message")
+
+// DecodeWriteRequest decodes the snappy(block format) compressed protobuf body of remote write
+// MaxDecodedSize is the max size of the snappy decoded body, prometheus sends about 100KB per request by default
+const MaxDecodedSize = 32 * 1024 * 1024
+
+var ErrTooLarge = errors.New("prometheus: the decoded body is too large")
+
+func DecodeWriteRequest(compressed []byte) (*WriteRequest, error) {
+	// the decoded length is in the header, checks it before allocating the buffer
+	n, err := snappy.DecodedLen(compressed)
+	if err != nil {
+		return nil, fmt.Errorf("prometheus: bad snappy body: %v", err)
+	}
+	if n > MaxDecodedSize {
+		return nil, ErrTooLarge
+	}
+	buf, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		return nil, fmt.Errorf("prometheus: bad snappy body: %v", err)
+	}
+	return UnmarshalWriteRequest(buf)
+}
+
+func UnmarshalWriteRequest(buf []byte) (*WriteRequest, error) {
+	req := &WriteRequest{}
+	err := eachField(buf, func(field int, wire int, data []byte, _ uint64) error {
+		if field != 1 || wire != wireBytes {
+			return nil
+		}
+		ts, err := unmarshalTimeSeries(data)
+		if err != nil {
+			return err
+		}
+		req.Timeseries = append(req.Timeseries, ts)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func unmarshalTimeSeries(buf []byte) (*TimeSeries, error) {
+	ts := &TimeSeries{}
+	err := eachField(buf, func(field int, wire int, data []byte, _ uint64) error {
+		if wire != wireBytes {
+			return nil
+		}
+		switch field {
+		case 1:
+			var l Label
+			err := eachField(data, func(field int, wire int, data []byte, _ uint64) error {
+				if wire == wireBytes && field == 1 {
+					l.Name = string(data)
+				} else if wire == wireBytes && field == 2 {
+					l.Value = string(data)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			ts.Labels = append(ts.Labels, l)
+		case 2:
+			var s Sample
+			err := eachField(data, func(field int, wire int, _ []byte, v uint64) error {
+				if wire == wireFixed64 && field == 1 {
+					s.Value = math.Float64frombits(v)
+				} else if wire == wireVarint && field == 2 {
+					s.Timestamp = int64(v)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			ts.Samples = append(ts.Samples, s)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ts, nil
+}
+
+// eachField calls fn with the payload of each field, data is set for length-delimited fields,
+// v is set for varint and fixed fields. Unknown fields are skipped by fn.
+func eachField(buf []byte, fn func(field int, wire int, data []byte, v uint64) error) error {
+	for len(buf) > 0 {
+		key, n := binary.Uvarint(buf)
+		if n <= 0 {
+			return errTruncated
+		}
+		buf = buf[n:]
+		field, wire := int(key>>3), int(key&7)
+
+		var data []byte
+		var v uint64
+		switch wire {
+		case wireVarint:
+			v, n = binary.Uvarint(buf)
+			if n <= 0 {
+				return errTruncated
+			}
+			buf = buf[n:]
+		case wireFixed64:
+			if len(buf) < 8 {
+				return errTruncated
+			}
+			v = binary.LittleEndian.Uint64(buf)
+			buf = buf[8:]
+		case wireFixed32:
+			if len(buf) < 4 {
+				return errTruncated
+			}
+			v = uint64(binary.LittleEndian.Uint32(buf))
+			buf = buf[4:]
+		case wireBytes:
+			l, n := binary.Uvarint(buf)
+			if n <= 0 || uint64(len(buf)-n) < l {
+				return errTruncated
+			}
+			data = buf[n : n+int(l)]
+			buf = buf[n+int(l):]
+		default:
+			return fmt.Errorf("prometheus: unsupported wire type %d", wire)
+		}
+
+		if err := fn(field, wire, data, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,11 +1,15 @@
 package receiver
 
 import (
+	"github.com/Cepave/open-falcon-backend/modules/transfer/receiver/graphite"
 	"github.com/Cepave/open-falcon-backend/modules/transfer/receiver/rpc"
 	"github.com/Cepave/open-falcon-backend/modules/transfer/receiver/socket"
+	"github.com/Cepave/open-falcon-backend/modules/transfer/receiver/statsd"
 )
 
 func Start() {
 	go rpc.StartRpc()
 	go socket.StartSocket()
+	go graphite.StartGraphite()
+	go statsd.StartStatsd()
 }
@@ -7,7 +7,10 @@ import (
 	"time"
 
 	"github.com/Cepave/open-falcon-backend/modules/transfer/g"
+	"github.com/Cepave/open-falcon-backend/modules/transfer/limit"
 	"github.com/Cepave/open-falcon-backend/modules/transfer/proc"
+	"github.com/Cepave/open-falcon-backend/modules/transfer/recording"
+	"github.com/Cepave/open-falcon-backend/modules/transfer/relabel"
 	"github.com/Cepave/open-falcon-backend/modules/transfer/sender"
 	cmodel "github.com/open-falcon/common/model"
 	cutils "github.com/open-falcon/common/utils"
@@ -39,6 +42,13 @@ func (t *Transfer) Update(args []*cmodel.MetricValue, reply *cmodel.TransferResp
 	return RecvMetricValues(args, reply, "rpc")
 }
 
+// Recording receives the items forwarded by other transfers, for the recording rules of this transfer.
+// The items are already sent to the backends by the transfer received them
+func (t *Transfer) Recording(args []*cmodel.MetaData, reply *cmodel.SimpleRpcResponse) error {
+	recording.FeedForwarded(args)
+	return nil
+}
+
 // process new metric values
 func RecvMetricValues(args []*cmodel.MetricValue, reply *cmodel.TransferResponse, from string) error {
 	start := time.Now()
@@ -125,6 +135,16 @@ func RecvMetricValues(args []*cmodel.MetricValue, reply *cmodel.TransferResponse
 		}
 
 		fv.Value = vv
+
+		if !relabel.Apply(fv) {
+			proc.RelabelDropCnt.Incr()
+			continue
+		}
+		if reason := limit.Allow(fv, now); reason != "" {
+			proc.LimitRejectCnt.IncrReason(reason, 1)
+			reply.Invalid += 1
+			continue
+		}
 		items = append(items, fv)
 
 		// Filter Staging items through endpoint
@@ -150,14 +170,30 @@ func RecvMetricValues(args []*cmodel.MetricValue, reply *cmodel.TransferResponse
 	// statistics
 	cnt := int64(len(items))
 	proc.RecvCnt.IncrBy(cnt)
-	if from == "rpc" {
+	switch from {
+	case "rpc":
 		proc.RpcRecvCnt.IncrBy(cnt)
-	} else if from == "http" {
+	case "http":
 		proc.HttpRecvCnt.IncrBy(cnt)
+	case "prometheus":
+		proc.PromRecvCnt.IncrBy(cnt)
+	case "graphite-tcp":
+		proc.GraphiteTcpRecvCnt.IncrBy(cnt)
+	case "graphite-udp":
+		proc.GraphiteUdpRecvCnt.IncrBy(cnt)
+	case "graphite-pickle":
+		proc.GraphitePickleRecvCnt.IncrBy(cnt)
+	case "statsd":
+		proc.StatsdRecvCnt.IncrBy(cnt)
+	case "influx":
+		proc.InfluxRecvCnt.IncrBy(cnt)
+	case "opentsdb":
+		proc.OpentsdbRecvCnt.IncrBy(cnt)
 	}
 
 	// demultiplexing
 	nqmFpingItems, nqmTcppingItems, nqmTcpconnItems, genericItems := sender.Demultiplex(items)
+	recording.Feed(genericItems)
 
 	if cfg.Staging.Enabled {
 		sender.Push2StagingSendQueue(stagingItems)
@@ -9,7 +9,10 @@ import (
 	"time"
 
 	"github.com/Cepave/open-falcon-backend/modules/transfer/g"
+	"github.com/Cepave/open-falcon-backend/modules/transfer/limit"
 	"github.com/Cepave/open-falcon-backend/modules/transfer/proc"
+	"github.com/Cepave/open-falcon-backend/modules/transfer/recording"
+	"github.com/Cepave/open-falcon-backend/modules/transfer/relabel"
 	"github.com/Cepave/open-falcon-backend/modules/transfer/sender"
 	cmodel "github.com/open-falcon/common/model"
 )
@@ -56,6 +59,15 @@ func socketTelnetHandle(conn net.Conn) {
 			continue
 		}
 
+		if !relabel.Apply(item) {
+			proc.RelabelDropCnt.Incr()
+			continue
+		}
+		if reason := limit.Allow(item, time.Now().Unix()); reason != "" {
+			proc.LimitRejectCnt.IncrReason(reason, 1)
+			continue
+		}
+
 		items = append(items, item)
 	}
 
@@ -65,6 +77,7 @@ func socketTelnetHandle(conn net.Conn) {
 
 	// demultiplexing
 	nqmFpingItems, nqmTcppingItems, nqmTcpconnItems, genericItems := sender.Demultiplex(items)
+	recording.Feed(genericItems)
 
 	if cfg.Graph.Enabled {
 		sender.Push2GraphSendQueue(genericItems)
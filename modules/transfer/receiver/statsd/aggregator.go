@@ -0,0 +1,167 @@
+package statsd
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/Cepave/open-falcon-backend/modules/transfer/g"
+	"github.com/Cepave/open-falcon-backend/modules/transfer/receiver/tagutil"
+	cmodel "github.com/open-falcon/common/model"
+)
+
+type seriesKey struct {
+	Endpoint string
+	Metric   string
+	Tags     string
+}
+
+type timer struct {
+	values []float64
+	// the number of events considering sample rates
+	count float64
+}
+
+// Aggregator accumulates the events of an interval, Flush converts them to metric values:
+//
+//	counter  <metric>: sum of values(divided by sample rates)
+//	gauge    <metric>: the last value
+//	timer    <metric>.mean, .upper, .lower, .count, .p<N>
+//	set      <metric>: the number of unique values
+type Aggregator struct {
+	sync.Mutex
+	cfg      *g.StatsdConfig
+	counters map[seriesKey]float64
+	gauges   map[seriesKey]float64
+	updated  map[seriesKey]bool // gauges updated in the interval
+	timers   map[seriesKey]*timer
+	sets     map[seriesKey]map[string]bool
+}
+
+func NewAggregator(cfg *g.StatsdConfig) *Aggregator {
+	return &Aggregator{
+		cfg:      cfg,
+		counters: make(map[seriesKey]float64),
+		gauges:   make(map[seriesKey]float64),
+		updated:  make(map[seriesKey]bool),
+		timers:   make(map[seriesKey]*timer),
+		sets:     make(map[seriesKey]map[string]bool),
+	}
+}
+
+// Add accumulates the event, addr is the host of sender which is the endpoint if nothing else is configured
+func (this *Aggregator) Add(e *Event, addr string) error {
+	endpoint := e.Tags[this.cfg.EndpointTag]
+	delete(e.Tags, this.cfg.EndpointTag)
+	if endpoint == "" {
+		endpoint = this.cfg.DefaultEndpoint
+	}
+	if endpoint == "" {
+		endpoint = addr
+	}
+	if endpoint == "" {
+		return fmt.Errorf("no endpoint of %s", e.Metric)
+	}
+	key := seriesKey{Endpoint: endpoint, Metric: e.Metric, Tags: tagutil.Join(e.Tags, nil)}
+
+	this.Lock()
+	defer this.Unlock()
+
+	switch e.Type {
+	case typeCounter:
+		this.counters[key] += e.Value / e.SampleRate
+	case typeGauge:
+		if e.Relative {
+			this.gauges[key] += e.Value
+		} else {
+			this.gauges[key] = e.Value
+		}
+		this.updated[key] = true
+	case typeTimer:
+		t, ok := this.timers[key]
+		if !ok {
+			t = &timer{}
+			this.timers[key] = t
+		}
+		t.values = append(t.values, e.Value)
+		t.count += 1 / e.SampleRate
+	case typeSet:
+		s, ok := this.sets[key]
+		if !ok {
+			s = make(map[string]bool)
+			this.sets[key] = s
+		}
+		s[e.SetValue] = true
+	}
+	return nil
+}
+
+// Flush returns the aggregated values of the interval and starts a new interval
+func (this *Aggregator) Flush(now int64) []*cmodel.MetricValue {
+	this.Lock()
+	counters, timers, sets := this.counters, this.timers, this.sets
+	this.counters = make(map[seriesKey]float64)
+	this.timers = make(map[seriesKey]*timer)
+	this.sets = make(map[seriesKey]map[string]bool)
+
+	gauges := make(map[seriesKey]float64, len(this.gauges))
+	for key, v := range this.gauges {
+		if this.cfg.DeleteGauges && !this.updated[key] {
+			delete(this.gauges, key)
+			continue
+		}
+		gauges[key] = v
+	}
+	this.updated = make(map[seriesKey]bool)
+	this.Unlock()
+
+	step := int64(this.cfg.Step)
+	ret := make([]*cmodel.MetricValue, 0, len(counters)+len(gauges)+len(sets)+len(timers)*(4+len(this.cfg.Percentiles)))
+	emit := func(key seriesKey, suffix string, v float64) {
+		ret = append(ret, &cmodel.MetricValue{
+			Endpoint:  key.Endpoint,
+			Metric:    key.Metric + suffix,
+			Value:     v,
+			Step:      step,
+			Type:      g.GAUGE,
+			Tags:      key.Tags,
+			Timestamp: now,
+		})
+	}
+
+	for key, v := range counters {
+		emit(key, "", v)
+	}
+	for key, v := range gauges {
+		emit(key, "", v)
+	}
+	for key, s := range sets {
+		emit(key, "", float64(len(s)))
+	}
+	for key, t := range timers {
+		sort.Float64s(t.values)
+		sum := 0.0
+		for _, v := range t.values {
+			sum += v
+		}
+		n := len(t.values)
+		emit(key, ".mean", sum/float64(n))
+		emit(key, ".upper", t.values[n-1])
+		emit(key, ".lower", t.values[0])
+		emit(key, ".count", t.count)
+		for _, p := range this.cfg.Percentiles {
+			emit(key, fmt.Sprintf(".p%d", p), percentile(t.values, p))
+		}
+	}
+	return ret
+}
+
+// percentile of sorted values by the nearest rank
+func percentile(sorted []float64, p int) float64 {
+	rank := int(math.Ceil(float64(p) / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
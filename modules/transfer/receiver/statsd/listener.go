@@ -0,0 +1,125 @@
+package statsd
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/Cepave/open-falcon-backend/modules/transfer/g"
+	"github.com/Cepave/open-falcon-backend/modules/transfer/proc"
+	trpc "github.com/Cepave/open-falcon-backend/modules/transfer/receiver/rpc"
+	log "github.com/Sirupsen/logrus"
+	cmodel "github.com/open-falcon/common/model"
+)
+
+const maxUdpPacket = 65536
+
+func StartStatsd() {
+	cfg := g.Config().Statsd
+	if !cfg.Enabled {
+		return
+	}
+
+	aggregator := NewAggregator(cfg)
+	if cfg.UdpListen != "" {
+		go listenUdp(cfg.UdpListen, aggregator)
+	}
+	if cfg.TcpListen != "" {
+		go listenTcp(cfg.TcpListen, aggregator, time.Duration(cfg.Timeout)*time.Second)
+	}
+	go flush(aggregator, time.Duration(cfg.Step)*time.Second)
+}
+
+func flush(aggregator *Aggregator, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		values := aggregator.Flush(now.Unix())
+		if len(values) == 0 {
+			continue
+		}
+		reply := &cmodel.TransferResponse{}
+		trpc.RecvMetricValues(values, reply, "statsd")
+		if reply.Invalid > 0 {
+			proc.StatsdInvalidCnt.IncrBy(int64(reply.Invalid))
+		}
+	}
+}
+
+func handleLine(aggregator *Aggregator, line string, host string) {
+	if line = strings.TrimSpace(line); line == "" {
+		return
+	}
+	proc.StatsdEventCnt.Incr()
+
+	e, err := ParseEvent(line)
+	if err == nil {
+		err = aggregator.Add(e, host)
+	}
+	if err != nil {
+		proc.StatsdInvalidCnt.Incr()
+		log.Debugf("statsd: %s", err)
+	}
+}
+
+func listenUdp(addr string, aggregator *Aggregator) {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		log.Fatalf("net.ResolveUDPAddr fail: %s", err)
+	}
+	conn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		log.Fatalf("listen %s fail: %s", addr, err)
+	} else {
+		log.Println("statsd listening", addr, "(udp)")
+	}
+	defer conn.Close()
+
+	buf := make([]byte, maxUdpPacket)
+	for {
+		n, remote, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			log.Println("statsd: read udp fail:", err)
+			continue
+		}
+		host := remote.IP.String()
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			handleLine(aggregator, line, host)
+		}
+	}
+}
+
+func listenTcp(addr string, aggregator *Aggregator, timeout time.Duration) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatalf("listen %s fail: %s", addr, err)
+	} else {
+		log.Println("statsd listening", addr)
+	}
+	defer listener.Close()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			log.Println("listener.Accept occur error:", err)
+			continue
+		}
+		go handleTcp(conn, aggregator, timeout)
+	}
+}
+
+func handleTcp(conn net.Conn, aggregator *Aggregator, timeout time.Duration) {
+	defer conn.Close()
+
+	host, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+	reader := bufio.NewReader(conn)
+	for {
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		line, err := reader.ReadString('\n')
+		handleLine(aggregator, line, host)
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package statsd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// types of statsd events
+const (
+	typeCounter = "c"
+	typeGauge   = "g"
+	typeTimer   = "ms"
+	typeSet     = "s"
+)
+
+// Event is a line of statsd: <metric>:<value>|<type>[|@<sample rate>][|#<tag1>:<v1>,<tag2>]
+type Event struct {
+	Metric     string
+	Type       string
+	Value      float64
+	SetValue   string // the raw value of set
+	SampleRate float64
+	// +N or -N of gauge changes the last value instead of setting it
+	Relative bool
+	Tags     map[string]string
+}
+
+func ParseEvent(line string) (*Event, error) {
+	i := strings.IndexByte(line, ':')
+	if i <= 0 {
+		return nil, fmt.Errorf("bad line: %q", line)
+	}
+	e := &Event{Metric: line[:i], SampleRate: 1, Tags: map[string]string{}}
+
+	fields := strings.Split(line[i+1:], "|")
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("bad line: %q", line)
+	}
+	raw := fields[0]
+
+	switch fields[1] {
+	case typeCounter, typeGauge, typeSet:
+		e.Type = fields[1]
+	// histogram and distribution of DogStatsD are aggregated as timers
+	case typeTimer, "h", "d":
+		e.Type = typeTimer
+	default:
+		return nil, fmt.Errorf("bad type of line: %q", line)
+	}
+
+	for _, f := range fields[2:] {
+		switch {
+		case strings.HasPrefix(f, "@"):
+			rate, err := strconv.ParseFloat(f[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return nil, fmt.Errorf("bad sample rate of line: %q", line)
+			}
+			e.SampleRate = rate
+		case strings.HasPrefix(f, "#"):
+			for _, tag := range strings.Split(f[1:], ",") {
+				if tag == "" {
+					continue
+				}
+				if kv := strings.SplitN(tag, ":", 2); len(kv) == 2 {
+					e.Tags[kv[0]] = kv[1]
+				} else {
+					e.Tags[tag] = "true"
+				}
+			}
+		}
+	}
+
+	if e.Type == typeSet {
+		e.SetValue = raw
+		return e, nil
+	}
+	if e.Type == typeGauge && (strings.HasPrefix(raw, "+") || strings.HasPrefix(raw, "-")) {
+		e.Relative = true
+	}
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return nil, fmt.Errorf("bad value of line: %q", line)
+	}
+	e.Value = v
+	return e, nil
+}
@@ -0,0 +1,82 @@
+package statsd
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/Cepave/open-falcon-backend/modules/transfer/g"
+)
+
+func TestParseEvent(t *testing.T) {
+	e, err := ParseEvent("api.requests:3|c|@0.5|#host:web01,env:prod,canary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Metric != "api.requests" || e.Type != typeCounter || e.Value != 3 || e.SampleRate != 0.5 ||
+		e.Tags["host"] != "web01" || e.Tags["env"] != "prod" || e.Tags["canary"] != "true" {
+		t.Errorf("bad event: %+v", e)
+	}
+
+	e, err = ParseEvent("queue.size:-2|g")
+	if err != nil || !e.Relative || e.Value != -2 {
+		t.Errorf("bad relative gauge: %+v, %v", e, err)
+	}
+
+	for _, bad := range []string{"no-value", ":1|c", "a:1", "a:1|x", "a:x|c", "a:1|c|@2"} {
+		if _, err := ParseEvent(bad); err == nil {
+			t.Errorf("line %q should be bad", bad)
+		}
+	}
+}
+
+func TestAggregator(t *testing.T) {
+	a := NewAggregator(&g.StatsdConfig{Step: 10, EndpointTag: "host", Percentiles: []int{90}, DeleteGauges: true})
+	lines := []string{
+		"hits:1|c|#host:web01", "hits:2|c|@0.5|#host:web01",
+		"temp:10|g", "temp:+5|g",
+		"users:alice|s", "users:bob|s", "users:alice|s",
+	}
+	for i := 0; i < 10; i++ {
+		lines = append(lines, "latency:"+strconv.Itoa(i)+"|ms")
+	}
+	for _, line := range lines {
+		e, err := ParseEvent(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := a.Add(e, "10.0.0.1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := map[string]float64{}
+	for _, v := range a.Flush(100) {
+		if v.Timestamp != 100 || v.Step != 10 || v.Type != g.GAUGE || v.Tags != "" {
+			t.Errorf("bad value: %v", v)
+		}
+		got[v.Endpoint+"/"+v.Metric] = v.Value.(float64)
+	}
+	expected := map[string]float64{
+		"web01/hits":             5,
+		"10.0.0.1/temp":          15,
+		"10.0.0.1/users":         2,
+		"10.0.0.1/latency.mean":  4.5,
+		"10.0.0.1/latency.upper": 9,
+		"10.0.0.1/latency.lower": 0,
+		"10.0.0.1/latency.count": 10,
+		"10.0.0.1/latency.p90":   8,
+	}
+	if len(got) != len(expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	for k, v := range expected {
+		if got[k] != v {
+			t.Errorf("%s: expected %v, got %v", k, v, got[k])
+		}
+	}
+
+	// the gauge is not updated in the next interval
+	if values := a.Flush(110); len(values) != 0 {
+		t.Errorf("expected nothing flushed, got %v", values)
+	}
+}
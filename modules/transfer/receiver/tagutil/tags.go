@@ -0,0 +1,39 @@
+// Package tagutil formats the tags of the metrics received by the protocols other than falcon's.
+package tagutil
+
+import (
+	"sort"
+	"strings"
+)
+
+// tag keys and values cannot contain the separators of falcon tags
+var replacer = strings.NewReplacer(",", "_", "=", "_")
+
+// Pair formats a tag as "k=v", the separators in key and value are replaced by "_"
+func Pair(k, v string) string {
+	return replacer.Replace(k) + "=" + replacer.Replace(v)
+}
+
+// Join formats tags as "k1=v1,k2=v2" sorted by keys, the tags in drop are skipped
+func Join(tags map[string]string, drop map[string]bool) string {
+	l := make([]string, 0, len(tags))
+	for k, v := range tags {
+		if !drop[k] {
+			l = append(l, Pair(k, v))
+		}
+	}
+	sort.Strings(l)
+	return strings.Join(l, ",")
+}
+
+// DropSet returns the set of names and extra, used as the drop of Join
+func DropSet(names []string, extra ...string) map[string]bool {
+	drop := make(map[string]bool, len(names)+len(extra))
+	for _, name := range names {
+		drop[name] = true
+	}
+	for _, name := range extra {
+		drop[name] = true
+	}
+	return drop
+}
@@ -0,0 +1,16 @@
+package tagutil
+
+import "testing"
+
+func TestJoin(t *testing.T) {
+	tags := map[string]string{"host": "a", "b=c": "d,e", "dc": "bj", "empty": ""}
+	if s := Join(tags, nil); s != "b_c=d_e,dc=bj,empty=,host=a" {
+		t.Errorf("unexpected %q", s)
+	}
+	if s := Join(tags, DropSet([]string{"dc"}, "host")); s != "b_c=d_e,empty=" {
+		t.Errorf("unexpected %q", s)
+	}
+	if s := Join(nil, nil); s != "" {
+		t.Errorf("unexpected %q", s)
+	}
+}
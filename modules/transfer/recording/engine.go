@@ -0,0 +1,335 @@
+package recording
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/Cepave/open-falcon-backend/modules/transfer/g"
+	"github.com/Cepave/open-falcon-backend/modules/transfer/proc"
+	"github.com/Cepave/open-falcon-backend/modules/transfer/sender"
+	log "github.com/Sirupsen/logrus"
+	cmodel "github.com/open-falcon/common/model"
+	cutils "github.com/open-falcon/common/utils"
+)
+
+type sample struct {
+	group string
+	tags  map[string]string
+	value float64
+}
+
+// window keeps the last value of each input series in [start, start+step)
+type window struct {
+	start       int64
+	step        int64
+	counterType string
+	samples     map[string]*sample // pk of input series => sample
+}
+
+type ruleState struct {
+	sync.Mutex
+	rule    *Rule
+	windows map[int64]*window
+
+	emitted      int64
+	late         int64
+	outputSeries int // of the last evaluated window
+}
+
+// RuleStatus is the cardinality and the statistics of rule
+type RuleStatus struct {
+	Name         string `json:"name"`
+	Expr         string `json:"expr"`
+	Windows      int    `json:"windows"`
+	InputSeries  int    `json:"input_series"`  // in the open windows
+	OutputSeries int    `json:"output_series"` // of the last evaluated window
+	Emitted      int64  `json:"emitted"`
+	Late         int64  `json:"late"`
+	Owner        string `json:"owner"` // rpc address of the transfer evaluating the rule, empty for this transfer
+}
+
+var (
+	states     []*ruleState
+	owners     map[*ruleState]string // rpc address of the owner, only the rules of other transfers
+	statesLock = new(sync.RWMutex)
+)
+
+func Start() {
+	if err := SetRules(g.Config().Recording); err != nil {
+		log.Fatalln("recording rules fail:", err)
+	}
+	go evaluate()
+}
+
+// SetRules replaces the rules, the windows of the unchanged rules are kept
+func SetRules(cfg *g.RecordingConfig) error {
+	rules := []*Rule{}
+	if len(cfg.Peers) > 0 {
+		if _, ok := cfg.Peers[cfg.Node]; !ok {
+			return fmt.Errorf("recording.node %q is not in recording.peers", cfg.Node)
+		}
+	}
+	if cfg.Enabled {
+		for _, r := range cfg.Rules {
+			rule, err := Compile(r)
+			if err != nil {
+				return err
+			}
+			rules = append(rules, rule)
+		}
+	}
+
+	statesLock.Lock()
+	defer statesLock.Unlock()
+	newStates := make([]*ruleState, 0, len(rules))
+	newOwners := make(map[*ruleState]string)
+	ring := peersRing(cfg.Peers)
+	for _, rule := range rules {
+		state := &ruleState{rule: rule, windows: make(map[int64]*window)}
+		for _, old := range states {
+			if old.rule.SameAs(rule) {
+				state = old
+				break
+			}
+		}
+		newStates = append(newStates, state)
+		if node, err := ring.Get(rule.Name); err == nil && node != cfg.Node {
+			newOwners[state] = cfg.Peers[node]
+		}
+	}
+	states = newStates
+	owners = newOwners
+	return nil
+}
+
+// Reload reads the rules from the config file
+func Reload() error {
+	cfg, err := g.ReadRecordingConfig()
+	if err != nil {
+		return err
+	}
+	if err := SetRules(cfg); err != nil {
+		return err
+	}
+	g.SetRecordingConfig(cfg)
+	log.Printf("recording rules are reloaded, %d rules", len(cfg.Rules))
+	return nil
+}
+
+func currentStates() []*ruleState {
+	statesLock.RLock()
+	defer statesLock.RUnlock()
+	return states
+}
+
+func currentOwners() ([]*ruleState, map[*ruleState]string) {
+	statesLock.RLock()
+	defer statesLock.RUnlock()
+	return states, owners
+}
+
+// Feed puts the received items into the windows of the matched rules,
+// the items matched by the rules of other transfers are forwarded to the owners
+func Feed(items []*cmodel.MetaData) {
+	all, owners := currentOwners()
+	if len(all) == 0 {
+		return
+	}
+	forwarded := feed(all, owners, items, time.Now().Unix(), int64(g.Config().Recording.Delay))
+	for addr, items := range forwarded {
+		forward(addr, items)
+	}
+}
+
+// FeedForwarded puts the items forwarded by other transfers into the rules of this transfer,
+// they are not forwarded again even if the peers of the transfers are different
+func FeedForwarded(items []*cmodel.MetaData) {
+	all, owners := currentOwners()
+	if len(all) == 0 {
+		return
+	}
+	feed(all, owners, items, time.Now().Unix(), int64(g.Config().Recording.Delay))
+}
+
+// feed adds the items to the rules of this transfer, and returns the items to forward, owner => items
+func feed(all []*ruleState, owners map[*ruleState]string, items []*cmodel.MetaData, now int64, delay int64) map[string][]*cmodel.MetaData {
+	forwarded := make(map[string][]*cmodel.MetaData)
+	for _, state := range all {
+		matched := []*cmodel.MetaData{}
+		for _, d := range items {
+			if d.Step > 0 && state.rule.Match(d) {
+				matched = append(matched, d)
+			}
+		}
+		if len(matched) == 0 {
+			continue
+		}
+		if owner, ok := owners[state]; ok {
+			forwarded[owner] = append(forwarded[owner], matched...)
+		} else {
+			state.add(matched, now, delay)
+		}
+	}
+	// 同一条数据匹配owner的多条规则时只转发一次
+	for owner, items := range forwarded {
+		seen := make(map[*cmodel.MetaData]bool, len(items))
+		uniq := items[:0]
+		for _, d := range items {
+			if !seen[d] {
+				seen[d] = true
+				uniq = append(uniq, d)
+			}
+		}
+		forwarded[owner] = uniq
+	}
+	return forwarded
+}
+
+func (this *ruleState) add(items []*cmodel.MetaData, now int64, delay int64) {
+	this.Lock()
+	defer this.Unlock()
+
+	for _, d := range items {
+		start := d.Timestamp - d.Timestamp%d.Step
+		if start+d.Step+delay <= now {
+			this.late++
+			proc.RecordingLateCnt.Incr()
+			continue
+		}
+
+		w, ok := this.windows[start]
+		if !ok {
+			w = &window{start: start, step: d.Step, counterType: d.CounterType, samples: make(map[string]*sample)}
+			this.windows[start] = w
+		}
+		group, tags := this.rule.group(d)
+		w.samples[cutils.PK(d.Endpoint, d.Metric, d.Tags)] = &sample{group: group, tags: tags, value: d.Value}
+	}
+}
+
+// 每秒检查一次, 窗口结束delay秒之后计算并发送
+func evaluate() {
+	for now := range time.Tick(time.Second) {
+		items := Evaluate(now.Unix(), int64(g.Config().Recording.Delay))
+		if len(items) == 0 {
+			continue
+		}
+		proc.RecordingEmitCnt.IncrBy(int64(len(items)))
+
+		cfg := g.Config()
+		if cfg.Graph.Enabled {
+			sender.Push2GraphSendQueue(items)
+		}
+		if cfg.Judge.Enabled {
+			sender.Push2JudgeSendQueue(items)
+		}
+		if cfg.Tsdb.Enabled {
+			sender.Push2TsdbSendQueue(items)
+		}
+		if cfg.Influxdb.Enabled {
+			sender.Push2InfluxdbSendQueue(items)
+		}
+	}
+}
+
+// Evaluate aggregates the windows which are due and removes them
+func Evaluate(now int64, delay int64) []*cmodel.MetaData {
+	ret := []*cmodel.MetaData{}
+	for _, state := range currentStates() {
+		state.Lock()
+		due := []*window{}
+		for start, w := range state.windows {
+			if start+w.step+delay <= now {
+				due = append(due, w)
+				delete(state.windows, start)
+			}
+		}
+		state.Unlock()
+
+		for _, w := range due {
+			items := state.rule.aggregate(w)
+			state.Lock()
+			state.emitted += int64(len(items))
+			state.outputSeries = len(items)
+			state.Unlock()
+			ret = append(ret, items...)
+		}
+	}
+	return ret
+}
+
+type accumulator struct {
+	tags                 map[string]string
+	sum, min, max, count float64
+}
+
+func (this *Rule) aggregate(w *window) []*cmodel.MetaData {
+	groups := make(map[string]*accumulator)
+	for _, s := range w.samples {
+		acc, ok := groups[s.group]
+		if !ok {
+			acc = &accumulator{tags: s.tags, min: math.Inf(1), max: math.Inf(-1)}
+			groups[s.group] = acc
+		}
+		acc.sum += s.value
+		acc.count++
+		acc.min = math.Min(acc.min, s.value)
+		acc.max = math.Max(acc.max, s.value)
+	}
+
+	counterType := w.counterType
+	if this.Aggregation == "count" {
+		counterType = g.GAUGE
+	}
+	ret := make([]*cmodel.MetaData, 0, len(groups))
+	for _, acc := range groups {
+		var value float64
+		switch this.Aggregation {
+		case "sum":
+			value = acc.sum
+		case "avg":
+			value = acc.sum / acc.count
+		case "min":
+			value = acc.min
+		case "max":
+			value = acc.max
+		case "count":
+			value = acc.count
+		}
+		ret = append(ret, &cmodel.MetaData{
+			Endpoint:    this.Endpoint,
+			Metric:      this.Name,
+			Timestamp:   w.start,
+			Step:        w.step,
+			CounterType: counterType,
+			Tags:        acc.tags,
+			Value:       value,
+		})
+	}
+	return ret
+}
+
+func Status() []*RuleStatus {
+	all, owners := currentOwners()
+	ret := make([]*RuleStatus, 0, len(all))
+	for _, state := range all {
+		state.Lock()
+		status := &RuleStatus{
+			Name:         state.rule.Name,
+			Expr:         state.rule.Expr,
+			Windows:      len(state.windows),
+			OutputSeries: state.outputSeries,
+			Emitted:      state.emitted,
+			Late:         state.late,
+			Owner:        owners[state],
+		}
+		for _, w := range state.windows {
+			status.InputSeries += len(w.samples)
+		}
+		state.Unlock()
+		ret = append(ret, status)
+	}
+	return ret
+}
@@ -0,0 +1,106 @@
+package recording
+
+import (
+	"errors"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Cepave/consistent"
+	"github.com/Cepave/open-falcon-backend/modules/transfer/proc"
+	log "github.com/Sirupsen/logrus"
+	cmodel "github.com/open-falcon/common/model"
+)
+
+// 多个transfer时, 同一条规则的输入必须在同一个transfer上聚合, 否则每个transfer各自输出部分的结果.
+// 规则按名称一致性哈希到peers中的一个transfer(owner), 其他transfer把匹配的数据通过rpc转发给owner
+
+const (
+	forwardQueueSize   = 1024 // batches
+	forwardConnTimeout = 5 * time.Second
+	forwardCallTimeout = 10 * time.Second
+)
+
+// peersRing returns the ring of the peer names, a ring without nodes when peers is empty
+func peersRing(peers map[string]string) *consistent.Consistent {
+	ring := consistent.New()
+	ring.NumberOfReplicas = 500
+	names := make([]string, 0, len(peers))
+	for name := range peers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		ring.Add(name)
+	}
+	return ring
+}
+
+type forwarder struct {
+	addr   string
+	queue  chan []*cmodel.MetaData
+	client *rpc.Client
+}
+
+var (
+	forwarders     = make(map[string]*forwarder) // rpc address => forwarder
+	forwardersLock = new(sync.Mutex)
+)
+
+// forward puts the items into the queue of the owner, the items are dropped when the queue is full
+func forward(addr string, items []*cmodel.MetaData) {
+	forwardersLock.Lock()
+	f, ok := forwarders[addr]
+	if !ok {
+		f = &forwarder{addr: addr, queue: make(chan []*cmodel.MetaData, forwardQueueSize)}
+		forwarders[addr] = f
+		go f.run()
+	}
+	forwardersLock.Unlock()
+
+	select {
+	case f.queue <- items:
+	default:
+		proc.RecordingForwardFailCnt.IncrBy(int64(len(items)))
+	}
+}
+
+func (this *forwarder) run() {
+	for items := range this.queue {
+		if err := this.send(items); err != nil {
+			log.Errorf("forward %d recording items to %s fail: %v", len(items), this.addr, err)
+			proc.RecordingForwardFailCnt.IncrBy(int64(len(items)))
+			continue
+		}
+		proc.RecordingForwardCnt.IncrBy(int64(len(items)))
+	}
+}
+
+// send calls Transfer.Recording of the owner, the connection is closed and dialed again on error
+func (this *forwarder) send(items []*cmodel.MetaData) error {
+	if this.client == nil {
+		conn, err := net.DialTimeout("tcp", this.addr, forwardConnTimeout)
+		if err != nil {
+			return err
+		}
+		this.client = jsonrpc.NewClient(conn)
+	}
+
+	var resp cmodel.SimpleRpcResponse
+	call := this.client.Go("Transfer.Recording", items, &resp, make(chan *rpc.Call, 1))
+	var err error
+	select {
+	case <-call.Done:
+		err = call.Error
+	case <-time.After(forwardCallTimeout):
+		err = errors.New("call timeout")
+	}
+	if err != nil {
+		this.client.Close()
+		this.client = nil
+	}
+	return err
+}
@@ -0,0 +1,205 @@
+package recording
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Cepave/open-falcon-backend/modules/transfer/g"
+	cmodel "github.com/open-falcon/common/model"
+)
+
+func TestCompile(t *testing.T) {
+	rule, err := Compile(&g.RecordingRule{
+		Name:     "idc.net.if.in.bytes",
+		Endpoint: "cluster",
+		Expr:     "sum by (idc, isp) (metric=net.if.in.bytes, endpoint=web-*, tags iface=eth0, dir=in)",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rule.Aggregation != "sum" || len(rule.By) != 2 || rule.By[1] != "isp" || rule.Metric != "net.if.in.bytes" ||
+		rule.EndpointPattern != "web-*" || rule.Tags["iface"] != "eth0" || rule.Tags["dir"] != "in" {
+		t.Errorf("bad rule: %+v", rule)
+	}
+
+	for _, bad := range []string{"", "sum", "median (metric=a)", "sum by idc (metric=a)", "sum (tags a=b)", "sum (metric=a) x", "sum (metric)"} {
+		if _, err := Compile(&g.RecordingRule{Name: "n", Endpoint: "e", Expr: bad}); err == nil {
+			t.Errorf("expr %q should be bad", bad)
+		}
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	err := SetRules(&g.RecordingConfig{Enabled: true, Rules: []*g.RecordingRule{
+		{Name: "idc.load", Endpoint: "cluster", Expr: "avg by (idc) (metric=load.1min)"},
+		{Name: "hosts", Endpoint: "cluster", Expr: "count (metric=load.1min, endpoint=web-*)"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := func(endpoint string, idc string, ts int64, value float64) *cmodel.MetaData {
+		return &cmodel.MetaData{Endpoint: endpoint, Metric: "load.1min", Timestamp: ts, Step: 60,
+			Value: value, CounterType: g.GAUGE, Tags: map[string]string{"idc": idc}}
+	}
+	items := []*cmodel.MetaData{
+		d("web-1", "bj", 1200, 1), d("web-2", "bj", 1210, 3), d("db-1", "sh", 1220, 5),
+		// the last value of a series in the window is used
+		d("web-1", "bj", 1230, 2),
+		// the next window
+		d("web-1", "bj", 1270, 10),
+	}
+	feed(currentStates(), nil, items, 1240, 30)
+
+	if got := Evaluate(1200+60+30-1, 30); len(got) != 0 {
+		t.Errorf("the window is not due, got %v", got)
+	}
+
+	got := Evaluate(1200+60+30, 30)
+	values := map[string]float64{}
+	for _, v := range got {
+		if v.Endpoint != "cluster" || v.Timestamp != 1200 || v.Step != 60 {
+			t.Errorf("bad value: %v", v)
+		}
+		values[v.Metric+"/"+v.Tags["idc"]] = v.Value
+	}
+	expected := map[string]float64{"idc.load/bj": 2.5, "idc.load/sh": 5, "hosts/": 2}
+	if len(values) != len(expected) {
+		t.Errorf("expected %v, got %v", expected, values)
+	}
+	for k, v := range expected {
+		if values[k] != v {
+			t.Errorf("%s: expected %v, got %v", k, v, values[k])
+		}
+	}
+
+	status := Status()
+	if len(status) != 2 || status[0].Windows != 1 || status[0].InputSeries != 1 || status[0].OutputSeries != 2 || status[0].Emitted != 2 {
+		t.Errorf("bad status: %+v", status[0])
+	}
+
+	// late data of the evaluated window
+	feed(currentStates(), nil, []*cmodel.MetaData{d("web-3", "bj", 1200, 1)}, 1300, 30)
+	if Status()[0].Late != 1 {
+		t.Errorf("expected 1 late item, got %+v", Status()[0])
+	}
+
+	// the unchanged rule keeps its windows after reloading
+	SetRules(&g.RecordingConfig{Enabled: true, Rules: []*g.RecordingRule{
+		{Name: "idc.load", Endpoint: "cluster", Expr: "avg by (idc) (metric=load.1min)"},
+	}})
+	if status := Status(); len(status) != 1 || status[0].Windows != 1 || status[0].Late != 1 {
+		t.Errorf("bad status after reloading: %+v", status)
+	}
+}
+
+func TestOwners(t *testing.T) {
+	rules := []*g.RecordingRule{}
+	for i := 0; i < 20; i++ {
+		rules = append(rules, &g.RecordingRule{Name: fmt.Sprintf("idc.load.%d", i), Endpoint: "cluster", Expr: "sum (metric=load.1min)"})
+	}
+	peers := map[string]string{"transfer-00": "10.0.0.1:8433", "transfer-01": "10.0.0.2:8433"}
+
+	// every rule is owned by exactly one of the transfers
+	owned := map[string]int{}
+	for _, node := range []string{"transfer-00", "transfer-01"} {
+		if err := SetRules(&g.RecordingConfig{Enabled: true, Rules: rules, Node: node, Peers: peers}); err != nil {
+			t.Fatal(err)
+		}
+		for _, status := range Status() {
+			if status.Owner == "" {
+				owned[status.Name]++
+			} else if status.Owner == peers[node] {
+				t.Errorf("%s is forwarded to the transfer itself", status.Name)
+			}
+		}
+	}
+	if len(owned) != len(rules) {
+		t.Errorf("expected %d owned rules, got %v", len(rules), owned)
+	}
+	for name, n := range owned {
+		if n != 1 {
+			t.Errorf("%s is owned by %d transfers", name, n)
+		}
+	}
+
+	if err := SetRules(&g.RecordingConfig{Enabled: true, Rules: rules, Node: "transfer-02", Peers: peers}); err == nil {
+		t.Error("expected error of the node not in peers")
+	}
+
+	// without peers all rules are evaluated locally
+	SetRules(&g.RecordingConfig{Enabled: true, Rules: rules})
+	for _, status := range Status() {
+		if status.Owner != "" {
+			t.Errorf("%s should be evaluated locally, owner %s", status.Name, status.Owner)
+		}
+	}
+}
+
+func TestFeedForward(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "transfer")
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "cfg.json")
+	if err := ioutil.WriteFile(filename, []byte(`{"judge": {}, "graph": {}, "recording": {"enabled": true}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	g.ParseConfig(filename)
+
+	peers := map[string]string{"transfer-00": "10.0.0.1:8433", "transfer-01": "10.0.0.2:8433"}
+	rules := []*g.RecordingRule{}
+	for i := 0; i < 10; i++ {
+		rules = append(rules, &g.RecordingRule{Name: fmt.Sprintf("load.sum.%d", i), Endpoint: "cluster", Expr: "sum (metric=load.1min)"})
+	}
+	// FeedForwarded puts the items by the current time
+	now := time.Now().Unix()
+	start := now - now%60
+	d := func(endpoint string, value float64) *cmodel.MetaData {
+		return &cmodel.MetaData{Endpoint: endpoint, Metric: "load.1min", Timestamp: start, Step: 60, Value: value, CounterType: g.GAUGE}
+	}
+	received := map[string][]*cmodel.MetaData{
+		"transfer-00": {d("web-1", 1), d("web-2", 2)},
+		"transfer-01": {d("web-3", 3), d("web-4", 4)},
+	}
+	other := map[string]string{"transfer-00": "transfer-01", "transfer-01": "transfer-00"}
+
+	// feedNode feeds the items received by the transfer, and the items forwarded to it
+	feedNode := func(node string, forwardedToNode []*cmodel.MetaData) map[string][]*cmodel.MetaData {
+		// the windows of the other transfer are not kept
+		SetRules(&g.RecordingConfig{Enabled: true})
+		SetRules(&g.RecordingConfig{Enabled: true, Rules: rules, Node: node, Peers: peers})
+		all, owners := currentOwners()
+		forwarded := feed(all, owners, received[node], now, 30)
+		FeedForwarded(forwardedToNode)
+		return forwarded
+	}
+
+	fromOther := feedNode("transfer-01", nil)[peers["transfer-00"]]
+	// the items matched by several rules are forwarded once
+	if len(fromOther) != 0 && len(fromOther) != len(received["transfer-01"]) {
+		t.Errorf("unexpected forwarded items: %v", fromOther)
+	}
+	emitted := map[string]float64{}
+	for _, node := range []string{"transfer-00", "transfer-01"} {
+		forwarded := feedNode(node, fromOther)
+		for _, v := range Evaluate(start+60+30, 30) {
+			if _, ok := emitted[v.Metric]; ok {
+				t.Errorf("%s is emitted by two transfers", v.Metric)
+			}
+			emitted[v.Metric] = v.Value
+		}
+		fromOther = forwarded[peers[other[node]]]
+	}
+
+	if len(emitted) != len(rules) {
+		t.Errorf("expected %d rules emitted, got %v", len(rules), emitted)
+	}
+	for metric, v := range emitted {
+		if v != 10 {
+			t.Errorf("%s: expected the sum of all transfers 10, got %v", metric, v)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package recording
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/Cepave/open-falcon-backend/modules/transfer/g"
+	cmodel "github.com/open-falcon/common/model"
+)
+
+// Rule is the compiled expression of recording rule:
+//
+//	<aggregation> [by (<tag>[, <tag>...])] (metric=<metric>[, endpoint=<pattern>][, tags <tag>=<value>[, <tag>=<value>...]])
+//
+// aggregation is one of sum, avg, min, max and count. The pattern of endpoint is a shell pattern, e.g. "web-*".
+type Rule struct {
+	Name     string
+	Endpoint string
+	Expr     string
+
+	Aggregation     string
+	By              []string
+	Metric          string
+	EndpointPattern string
+	Tags            map[string]string
+}
+
+var aggregations = map[string]bool{"sum": true, "avg": true, "min": true, "max": true, "count": true}
+
+func Compile(r *g.RecordingRule) (*Rule, error) {
+	if r.Name == "" || r.Endpoint == "" {
+		return nil, fmt.Errorf("name and endpoint of rule %q are needed", r.Expr)
+	}
+	rule := &Rule{Name: r.Name, Endpoint: r.Endpoint, Expr: r.Expr, Tags: map[string]string{}}
+
+	expr := strings.TrimSpace(r.Expr)
+	i := strings.IndexAny(expr, " (")
+	if i < 0 {
+		return nil, fmt.Errorf("bad expr of rule %s: %q", r.Name, r.Expr)
+	}
+	rule.Aggregation, expr = expr[:i], strings.TrimSpace(expr[i:])
+	if !aggregations[rule.Aggregation] {
+		return nil, fmt.Errorf("bad aggregation of rule %s: %s", r.Name, rule.Aggregation)
+	}
+
+	if strings.HasPrefix(expr, "by") {
+		by, rest, err := parenthesized(strings.TrimSpace(expr[2:]))
+		if err != nil {
+			return nil, fmt.Errorf("bad by of rule %s: %v", r.Name, err)
+		}
+		for _, tag := range strings.Split(by, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				rule.By = append(rule.By, tag)
+			}
+		}
+		expr = strings.TrimSpace(rest)
+	}
+
+	selector, rest, err := parenthesized(expr)
+	if err != nil || strings.TrimSpace(rest) != "" {
+		return nil, fmt.Errorf("bad selector of rule %s: %q", r.Name, r.Expr)
+	}
+	for _, item := range strings.Split(selector, ",") {
+		item = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(item), "tags "))
+		if item == "" {
+			continue
+		}
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("bad selector of rule %s: %q", r.Name, item)
+		}
+		k, v := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		switch k {
+		case "metric":
+			rule.Metric = v
+		case "endpoint":
+			if _, err := filepath.Match(v, ""); err != nil {
+				return nil, fmt.Errorf("bad endpoint pattern of rule %s: %v", r.Name, err)
+			}
+			rule.EndpointPattern = v
+		default:
+			rule.Tags[k] = v
+		}
+	}
+	if rule.Metric == "" {
+		return nil, fmt.Errorf("metric of rule %s is needed", r.Name)
+	}
+	return rule, nil
+}
+
+// parenthesized returns the content of the leading "(...)" and the rest
+func parenthesized(s string) (string, string, error) {
+	if !strings.HasPrefix(s, "(") {
+		return "", "", fmt.Errorf("( is expected: %q", s)
+	}
+	i := strings.IndexByte(s, ')')
+	if i < 0 {
+		return "", "", fmt.Errorf(") is expected: %q", s)
+	}
+	return s[1:i], s[i+1:], nil
+}
+
+func (this *Rule) Match(d *cmodel.MetaData) bool {
+	if d.Metric != this.Metric {
+		return false
+	}
+	if this.EndpointPattern != "" {
+		if ok, _ := filepath.Match(this.EndpointPattern, d.Endpoint); !ok {
+			return false
+		}
+	}
+	for k, v := range this.Tags {
+		if d.Tags[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// group returns the key and tags of the emitted series which d belongs to
+func (this *Rule) group(d *cmodel.MetaData) (string, map[string]string) {
+	tags := make(map[string]string, len(this.By))
+	values := make([]string, len(this.By))
+	for i, tag := range this.By {
+		if v := d.Tags[tag]; v != "" {
+			tags[tag] = v
+			values[i] = v
+		}
+	}
+	return strings.Join(values, "\x00"), tags
+}
+
+// SameAs means the state of rule can be kept after reloading
+func (this *Rule) SameAs(other *Rule) bool {
+	return this.Name == other.Name && this.Endpoint == other.Endpoint && this.Expr == other.Expr
+}
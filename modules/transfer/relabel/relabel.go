@@ -0,0 +1,144 @@
+package relabel
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/Cepave/open-falcon-backend/modules/transfer/g"
+	log "github.com/Sirupsen/logrus"
+	cmodel "github.com/open-falcon/common/model"
+	cutils "github.com/open-falcon/common/utils"
+)
+
+var (
+	rules     []*Rule
+	rulesLock = new(sync.RWMutex)
+)
+
+func Start() {
+	if err := SetRules(g.Config().Relabel); err != nil {
+		log.Fatalln("relabel rules fail:", err)
+	}
+}
+
+// SetRules compiles and replaces the rule chain
+func SetRules(cfg *g.RelabelConfig) error {
+	chain := []*Rule{}
+	if cfg.Enabled {
+		for i, r := range cfg.Rules {
+			rule, err := Compile(r)
+			if err != nil {
+				return fmt.Errorf("rule %d: %v", i, err)
+			}
+			chain = append(chain, rule)
+		}
+	}
+
+	rulesLock.Lock()
+	defer rulesLock.Unlock()
+	rules = chain
+	return nil
+}
+
+func Reload() error {
+	cfg, err := g.ReadRelabelConfig()
+	if err != nil {
+		return err
+	}
+	if err := SetRules(cfg); err != nil {
+		return err
+	}
+	g.SetRelabelConfig(cfg)
+	log.Printf("relabel rules are reloaded, %d rules", len(cfg.Rules))
+	return nil
+}
+
+func currentRules() []*Rule {
+	rulesLock.RLock()
+	defer rulesLock.RUnlock()
+	return rules
+}
+
+// Apply rewrites d by the rules in order, it returns false if d is dropped
+func Apply(d *cmodel.MetaData) bool {
+	return apply(currentRules(), d, nil)
+}
+
+// apply drops d if its endpoint or metric is replaced with empty string,
+// trace is called for each rule with whether the rule matched d before it's applied
+func apply(chain []*Rule, d *cmodel.MetaData, trace func(i int, rule *Rule, matched bool, kept bool)) bool {
+	for i, rule := range chain {
+		matched := false
+		if trace != nil {
+			matched = rule.Match(d)
+		}
+		kept := rule.Apply(d)
+		if kept && (d.Endpoint == "" || d.Metric == "") {
+			kept = false
+		}
+		if trace != nil {
+			trace(i, rule, matched, kept)
+		}
+		if !kept {
+			return false
+		}
+	}
+	return true
+}
+
+// Step is the series after a rule is applied
+type Step struct {
+	Rule     int    `json:"rule"` // index in the rules
+	Action   string `json:"action"`
+	Endpoint string `json:"endpoint"`
+	Metric   string `json:"metric"`
+	Tags     string `json:"tags"`
+	Dropped  bool   `json:"dropped"`
+}
+
+// DryRunResult is what the value would become, Output is nil if it is dropped
+type DryRunResult struct {
+	Input  *cmodel.MetricValue `json:"input"`
+	Output *cmodel.MetricValue `json:"output"`
+	Steps  []*Step             `json:"steps"` // of the matched rules and the dropping rule
+}
+
+// DryRun applies the current rules to the values without sending them
+func DryRun(values []*cmodel.MetricValue) []*DryRunResult {
+	chain := currentRules()
+	results := make([]*DryRunResult, 0, len(values))
+	for _, v := range values {
+		if v == nil {
+			continue
+		}
+		d := &cmodel.MetaData{
+			Endpoint: v.Endpoint,
+			Metric:   v.Metric,
+			Tags:     cutils.DictedTagstring(v.Tags),
+		}
+
+		result := &DryRunResult{Input: v, Steps: []*Step{}}
+		trace := func(i int, rule *Rule, matched bool, kept bool) {
+			if !matched && kept {
+				return
+			}
+			result.Steps = append(result.Steps, &Step{
+				Rule:     i,
+				Action:   rule.Action,
+				Endpoint: d.Endpoint,
+				Metric:   d.Metric,
+				Tags:     cutils.SortedTags(d.Tags),
+				Dropped:  !kept,
+			})
+		}
+		if apply(chain, d, trace) {
+			output := *v
+			output.Endpoint = d.Endpoint
+			output.Metric = d.Metric
+			output.Tags = cutils.SortedTags(d.Tags)
+			result.Output = &output
+		}
+		results = append(results, result)
+	}
+	return results
+}
@@ -0,0 +1,115 @@
+package relabel
+
+import (
+	"testing"
+
+	"github.com/Cepave/open-falcon-backend/modules/transfer/g"
+	cmodel "github.com/open-falcon/common/model"
+)
+
+func compileAll(t *testing.T, rules ...*g.RelabelRule) []*Rule {
+	chain := []*Rule{}
+	for _, r := range rules {
+		rule, err := Compile(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		chain = append(chain, rule)
+	}
+	return chain
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, r := range []*g.RelabelRule{
+		{Action: "unknown"},
+		{Action: Keep},
+		{Action: Replace},
+		{Action: Replace, Target: MetricField, Regex: "("},
+		{Action: RenameTag, Source: "a", Target: MetricField},
+		{Action: DropTag},
+		{Action: HashMod, Source: EndpointField, Target: "shard"},
+		{Action: Drop, Match: &g.RelabelMatch{Metric: "["}},
+	} {
+		if _, err := Compile(r); err == nil {
+			t.Errorf("expected error of %+v", r)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	chain := compileAll(t,
+		&g.RelabelRule{Action: Drop, Match: &g.RelabelMatch{Metric: `debug\..*`}},
+		&g.RelabelRule{Action: DropTag, Match: &g.RelabelMatch{Tags: map[string]string{"pid": ".+"}}, Source: "pid"},
+		&g.RelabelRule{Action: Replace, Source: MetricField, Regex: `app\.(.*)`, Target: MetricField, Replacement: "service.$1"},
+		&g.RelabelRule{Action: RenameTag, Match: &g.RelabelMatch{Endpoint: "web-.*"}, Source: "mod", Target: "module"},
+		&g.RelabelRule{Action: Replace, Source: EndpointField, Regex: `([a-z]+)-\d+`, Target: "role"},
+		&g.RelabelRule{Action: HashMod, Source: EndpointField, Target: "shard", Modulus: 4},
+	)
+
+	d := &cmodel.MetaData{Endpoint: "web-01", Metric: "app.qps", Tags: map[string]string{"pid": "1234", "mod": "login"}}
+	if !apply(chain, d, nil) {
+		t.Fatal("series is dropped")
+	}
+	if d.Metric != "service.qps" {
+		t.Errorf("unexpected metric: %s", d.Metric)
+	}
+	if _, ok := d.Tags["pid"]; ok {
+		t.Errorf("pid is not dropped: %v", d.Tags)
+	}
+	if d.Tags["module"] != "login" || d.Tags["mod"] != "" {
+		t.Errorf("mod is not renamed: %v", d.Tags)
+	}
+	if d.Tags["role"] != "web" {
+		t.Errorf("unexpected role: %v", d.Tags)
+	}
+	if shard := d.Tags["shard"]; len(shard) != 1 || shard < "0" || shard > "3" {
+		t.Errorf("unexpected shard: %v", d.Tags)
+	}
+
+	d = &cmodel.MetaData{Endpoint: "web-01", Metric: "debug.gc"}
+	if apply(chain, d, nil) {
+		t.Error("debug.gc is not dropped")
+	}
+}
+
+func TestKeepAndEmptyMetric(t *testing.T) {
+	chain := compileAll(t,
+		&g.RelabelRule{Action: Keep, Match: &g.RelabelMatch{Endpoint: "db-.*"}},
+		&g.RelabelRule{Action: Replace, Source: MetricField, Regex: "tmp\\..*", Target: MetricField, Replacement: ""},
+	)
+
+	if apply(chain, &cmodel.MetaData{Endpoint: "web-01", Metric: "cpu.idle"}, nil) {
+		t.Error("unmatched series is kept")
+	}
+	if !apply(chain, &cmodel.MetaData{Endpoint: "db-01", Metric: "cpu.idle"}, nil) {
+		t.Error("matched series is dropped")
+	}
+	if apply(chain, &cmodel.MetaData{Endpoint: "db-01", Metric: "tmp.x"}, nil) {
+		t.Error("series with empty metric is kept")
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	err := SetRules(&g.RelabelConfig{Enabled: true, Rules: []*g.RelabelRule{
+		{Action: DropTag, Source: "pid"},
+		{Action: Drop, Match: &g.RelabelMatch{Metric: "proc.num"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer SetRules(&g.RelabelConfig{})
+
+	results := DryRun([]*cmodel.MetricValue{
+		{Endpoint: "host-1", Metric: "cpu.idle", Tags: "pid=1,core=0", Value: 1},
+		{Endpoint: "host-1", Metric: "proc.num", Value: 1},
+	})
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+	if out := results[0].Output; out == nil || out.Tags != "core=0" || len(results[0].Steps) != 1 {
+		t.Errorf("unexpected result: %+v %+v", out, results[0].Steps)
+	}
+	if results[1].Output != nil || len(results[1].Steps) != 2 || !results[1].Steps[1].Dropped {
+		t.Errorf("proc.num is not dropped: %+v", results[1])
+	}
+}
@@ -0,0 +1,196 @@
+package relabel
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/Cepave/open-falcon-backend/modules/transfer/g"
+	cmodel "github.com/open-falcon/common/model"
+)
+
+// the names of endpoint and metric in source and target, the others are tags
+const (
+	EndpointField = "__endpoint__"
+	MetricField   = "__metric__"
+)
+
+const (
+	Drop      = "drop"       // drops the matched series
+	Keep      = "keep"       // drops the unmatched series
+	Replace   = "replace"    // sets target to the expanded replacement if source matches regex
+	RenameTag = "rename_tag" // renames tag source to target
+	DropTag   = "drop_tag"   // removes tag source
+	HashMod   = "hashmod"    // sets target to the hash of source modulo modulus
+)
+
+// Rule is the compiled relabel rule
+type Rule struct {
+	Action      string
+	Source      string
+	Target      string
+	Replacement string
+	Modulus     uint64
+
+	endpoint *regexp.Regexp
+	metric   *regexp.Regexp
+	tags     map[string]*regexp.Regexp
+	regex    *regexp.Regexp
+}
+
+// anchored compiles the pattern which must match the whole string, empty pattern matches anything
+func anchored(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	return regexp.Compile("^(?:" + pattern + ")$")
+}
+
+func Compile(r *g.RelabelRule) (*Rule, error) {
+	rule := &Rule{
+		Action:      r.Action,
+		Source:      r.Source,
+		Target:      r.Target,
+		Replacement: r.Replacement,
+		Modulus:     r.Modulus,
+		tags:        map[string]*regexp.Regexp{},
+	}
+
+	var err error
+	if r.Match != nil {
+		if rule.endpoint, err = anchored(r.Match.Endpoint); err != nil {
+			return nil, fmt.Errorf("bad endpoint of match: %v", err)
+		}
+		if rule.metric, err = anchored(r.Match.Metric); err != nil {
+			return nil, fmt.Errorf("bad metric of match: %v", err)
+		}
+		for tag, pattern := range r.Match.Tags {
+			if rule.tags[tag], err = regexp.Compile("^(?:" + pattern + ")$"); err != nil {
+				return nil, fmt.Errorf("bad tag %s of match: %v", tag, err)
+			}
+		}
+	}
+
+	isTag := func(name string) bool {
+		return name != "" && name != EndpointField && name != MetricField
+	}
+	switch r.Action {
+	case Drop:
+	case Keep:
+		if r.Match == nil {
+			return nil, fmt.Errorf("match of %s is needed", r.Action)
+		}
+	case Replace:
+		if r.Target == "" {
+			return nil, fmt.Errorf("target of %s is needed", r.Action)
+		}
+		pattern := r.Regex
+		if pattern == "" {
+			pattern = "(.*)"
+		}
+		if rule.regex, err = anchored(pattern); err != nil {
+			return nil, fmt.Errorf("bad regex: %v", err)
+		}
+		if rule.Replacement == "" {
+			rule.Replacement = "$1"
+		}
+	case RenameTag:
+		if !isTag(r.Source) || !isTag(r.Target) {
+			return nil, fmt.Errorf("source and target of %s must be tags", r.Action)
+		}
+	case DropTag:
+		if !isTag(r.Source) {
+			return nil, fmt.Errorf("source of %s must be tag", r.Action)
+		}
+	case HashMod:
+		if r.Source == "" || r.Target == "" || r.Modulus == 0 {
+			return nil, fmt.Errorf("source, target and modulus of %s are needed", r.Action)
+		}
+	default:
+		return nil, fmt.Errorf("unknown action: %q", r.Action)
+	}
+	return rule, nil
+}
+
+func (this *Rule) Match(d *cmodel.MetaData) bool {
+	if this.endpoint != nil && !this.endpoint.MatchString(d.Endpoint) {
+		return false
+	}
+	if this.metric != nil && !this.metric.MatchString(d.Metric) {
+		return false
+	}
+	for tag, re := range this.tags {
+		value, ok := d.Tags[tag]
+		if !ok || !re.MatchString(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// Apply rewrites d in place, it returns false if d is dropped
+func (this *Rule) Apply(d *cmodel.MetaData) bool {
+	matched := this.Match(d)
+	switch this.Action {
+	case Drop:
+		return !matched
+	case Keep:
+		return matched
+	}
+	if !matched {
+		return true
+	}
+
+	switch this.Action {
+	case Replace:
+		source := get(d, this.Source)
+		indexes := this.regex.FindStringSubmatchIndex(source)
+		if indexes == nil {
+			return true
+		}
+		value := this.regex.ExpandString(nil, this.Replacement, source, indexes)
+		set(d, this.Target, string(value))
+	case RenameTag:
+		if value, ok := d.Tags[this.Source]; ok {
+			delete(d.Tags, this.Source)
+			d.Tags[this.Target] = value
+		}
+	case DropTag:
+		delete(d.Tags, this.Source)
+	case HashMod:
+		sum := md5.Sum([]byte(get(d, this.Source)))
+		set(d, this.Target, strconv.FormatUint(binary.BigEndian.Uint64(sum[8:])%this.Modulus, 10))
+	}
+	return true
+}
+
+func get(d *cmodel.MetaData, name string) string {
+	switch name {
+	case EndpointField:
+		return d.Endpoint
+	case MetricField:
+		return d.Metric
+	}
+	return d.Tags[name]
+}
+
+// set removes the tag if value is empty
+func set(d *cmodel.MetaData, name string, value string) {
+	switch name {
+	case EndpointField:
+		d.Endpoint = value
+	case MetricField:
+		d.Metric = value
+	default:
+		if value == "" {
+			delete(d.Tags, name)
+			return
+		}
+		if d.Tags == nil {
+			d.Tags = map[string]string{}
+		}
+		d.Tags[name] = value
+	}
+}
@@ -112,7 +112,7 @@ func initConnPools() {
 
 	// graph
 	graphInstances := nset.NewSafeSet()
-	for _, nitem := range cfg.Graph.ClusterList {
+	for _, nitem := range cfg.Graph.AllNodes() {
 		for _, addr := range nitem.Addrs {
 			graphInstances.Add(addr)
 		}
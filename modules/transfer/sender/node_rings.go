@@ -1,15 +1,93 @@
 package sender
 
 import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
 	"github.com/Cepave/consistent"
 	"github.com/Cepave/open-falcon-backend/modules/transfer/g"
+	log "github.com/Sirupsen/logrus"
+)
+
+// 扩容graph时的新环, 数据同时写入两个环, 切换前为nil
+var (
+	GraphNextNodeRing *ConsistentHashNodeRing
+	graphRingsLock    = new(sync.RWMutex)
+	// 启动时的所有graph节点, 发送队列和连接池只为这些节点创建
+	graphNodes map[string]*g.ClusterNode
 )
 
 func initNodeRings() {
 	cfg := g.Config()
 
 	JudgeNodeRing = newConsistentHashNodesRing(cfg.Judge.Replicas, KeysOfMap(cfg.Judge.Cluster))
-	GraphNodeRing = newConsistentHashNodesRing(cfg.Graph.Replicas, KeysOfMap(cfg.Graph.Cluster))
+	GraphNodeRing, GraphNextNodeRing = newGraphNodeRings(cfg.Graph)
+	graphNodes = cfg.Graph.AllNodes()
+}
+
+func newGraphNodeRings(cfg *g.GraphConfig) (current *ConsistentHashNodeRing, next *ConsistentHashNodeRing) {
+	current = newConsistentHashNodesRing(cfg.Replicas, KeysOfMap(cfg.Cluster))
+	if cfg.Next != nil {
+		next = newConsistentHashNodesRing(cfg.Next.Replicas, KeysOfMap(cfg.Next.Cluster))
+	}
+	return
+}
+
+func graphNodeRings() (current *ConsistentHashNodeRing, next *ConsistentHashNodeRing) {
+	graphRingsLock.RLock()
+	defer graphRingsLock.RUnlock()
+	return GraphNodeRing, GraphNextNodeRing
+}
+
+// ReloadGraphRings reads the graph rings from the config file, to start or cut over a rebalancing.
+// The nodes must be started with transfer, i.e. in cluster or in the next ring, otherwise restart is needed.
+func ReloadGraphRings() error {
+	rings, err := g.ReadGraphRings()
+	if err != nil {
+		return err
+	}
+	for name, node := range rings.AllNodes() {
+		started, ok := graphNodes[name]
+		if !ok || strings.Join(started.Addrs, ",") != strings.Join(node.Addrs, ",") {
+			return fmt.Errorf("graph node %s(%s) is not started, restart is needed", name, strings.Join(node.Addrs, ","))
+		}
+	}
+
+	current, next := newGraphNodeRings(rings)
+	graphRingsLock.Lock()
+	GraphNodeRing, GraphNextNodeRing = current, next
+	graphRingsLock.Unlock()
+	g.SetGraphRings(rings)
+
+	if rings.Next != nil {
+		log.Printf("graph rings are reloaded, version %d, writing to next version %d", rings.Version, rings.Next.Version)
+	} else {
+		log.Printf("graph rings are reloaded, version %d", rings.Version)
+	}
+	return nil
+}
+
+type GraphRingStatus struct {
+	Version  int      `json:"version"`
+	Replicas int      `json:"replicas"`
+	Nodes    []string `json:"nodes"`
+}
+
+// GetGraphRingStatus returns the current ring and the next ring, which is nil if not rebalancing
+func GetGraphRingStatus() map[string]*GraphRingStatus {
+	cfg := g.Config().Graph
+	ret := map[string]*GraphRingStatus{
+		"current": {Version: cfg.Version, Replicas: cfg.Replicas, Nodes: KeysOfMap(cfg.Cluster)},
+		"next":    nil,
+	}
+	sort.Strings(ret["current"].Nodes)
+	if cfg.Next != nil {
+		ret["next"] = &GraphRingStatus{Version: cfg.Next.Version, Replicas: cfg.Next.Replicas, Nodes: KeysOfMap(cfg.Next.Cluster)}
+		sort.Strings(ret["next"].Nodes)
+	}
+	return ret
 }
 
 // TODO 考虑放到公共组件库,或utils库
@@ -0,0 +1,158 @@
+package sender
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Cepave/open-falcon-backend/modules/transfer/g"
+	cmodel "github.com/open-falcon/common/model"
+	nlist "github.com/toolkits/container/list"
+)
+
+const (
+	currentRingConfig = `{"judge": {}, "graph": {"version": 1, "replicas": 500,
+		"cluster": {"graph-00": "10.0.0.1:6070"}}}`
+	nextRingConfig = `{"judge": {}, "graph": {"version": 1, "replicas": 500,
+		"cluster": {"graph-00": "10.0.0.1:6070"},
+		"next": {"version": 2, "replicas": 500, "cluster": {"graph-00": "10.0.0.1:6070", "graph-01": "10.0.0.2:6070,10.0.0.3:6070"}}}}`
+	cutoverRingConfig = `{"judge": {}, "graph": {"version": 2, "replicas": 500,
+		"cluster": {"graph-00": "10.0.0.1:6070", "graph-01": "10.0.0.2:6070,10.0.0.3:6070"}}}`
+)
+
+func writeRingConfig(t *testing.T, filename string, content string) {
+	if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// initTestRings starts the rings and the graph queues by the config
+func initTestRings(t *testing.T, filename string, content string) {
+	writeRingConfig(t, filename, content)
+	g.ParseConfig(filename)
+	initNodeRings()
+	GraphQueues = make(map[string]*nlist.SafeListLimited)
+	for node, cnode := range graphNodes {
+		for _, addr := range cnode.Addrs {
+			GraphQueues[node+addr] = nlist.NewSafeListLimited(1024)
+		}
+	}
+}
+
+func TestReloadGraphRings(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "transfer")
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "cfg.json")
+
+	// the nodes of the next ring are started
+	initTestRings(t, filename, nextRingConfig)
+	writeRingConfig(t, filename, currentRingConfig)
+	if err := ReloadGraphRings(); err != nil {
+		t.Fatal(err)
+	}
+	if _, next := graphNodeRings(); next != nil || g.Config().Graph.Next != nil {
+		t.Error("the next ring is not removed")
+	}
+
+	// start rebalancing
+	writeRingConfig(t, filename, nextRingConfig)
+	if err := ReloadGraphRings(); err != nil {
+		t.Fatal(err)
+	}
+	status := GetGraphRingStatus()
+	if status["next"] == nil || status["next"].Version != 2 || len(status["next"].Nodes) != 2 {
+		t.Errorf("unexpected status: %v", status["next"])
+	}
+
+	// cut over
+	writeRingConfig(t, filename, cutoverRingConfig)
+	if err := ReloadGraphRings(); err != nil {
+		t.Fatal(err)
+	}
+	status = GetGraphRingStatus()
+	if status["next"] != nil || status["current"].Version != 2 || len(status["current"].Nodes) != 2 {
+		t.Errorf("unexpected status: %v", status["current"])
+	}
+
+	// the node not started, and the node with different addresses
+	for _, content := range []string{
+		`{"graph": {"version": 2, "replicas": 500, "cluster": {"graph-00": "10.0.0.1:6070", "graph-02": "10.0.0.4:6070"}}}`,
+		`{"graph": {"version": 2, "replicas": 500, "cluster": {"graph-00": "10.0.0.1:6070", "graph-01": "10.0.0.2:6070"}}}`,
+		`{"graph": {"version": 2, "replicas": 500, "cluster": {"graph-00": "10.0.0.1:6070"},
+			"next": {"version": 2, "replicas": 500, "cluster": {"graph-00": "10.0.0.1:6070"}}}}`,
+	} {
+		writeRingConfig(t, filename, content)
+		if err := ReloadGraphRings(); err == nil {
+			t.Errorf("expected error of %s", content)
+		}
+	}
+	if g.Config().Graph.Version != 2 || len(g.Config().Graph.Cluster) != 2 {
+		t.Error("the rings are changed by the failed reloading")
+	}
+}
+
+func TestPush2GraphSendQueueDoubleWrite(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "transfer")
+	defer os.RemoveAll(dir)
+	initTestRings(t, filepath.Join(dir, "cfg.json"), nextRingConfig)
+	MinStep = 30
+
+	current, next := graphNodeRings()
+	items := make([]*cmodel.MetaData, 0, 100)
+	for i := 0; i < 100; i++ {
+		items = append(items, &cmodel.MetaData{
+			Endpoint:    fmt.Sprintf("host-%d", i),
+			Metric:      "cpu.idle",
+			Timestamp:   1500000000,
+			Step:        60,
+			Value:       1,
+			CounterType: g.GAUGE,
+		})
+	}
+	Push2GraphSendQueue(items)
+
+	expected := make(map[string]int)
+	moved := 0
+	for _, item := range items {
+		node, _ := current.GetNode(item.PK())
+		nextNode, _ := next.GetNode(item.PK())
+		nodes := []string{node}
+		if nextNode != node {
+			nodes = append(nodes, nextNode)
+			moved++
+		}
+		for _, node := range nodes {
+			for _, addr := range graphNodes[node].Addrs {
+				expected[node+addr]++
+			}
+		}
+	}
+	if moved == 0 {
+		t.Fatal("no counter is moved to the next ring")
+	}
+	for key, Q := range GraphQueues {
+		if Q.Len() != expected[key] {
+			t.Errorf("queue %s: expected %d items, got %d", key, expected[key], Q.Len())
+		}
+	}
+	// all replicas of the new node receive the moved counters
+	if GraphQueues["graph-0110.0.0.2:6070"].Len() != moved || GraphQueues["graph-0110.0.0.3:6070"].Len() != moved {
+		t.Errorf("the moved counters are not written to all replicas of graph-01")
+	}
+	if GraphQueues["graph-0010.0.0.1:6070"].Len() != len(items) {
+		t.Errorf("the counters are not written to the current ring")
+	}
+
+	// not rebalancing
+	initTestRings(t, filepath.Join(dir, "cfg.json"), cutoverRingConfig)
+	Push2GraphSendQueue(items)
+	total := 0
+	for node, cnode := range graphNodes {
+		total += GraphQueues[node+cnode.Addrs[0]].Len()
+	}
+	if total != len(items) {
+		t.Errorf("expected %d items in the current ring, got %d", len(items), total)
+	}
+}
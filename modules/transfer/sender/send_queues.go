@@ -12,7 +12,7 @@ func initSendQueues() {
 		JudgeQueues[node] = Q
 	}
 
-	for node, nitem := range cfg.Graph.ClusterList {
+	for node, nitem := range cfg.Graph.AllNodes() {
 		for _, addr := range nitem.Addrs {
 			Q := nlist.NewSafeListLimited(DefaultSendQueueMaxSize)
 			GraphQueues[node+addr] = Q
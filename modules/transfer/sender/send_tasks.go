@@ -51,7 +51,7 @@ func startSendTasks() {
 		go forward2JudgeTask(queue, node, judgeConcurrent)
 	}
 
-	for node, nitem := range cfg.Graph.ClusterList {
+	for node, nitem := range cfg.Graph.AllNodes() {
 		for _, addr := range nitem.Addrs {
 			queue := GraphQueues[node+addr]
 			go forward2GraphTask(queue, node, addr, graphConcurrent)
@@ -80,6 +80,7 @@ func forward2JudgeTask(Q *list.SafeListLimited, node string, concurrent int) {
 	batch := g.Config().Judge.Batch // 一次发送,最多batch条数据
 	addr := g.Config().Judge.Cluster[node]
 	sema := nsema.NewSemaphore(concurrent)
+	spillQ := JudgeSpillQueues[node]
 
 	for {
 		items := Q.PopBackBy(batch)
@@ -94,6 +95,11 @@ func forward2JudgeTask(Q *list.SafeListLimited, node string, concurrent int) {
 			judgeItems[i] = items[i].(*cmodel.JudgeItem)
 		}
 
+		// 落盘数据尚未重放完毕时, 新数据排在其后
+		if isSpilling(spillQ) && spill2JudgeQueue(node, judgeItems) {
+			continue
+		}
+
 		//	同步Call + 有限并发 进行发送
 		sema.Acquire()
 		go func(addr string, judgeItems []*cmodel.JudgeItem, count int) {
@@ -114,6 +120,9 @@ func forward2JudgeTask(Q *list.SafeListLimited, node string, concurrent int) {
 			// statistics
 			if !sendOk {
 				log.Printf("send judge %s:%s fail: %v", node, addr, err)
+				if spill2JudgeQueue(node, judgeItems) {
+					return
+				}
 				proc.SendToJudgeFailCnt.IncrBy(int64(count))
 			} else {
 				proc.SendToJudgeCnt.IncrBy(int64(count))
@@ -126,6 +135,7 @@ func forward2JudgeTask(Q *list.SafeListLimited, node string, concurrent int) {
 func forward2GraphTask(Q *list.SafeListLimited, node string, addr string, concurrent int) {
 	batch := g.Config().Graph.Batch // 一次发送,最多batch条数据
 	sema := nsema.NewSemaphore(concurrent)
+	spillQ := GraphSpillQueues[node+addr]
 
 	for {
 		items := Q.PopBackBy(batch)
@@ -140,6 +150,11 @@ func forward2GraphTask(Q *list.SafeListLimited, node string, addr string, concur
 			graphItems[i] = items[i].(*cmodel.GraphItem)
 		}
 
+		// 落盘数据尚未重放完毕时, 新数据排在其后
+		if isSpilling(spillQ) && spill2GraphQueue(node+addr, graphItems) {
+			continue
+		}
+
 		sema.Acquire()
 		go func(addr string, graphItems []*cmodel.GraphItem, count int) {
 			defer sema.Release()
@@ -159,6 +174,9 @@ func forward2GraphTask(Q *list.SafeListLimited, node string, addr string, concur
 			// statistics
 			if !sendOk {
 				log.Printf("send to graph %s:%s fail: %v", node, addr, err)
+				if spill2GraphQueue(node+addr, graphItems) {
+					return
+				}
 				proc.SendToGraphFailCnt.IncrBy(int64(count))
 			} else {
 				proc.SendToGraphCnt.IncrBy(int64(count))
@@ -63,9 +63,11 @@ func Start() {
 	//
 	initConnPools()
 	initSendQueues()
+	initSpillQueues()
 	initNodeRings()
 	// SendTasks依赖基础组件的初始化,要最后启动
 	startSendTasks()
+	startSpillTasks()
 	startSenderCron()
 	log.Println("send.Start, ok")
 }
@@ -98,6 +100,11 @@ func Push2JudgeSendQueue(items []*cmodel.MetaData) {
 		Q := JudgeQueues[node]
 		isSuccess := Q.PushFront(judgeItem)
 
+		// 发送缓存溢出时, 尝试落盘
+		if !isSuccess {
+			isSuccess = spill2JudgeQueue(node, []*cmodel.JudgeItem{judgeItem})
+		}
+
 		// statistics
 		if !isSuccess {
 			proc.SendToJudgeDropCnt.Incr()
@@ -107,7 +114,7 @@ func Push2JudgeSendQueue(items []*cmodel.MetaData) {
 
 // 将数据 打入 某个Graph的发送缓存队列, 具体是哪一个Graph 由一致性哈希 决定
 func Push2GraphSendQueue(items []*cmodel.MetaData) {
-	cfg := g.Config().Graph
+	ring, nextRing := graphNodeRings()
 
 	for _, item := range items {
 		graphItem, err := convert2GraphItem(item)
@@ -121,18 +128,32 @@ func Push2GraphSendQueue(items []*cmodel.MetaData) {
 		proc.RecvDataTrace.Trace(pk, item)
 		proc.RecvDataFilter.Filter(pk, item.Value, item)
 
-		node, err := GraphNodeRing.GetNode(pk)
+		node, err := ring.GetNode(pk)
 		if err != nil {
 			log.Println("E:", err)
 			continue
 		}
+		nodes := []string{node}
+
+		// 扩容过程中, 同时写入新环的节点
+		if nextRing != nil {
+			if nextNode, err := nextRing.GetNode(pk); err == nil && nextNode != node {
+				nodes = append(nodes, nextNode)
+				proc.SendToGraphDoubleWriteCnt.Incr()
+			}
+		}
 
-		cnode := cfg.ClusterList[node]
 		errCnt := 0
-		for _, addr := range cnode.Addrs {
-			Q := GraphQueues[node+addr]
-			if !Q.PushFront(graphItem) {
-				errCnt += 1
+		for _, node := range nodes {
+			for _, addr := range graphNodes[node].Addrs {
+				Q := GraphQueues[node+addr]
+				if Q.PushFront(graphItem) {
+					continue
+				}
+				// 发送缓存溢出时, 尝试落盘
+				if !spill2GraphQueue(node+addr, []*cmodel.GraphItem{graphItem}) {
+					errCnt += 1
+				}
 			}
 		}
 
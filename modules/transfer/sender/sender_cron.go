@@ -37,6 +37,16 @@ func refreshSendingCacheSize() {
 	proc.JudgeQueuesCnt.SetCnt(calcSendCacheSize(JudgeQueues))
 	proc.GraphQueuesCnt.SetCnt(calcSendCacheSize(GraphQueues))
 	proc.InfluxdbQueuesCnt.SetCnt(calcSendCacheSize(InfluxdbQueues))
+
+	judgeItems, judgeBytes, judgeDropped := calcSpillSize(JudgeSpillQueues)
+	proc.JudgeSpillCnt.SetCnt(judgeItems)
+	proc.JudgeSpillBytes.SetCnt(judgeBytes)
+	proc.JudgeSpillDropCnt.SetCnt(judgeDropped)
+
+	graphItems, graphBytes, graphDropped := calcSpillSize(GraphSpillQueues)
+	proc.GraphSpillCnt.SetCnt(graphItems)
+	proc.GraphSpillBytes.SetCnt(graphBytes)
+	proc.GraphSpillDropCnt.SetCnt(graphDropped)
 }
 func calcSendCacheSize(mapList map[string]*list.SafeListLimited) int64 {
 	var cnt int64 = 0
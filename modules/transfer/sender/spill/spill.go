@@ -0,0 +1,484 @@
+// Package spill implements a durable FIFO queue of opaque records,
+// stored as a sequence of append-only segment files under one directory.
+//
+// Layout of a record:
+//
+//	| payload length(4) | item count(4) | crc32 of payload(4) | payload |
+//
+// The read position is persisted into a cursor file after every Commit(),
+// so records which have been replayed successfully are not replayed again after restart.
+package spill
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	headerSize    = 12
+	segmentSuffix = ".seg"
+	cursorFile    = "cursor"
+)
+
+var (
+	ErrFull    = errors.New("spill queue is full")
+	ErrEmpty   = errors.New("spill queue is empty")
+	ErrCorrupt = errors.New("spill record is corrupted")
+	ErrClosed  = errors.New("spill queue is closed")
+)
+
+type segment struct {
+	id    uint64
+	size  int64
+	items int64
+}
+
+// Queue is safe for concurrent use. Records are appended by Append() and
+// consumed by the pair of Peek()/Commit().
+type Queue struct {
+	lock sync.Mutex
+
+	dir         string
+	segmentSize int64
+	maxSize     int64
+
+	// segments[0] is the one being read, the last one is the one being written
+	segments []*segment
+	writer   *os.File
+	lastId   uint64
+
+	readOffset int64
+	peekLen    int64
+	peekCount  int64
+
+	items   int64
+	size    int64
+	dropped int64
+	closed  bool
+}
+
+// Open loads(or creates) a queue in the directory.
+//
+// segmentSize is the size(in bytes) for rotating segment files,
+// maxSize is the disk budget(in bytes) of the whole queue.
+// When the budget is exhausted, the oldest segment is discarded to make room for new records.
+func Open(dir string, segmentSize int64, maxSize int64) (*Queue, error) {
+	if segmentSize <= 0 || maxSize <= 0 {
+		return nil, fmt.Errorf("invalid size of spill queue. segment: %d, max: %d", segmentSize, maxSize)
+	}
+	if segmentSize > maxSize {
+		segmentSize = maxSize
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	q := &Queue{
+		dir:         dir,
+		segmentSize: segmentSize,
+		maxSize:     maxSize,
+	}
+
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+
+	return q, nil
+}
+
+// Append writes one record which holds count items
+func (q *Queue) Append(payload []byte, count int) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.closed {
+		return ErrClosed
+	}
+
+	recordSize := int64(headerSize + len(payload))
+	if recordSize > q.maxSize {
+		return ErrFull
+	}
+
+	/**
+	 * Discards the oldest segments until the new record fits into the budget
+	 */
+	for q.size+recordSize > q.maxSize && len(q.segments) > 1 {
+		if err := q.dropOldestSegment(); err != nil {
+			return err
+		}
+	}
+	if q.size+recordSize > q.maxSize {
+		return ErrFull
+	}
+	// :~)
+
+	last := q.lastSegment()
+	if last == nil || (last.size > 0 && last.size+recordSize > q.segmentSize) {
+		if err := q.rotate(); err != nil {
+			return err
+		}
+		last = q.lastSegment()
+	}
+
+	record := make([]byte, recordSize)
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:8], uint32(count))
+	binary.BigEndian.PutUint32(record[8:12], crc32.ChecksumIEEE(payload))
+	copy(record[headerSize:], payload)
+
+	if _, err := q.writer.Write(record); err != nil {
+		return err
+	}
+
+	last.size += recordSize
+	last.items += int64(count)
+	q.size += recordSize
+	q.items += int64(count)
+
+	return nil
+}
+
+// Peek returns the oldest record without removing it.
+//
+// ErrEmpty is returned if there is nothing to read.
+// ErrCorrupt is returned if the record cannot be verified, the caller should still Commit() it to skip it.
+func (q *Queue) Peek() ([]byte, int, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.closed {
+		return nil, 0, ErrClosed
+	}
+
+	for {
+		if len(q.segments) == 0 {
+			return nil, 0, ErrEmpty
+		}
+
+		first := q.segments[0]
+		if q.readOffset < first.size {
+			break
+		}
+		if len(q.segments) == 1 {
+			return nil, 0, ErrEmpty
+		}
+		if err := q.removeFirstSegment(); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	f, err := os.Open(q.segmentPath(q.segments[0].id))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(q.readOffset, io.SeekStart); err != nil {
+		return nil, 0, err
+	}
+
+	payload, count, err := readRecord(bufio.NewReader(f))
+	if err != nil {
+		/**
+		 * Skips the rest of the segment
+		 */
+		q.peekLen = q.segments[0].size - q.readOffset
+		q.peekCount = 0
+		return nil, 0, ErrCorrupt
+		// :~)
+	}
+
+	q.peekLen = int64(headerSize + len(payload))
+	q.peekCount = int64(count)
+
+	return payload, count, nil
+}
+
+// Commit removes the record returned by the last Peek()
+func (q *Queue) Commit() error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.closed {
+		return ErrClosed
+	}
+	if q.peekLen == 0 || len(q.segments) == 0 {
+		return nil
+	}
+
+	q.readOffset += q.peekLen
+	q.segments[0].items -= q.peekCount
+	q.items -= q.peekCount
+	q.peekLen, q.peekCount = 0, 0
+
+	if q.readOffset >= q.segments[0].size && len(q.segments) > 1 {
+		return q.removeFirstSegment()
+	}
+
+	return q.saveCursor()
+}
+
+// Len returns the number of items which are not committed yet
+func (q *Queue) Len() int64 {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.items
+}
+
+// Size returns the bytes used on disk
+func (q *Queue) Size() int64 {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.size
+}
+
+// Dropped returns the number of items discarded because of the disk budget
+func (q *Queue) Dropped() int64 {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.dropped
+}
+
+func (q *Queue) Dir() string {
+	return q.dir
+}
+
+func (q *Queue) Close() error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.closed {
+		return nil
+	}
+	q.closed = true
+
+	if q.writer != nil {
+		err := q.writer.Close()
+		q.writer = nil
+		return err
+	}
+	return nil
+}
+
+func (q *Queue) load() error {
+	files, err := ioutil.ReadDir(q.dir)
+	if err != nil {
+		return err
+	}
+
+	ids := make([]uint64, 0, len(files))
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, segmentSuffix), 16, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Sort(segmentIds(ids))
+
+	cursorId, cursorOffset := q.loadCursor()
+	q.lastId = cursorId
+
+	for _, id := range ids {
+		/**
+		 * Segments before the cursor have been consumed
+		 */
+		if id < cursorId {
+			if err := os.Remove(q.segmentPath(id)); err != nil {
+				return err
+			}
+			continue
+		}
+		// :~)
+
+		skip := int64(0)
+		if id == cursorId {
+			skip = cursorOffset
+		}
+
+		seg, err := q.scanSegment(id, skip)
+		if err != nil {
+			return err
+		}
+		q.segments = append(q.segments, seg)
+		q.lastId = id
+		q.size += seg.size
+		q.items += seg.items
+	}
+
+	if len(q.segments) > 0 && q.segments[0].id == cursorId {
+		q.readOffset = cursorOffset
+		if q.readOffset > q.segments[0].size {
+			q.readOffset = q.segments[0].size
+		}
+	}
+
+	if last := q.lastSegment(); last != nil {
+		q.writer, err = os.OpenFile(q.segmentPath(last.id), os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// scanSegment verifies every record in the segment and truncates the broken tail(e.g. crash during writing)
+func (q *Queue) scanSegment(id uint64, skip int64) (*segment, error) {
+	path := q.segmentPath(id)
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	seg := &segment{id: id}
+	reader := bufio.NewReader(f)
+	for {
+		payload, count, err := readRecord(reader)
+		if err != nil {
+			break
+		}
+		if seg.size >= skip {
+			seg.items += int64(count)
+		}
+		seg.size += int64(headerSize + len(payload))
+	}
+	f.Close()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() != seg.size {
+		if err := os.Truncate(path, seg.size); err != nil {
+			return nil, err
+		}
+	}
+
+	return seg, nil
+}
+
+func readRecord(reader io.Reader) ([]byte, int, error) {
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, 0, err
+	}
+
+	length := binary.BigEndian.Uint32(header[0:4])
+	count := binary.BigEndian.Uint32(header[4:8])
+	checksum := binary.BigEndian.Uint32(header[8:12])
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return nil, 0, err
+	}
+	if crc32.ChecksumIEEE(payload) != checksum {
+		return nil, 0, ErrCorrupt
+	}
+
+	return payload, int(count), nil
+}
+
+func (q *Queue) rotate() error {
+	id := q.lastId + 1
+
+	f, err := os.OpenFile(q.segmentPath(id), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	if q.writer != nil {
+		q.writer.Close()
+	}
+	q.writer = f
+	q.lastId = id
+	q.segments = append(q.segments, &segment{id: id})
+
+	if len(q.segments) == 1 {
+		q.readOffset = 0
+		return q.saveCursor()
+	}
+	return nil
+}
+
+func (q *Queue) dropOldestSegment() error {
+	q.dropped += q.segments[0].items
+	return q.removeFirstSegment()
+}
+
+func (q *Queue) removeFirstSegment() error {
+	first := q.segments[0]
+	if err := os.Remove(q.segmentPath(first.id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	q.segments = q.segments[1:]
+	q.size -= first.size
+	q.items -= first.items
+	q.readOffset = 0
+	q.peekLen, q.peekCount = 0, 0
+
+	return q.saveCursor()
+}
+
+func (q *Queue) lastSegment() *segment {
+	if len(q.segments) == 0 {
+		return nil
+	}
+	return q.segments[len(q.segments)-1]
+}
+
+func (q *Queue) segmentPath(id uint64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%016x%s", id, segmentSuffix))
+}
+
+func (q *Queue) loadCursor() (uint64, int64) {
+	content, err := ioutil.ReadFile(filepath.Join(q.dir, cursorFile))
+	if err != nil {
+		return 0, 0
+	}
+
+	var id uint64
+	var offset int64
+	if _, err := fmt.Sscanf(string(content), "%x %d", &id, &offset); err != nil {
+		return 0, 0
+	}
+	return id, offset
+}
+
+func (q *Queue) saveCursor() error {
+	var id uint64
+	if len(q.segments) > 0 {
+		id = q.segments[0].id
+	}
+
+	path := filepath.Join(q.dir, cursorFile)
+	tmpPath := path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, []byte(fmt.Sprintf("%x %d\n", id, q.readOffset)), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+type segmentIds []uint64
+
+func (this segmentIds) Len() int           { return len(this) }
+func (this segmentIds) Less(i, j int) bool { return this[i] < this[j] }
+func (this segmentIds) Swap(i, j int)      { this[i], this[j] = this[j], this[i] }
@@ -0,0 +1,167 @@
+package spill
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestAppendAndReplayInOrder(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	q, err := Open(dir, 64, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	for i := 0; i < 10; i++ {
+		if err := q.Append([]byte(fmt.Sprintf("record-%d", i)), 2); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if q.Len() != 20 {
+		t.Fatalf("expected 20 items, got %d", q.Len())
+	}
+
+	for i := 0; i < 10; i++ {
+		payload, count, err := q.Peek()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := fmt.Sprintf("record-%d", i); string(payload) != expected || count != 2 {
+			t.Fatalf("expected %s(2), got %s(%d)", expected, payload, count)
+		}
+		if err := q.Commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, _, err := q.Peek(); err != ErrEmpty {
+		t.Fatalf("expected ErrEmpty, got %v", err)
+	}
+	if q.Len() != 0 {
+		t.Fatalf("expected empty queue, got %d items", q.Len())
+	}
+}
+
+func TestReopenKeepsCursor(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	q, err := Open(dir, 64, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		q.Append([]byte(fmt.Sprintf("record-%d", i)), 1)
+	}
+	for i := 0; i < 2; i++ {
+		q.Peek()
+		q.Commit()
+	}
+	q.Close()
+
+	q, err = Open(dir, 64, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	if q.Len() != 3 {
+		t.Fatalf("expected 3 items after reopen, got %d", q.Len())
+	}
+	payload, _, err := q.Peek()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(payload) != "record-2" {
+		t.Fatalf("expected record-2, got %s", payload)
+	}
+}
+
+func TestBudgetDropsOldestSegment(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	// Every record is 12 bytes of header + 8 bytes of payload
+	q, err := Open(dir, 40, 80)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	for i := 0; i < 6; i++ {
+		if err := q.Append([]byte(fmt.Sprintf("record-%d", i)), 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if q.Size() > 80 {
+		t.Fatalf("size %d exceeds the budget", q.Size())
+	}
+	if q.Dropped() != 2 {
+		t.Fatalf("expected 2 dropped items, got %d", q.Dropped())
+	}
+
+	payload, _, err := q.Peek()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(payload) != "record-2" {
+		t.Fatalf("expected record-2, got %s", payload)
+	}
+}
+
+func TestTruncatedTailIsDiscarded(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	q, err := Open(dir, 1024, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Append([]byte("record-0"), 1)
+	q.Append([]byte("record-1"), 1)
+	q.Close()
+
+	// Simulates a crash in the middle of writing the second record
+	path := q.segmentPath(1)
+	if err := os.Truncate(path, 30); err != nil {
+		t.Fatal(err)
+	}
+
+	q, err = Open(dir, 1024, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	if q.Len() != 1 {
+		t.Fatalf("expected 1 item, got %d", q.Len())
+	}
+	if err := q.Append([]byte("record-2"), 1); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{"record-0", "record-2"} {
+		payload, _, err := q.Peek()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(payload) != expected {
+			t.Fatalf("expected %s, got %s", expected, payload)
+		}
+		q.Commit()
+	}
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "spill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
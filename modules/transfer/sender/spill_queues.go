@@ -0,0 +1,285 @@
+package sender
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/Cepave/open-falcon-backend/modules/transfer/g"
+	"github.com/Cepave/open-falcon-backend/modules/transfer/proc"
+	cpool "github.com/Cepave/open-falcon-backend/modules/transfer/sender/conn_pool"
+	"github.com/Cepave/open-falcon-backend/modules/transfer/sender/spill"
+	cmodel "github.com/open-falcon/common/model"
+	nproc "github.com/toolkits/proc"
+)
+
+const (
+	DefaultSpillDir          = "./spill"
+	DefaultSpillSegmentSize  = 64   // MB
+	DefaultSpillMaxSize      = 1024 // MB
+	DefaultSpillPingInterval = 5    // sec
+)
+
+// 落盘缓存队列, 存放发送失败或者发送缓存溢出的数据
+// node -> spill_queue (the key is the same as JudgeQueues/GraphQueues)
+var (
+	JudgeSpillQueues = make(map[string]*spill.Queue)
+	GraphSpillQueues = make(map[string]*spill.Queue)
+)
+
+// SpillStatus is the snapshot of a spill queue
+type SpillStatus struct {
+	Dir     string `json:"dir"`
+	Items   int64  `json:"items"`
+	Bytes   int64  `json:"bytes"`
+	Dropped int64  `json:"dropped"`
+}
+
+func spillEnabled() bool {
+	cfg := g.Config().Spill
+	return cfg != nil && cfg.Enabled
+}
+
+func initSpillQueues() {
+	if !spillEnabled() {
+		return
+	}
+
+	cfg := g.Config()
+	dir := cfg.Spill.Dir
+	if dir == "" {
+		dir = DefaultSpillDir
+	}
+	segmentSize := cfg.Spill.SegmentSize
+	if segmentSize <= 0 {
+		segmentSize = DefaultSpillSegmentSize
+	}
+	maxSize := cfg.Spill.MaxSize
+	if maxSize <= 0 {
+		maxSize = DefaultSpillMaxSize
+	}
+
+	openQueue := func(path string) *spill.Queue {
+		Q, err := spill.Open(path, segmentSize<<20, maxSize<<20)
+		if err != nil {
+			log.Fatalf("open spill queue %s fail: %v", path, err)
+		}
+		return Q
+	}
+
+	for node, _ := range cfg.Judge.Cluster {
+		JudgeSpillQueues[node] = openQueue(filepath.Join(dir, "judge", node))
+	}
+
+	for node, nitem := range cfg.Graph.AllNodes() {
+		for _, addr := range nitem.Addrs {
+			GraphSpillQueues[node+addr] = openQueue(filepath.Join(dir, "graph", node+"_"+strings.Replace(addr, ":", "_", -1)))
+		}
+	}
+}
+
+func startSpillTasks() {
+	if !spillEnabled() {
+		return
+	}
+
+	cfg := g.Config()
+
+	judgePing := cfg.Judge.PingMethod
+	if judgePing == "" {
+		judgePing = "Judge.Ping"
+	}
+	for node, addr := range cfg.Judge.Cluster {
+		go replaySpillTask(
+			JudgeSpillQueues[node], JudgeConnPools, node, addr,
+			judgePing, "Judge.Send", decodeJudgeItems,
+			proc.ReplayToJudgeCnt, proc.ReplayToJudgeFailCnt,
+		)
+	}
+
+	graphPing := cfg.Graph.PingMethod
+	if graphPing == "" {
+		graphPing = "Graph.Ping"
+	}
+	for node, nitem := range cfg.Graph.AllNodes() {
+		for _, addr := range nitem.Addrs {
+			go replaySpillTask(
+				GraphSpillQueues[node+addr], GraphConnPools, node, addr,
+				graphPing, "Graph.Send", decodeGraphItems,
+				proc.ReplayToGraphCnt, proc.ReplayToGraphFailCnt,
+			)
+		}
+	}
+}
+
+// 将发送失败的Judge数据落盘, 返回false表示落盘失败(数据丢弃)
+func spill2JudgeQueue(node string, items []*cmodel.JudgeItem) bool {
+	Q, ok := JudgeSpillQueues[node]
+	if !ok {
+		return false
+	}
+	if !appendToSpillQueue(Q, items, len(items)) {
+		return false
+	}
+
+	proc.SpillToJudgeCnt.IncrBy(int64(len(items)))
+	return true
+}
+
+// 将发送失败的Graph数据落盘, 返回false表示落盘失败(数据丢弃)
+func spill2GraphQueue(key string, items []*cmodel.GraphItem) bool {
+	Q, ok := GraphSpillQueues[key]
+	if !ok {
+		return false
+	}
+	if !appendToSpillQueue(Q, items, len(items)) {
+		return false
+	}
+
+	proc.SpillToGraphCnt.IncrBy(int64(len(items)))
+	return true
+}
+
+func appendToSpillQueue(Q *spill.Queue, items interface{}, count int) bool {
+	payload, err := json.Marshal(items)
+	if err != nil {
+		log.Errorf("encode items for spill queue %s fail: %v", Q.Dir(), err)
+		return false
+	}
+
+	if err := Q.Append(payload, count); err != nil {
+		log.Errorf("append to spill queue %s fail: %v", Q.Dir(), err)
+		return false
+	}
+
+	return true
+}
+
+// isSpilling is true if there are items waiting for replaying.
+// New batches should be spilled as well in order to keep them behind the replaying ones,
+// because rrd refuses updates which are older than the last one.
+func isSpilling(Q *spill.Queue) bool {
+	return Q != nil && Q.Len() > 0
+}
+
+func decodeJudgeItems(payload []byte) (interface{}, error) {
+	items := []*cmodel.JudgeItem{}
+	err := json.Unmarshal(payload, &items)
+	return items, err
+}
+
+func decodeGraphItems(payload []byte) (interface{}, error) {
+	items := []*cmodel.GraphItem{}
+	err := json.Unmarshal(payload, &items)
+	return items, err
+}
+
+// 待后端节点响应ping之后, 按序重放落盘的数据
+func replaySpillTask(
+	Q *spill.Queue, connPools *cpool.SafeRpcConnPools,
+	node string, addr string,
+	pingMethod string, sendMethod string,
+	decode func([]byte) (interface{}, error),
+	cnt *nproc.SCounterQps, failCnt *nproc.SCounterQps,
+) {
+	interval := g.Config().Spill.PingInterval
+	if interval <= 0 {
+		interval = DefaultSpillPingInterval
+	}
+	sleepTime := time.Duration(interval) * time.Second
+
+	for {
+		if Q.Len() == 0 {
+			time.Sleep(sleepTime)
+			continue
+		}
+
+		err := connPools.Call(addr, pingMethod, cmodel.NullRpcRequest{}, &cmodel.SimpleRpcResponse{})
+		if err != nil {
+			log.Debugf("[Spill] %s:%s is not available: %v", node, addr, err)
+			time.Sleep(sleepTime)
+			continue
+		}
+
+		log.Infof("[Spill] %s:%s is available, replaying %d items", node, addr, Q.Len())
+		if !replaySpillQueue(Q, connPools, addr, sendMethod, decode, cnt) {
+			failCnt.Incr()
+			time.Sleep(sleepTime)
+		}
+	}
+}
+
+// 返回false表示重放中断(后端再次不可用)
+func replaySpillQueue(
+	Q *spill.Queue, connPools *cpool.SafeRpcConnPools,
+	addr string, sendMethod string,
+	decode func([]byte) (interface{}, error),
+	cnt *nproc.SCounterQps,
+) bool {
+	for {
+		payload, count, err := Q.Peek()
+		switch err {
+		case nil:
+		case spill.ErrEmpty:
+			return true
+		case spill.ErrCorrupt:
+			log.Errorf("[Spill] skip corrupted record in %s", Q.Dir())
+			Q.Commit()
+			continue
+		default:
+			log.Errorf("[Spill] read %s fail: %v", Q.Dir(), err)
+			return false
+		}
+
+		items, err := decode(payload)
+		if err != nil {
+			log.Errorf("[Spill] skip undecodable record in %s: %v", Q.Dir(), err)
+			Q.Commit()
+			continue
+		}
+
+		resp := &cmodel.SimpleRpcResponse{}
+		if err := connPools.Call(addr, sendMethod, items, resp); err != nil {
+			log.Printf("[Spill] replay to %s fail: %v", addr, err)
+			return false
+		}
+
+		if err := Q.Commit(); err != nil {
+			log.Errorf("[Spill] commit %s fail: %v", Q.Dir(), err)
+			return false
+		}
+		cnt.IncrBy(int64(count))
+	}
+}
+
+func GetSpillStatus() map[string]map[string]*SpillStatus {
+	return map[string]map[string]*SpillStatus{
+		"judge": spillStatusOf(JudgeSpillQueues),
+		"graph": spillStatusOf(GraphSpillQueues),
+	}
+}
+
+func spillStatusOf(queues map[string]*spill.Queue) map[string]*SpillStatus {
+	ret := make(map[string]*SpillStatus)
+	for key, Q := range queues {
+		ret[key] = &SpillStatus{
+			Dir:     Q.Dir(),
+			Items:   Q.Len(),
+			Bytes:   Q.Size(),
+			Dropped: Q.Dropped(),
+		}
+	}
+	return ret
+}
+
+func calcSpillSize(queues map[string]*spill.Queue) (items int64, bytes int64, dropped int64) {
+	for _, Q := range queues {
+		items += Q.Len()
+		bytes += Q.Size()
+		dropped += Q.Dropped()
+	}
+	return
+}
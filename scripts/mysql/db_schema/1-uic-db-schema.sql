@@ -83,3 +83,32 @@ CREATE TABLE uic.readpath (
   REFERENCES uic.user(id)
   ON UPDATE RESTRICT ON DELETE CASCADE
 ) ENGINE=INNODB;
+
+
+DROP TABLE if exists `oncall_override`;
+DROP TABLE if exists `oncall_schedule`;
+CREATE TABLE `oncall_schedule` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `name` varchar(255) NOT NULL,
+  `members` varchar(1024) NOT NULL DEFAULT '',
+  `rotation_start` datetime NOT NULL,
+  `rotation_days` int(10) unsigned NOT NULL DEFAULT 7,
+  `creator` varchar(64) NOT NULL DEFAULT '',
+  `created` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_oncall_schedule_name` (`name`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE `oncall_override` (
+  `id` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  `schedule_id` int(10) unsigned NOT NULL,
+  `user` varchar(64) NOT NULL,
+  `start_at` datetime NOT NULL,
+  `end_at` datetime NOT NULL,
+  `creator` varchar(64) NOT NULL DEFAULT '',
+  PRIMARY KEY (`id`),
+  KEY `idx_oncall_override_schedule` (`schedule_id`, `end_at`),
+  FOREIGN KEY (`schedule_id`) REFERENCES `oncall_schedule`(`id`)
+    ON DELETE CASCADE
+    ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
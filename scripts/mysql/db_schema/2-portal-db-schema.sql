@@ -164,6 +164,9 @@ CREATE TABLE `action` (
   `before_callback_mail` TINYINT(4)       NOT NULL DEFAULT '0',
   `after_callback_sms`   TINYINT(4)       NOT NULL DEFAULT '0',
   `after_callback_mail`  TINYINT(4)       NOT NULL DEFAULT '0',
+  `escalation_policy_id` INT(10) UNSIGNED NOT NULL DEFAULT '0',
+  `webhook_id`           INT(10) UNSIGNED NOT NULL DEFAULT '0',
+  `channels`             VARCHAR(64)      NOT NULL DEFAULT '',
   PRIMARY KEY (`id`)
 )
   ENGINE =InnoDB
@@ -246,6 +249,12 @@ CREATE TABLE event_cases (
   expression_id int(10) unsigned,
   strategy_id int(10) unsigned,
   template_id int(10) unsigned,
+  silence_id int(10) unsigned NOT NULL DEFAULT 0,
+  inhibited_by VARCHAR(50) NOT NULL DEFAULT '',
+  acknowledged_by VARCHAR(64) NOT NULL DEFAULT '',
+  acknowledged_at Timestamp NULL DEFAULT NULL,
+  assignee VARCHAR(64) NOT NULL DEFAULT '',
+  snoozed_until Timestamp NULL DEFAULT NULL,
   PRIMARY KEY (id),
   INDEX (endpoint, strategy_id, template_id)
 )
@@ -253,6 +262,139 @@ CREATE TABLE event_cases (
   DEFAULT CHARSET =utf8;
 
 
+DROP TABLE IF EXISTS alarm_silence;
+CREATE TABLE alarm_silence (
+  id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  endpoint VARCHAR(255) NOT NULL DEFAULT '',
+  grp_id INT UNSIGNED NOT NULL DEFAULT 0,
+  metric VARCHAR(128) NOT NULL DEFAULT '',
+  tags VARCHAR(256) NOT NULL DEFAULT '',
+  strategy_id INT UNSIGNED NOT NULL DEFAULT 0,
+  tpl_id INT UNSIGNED NOT NULL DEFAULT 0,
+  start_at DATETIME NOT NULL,
+  end_at DATETIME NULL DEFAULT NULL,
+  weekdays VARCHAR(16) NOT NULL DEFAULT '',
+  daily_begin VARCHAR(16) NOT NULL DEFAULT '',
+  daily_end VARCHAR(16) NOT NULL DEFAULT '',
+  creator VARCHAR(64) NOT NULL DEFAULT '',
+  comment VARCHAR(255) NOT NULL DEFAULT '',
+  create_at DATETIME NOT NULL,
+  PRIMARY KEY (id),
+  INDEX (end_at)
+)
+  ENGINE =InnoDB
+  DEFAULT CHARSET =utf8;
+
+
+DROP TABLE IF EXISTS alarm_inhibit_rule;
+CREATE TABLE alarm_inhibit_rule (
+  id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  source_metric VARCHAR(128) NOT NULL DEFAULT '',
+  source_tags VARCHAR(256) NOT NULL DEFAULT '',
+  source_strategy_id INT UNSIGNED NOT NULL DEFAULT 0,
+  target_metric VARCHAR(128) NOT NULL DEFAULT '',
+  target_tags VARCHAR(256) NOT NULL DEFAULT '',
+  target_strategy_id INT UNSIGNED NOT NULL DEFAULT 0,
+  equal VARCHAR(256) NOT NULL DEFAULT '',
+  creator VARCHAR(64) NOT NULL DEFAULT '',
+  comment VARCHAR(255) NOT NULL DEFAULT '',
+  create_at DATETIME NOT NULL,
+  PRIMARY KEY (id)
+)
+  ENGINE =InnoDB
+  DEFAULT CHARSET =utf8;
+
+
+DROP TABLE IF EXISTS alarm_endpoint_dependency;
+CREATE TABLE alarm_endpoint_dependency (
+  id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  parent VARCHAR(255) NOT NULL,
+  child VARCHAR(255) NOT NULL,
+  parent_metric VARCHAR(128) NOT NULL DEFAULT '',
+  creator VARCHAR(64) NOT NULL DEFAULT '',
+  create_at DATETIME NOT NULL,
+  PRIMARY KEY (id),
+  UNIQUE KEY idx_alarm_endpoint_dependency (parent, child, parent_metric),
+  INDEX (child)
+)
+  ENGINE =InnoDB
+  DEFAULT CHARSET =utf8;
+
+
+DROP TABLE IF EXISTS escalation_policy;
+CREATE TABLE escalation_policy (
+  id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  name VARCHAR(255) NOT NULL,
+  creator VARCHAR(64) NOT NULL DEFAULT '',
+  create_at DATETIME NOT NULL,
+  PRIMARY KEY (id),
+  UNIQUE KEY idx_escalation_policy_name (name)
+)
+  ENGINE =InnoDB
+  DEFAULT CHARSET =utf8;
+
+
+DROP TABLE IF EXISTS escalation_step;
+CREATE TABLE escalation_step (
+  id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  policy_id INT UNSIGNED NOT NULL,
+  step INT UNSIGNED NOT NULL,
+  wait_minutes INT UNSIGNED NOT NULL DEFAULT 0,
+  schedule_id INT UNSIGNED NOT NULL DEFAULT 0,
+  schedule_offset INT UNSIGNED NOT NULL DEFAULT 0,
+  users VARCHAR(1024) NOT NULL DEFAULT '',
+  teams VARCHAR(1024) NOT NULL DEFAULT '',
+  PRIMARY KEY (id),
+  UNIQUE KEY idx_escalation_step (policy_id, step),
+  FOREIGN KEY (policy_id) REFERENCES escalation_policy(id)
+    ON DELETE CASCADE
+    ON UPDATE CASCADE
+)
+  ENGINE =InnoDB
+  DEFAULT CHARSET =utf8;
+
+
+DROP TABLE IF EXISTS alarm_webhook;
+CREATE TABLE alarm_webhook (
+  id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  name VARCHAR(255) NOT NULL,
+  url VARCHAR(1024) NOT NULL,
+  method VARCHAR(16) NOT NULL DEFAULT 'POST',
+  content_type VARCHAR(16) NOT NULL DEFAULT 'json',
+  headers TEXT NOT NULL,
+  body_template TEXT NOT NULL,
+  secret VARCHAR(255) NOT NULL DEFAULT '',
+  max_retries INT UNSIGNED NOT NULL DEFAULT 3,
+  timeout INT UNSIGNED NOT NULL DEFAULT 10,
+  creator VARCHAR(64) NOT NULL DEFAULT '',
+  create_at DATETIME NOT NULL,
+  PRIMARY KEY (id),
+  UNIQUE KEY idx_alarm_webhook_name (name)
+)
+  ENGINE =InnoDB
+  DEFAULT CHARSET =utf8;
+
+
+DROP TABLE IF EXISTS alarm_webhook_delivery;
+CREATE TABLE alarm_webhook_delivery (
+  id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  event_caseId VARCHAR(50) NOT NULL,
+  webhook_id INT UNSIGNED NOT NULL,
+  attempt INT UNSIGNED NOT NULL DEFAULT 1,
+  status_code INT NOT NULL DEFAULT 0,
+  request TEXT NOT NULL,
+  response TEXT NOT NULL,
+  error VARCHAR(255) NOT NULL DEFAULT '',
+  duration_ms INT UNSIGNED NOT NULL DEFAULT 0,
+  create_at DATETIME NOT NULL,
+  PRIMARY KEY (id),
+  INDEX (event_caseId),
+  INDEX (webhook_id, create_at)
+)
+  ENGINE =InnoDB
+  DEFAULT CHARSET =utf8;
+
+
 DROP TABLE IF EXISTS event_note;
 CREATE TABLE IF NOT EXISTS event_note (
   id MEDIUMINT NOT NULL AUTO_INCREMENT,
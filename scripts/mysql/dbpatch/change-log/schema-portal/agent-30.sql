@@ -0,0 +1,26 @@
+SET NAMES 'utf8';
+
+CREATE TABLE IF NOT EXISTS alarm_silence (
+  id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  endpoint VARCHAR(255) NOT NULL DEFAULT '',
+  grp_id INT UNSIGNED NOT NULL DEFAULT 0,
+  metric VARCHAR(128) NOT NULL DEFAULT '',
+  tags VARCHAR(256) NOT NULL DEFAULT '',
+  strategy_id INT UNSIGNED NOT NULL DEFAULT 0,
+  tpl_id INT UNSIGNED NOT NULL DEFAULT 0,
+  start_at DATETIME NOT NULL,
+  end_at DATETIME NULL DEFAULT NULL,
+  weekdays VARCHAR(16) NOT NULL DEFAULT '',
+  daily_begin VARCHAR(16) NOT NULL DEFAULT '',
+  daily_end VARCHAR(16) NOT NULL DEFAULT '',
+  creator VARCHAR(64) NOT NULL DEFAULT '',
+  comment VARCHAR(255) NOT NULL DEFAULT '',
+  create_at DATETIME NOT NULL,
+  PRIMARY KEY (id),
+  INDEX (end_at)
+)
+  ENGINE =InnoDB
+  DEFAULT CHARSET =utf8;
+
+ALTER TABLE falcon_portal.event_cases
+  ADD COLUMN silence_id INT UNSIGNED NOT NULL DEFAULT 0;
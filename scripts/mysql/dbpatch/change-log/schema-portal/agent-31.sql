@@ -0,0 +1,35 @@
+SET NAMES 'utf8';
+
+CREATE TABLE IF NOT EXISTS alarm_inhibit_rule (
+  id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  source_metric VARCHAR(128) NOT NULL DEFAULT '',
+  source_tags VARCHAR(256) NOT NULL DEFAULT '',
+  source_strategy_id INT UNSIGNED NOT NULL DEFAULT 0,
+  target_metric VARCHAR(128) NOT NULL DEFAULT '',
+  target_tags VARCHAR(256) NOT NULL DEFAULT '',
+  target_strategy_id INT UNSIGNED NOT NULL DEFAULT 0,
+  equal VARCHAR(256) NOT NULL DEFAULT '',
+  creator VARCHAR(64) NOT NULL DEFAULT '',
+  comment VARCHAR(255) NOT NULL DEFAULT '',
+  create_at DATETIME NOT NULL,
+  PRIMARY KEY (id)
+)
+  ENGINE =InnoDB
+  DEFAULT CHARSET =utf8;
+
+CREATE TABLE IF NOT EXISTS alarm_endpoint_dependency (
+  id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  parent VARCHAR(255) NOT NULL,
+  child VARCHAR(255) NOT NULL,
+  parent_metric VARCHAR(128) NOT NULL DEFAULT '',
+  creator VARCHAR(64) NOT NULL DEFAULT '',
+  create_at DATETIME NOT NULL,
+  PRIMARY KEY (id),
+  UNIQUE KEY idx_alarm_endpoint_dependency (parent, child, parent_metric),
+  INDEX (child)
+)
+  ENGINE =InnoDB
+  DEFAULT CHARSET =utf8;
+
+ALTER TABLE falcon_portal.event_cases
+  ADD COLUMN inhibited_by VARCHAR(50) NOT NULL DEFAULT '';
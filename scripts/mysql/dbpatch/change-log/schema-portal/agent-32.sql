@@ -0,0 +1,33 @@
+SET NAMES 'utf8';
+
+CREATE TABLE IF NOT EXISTS escalation_policy (
+  id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  name VARCHAR(255) NOT NULL,
+  creator VARCHAR(64) NOT NULL DEFAULT '',
+  create_at DATETIME NOT NULL,
+  PRIMARY KEY (id),
+  UNIQUE KEY idx_escalation_policy_name (name)
+)
+  ENGINE =InnoDB
+  DEFAULT CHARSET =utf8;
+
+CREATE TABLE IF NOT EXISTS escalation_step (
+  id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  policy_id INT UNSIGNED NOT NULL,
+  step INT UNSIGNED NOT NULL,
+  wait_minutes INT UNSIGNED NOT NULL DEFAULT 0,
+  schedule_id INT UNSIGNED NOT NULL DEFAULT 0,
+  schedule_offset INT UNSIGNED NOT NULL DEFAULT 0,
+  users VARCHAR(1024) NOT NULL DEFAULT '',
+  teams VARCHAR(1024) NOT NULL DEFAULT '',
+  PRIMARY KEY (id),
+  UNIQUE KEY idx_escalation_step (policy_id, step),
+  FOREIGN KEY (policy_id) REFERENCES escalation_policy(id)
+    ON DELETE CASCADE
+    ON UPDATE CASCADE
+)
+  ENGINE =InnoDB
+  DEFAULT CHARSET =utf8;
+
+ALTER TABLE falcon_portal.action
+  ADD COLUMN escalation_policy_id INT UNSIGNED NOT NULL DEFAULT 0;
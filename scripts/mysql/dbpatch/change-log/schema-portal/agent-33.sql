@@ -0,0 +1,7 @@
+SET NAMES 'utf8';
+
+ALTER TABLE falcon_portal.event_cases
+  ADD COLUMN acknowledged_by VARCHAR(64) NOT NULL DEFAULT '',
+  ADD COLUMN acknowledged_at Timestamp NULL DEFAULT NULL,
+  ADD COLUMN assignee VARCHAR(64) NOT NULL DEFAULT '',
+  ADD COLUMN snoozed_until Timestamp NULL DEFAULT NULL;
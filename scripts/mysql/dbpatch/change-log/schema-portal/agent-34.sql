@@ -0,0 +1,42 @@
+SET NAMES 'utf8';
+
+CREATE TABLE IF NOT EXISTS alarm_webhook (
+  id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  name VARCHAR(255) NOT NULL,
+  url VARCHAR(1024) NOT NULL,
+  method VARCHAR(16) NOT NULL DEFAULT 'POST',
+  content_type VARCHAR(16) NOT NULL DEFAULT 'json',
+  headers TEXT NOT NULL,
+  body_template TEXT NOT NULL,
+  secret VARCHAR(255) NOT NULL DEFAULT '',
+  max_retries INT UNSIGNED NOT NULL DEFAULT 3,
+  timeout INT UNSIGNED NOT NULL DEFAULT 10,
+  creator VARCHAR(64) NOT NULL DEFAULT '',
+  create_at DATETIME NOT NULL,
+  PRIMARY KEY (id),
+  UNIQUE KEY idx_alarm_webhook_name (name)
+)
+  ENGINE =InnoDB
+  DEFAULT CHARSET =utf8;
+
+CREATE TABLE IF NOT EXISTS alarm_webhook_delivery (
+  id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  event_caseId VARCHAR(50) NOT NULL,
+  webhook_id INT UNSIGNED NOT NULL,
+  attempt INT UNSIGNED NOT NULL DEFAULT 1,
+  status_code INT NOT NULL DEFAULT 0,
+  request TEXT NOT NULL,
+  response TEXT NOT NULL,
+  error VARCHAR(255) NOT NULL DEFAULT '',
+  duration_ms INT UNSIGNED NOT NULL DEFAULT 0,
+  create_at DATETIME NOT NULL,
+  PRIMARY KEY (id),
+  INDEX (event_caseId),
+  INDEX (webhook_id, create_at)
+)
+  ENGINE =InnoDB
+  DEFAULT CHARSET =utf8;
+
+ALTER TABLE falcon_portal.action
+  ADD COLUMN webhook_id INT UNSIGNED NOT NULL DEFAULT 0,
+  ADD COLUMN channels VARCHAR(64) NOT NULL DEFAULT '';